@@ -0,0 +1,69 @@
+// Command mock-idp serves an OpenID Connect provider that signs everyone in
+// as one configured user, for trying single sign-on locally. Point a
+// client's SSO configuration at it, and have a platform admin approve the
+// email's domain, which cannot be verified through DNS:
+//
+//	go run ./cmd/mock-idp -email jane@example.com -groups admins
+//	PUT /api/v1/admin/clients/{id}/sso with the configuration it prints
+//	POST /api/v1/admin/clients/{id}/sso/domains/example.com/approve
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"video-conference-backend/internal/oidc/mockidp"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9000", "address to listen on")
+	issuer := flag.String("issuer", "http://127.0.0.1:9000", "issuer URL, where the provider is reachable")
+	clientID := flag.String("client-id", "video-conference", "OAuth client ID")
+	clientSecret := flag.String("client-secret", "mock-secret", "OAuth client secret, empty for a public client")
+	email := flag.String("email", "jane@example.com", "email of the signed-in user")
+	name := flag.String("name", "Jane Doe", "name of the signed-in user")
+	groups := flag.String("groups", "", "comma separated groups of the signed-in user")
+	flag.Parse()
+
+	log.SetPrefix("[mock-idp] ")
+
+	idp, err := mockidp.New(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatalf("Failed to create provider: %v", err)
+	}
+
+	user := map[string]interface{}{
+		"sub":            "mock|" + *email,
+		"email":          *email,
+		"email_verified": true,
+		"name":           *name,
+	}
+	if *groups != "" {
+		user["groups"] = strings.Split(*groups, ",")
+	}
+	idp.SetUser(user)
+
+	_, domain, _ := strings.Cut(*email, "@")
+	config := map[string]interface{}{
+		"issuer":             *issuer,
+		"oidc_client_id":     *clientID,
+		"oidc_client_secret": *clientSecret,
+		"allowed_domains":    []string{domain},
+		"role_claim":         "groups",
+		"role_mapping":       map[string]string{"admins": "admin"},
+	}
+	log.Printf("SSO configuration for PUT /api/v1/admin/clients/{id}/sso:")
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(config)
+	log.Printf("Then approve the domain as a platform admin: POST /api/v1/admin/clients/{id}/sso/domains/%s/approve", domain)
+
+	log.Printf("Signing everyone in as %s at %s", *email, *issuer)
+	if err := http.ListenAndServe(*addr, idp); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+// Command oidc-loopback runs the OpenID Connect relying party against an
+// in-process mock provider over the loopback network. It checks the
+// authorization code flow with PKCE end to end, and that codes, verifiers,
+// nonces and ID tokens the relying party must not accept are refused. It
+// exits non-zero on the first failure.
+//
+//	go run ./cmd/oidc-loopback
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"video-conference-backend/internal/oidc"
+	"video-conference-backend/internal/oidc/mockidp"
+)
+
+const (
+	clientID     = "video-conference"
+	clientSecret = "loopback-secret"
+	redirectURI  = "http://127.0.0.1:3000/sso/callback"
+)
+
+func init() {
+	log.SetFlags(log.Lmicroseconds)
+	log.SetPrefix("[oidc-loopback] ")
+}
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var idp *mockidp.Server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	idp, err := mockidp.New(server.URL, clientID, clientSecret)
+	if err != nil {
+		log.Fatalf("Failed to create provider: %v", err)
+	}
+	idp.SetUser(map[string]interface{}{
+		"sub":            "loopback-user",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"given_name":     "Jane",
+		"family_name":    "Doe",
+		"groups":         []string{"staff", "admins"},
+	})
+
+	provider, err := oidc.Discover(ctx, server.Client(), server.URL)
+	if err != nil {
+		log.Fatalf("Discovery failed: %v", err)
+	}
+	log.Printf("Discovered %s", provider.Issuer)
+
+	// Happy path
+	flow := authorize(provider)
+	token, err := provider.Exchange(ctx, clientID, clientSecret, flow.code, redirectURI, flow.verifier)
+	if err != nil {
+		log.Fatalf("Exchange failed: %v", err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, clientID, flow.nonce)
+	if err != nil {
+		log.Fatalf("ID token rejected: %v", err)
+	}
+	if claims.String("sub") != "loopback-user" || claims.String("email") != "jane@example.com" {
+		log.Fatalf("Unexpected claims: %v", claims)
+	}
+	if verified, ok := claims.Bool("email_verified"); !ok || !verified {
+		log.Fatalf("email_verified not carried: %v", claims)
+	}
+	if !slices.Contains(claims.Strings("groups"), "admins") {
+		log.Fatalf("groups not carried: %v", claims)
+	}
+	log.Printf("Signed in as %s", claims.String("email"))
+
+	// A code is redeemed once
+	if _, err := provider.Exchange(ctx, clientID, clientSecret, flow.code, redirectURI, flow.verifier); err == nil {
+		log.Fatalf("Code was redeemed twice")
+	}
+	log.Printf("Reused code refused")
+
+	// Codes are bound to the verifier, the client and the redirect URI
+	flow = authorize(provider)
+	if _, err := provider.Exchange(ctx, clientID, clientSecret, flow.code, redirectURI, "wrong-verifier"); err == nil {
+		log.Fatalf("Code was redeemed with the wrong verifier")
+	}
+	flow = authorize(provider)
+	if _, err := provider.Exchange(ctx, clientID, "wrong-secret", flow.code, redirectURI, flow.verifier); err == nil {
+		log.Fatalf("Code was redeemed with the wrong secret")
+	}
+	flow = authorize(provider)
+	if _, err := provider.Exchange(ctx, clientID, clientSecret, flow.code, redirectURI+"/other", flow.verifier); err == nil {
+		log.Fatalf("Code was redeemed for another redirect URI")
+	}
+	log.Printf("Wrong verifier, secret and redirect URI refused")
+
+	// The nonce ties the ID token to the sign-in that requested it
+	flow = authorize(provider)
+	token, err = provider.Exchange(ctx, clientID, clientSecret, flow.code, redirectURI, flow.verifier)
+	if err != nil {
+		log.Fatalf("Exchange failed: %v", err)
+	}
+	expectRejected(ctx, provider, token.IDToken, "a token for another sign-in", "other-nonce")
+
+	// ID tokens the provider's key signed, but not for this sign-in
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": server.URL, "aud": clientID, "sub": "loopback-user", "nonce": "n",
+			"iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		}
+	}
+	forged := map[string]jwt.MapClaims{
+		"another audience":           withClaim(valid(), "aud", "other-client"),
+		"another issuer":             withClaim(valid(), "iss", "https://evil.example.com"),
+		"an expired token":           withClaim(valid(), "exp", now.Add(-time.Hour).Unix()),
+		"a token without expiry":     withClaim(valid(), "exp", nil),
+		"a token for another holder": withClaim(withClaim(valid(), "aud", []string{clientID, "other-client"}), "azp", "other-client"),
+		"a token without subject":    withClaim(valid(), "sub", nil),
+	}
+	for name, claims := range forged {
+		raw, err := idp.Sign(claims)
+		if err != nil {
+			log.Fatalf("Failed to sign %s: %v", name, err)
+		}
+		expectRejected(ctx, provider, raw, name, "n")
+	}
+
+	// Tokens not signed by the provider
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte(clientSecret))
+	expectRejected(ctx, provider, hmacToken, "an HMAC token keyed with the client secret", "n")
+	noneToken, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	expectRejected(ctx, provider, noneToken, "an unsigned token", "n")
+
+	// Providers are only trusted for the issuer they were discovered from,
+	// and over HTTPS outside the loopback interface
+	if _, err := oidc.Discover(ctx, server.Client(), server.URL+"/"); err == nil {
+		log.Fatalf("Discovery accepted a mismatched issuer")
+	}
+	if _, err := oidc.Discover(ctx, server.Client(), "http://idp.example.com"); err == nil {
+		log.Fatalf("Discovery accepted a plain HTTP issuer")
+	}
+	log.Printf("Mismatched and insecure issuers refused")
+
+	log.Printf("PASS")
+}
+
+// flow is a started sign-in, redirected back with its code
+type flow struct {
+	code     string
+	verifier string
+	nonce    string
+}
+
+// authorize starts a sign-in and follows it to the redirect back, the way
+// the browser and the frontend would
+func authorize(provider *oidc.Provider) flow {
+	state, _ := oidc.RandomString()
+	nonce, _ := oidc.RandomString()
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		log.Fatalf("Failed to create PKCE verifier: %v", err)
+	}
+
+	authURL := provider.AuthCodeURL(oidc.AuthRequest{
+		ClientID:      clientID,
+		RedirectURI:   redirectURI,
+		Scopes:        []string{"openid", "email", "profile"},
+		State:         state,
+		Nonce:         nonce,
+		CodeChallenge: challenge,
+	})
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		log.Fatalf("Authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		log.Fatalf("Authorization returned status %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		log.Fatalf("Invalid redirect: %v", err)
+	}
+	if location.Query().Get("state") != state {
+		log.Fatalf("Redirect carried state %q, want %q", location.Query().Get("state"), state)
+	}
+	return flow{code: location.Query().Get("code"), verifier: verifier, nonce: nonce}
+}
+
+func expectRejected(ctx context.Context, provider *oidc.Provider, raw, name, nonce string) {
+	_, err := provider.VerifyIDToken(ctx, raw, clientID, nonce)
+	if !errors.Is(err, oidc.ErrInvalidIDToken) {
+		log.Fatalf("Accepted %s: %v", name, err)
+	}
+	log.Printf("Refused %s", name)
+}
+
+func withClaim(claims jwt.MapClaims, name string, value interface{}) jwt.MapClaims {
+	if value == nil {
+		delete(claims, name)
+	} else {
+		claims[name] = value
+	}
+	return claims
+}
@@ -0,0 +1,324 @@
+// Command sfu-loopback runs an SFU router against two in-process clients
+// over the loopback network and checks that it forwards media, switches a
+// subscriber between simulcast layers and renegotiates tracks away when
+// their publisher leaves. It exits non-zero on the first failure.
+//
+//	go run ./cmd/sfu-loopback
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+	"video-conference-backend/internal/sfu"
+	"video-conference-backend/internal/signaling"
+	"video-conference-backend/internal/webrtctest"
+)
+
+const (
+	routerID    = "sfu_loopback"
+	stepTimeout = 10 * time.Second
+)
+
+// layers are the simulcast layers the publisher sends, worst first
+var layers = []string{"q", "h", "f"}
+
+func init() {
+	log.SetFlags(log.Lmicroseconds)
+	log.SetPrefix("[sfu-loopback] ")
+}
+
+func main() {
+	api, err := sfu.NewAPI(0, 0, nil)
+	if err != nil {
+		log.Fatalf("Failed to create SFU API: %v", err)
+	}
+	router := sfu.NewRouter(api, webrtc.Configuration{}, 0, nil)
+	defer router.Close()
+
+	clients := make(map[string]*client)
+	var clientsMutex sync.Mutex
+
+	// The router's messages are delivered to their target in order, the way
+	// the hub queues them for a socket
+	routerInbox := webrtctest.Inbox(router.HandleMessage)
+	router.Start(webrtctest.SignalerFunc(func(msg signaling.Message) {
+		var payload signaling.SignalPayload
+		if err := msg.DecodePayload(&payload); err != nil {
+			log.Fatalf("Router sent an invalid %s: %v", msg.Type, err)
+		}
+		clientsMutex.Lock()
+		c, ok := clients[payload.TargetID]
+		clientsMutex.Unlock()
+		if !ok {
+			return
+		}
+		relayed, _ := signaling.NewMessage(msg.Type, signaling.RelayedSignalPayload{
+			SenderID:  routerID,
+			SDP:       payload.SDP,
+			Candidate: payload.Candidate,
+		})
+		c.Deliver(relayed)
+	}))
+
+	alice := newClient("alice", routerInbox)
+	bob := newClient("bob", routerInbox)
+	clientsMutex.Lock()
+	clients[alice.ID], clients[bob.ID] = alice, bob
+	clientsMutex.Unlock()
+
+	// Alice publishes simulcast video and audio, Bob audio only
+	publisher := alice.publishVideo()
+	alice.publishAudio()
+	bob.publishAudio()
+
+	alice.connect()
+	bob.connect()
+
+	step("Bob receives Alice's audio", func() bool { return bob.Packets("alice:audio") > 0 })
+	step("Alice receives Bob's audio", func() bool { return alice.Packets("bob:audio") > 0 })
+	step("Bob receives Alice's best layer", func() bool { return bob.layer("alice:video") == "f" })
+
+	before := bob.lastSeq("alice:video")
+	selectLayer, _ := signaling.NewMessage(signaling.TypeSelectLayer, signaling.RelayedLayerPayload{
+		SenderID: bob.ID,
+		TrackID:  "alice:video",
+		Layer:    "q",
+	})
+	routerInbox <- selectLayer
+	step("Bob switches to Alice's lowest layer", func() bool { return bob.layer("alice:video") == "q" })
+	if gaps := bob.gaps("alice:video"); gaps > 0 {
+		log.Fatalf("FAIL: %d sequence gaps in Alice's video after packet %d", gaps, before)
+	}
+
+	offers := bob.Offers()
+	left, _ := signaling.NewMessage(signaling.TypeUserLeft, signaling.UserLeftPayload{UserID: alice.ID})
+	routerInbox <- left
+	publisher.stop()
+	alice.Close()
+	step("Bob is renegotiated without Alice's tracks", func() bool {
+		return bob.Offers() > offers && !bob.Receiving("alice:")
+	})
+
+	bob.Close()
+	log.Printf("PASS")
+}
+
+// step waits for a condition, failing the run if it does not hold in time
+func step(name string, done func() bool) {
+	if !webrtctest.Until(stepTimeout, done) {
+		log.Fatalf("FAIL: %s", name)
+	}
+	log.Printf("ok: %s", name)
+}
+
+// client is a participant connected to the router. Besides counting
+// packets it notes the simulcast layer each video frame carries and any
+// gaps in the sequence numbers of the tracks it receives.
+type client struct {
+	*webrtctest.Peer
+
+	mutex  sync.Mutex
+	tracks map[string]*receivedTrack
+}
+
+// receivedTrack is what a client has seen of a forwarded track
+type receivedTrack struct {
+	layer   string
+	lastSeq uint16
+	gaps    int
+}
+
+func newClient(id string, router chan signaling.Message) *client {
+	peer, err := webrtctest.NewPeer(id, func(msg signaling.Message) { router <- msg }, log.Fatalf)
+	if err != nil {
+		log.Fatalf("Failed to create client %s: %v", id, err)
+	}
+	c := &client{Peer: peer, tracks: make(map[string]*receivedTrack)}
+	c.OnPacket = c.receive
+	return c
+}
+
+// connect makes the client's one offer to the router
+func (c *client) connect() {
+	if err := c.Connect(); err != nil {
+		log.Fatalf("%s: %v", c.ID, err)
+	}
+}
+
+func (c *client) receive(track *webrtc.TrackRemote, packet *rtp.Packet) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t, ok := c.tracks[track.ID()]
+	if !ok {
+		log.Printf("%s receiving %s track %s", c.ID, track.Kind(), track.ID())
+		t = &receivedTrack{}
+		c.tracks[track.ID()] = t
+	} else if packet.SequenceNumber != t.lastSeq+1 {
+		t.gaps++
+	}
+	t.lastSeq = packet.SequenceNumber
+	if track.Kind() == webrtc.RTPCodecTypeVideo && len(packet.Payload) > 2 {
+		t.layer = string(packet.Payload[2])
+	}
+}
+
+func (c *client) track(id string) receivedTrack {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if t, ok := c.tracks[id]; ok {
+		return *t
+	}
+	return receivedTrack{}
+}
+
+func (c *client) layer(id string) string   { return c.track(id).layer }
+func (c *client) lastSeq(id string) uint16 { return c.track(id).lastSeq }
+func (c *client) gaps(id string) int       { return c.track(id).gaps }
+
+// publishAudio sends a stream of silent Opus frames
+func (c *client) publishAudio() {
+	if err := c.Publish(webrtc.RTPCodecTypeAudio, "audio", c.ID); err != nil {
+		log.Fatalf("%s: %v", c.ID, err)
+	}
+}
+
+// videoPublisher sends three simulcast layers of a fake VP8 track. Each
+// frame is a single packet whose third byte names its layer.
+type videoPublisher struct {
+	sender   *webrtc.RTPSender
+	tracks   []*webrtc.TrackLocalStaticRTP
+	keyframe [3]atomic.Bool
+	done     chan struct{}
+}
+
+func (c *client) publishVideo() *videoPublisher {
+	p := &videoPublisher{done: make(chan struct{})}
+	for _, rid := range layers {
+		track, err := webrtc.NewTrackLocalStaticRTP(
+			webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", c.ID, webrtc.WithRTPStreamID(rid),
+		)
+		if err != nil {
+			log.Fatalf("Failed to create video layer %s: %v", rid, err)
+		}
+		p.tracks = append(p.tracks, track)
+	}
+
+	sender, err := c.PC.AddTrack(p.tracks[0])
+	if err != nil {
+		log.Fatalf("Failed to add video track: %v", err)
+	}
+	for _, track := range p.tracks[1:] {
+		if err := sender.AddEncoding(track); err != nil {
+			log.Fatalf("Failed to add video layer %s: %v", track.RID(), err)
+		}
+	}
+	p.sender = sender
+
+	go p.readRTCP()
+	go p.send(c)
+	return p
+}
+
+// readRTCP marks the layers the router asks keyframes for
+func (p *videoPublisher) readRTCP() {
+	for {
+		packets, _, err := p.sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, packet := range packets {
+			pli, ok := packet.(*rtcp.PictureLossIndication)
+			if !ok {
+				continue
+			}
+			for i, encoding := range p.sender.GetParameters().Encodings {
+				if uint32(encoding.SSRC) == pli.MediaSSRC {
+					p.keyframe[i].Store(true)
+				}
+			}
+		}
+	}
+}
+
+// send writes a frame of every layer at 30 fps, with a keyframe every
+// second and whenever one is asked for
+func (p *videoPublisher) send(c *client) {
+	ticker := time.NewTicker(33 * time.Millisecond)
+	defer ticker.Stop()
+
+	for frame := 0; ; frame++ {
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+
+		mid, midID, ridID := p.extensions(c)
+		if mid == "" {
+			continue
+		}
+
+		for i, track := range p.tracks {
+			keyframe := frame%30 == 0 || p.keyframe[i].Swap(false)
+			tag := byte(0x01)
+			if keyframe {
+				tag = 0x00
+			}
+			packet := &rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					Marker:         true,
+					SequenceNumber: uint16(frame),
+					Timestamp:      uint32(frame) * 3000,
+				},
+				Payload: []byte{0x10, tag, track.RID()[0], 0x9d, 0x01, 0x2a},
+			}
+			if err := packet.Header.SetExtension(midID, []byte(mid)); err != nil {
+				log.Fatalf("Failed to set MID: %v", err)
+			}
+			if err := packet.Header.SetExtension(ridID, []byte(track.RID())); err != nil {
+				log.Fatalf("Failed to set RID: %v", err)
+			}
+			if err := track.WriteRTP(packet); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// extensions returns the video transceiver's MID and the negotiated IDs of
+// the header extensions that let the router tell the layers apart
+func (p *videoPublisher) extensions(c *client) (string, uint8, uint8) {
+	var mid string
+	for _, transceiver := range c.PC.GetTransceivers() {
+		if transceiver.Sender() == p.sender {
+			mid = transceiver.Mid()
+		}
+	}
+
+	var midID, ridID uint8
+	for _, extension := range p.sender.GetParameters().HeaderExtensions {
+		switch extension.URI {
+		case sdp.SDESMidURI:
+			midID = uint8(extension.ID)
+		case sdp.SDESRTPStreamIDURI:
+			ridID = uint8(extension.ID)
+		}
+	}
+	if midID == 0 || ridID == 0 {
+		return "", 0, 0
+	}
+	return mid, midID, ridID
+}
+
+func (p *videoPublisher) stop() {
+	close(p.done)
+}
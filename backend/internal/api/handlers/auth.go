@@ -2,24 +2,40 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/url"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/gorilla/mux"
 	"video-conference-backend/internal/models"
 	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/signaling"
 	"video-conference-backend/internal/utils"
 )
 
 // AuthHandler handles authentication endpoints
 type AuthHandler struct {
-	authService services.AuthService
-	userService services.UserService
+	authService  services.AuthService
+	userService  services.UserService
+	emailService *services.EmailService
+	frontendURL  string // password reset links point here
+	signaling    *signaling.Hub
 }
 
-// NewAuthHandler creates a new auth handler
-func NewAuthHandler(authService services.AuthService, userService services.UserService) *AuthHandler {
+// NewAuthHandler creates a new auth handler. Revoking all of a user's
+// sessions also closes their connections to hub.
+func NewAuthHandler(authService services.AuthService, userService services.UserService, emailService *services.EmailService, frontendURL string, hub *signaling.Hub) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
-		userService: userService,
+		authService:  authService,
+		userService:  userService,
+		emailService: emailService,
+		frontendURL:  frontendURL,
+		signaling:    hub,
 	}
 }
 
@@ -44,7 +60,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authenticate user
-	authResponse, err := h.authService.Login(r.Context(), req.Email, req.Password)
+	authResponse, err := h.authService.Login(r.Context(), req.Email, req.Password, sessionClient(r))
 	if err != nil {
 		utils.WriteError(w, http.StatusUnauthorized, "Invalid credentials")
 		return
@@ -53,6 +69,76 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	utils.WriteSuccess(w, authResponse)
 }
 
+// VerifyMFA completes a login with a TOTP or recovery code
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.MFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.MFAToken == "" || req.Code == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MFA token and code are required")
+		return
+	}
+
+	authResponse, err := h.authService.LoginWithMFA(r.Context(), req.MFAToken, req.Code, sessionClient(r))
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, authResponse)
+}
+
+// SetupMFAEnrollment starts enrolling a second factor at login, for users
+// whose client requires one
+func (h *AuthHandler) SetupMFAEnrollment(w http.ResponseWriter, r *http.Request) {
+	var req models.MFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.MFAToken == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MFA token is required")
+		return
+	}
+
+	setup, err := h.authService.BeginMFAEnrollment(r.Context(), req.MFAToken)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteSuccess(w, setup)
+}
+
+// ConfirmMFAEnrollment confirms the second factor enrolled at login and
+// completes the login, returning recovery codes with the tokens
+func (h *AuthHandler) ConfirmMFAEnrollment(w http.ResponseWriter, r *http.Request) {
+	var req models.MFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.MFAToken == "" || req.Code == "" {
+		utils.WriteError(w, http.StatusBadRequest, "MFA token and code are required")
+		return
+	}
+
+	authResponse, err := h.authService.CompleteMFAEnrollment(r.Context(), req.MFAToken, req.Code, sessionClient(r))
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteSuccess(w, authResponse)
+}
+
 // Register handles user registration
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// Handle OPTIONS request for CORS
@@ -117,7 +203,7 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Refresh token
-	authResponse, err := h.authService.RefreshToken(r.Context(), req.RefreshToken)
+	authResponse, err := h.authService.RefreshToken(r.Context(), req.RefreshToken, sessionClient(r))
 	if err != nil {
 		utils.WriteError(w, http.StatusUnauthorized, "Invalid refresh token")
 		return
@@ -126,10 +212,11 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	utils.WriteSuccess(w, authResponse)
 }
 
-// Logout handles user logout
+// Logout ends the caller's session and revokes their access token. The
+// refresh token in the body is optional.
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	var req models.RefreshTokenRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
 		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
@@ -141,7 +228,7 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Logout user
-	err := h.authService.Logout(r.Context(), userID, req.RefreshToken)
+	err := h.authService.Logout(r.Context(), userID, req.RefreshToken, utils.GetTokenIDFromContext(r))
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Logout failed")
 		return
@@ -150,30 +237,103 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	utils.WriteSuccess(w, map[string]string{"message": "Logged out successfully"})
 }
 
-// ResetPassword handles password reset request
+// ResetPassword emails a password reset link. The response is the same
+// whether or not the email has an account.
 func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Email string `json:"email"`
-	}
+	var req models.PasswordResetRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	if req.Email == "" {
+	if req.Email == "" || len(req.Email) > 255 {
 		utils.WriteError(w, http.StatusBadRequest, "Email is required")
 		return
 	}
 
 	// Initiate password reset
-	err := h.authService.ResetPassword(r.Context(), req.Email)
+	user, token, err := h.authService.ResetPassword(r.Context(), req.Email, utils.RemoteIP(r))
+	if errors.Is(err, services.ErrPasswordResetThrottled) {
+		utils.WriteError(w, http.StatusTooManyRequests, "Too many password reset requests, please try again later")
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to request password reset")
+		return
+	}
+
+	// Sent in the background so the response time does not tell either
+	if user != nil {
+		resetLink := h.frontendURL + "/reset-password?token=" + url.QueryEscape(token)
+		go func() {
+			if err := h.emailService.SendPasswordResetEmail(user.Email, resetLink); err != nil {
+				log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+			}
+		}()
+	}
+
+	utils.WriteSuccess(w, map[string]string{"message": "If the email exists, a reset link has been sent"})
+}
+
+// VerifyResetToken checks a password reset link before the new password is
+// asked for
+func (h *AuthHandler) VerifyResetToken(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	user, err := h.authService.VerifyPasswordResetToken(r.Context(), token)
+	if errors.Is(err, services.ErrInvalidResetToken) {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid or expired reset link")
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to verify reset link")
+		return
+	}
+
+	utils.WriteSuccess(w, map[string]interface{}{"valid": true, "email": user.Email})
+}
+
+// CompleteResetPassword sets a new password through a reset link and signs
+// the user out everywhere
+func (h *AuthHandler) CompleteResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.CompletePasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Token == "" || req.NewPassword == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Token and new password are required")
+		return
+	}
+	if len(req.NewPassword) < 8 {
+		utils.WriteError(w, http.StatusBadRequest, "Password must be at least 8 characters")
+		return
+	}
+
+	user, err := h.authService.CompletePasswordReset(r.Context(), req.Token, req.NewPassword)
+	if errors.Is(err, services.ErrInvalidResetToken) {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid or expired reset link")
+		return
+	}
 	if err != nil {
-		// Don't reveal if email exists or not for security
-		utils.WriteSuccess(w, map[string]string{"message": "If the email exists, a reset link has been sent"})
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to reset password")
 		return
 	}
 
-	utils.WriteSuccess(w, map[string]string{"message": "Password reset email sent"})
+	h.disconnect(user.ID)
+
+	go func() {
+		if err := h.emailService.SendPasswordChangedEmail(user.Email, user.GetFullName()); err != nil {
+			log.Printf("Failed to send password changed email to user %d: %v", user.ID, err)
+		}
+	}()
+
+	utils.WriteSuccess(w, map[string]string{"message": "Password reset successfully"})
 }
 
 // ValidateToken handles token validation (for debugging)
@@ -191,4 +351,120 @@ func (h *AuthHandler) ValidateToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	utils.WriteSuccess(w, tokenInfo)
+}
+
+// ListSessions returns the caller's active sessions
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := utils.GetUserIDFromContext(r)
+	if userID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User ID not found")
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(r.Context(), userID, utils.GetTokenIDFromContext(r))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to list sessions")
+		return
+	}
+
+	utils.WriteSuccess(w, sessions)
+}
+
+// RevokeSession signs one of the caller's sessions out
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := utils.GetUserIDFromContext(r)
+	if userID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User ID not found")
+		return
+	}
+
+	sessionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	if err := h.authService.RevokeSession(r.Context(), userID, sessionID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	utils.WriteSuccess(w, map[string]string{"message": "Session revoked successfully"})
+}
+
+// RevokeAllSessions signs the caller out everywhere, this session included
+func (h *AuthHandler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID := utils.GetUserIDFromContext(r)
+	if userID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User ID not found")
+		return
+	}
+
+	revoked, err := h.authService.RevokeAllSessions(r.Context(), userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+	h.disconnect(userID)
+
+	utils.WriteSuccess(w, map[string]int{"revoked": revoked})
+}
+
+// ForceLogout signs a user out of every session, for admins offboarding
+// them. Admins are limited to users of their own client.
+func (h *AuthHandler) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := h.userService.GetUserByID(r.Context(), userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if utils.GetUserRoleFromContext(r) != "super_admin" && user.ClientID != utils.GetClientIDFromContext(r) {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	revoked, err := h.authService.RevokeAllSessions(r.Context(), user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+	h.disconnect(user.ID)
+
+	utils.WriteSuccess(w, map[string]int{"revoked": revoked})
+}
+
+// disconnect closes a user's signaling connections once all their sessions
+// are revoked
+func (h *AuthHandler) disconnect(userID int) {
+	if h.signaling != nil {
+		h.signaling.DisconnectUser(userID)
+	}
+}
+
+// sessionClient describes the device a request comes from. The address is
+// informational, so proxy headers are taken as given; throttling keys on
+// utils.RemoteIP instead.
+func sessionClient(r *http.Request) *models.SessionClient {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	forwarded := r.Header.Get("X-Real-IP")
+	if header := r.Header.Get("X-Forwarded-For"); header != "" {
+		forwarded = strings.TrimSpace(strings.Split(header, ",")[0])
+	}
+	if net.ParseIP(forwarded) != nil {
+		ip = forwarded
+	}
+
+	return &models.SessionClient{
+		UserAgent: r.UserAgent(),
+		IPAddress: ip,
+	}
 }
\ No newline at end of file
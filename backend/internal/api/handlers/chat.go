@@ -2,33 +2,65 @@ package handlers
 
 import (
 	"video-conference-backend/internal/utils"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"mime"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"video-conference-backend/internal/models"
 	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/signaling"
+	"video-conference-backend/internal/storage"
+	"video-conference-backend/internal/thumbnail"
+)
+
+const (
+	// attachmentMemory is how much of an upload is held in memory before
+	// the rest is spooled to a temporary file
+	attachmentMemory = 8 << 20
+	// attachmentFormOverhead allows for the multipart form around the file
+	attachmentFormOverhead = 1 << 20
 )
 
 // ChatHandler handles chat endpoints
 type ChatHandler struct {
-	chatService services.ChatService
+	chatService    services.ChatService
+	meetingService services.MeetingService
+	clientService  services.ClientService
+	userService    services.UserService
+	emailService   *services.EmailService
+	signaling      *signaling.Hub
+	store          storage.Storage
+	maxUploadMB    int
 }
 
-// NewChatHandler creates a new chat handler
-func NewChatHandler(chatService services.ChatService) *ChatHandler {
+// NewChatHandler creates a new chat handler. Messages sent through it are
+// also delivered live to the meeting's room on the signaling hub.
+// Attachments are served from store; uploads over maxUploadMB are cut off.
+func NewChatHandler(chatService services.ChatService, meetingService services.MeetingService, clientService services.ClientService, userService services.UserService, emailService *services.EmailService, hub *signaling.Hub, store storage.Storage, maxUploadMB int) *ChatHandler {
 	return &ChatHandler{
-		chatService: chatService,
+		chatService:    chatService,
+		meetingService: meetingService,
+		clientService:  clientService,
+		userService:    userService,
+		emailService:   emailService,
+		signaling:      hub,
+		store:          store,
+		maxUploadMB:    maxUploadMB,
 	}
 }
 
 // GetMessages gets chat messages for a meeting
 func (h *ChatHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	meetingID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "Invalid meeting ID")
+	meeting, ok := h.getMeeting(w, r)
+	if !ok {
 		return
 	}
 
@@ -47,28 +79,21 @@ func (h *ChatHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	messages, err := h.chatService.GetMessagesByMeeting(r.Context(), meetingID, limit, offset)
+	messages, err := h.chatService.GetMessagesByMeeting(r.Context(), meeting.ID, h.viewer(r, meeting), limit, offset)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to get messages")
 		return
 	}
 
+	h.withLinks(messages...)
+
 	utils.WriteSuccess(w, messages)
 }
 
 // SendMessage sends a chat message
 func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	meetingID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "Invalid meeting ID")
-		return
-	}
-
-	userID := utils.GetUserIDFromContext(r)
-	clientID := utils.GetClientIDFromContext(r)
-	if userID == 0 || clientID == 0 {
-		utils.WriteError(w, http.StatusUnauthorized, "User or client ID not found")
+	meeting, ok := h.getMeeting(w, r)
+	if !ok || !h.chatAllowed(w, r, meeting) {
 		return
 	}
 
@@ -77,6 +102,9 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		MessageType string                 `json:"message_type"`
 		ReplyToID   *int                   `json:"reply_to_id"`
 		Metadata    map[string]interface{} `json:"metadata"`
+		// Private messages go to one participant, by signaling ID, or to the hosts
+		RecipientID string `json:"recipient_id"`
+		ToHosts     bool   `json:"to_hosts"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -95,26 +123,199 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create chat message
-	message := &models.ChatMessage{
-		ClientID:    clientID,
-		MeetingID:   meetingID,
-		SenderID:    &userID,
-		SenderName:  "User", // TODO: Get actual user name
-		Message:     req.Message,
-		MessageType: req.MessageType,
-		ReplyToID:   req.ReplyToID,
-		Metadata:    models.JSONB(req.Metadata),
+	message, ok := h.newMessage(w, r, meeting, req.RecipientID, req.ToHosts)
+	if !ok {
+		return
+	}
+	message.Message = req.Message
+	message.MessageType = req.MessageType
+	message.ReplyToID = req.ReplyToID
+	for key, value := range req.Metadata {
+		if key != models.ChatMetaSenderID {
+			message.Metadata[key] = value
+		}
 	}
 
-	err = h.chatService.SendMessage(r.Context(), message)
+	err := h.chatService.SendMessage(r.Context(), message)
+	if rateLimited(w, err) {
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to send message: "+err.Error())
 		return
 	}
 
+	if h.signaling != nil {
+		h.signaling.PublishChatMessage(meeting, message)
+	}
+
+	utils.WriteSuccess(w, message)
+}
+
+// UploadAttachment posts a file to the meeting's chat. The multipart form
+// carries the file and optionally a caption, reply and private recipient.
+func (h *ChatHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	meeting, ok := h.getMeeting(w, r)
+	if !ok || !h.chatAllowed(w, r, meeting) {
+		return
+	}
+
+	if h.maxUploadMB > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(h.maxUploadMB)<<20+attachmentFormOverhead)
+	}
+	if err := r.ParseMultipartForm(attachmentMemory); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid multipart form: "+err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "File is required")
+		return
+	}
+	defer file.Close()
+
+	message, ok := h.newMessage(w, r, meeting, r.FormValue("recipient_id"), r.FormValue("to_hosts") == "true")
+	if !ok {
+		return
+	}
+	message.Message = r.FormValue("message")
+	if replyTo := r.FormValue("reply_to_id"); replyTo != "" {
+		replyToID, err := strconv.Atoi(replyTo)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid reply_to_id")
+			return
+		}
+		message.ReplyToID = &replyToID
+	}
+
+	err = h.chatService.UploadAttachment(r.Context(), &services.AttachmentUpload{
+		Message:  message,
+		FileName: header.Filename,
+		Size:     header.Size,
+		Body:     file,
+	})
+	if rateLimited(w, err) {
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAttachmentTooLarge):
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, err.Error())
+		case errors.Is(err, services.ErrAttachmentType):
+			utils.WriteError(w, http.StatusUnsupportedMediaType, err.Error())
+		case errors.Is(err, services.ErrAttachmentQuota):
+			utils.WriteError(w, http.StatusInsufficientStorage, err.Error())
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to upload attachment")
+		}
+		return
+	}
+
+	if h.signaling != nil {
+		h.signaling.PublishChatMessage(meeting, message)
+	}
+
+	h.withLinks(message)
 	utils.WriteSuccess(w, message)
 }
 
+// DownloadAttachment serves an attachment, or its thumbnail, through a
+// signed link handed out with the message
+func (h *ChatHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	messageID, err := strconv.Atoi(vars["messageId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+	attachmentID, variant := vars["attachmentId"], vars["variant"]
+
+	expires, _ := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	err = h.chatService.VerifyAttachmentURL(messageID, attachmentID, variant, expires, r.URL.Query().Get("signature"))
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	attachment, err := h.chatService.GetAttachment(r.Context(), messageID, attachmentID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	key, contentType := attachment.Key, attachment.ContentType
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})
+	if variant == services.AttachmentThumbnail {
+		if attachment.ThumbnailKey == "" {
+			utils.WriteError(w, http.StatusNotFound, "Attachment has no thumbnail")
+			return
+		}
+		key, contentType, disposition = attachment.ThumbnailKey, thumbnail.ContentType, "inline"
+	} else if attachment.IsImage() {
+		disposition = mime.FormatMediaType("inline", map[string]string{"filename": attachment.Name})
+	}
+
+	// Uploaded content is never rendered as anything but its checked type
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// A redirect to storage lives no longer than the signed link itself
+	expiresIn := max(time.Until(time.Unix(expires, 0)), time.Minute)
+	if err := storage.ServeObject(w, r, h.store, key, contentType, disposition, expiresIn); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			utils.WriteError(w, http.StatusNotFound, "Attachment not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to read attachment")
+	}
+}
+
+// newMessage starts a message from the user to the meeting, private to
+// recipientID or to the hosts if given. It writes the error response itself
+// and returns false on failure.
+func (h *ChatHandler) newMessage(w http.ResponseWriter, r *http.Request, meeting *models.Meeting, recipientID string, toHosts bool) (*models.ChatMessage, bool) {
+	userID := utils.GetUserIDFromContext(r)
+	user, err := h.userService.GetUserByID(r.Context(), userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, "User not found")
+		return nil, false
+	}
+
+	message := &models.ChatMessage{
+		ClientID:    meeting.ClientID,
+		MeetingID:   meeting.ID,
+		SenderID:    &userID,
+		SenderEmail: &user.Email,
+		SenderName:  user.GetFullName(),
+		Metadata:    models.JSONB{models.ChatMetaSenderID: strconv.Itoa(userID)},
+		IsPrivate:   toHosts || recipientID != "",
+	}
+	if recipientID != "" {
+		if recipientID == strconv.Itoa(userID) {
+			utils.WriteError(w, http.StatusBadRequest, "Cannot send a private message to yourself")
+			return nil, false
+		}
+		message.RecipientID = &recipientID
+		if recipientUserID, err := strconv.Atoi(recipientID); err == nil {
+			message.RecipientUserID = &recipientUserID
+		}
+	}
+	return message, true
+}
+
+// withLinks replaces the storage keys of the messages' attachments with
+// signed links readers can download them from
+func (h *ChatHandler) withLinks(messages ...*models.ChatMessage) {
+	for _, message := range messages {
+		if message.Attachments == nil {
+			continue
+		}
+		links := h.chatService.AttachmentLinks(message)
+		message.Attachments = models.JSONB{"files": links}
+	}
+}
+
 // GetMessageReplies gets replies to a specific message
 func (h *ChatHandler) GetMessageReplies(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -136,36 +337,148 @@ func (h *ChatHandler) GetMessageReplies(w http.ResponseWriter, r *http.Request)
 	utils.WriteSuccess(w, replies)
 }
 
-// ModerateMessage moderates a chat message (admin only)
+// ModerateMessage hides a chat message from the meeting (hosts only)
 func (h *ChatHandler) ModerateMessage(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	messageID, err := strconv.Atoi(vars["messageId"])
-	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "Invalid message ID")
+	meeting, message, ok := h.reviewMessage(w, r)
+	if !ok {
 		return
 	}
-
-	userID := utils.GetUserIDFromContext(r)
-	if userID == 0 {
-		utils.WriteError(w, http.StatusUnauthorized, "User ID not found")
+	if message.IsModerated {
+		utils.WriteError(w, http.StatusConflict, "Message is already hidden")
 		return
 	}
 
-	err = h.chatService.ModerateMessage(r.Context(), messageID, userID)
+	userID := utils.GetUserIDFromContext(r)
+	err := h.chatService.ModerateMessage(r.Context(), message.ID, userID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to moderate message")
 		return
 	}
 
+	h.auditMessage(r, meeting, message, models.AuditActionDeleteMessage)
+	if h.signaling != nil {
+		h.signaling.PublishChatDeleted(meeting, message, strconv.Itoa(userID))
+	}
+
 	utils.WriteSuccess(w, map[string]string{"message": "Message moderated successfully"})
 }
 
+// ApproveMessage releases a hidden message to its readers (hosts only)
+func (h *ChatHandler) ApproveMessage(w http.ResponseWriter, r *http.Request) {
+	meeting, message, ok := h.reviewMessage(w, r)
+	if !ok {
+		return
+	}
+	if !message.IsModerated {
+		utils.WriteError(w, http.StatusConflict, "Message is not hidden")
+		return
+	}
+
+	if err := h.chatService.UnmoderateMessage(r.Context(), message.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to approve message")
+		return
+	}
+
+	message, err := h.chatService.GetMessageByID(r.Context(), message.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to get message")
+		return
+	}
+
+	h.auditMessage(r, meeting, message, models.AuditActionApproveMessage)
+	if h.signaling != nil {
+		h.signaling.PublishChatMessage(meeting, message)
+	}
+
+	h.withLinks(message)
+	utils.WriteSuccess(w, message)
+}
+
+// GetReviewQueue lists the meeting's hidden messages, newest first, with
+// the reason each was hidden in its metadata (hosts only)
+func (h *ChatHandler) GetReviewQueue(w http.ResponseWriter, r *http.Request) {
+	meeting, ok := h.getMeeting(w, r)
+	if !ok {
+		return
+	}
+
+	viewer := h.viewer(r, meeting)
+	if !viewer.Moderator {
+		utils.WriteError(w, http.StatusForbidden, "Only hosts can review messages")
+		return
+	}
+
+	limit, offset := pageParams(r)
+	messages, err := h.chatService.GetModeratedMessages(r.Context(), meeting.ID, viewer, limit, offset)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to get review queue")
+		return
+	}
+
+	h.withLinks(messages...)
+
+	utils.WriteSuccess(w, messages)
+}
+
+// GetModerationPolicy gets the chat moderation policy of the admin's client
+func (h *ChatHandler) GetModerationPolicy(w http.ResponseWriter, r *http.Request) {
+	clientID := utils.GetClientIDFromContext(r)
+	if clientID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "Client ID not found")
+		return
+	}
+
+	policy, err := h.chatService.GetModerationPolicy(r.Context(), clientID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to get moderation policy")
+		return
+	}
+
+	utils.WriteSuccess(w, policy)
+}
+
+// UpdateModerationPolicy replaces the chat moderation policy of the admin's
+// client
+func (h *ChatHandler) UpdateModerationPolicy(w http.ResponseWriter, r *http.Request) {
+	clientID := utils.GetClientIDFromContext(r)
+	if clientID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "Client ID not found")
+		return
+	}
+
+	var policy models.ChatModerationPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	policy.ClientID = clientID
+	if policy.BlockedWords == nil {
+		policy.BlockedWords = []string{}
+	}
+	if policy.BlockedPatterns == nil {
+		policy.BlockedPatterns = []string{}
+	}
+	if policy.AllowedDomains == nil {
+		policy.AllowedDomains = []string{}
+	}
+
+	err := h.chatService.UpdateModerationPolicy(r.Context(), &policy)
+	if errors.Is(err, services.ErrInvalidModerationPolicy) {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update moderation policy")
+		return
+	}
+
+	utils.WriteSuccess(w, policy)
+}
+
 // SearchMessages searches messages in a meeting
 func (h *ChatHandler) SearchMessages(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	meetingID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "Invalid meeting ID")
+	meeting, ok := h.getMeeting(w, r)
+	if !ok {
 		return
 	}
 
@@ -175,18 +488,113 @@ func (h *ChatHandler) SearchMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit := 20 // default
-	offset := 0 // default
+	limit, offset := pageParams(r)
 
-	messages, err := h.chatService.SearchMessages(r.Context(), meetingID, query, limit, offset)
+	messages, err := h.chatService.SearchMessages(r.Context(), meeting.ID, h.viewer(r, meeting), query, limit, offset)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to search messages")
 		return
 	}
 
+	h.withLinks(messages...)
+
 	utils.WriteSuccess(w, messages)
 }
 
+// Search searches chat across the meetings the user attended. Besides the
+// query q it takes the filters meeting_id, sender_id, type, and from and to
+// (RFC 3339 times or dates, to being exclusive), and lang to stem the query
+// with.
+func (h *ChatHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userID := utils.GetUserIDFromContext(r)
+	clientID := utils.GetClientIDFromContext(r)
+	if userID == 0 || clientID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User or client ID not found")
+		return
+	}
+
+	query := r.URL.Query()
+	search := &services.ChatSearch{
+		Query:       query.Get("q"),
+		Language:    query.Get("lang"),
+		SenderID:    query.Get("sender_id"),
+		MessageType: query.Get("type"),
+	}
+	if search.Query == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Search query is required")
+		return
+	}
+	if search.Language != "" && !services.ValidSearchLanguage(search.Language) {
+		utils.WriteError(w, http.StatusBadRequest, "Unsupported search language")
+		return
+	}
+
+	if meetingIDStr := query.Get("meeting_id"); meetingIDStr != "" {
+		meetingID, err := strconv.Atoi(meetingIDStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid meeting ID")
+			return
+		}
+		search.MeetingID = &meetingID
+	}
+
+	var err error
+	if search.From, err = searchTime(query.Get("from"), false); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid from date")
+		return
+	}
+	if search.To, err = searchTime(query.Get("to"), true); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid to date")
+		return
+	}
+
+	search.Limit, search.Offset = pageParams(r)
+
+	results, err := h.chatService.Search(r.Context(), userID, clientID, search)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to search messages")
+		return
+	}
+
+	for _, result := range results {
+		h.withLinks(&result.ChatMessage)
+	}
+
+	utils.WriteSuccess(w, results)
+}
+
+// pageParams reads the limit and offset query parameters, 20 results by
+// default
+func pageParams(r *http.Request) (limit, offset int) {
+	limit = 20
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+	return limit, offset
+}
+
+// searchTime parses a search bound, either an RFC 3339 time or a date. A date
+// ending a range includes that whole day.
+func searchTime(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
 // GetChatStats gets chat statistics for a meeting
 func (h *ChatHandler) GetChatStats(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -203,4 +611,222 @@ func (h *ChatHandler) GetChatStats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	utils.WriteSuccess(w, stats)
-}
\ No newline at end of file
+}
+
+// ExportTranscript downloads the meeting's chat as a transcript. The format
+// query parameter picks json, txt, html or csv; tz is an IANA time zone for
+// the message times, UTC by default.
+func (h *ChatHandler) ExportTranscript(w http.ResponseWriter, r *http.Request) {
+	meeting, ok := h.getMeeting(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = services.TranscriptJSON
+	}
+	if !services.ValidTranscriptFormat(format) {
+		utils.WriteError(w, http.StatusBadRequest, "Format must be json, txt, html or csv")
+		return
+	}
+
+	loc, err := transcriptLocation(r.URL.Query().Get("tz"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid time zone")
+		return
+	}
+
+	transcript, err := h.chatService.GetTranscript(r.Context(), meeting, h.viewer(r, meeting), loc)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to build transcript")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := transcript.Write(&buf, format); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to render transcript")
+		return
+	}
+
+	filename := fmt.Sprintf("meeting-%d-chat.%s", meeting.ID, format)
+	w.Header().Set("Content-Type", services.TranscriptContentType(format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(buf.Bytes())
+}
+
+// EmailTranscript emails the meeting's chat transcript, as HTML, to the
+// requesting user
+func (h *ChatHandler) EmailTranscript(w http.ResponseWriter, r *http.Request) {
+	meeting, ok := h.getMeeting(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		TimeZone string `json:"tz"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	loc, err := transcriptLocation(req.TimeZone)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid time zone")
+		return
+	}
+
+	user, err := h.userService.GetUserByID(r.Context(), utils.GetUserIDFromContext(r))
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	transcript, err := h.chatService.GetTranscript(r.Context(), meeting, h.viewer(r, meeting), loc)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to build transcript")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := transcript.Write(&buf, services.TranscriptHTML); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to render transcript")
+		return
+	}
+
+	if err := h.emailService.SendChatTranscriptEmail(user.Email, meeting.Title, buf.String()); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to send transcript")
+		return
+	}
+
+	utils.WriteSuccess(w, map[string]string{"message": "Transcript sent to " + user.Email})
+}
+
+// transcriptLocation loads the time zone a transcript is written in
+func transcriptLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// getMeeting loads the meeting named in the URL, checking it belongs to the
+// user's client. It writes the error response itself and returns false on
+// failure.
+func (h *ChatHandler) getMeeting(w http.ResponseWriter, r *http.Request) (*models.Meeting, bool) {
+	meetingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid meeting ID")
+		return nil, false
+	}
+
+	userID := utils.GetUserIDFromContext(r)
+	clientID := utils.GetClientIDFromContext(r)
+	if userID == 0 || clientID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User or client ID not found")
+		return nil, false
+	}
+
+	meeting, err := h.meetingService.GetMeetingByID(r.Context(), meetingID)
+	if err != nil || meeting.ClientID != clientID {
+		utils.WriteError(w, http.StatusNotFound, "Meeting not found")
+		return nil, false
+	}
+
+	return meeting, true
+}
+
+// chatAllowed refuses posts to a meeting whose chat is turned off, by the
+// meeting or its tenant, as the signaling socket does
+func (h *ChatHandler) chatAllowed(w http.ResponseWriter, r *http.Request, meeting *models.Meeting) bool {
+	features, err := h.clientService.GetClientFeatures(r.Context(), meeting.ClientID)
+	if err != nil {
+		log.Printf("Chat could not load features for client %d: %v", meeting.ClientID, err)
+		features = nil
+	}
+	if !meeting.ChatAllowed(features) {
+		utils.WriteError(w, http.StatusForbidden, "Chat is disabled for this meeting")
+		return false
+	}
+	return true
+}
+
+// reviewMessage loads the message named in the URL for one of the
+// meeting's moderators to act on. It writes the error response itself and
+// returns false on failure.
+func (h *ChatHandler) reviewMessage(w http.ResponseWriter, r *http.Request) (*models.Meeting, *models.ChatMessage, bool) {
+	meeting, ok := h.getMeeting(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	viewer := h.viewer(r, meeting)
+	if !viewer.Moderator {
+		utils.WriteError(w, http.StatusForbidden, "Only hosts can moderate messages")
+		return nil, nil, false
+	}
+
+	messageID, err := strconv.Atoi(mux.Vars(r)["messageId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid message ID")
+		return nil, nil, false
+	}
+
+	message, err := h.chatService.GetMessageByID(r.Context(), messageID)
+	if err != nil || message.MeetingID != meeting.ID || !viewer.CanRead(message) {
+		utils.WriteError(w, http.StatusNotFound, "Message not found")
+		return nil, nil, false
+	}
+
+	return meeting, message, true
+}
+
+// auditMessage records a moderator's action on a message in the meeting's
+// audit log
+func (h *ChatHandler) auditMessage(r *http.Request, meeting *models.Meeting, message *models.ChatMessage, action string) {
+	userID := utils.GetUserIDFromContext(r)
+	targetID := message.SenderWireID()
+	event := &models.MeetingAuditEvent{
+		MeetingID:   meeting.ID,
+		ActorUserID: &userID,
+		ActorID:     strconv.Itoa(userID),
+		Action:      action,
+		TargetID:    &targetID,
+		Details:     models.JSONB{"message_id": message.ID},
+	}
+	if err := h.meetingService.RecordAuditEvent(r.Context(), event); err != nil {
+		log.Printf("Failed to audit %s of chat message %d: %v", action, message.ID, err)
+	}
+}
+
+// rateLimited answers a message the moderation policy's rate limits refused,
+// returning false for any other error
+func rateLimited(w http.ResponseWriter, err error) bool {
+	var limited *services.RateLimitError
+	if !errors.As(err, &limited) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+	utils.WriteError(w, http.StatusTooManyRequests, limited.Error())
+	return true
+}
+
+// viewer returns the user as a reader of the meeting's chat. The meeting's
+// creator and its hosts and co-hosts also read messages sent to the hosts.
+func (h *ChatHandler) viewer(r *http.Request, meeting *models.Meeting) *services.ChatViewer {
+	userID := utils.GetUserIDFromContext(r)
+	viewer := &services.ChatViewer{
+		UserID:    &userID,
+		WireID:    strconv.Itoa(userID),
+		Moderator: meeting.CreatedByUserID == userID,
+	}
+	if !viewer.Moderator {
+		participant, err := h.meetingService.GetParticipant(r.Context(), meeting.ID, &userID, nil)
+		viewer.Moderator = err == nil && participant.IsModerator()
+	}
+	return viewer
+}
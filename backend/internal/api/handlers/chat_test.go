@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+)
+
+// fakeChatMeetings serves meeting 1 of client 1
+type fakeChatMeetings struct {
+	services.MeetingService
+	enableChat bool
+}
+
+func (m fakeChatMeetings) GetMeetingByID(ctx context.Context, id int) (*models.Meeting, error) {
+	return &models.Meeting{ID: id, ClientID: 1, EnableChat: m.enableChat}, nil
+}
+
+type fakeChatClients struct {
+	services.ClientService
+	chatEnabled bool
+}
+
+func (c fakeChatClients) GetClientFeatures(ctx context.Context, clientID int) (*models.ClientFeatures, error) {
+	return &models.ClientFeatures{ClientID: clientID, ChatEnabled: c.chatEnabled}, nil
+}
+
+type fakeChatUsers struct{ services.UserService }
+
+func (fakeChatUsers) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	return &models.User{ID: id, ClientID: 1, Email: "jane@example.com"}, nil
+}
+
+// fakeChat counts the messages posted through it
+type fakeChat struct {
+	services.ChatService
+	sent int
+}
+
+func (c *fakeChat) SendMessage(ctx context.Context, message *models.ChatMessage) error {
+	c.sent++
+	return nil
+}
+
+func TestPostingChatRespectsChatSettings(t *testing.T) {
+	tests := []struct {
+		name          string
+		meetingChat   bool
+		clientChat    bool
+		messageStatus int
+		uploadStatus  int
+	}{
+		{name: "chat on", meetingChat: true, clientChat: true, messageStatus: http.StatusOK, uploadStatus: http.StatusBadRequest},
+		{name: "meeting chat off", meetingChat: false, clientChat: true, messageStatus: http.StatusForbidden, uploadStatus: http.StatusForbidden},
+		{name: "client chat off", meetingChat: true, clientChat: false, messageStatus: http.StatusForbidden, uploadStatus: http.StatusForbidden},
+	}
+
+	request := func(target string, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		ctx := context.WithValue(r.Context(), "user_id", 1)
+		ctx = context.WithValue(ctx, "client_id", 1)
+		return mux.SetURLVars(r.WithContext(ctx), map[string]string{"id": "1"})
+	}
+
+	for _, tt := range tests {
+		chat := &fakeChat{}
+		h := NewChatHandler(chat, fakeChatMeetings{enableChat: tt.meetingChat}, fakeChatClients{chatEnabled: tt.clientChat}, fakeChatUsers{}, nil, nil, nil, 10)
+
+		w := httptest.NewRecorder()
+		h.SendMessage(w, request("/api/v1/meetings/1/chat", `{"message":"hello"}`))
+		if w.Code != tt.messageStatus {
+			t.Errorf("%s: message got status %d, want %d", tt.name, w.Code, tt.messageStatus)
+		}
+		if posted := chat.sent > 0; posted != (tt.messageStatus == http.StatusOK) {
+			t.Errorf("%s: message posted = %v", tt.name, posted)
+		}
+
+		// With chat on, the empty upload gets as far as the missing form
+		w = httptest.NewRecorder()
+		h.UploadAttachment(w, request("/api/v1/meetings/1/chat/attachments", ""))
+		if w.Code != tt.uploadStatus {
+			t.Errorf("%s: upload got status %d, want %d", tt.name, w.Code, tt.uploadStatus)
+		}
+	}
+}
@@ -86,12 +86,10 @@ func (h *ClientHandler) GetClient(w http.ResponseWriter, r *http.Request) {
 	utils.WriteSuccess(w, client)
 }
 
-// UpdateClient updates a client
+// UpdateClient updates a client. Admins may only update their own client.
 func (h *ClientHandler) UpdateClient(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	clientID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "Invalid client ID")
+	clientID, ok := adminClientID(w, r)
+	if !ok {
 		return
 	}
 
@@ -101,6 +99,7 @@ func (h *ClientHandler) UpdateClient(w http.ResponseWriter, r *http.Request) {
 		LogoURL      *string `json:"logo_url"`
 		Theme        string  `json:"theme"`
 		PrimaryColor string  `json:"primary_color"`
+		RequireMFA   *bool   `json:"require_mfa"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
@@ -131,6 +130,9 @@ func (h *ClientHandler) UpdateClient(w http.ResponseWriter, r *http.Request) {
 	if updateReq.PrimaryColor != "" {
 		client.PrimaryColor = updateReq.PrimaryColor
 	}
+	if updateReq.RequireMFA != nil {
+		client.RequireMFA = *updateReq.RequireMFA
+	}
 
 	err = h.clientService.UpdateClient(r.Context(), client)
 	if err != nil {
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+)
+
+// fakeClientUpdates serves any client and records the ones updated
+type fakeClientUpdates struct {
+	services.ClientService
+	updated []int
+}
+
+func (s *fakeClientUpdates) GetClientByID(ctx context.Context, id int) (*models.Client, error) {
+	return &models.Client{ID: id}, nil
+}
+
+func (s *fakeClientUpdates) UpdateClient(ctx context.Context, client *models.Client) error {
+	s.updated = append(s.updated, client.ID)
+	return nil
+}
+
+func TestUpdateClientIsScopedToTheAdminsClient(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientID int
+		role     string
+		status   int
+	}{
+		{name: "own client's admin", clientID: 1, role: "admin", status: http.StatusOK},
+		{name: "platform admin", clientID: 2, role: "super_admin", status: http.StatusOK},
+		{name: "another client's admin", clientID: 2, role: "admin", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		clients := &fakeClientUpdates{}
+		h := NewClientHandler(clients)
+
+		r := httptest.NewRequest(http.MethodPut, "/api/v1/admin/clients/1", strings.NewReader(`{"require_mfa":true}`))
+		ctx := context.WithValue(r.Context(), "user_id", 1)
+		ctx = context.WithValue(ctx, "client_id", tt.clientID)
+		ctx = context.WithValue(ctx, "role", tt.role)
+		r = mux.SetURLVars(r.WithContext(ctx), map[string]string{"id": "1"})
+
+		w := httptest.NewRecorder()
+		h.UpdateClient(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if updated := len(clients.updated) > 0; updated != (tt.status == http.StatusOK) {
+			t.Errorf("%s: client updated = %v", tt.name, updated)
+		}
+	}
+}
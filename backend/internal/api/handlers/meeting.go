@@ -68,6 +68,10 @@ func (h *MeetingHandler) CreateMeeting(w http.ResponseWriter, r *http.Request) {
 		MaxParticipants *int                   `json:"max_participants"`
 		Password        *string                `json:"password"`
 		Settings        map[string]interface{} `json:"settings"`
+		// Optional RFC 5545 recurrence, e.g. "FREQ=WEEKLY;BYDAY=MO,WE,FR"
+		RecurrenceRule     *string     `json:"recurrence_rule"`
+		RecurrenceTimezone *string     `json:"recurrence_timezone"`
+		RecurrenceExDates  []time.Time `json:"recurrence_exdates"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -114,6 +118,24 @@ func (h *MeetingHandler) CreateMeeting(w http.ResponseWriter, r *http.Request) {
 		Settings:            models.JSONB(req.Settings),
 	}
 
+	if req.RecurrenceRule != nil && *req.RecurrenceRule != "" {
+		meeting.RecurrenceRule = req.RecurrenceRule
+		meeting.RecurrenceTimezone = req.RecurrenceTimezone
+		meeting.RecurrenceExDates = models.TimeList(req.RecurrenceExDates)
+
+		occurrences, err := h.meetingService.CreateRecurringMeetings(r.Context(), meeting)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Failed to create recurring meeting: "+err.Error())
+			return
+		}
+
+		utils.WriteSuccess(w, map[string]interface{}{
+			"meeting":     meeting,
+			"occurrences": occurrences,
+		})
+		return
+	}
+
 	err := h.meetingService.CreateMeeting(r.Context(), meeting)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to create meeting: "+err.Error())
@@ -297,4 +319,216 @@ func (h *MeetingHandler) GetUpcomingMeetings(w http.ResponseWriter, r *http.Requ
 	}
 
 	utils.WriteSuccess(w, meetings)
-}
\ No newline at end of file
+}
+
+// ListOccurrences lists the occurrences of a recurring meeting. The window
+// defaults to the next 30 days and can be set with the from and to query
+// parameters (RFC 3339).
+func (h *MeetingHandler) ListOccurrences(w http.ResponseWriter, r *http.Request) {
+	meeting, ok := h.getSeries(w, r, false)
+	if !ok {
+		return
+	}
+
+	from := time.Now()
+	to := from.AddDate(0, 0, 30)
+	if value := r.URL.Query().Get("from"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid from time")
+			return
+		}
+		from = t
+		to = from.AddDate(0, 0, 30)
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid to time")
+			return
+		}
+		to = t
+	}
+
+	occurrences, err := h.meetingService.ListOccurrences(r.Context(), meeting.ID, from, to)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Failed to list occurrences: "+err.Error())
+		return
+	}
+
+	utils.WriteSuccess(w, occurrences)
+}
+
+// UpdateOccurrence updates one occurrence of a recurring meeting, or with
+// scope "following" that occurrence and all later ones
+func (h *MeetingHandler) UpdateOccurrence(w http.ResponseWriter, r *http.Request) {
+	meeting, ok := h.getSeries(w, r, true)
+	if !ok {
+		return
+	}
+
+	occurrence, err := time.Parse(time.RFC3339, mux.Vars(r)["occurrence"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid occurrence time")
+		return
+	}
+
+	var req struct {
+		Scope          string     `json:"scope"`
+		Title          *string    `json:"title"`
+		Description    *string    `json:"description"`
+		ScheduledStart *time.Time `json:"scheduled_start"`
+		ScheduledEnd   *time.Time `json:"scheduled_end"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Scope == "" {
+		req.Scope = models.RecurrenceScopeThis
+	}
+
+	update := &services.OccurrenceUpdate{
+		Title:          req.Title,
+		Description:    req.Description,
+		ScheduledStart: req.ScheduledStart,
+		ScheduledEnd:   req.ScheduledEnd,
+	}
+
+	updated, err := h.meetingService.UpdateOccurrence(r.Context(), meeting.ID, occurrence, update, req.Scope)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Failed to update occurrence: "+err.Error())
+		return
+	}
+
+	utils.WriteSuccess(w, updated)
+}
+
+// CancelOccurrence cancels one occurrence of a recurring meeting, or with
+// ?scope=following that occurrence and all later ones
+func (h *MeetingHandler) CancelOccurrence(w http.ResponseWriter, r *http.Request) {
+	meeting, ok := h.getSeries(w, r, true)
+	if !ok {
+		return
+	}
+
+	occurrence, err := time.Parse(time.RFC3339, mux.Vars(r)["occurrence"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid occurrence time")
+		return
+	}
+
+	scope := r.URL.Query().Get("scope")
+	if scope == "" {
+		scope = models.RecurrenceScopeThis
+	}
+
+	err = h.meetingService.CancelOccurrence(r.Context(), meeting.ID, occurrence, scope)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Failed to cancel occurrence: "+err.Error())
+		return
+	}
+
+	utils.WriteSuccess(w, map[string]string{
+		"message": "Occurrence cancelled successfully",
+	})
+}
+
+// GetEngagement reports the reactions and raised hands in a meeting
+func (h *MeetingHandler) GetEngagement(w http.ResponseWriter, r *http.Request) {
+	meetingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid meeting ID")
+		return
+	}
+
+	meeting, err := h.meetingService.GetMeetingByID(r.Context(), meetingID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Meeting not found")
+		return
+	}
+
+	if meeting.CreatedByUserID != utils.GetUserIDFromContext(r) {
+		utils.WriteError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+
+	summary, err := h.meetingService.GetEngagementSummary(r.Context(), meeting.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to get engagement")
+		return
+	}
+
+	utils.WriteSuccess(w, summary)
+}
+
+// GetAuditLog lists the moderation actions taken in a meeting, for its
+// hosts and co-hosts and the client's admins
+func (h *MeetingHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	meetingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid meeting ID")
+		return
+	}
+
+	userID := utils.GetUserIDFromContext(r)
+	role := utils.GetUserRoleFromContext(r)
+	meeting, err := h.meetingService.GetMeetingByID(r.Context(), meetingID)
+	if err != nil || (role != "super_admin" && meeting.ClientID != utils.GetClientIDFromContext(r)) {
+		utils.WriteError(w, http.StatusNotFound, "Meeting not found")
+		return
+	}
+
+	allowed := role == "admin" || role == "super_admin" || meeting.CreatedByUserID == userID
+	if !allowed {
+		participant, err := h.meetingService.GetParticipant(r.Context(), meeting.ID, &userID, nil)
+		allowed = err == nil && participant.IsModerator()
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, "Only hosts and admins can see the audit log")
+		return
+	}
+
+	events, err := h.meetingService.ListAuditEvents(r.Context(), meeting.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to get audit log")
+		return
+	}
+
+	utils.WriteSuccess(w, events)
+}
+
+// getSeries loads the recurring meeting named in the URL and checks that the
+// caller may see it, or with hostOnly change it. It writes the error
+// response itself and returns false on failure.
+func (h *MeetingHandler) getSeries(w http.ResponseWriter, r *http.Request, hostOnly bool) (*models.Meeting, bool) {
+	meetingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid meeting ID")
+		return nil, false
+	}
+
+	meeting, err := h.meetingService.GetMeetingByID(r.Context(), meetingID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Meeting not found")
+		return nil, false
+	}
+
+	userID := utils.GetUserIDFromContext(r)
+	if meeting.CreatedByUserID != userID {
+		if hostOnly {
+			utils.WriteError(w, http.StatusForbidden, "Only the host can change the meeting")
+		} else {
+			utils.WriteError(w, http.StatusForbidden, "Access denied")
+		}
+		return nil, false
+	}
+
+	if !meeting.IsRecurring() {
+		utils.WriteError(w, http.StatusBadRequest, "Meeting is not recurring")
+		return nil, false
+	}
+
+	return meeting, true
+}
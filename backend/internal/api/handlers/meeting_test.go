@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+)
+
+// fakeAuditMeetings serves meeting 1 of client 1, created by user 1, with
+// user 2 as a co-host and user 3 as an attendee
+type fakeAuditMeetings struct{ services.MeetingService }
+
+func (fakeAuditMeetings) GetMeetingByID(ctx context.Context, id int) (*models.Meeting, error) {
+	if id != 1 {
+		return nil, sql.ErrNoRows
+	}
+	return &models.Meeting{ID: 1, ClientID: 1, CreatedByUserID: 1}, nil
+}
+
+func (fakeAuditMeetings) GetParticipant(ctx context.Context, meetingID int, userID *int, email *string) (*models.MeetingParticipant, error) {
+	roles := map[int]string{2: models.ParticipantRoleCoHost, 3: models.ParticipantRoleAttendee}
+	if userID == nil || roles[*userID] == "" {
+		return nil, sql.ErrNoRows
+	}
+	return &models.MeetingParticipant{MeetingID: meetingID, UserID: userID, Role: roles[*userID]}, nil
+}
+
+func (fakeAuditMeetings) ListAuditEvents(ctx context.Context, meetingID int) ([]*models.MeetingAuditEvent, error) {
+	return []*models.MeetingAuditEvent{{ID: 1, MeetingID: meetingID, ActorID: "1", Action: "mute"}}, nil
+}
+
+func TestGetAuditLogIsForHostsAndAdmins(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   int
+		clientID int
+		role     string
+		status   int
+	}{
+		{name: "host", userID: 1, clientID: 1, role: "user", status: http.StatusOK},
+		{name: "co-host", userID: 2, clientID: 1, role: "user", status: http.StatusOK},
+		{name: "admin", userID: 4, clientID: 1, role: "admin", status: http.StatusOK},
+		{name: "platform admin", userID: 5, clientID: 2, role: "super_admin", status: http.StatusOK},
+		{name: "attendee", userID: 3, clientID: 1, role: "user", status: http.StatusForbidden},
+		{name: "another client's admin", userID: 6, clientID: 2, role: "admin", status: http.StatusNotFound},
+	}
+
+	h := NewMeetingHandler(fakeAuditMeetings{})
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/meetings/1/audit", nil)
+		ctx := context.WithValue(r.Context(), "user_id", tt.userID)
+		ctx = context.WithValue(ctx, "client_id", tt.clientID)
+		ctx = context.WithValue(ctx, "role", tt.role)
+		r = mux.SetURLVars(r.WithContext(ctx), map[string]string{"id": "1"})
+
+		w := httptest.NewRecorder()
+		h.GetAuditLog(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/utils"
+)
+
+// MFAHandler lets users manage their second factor, and admins reset it
+type MFAHandler struct {
+	mfaService  services.MFAService
+	userService services.UserService
+}
+
+// NewMFAHandler creates a new MFA handler
+func NewMFAHandler(mfaService services.MFAService, userService services.UserService) *MFAHandler {
+	return &MFAHandler{
+		mfaService:  mfaService,
+		userService: userService,
+	}
+}
+
+// mfaCodeRequest carries a TOTP or recovery code
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// GetStatus returns the caller's second factor status
+func (h *MFAHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	userID := utils.GetUserIDFromContext(r)
+	if userID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User ID not found")
+		return
+	}
+
+	status, err := h.mfaService.GetStatus(r.Context(), userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to get MFA status")
+		return
+	}
+
+	utils.WriteSuccess(w, status)
+}
+
+// Setup starts enrolling a second factor, returning the secret and its
+// provisioning URI
+func (h *MFAHandler) Setup(w http.ResponseWriter, r *http.Request) {
+	userID := utils.GetUserIDFromContext(r)
+	if userID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User ID not found")
+		return
+	}
+
+	user, err := h.userService.GetUserByID(r.Context(), userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	setup, err := h.mfaService.Setup(r.Context(), user)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteSuccess(w, setup)
+}
+
+// Enable confirms enrollment with a code and returns recovery codes
+func (h *MFAHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.codeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfaService.Enable(r.Context(), userID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteSuccess(w, map[string][]string{"recovery_codes": codes})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes, given a
+// current code
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.codeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.mfaService.Verify(r.Context(), userID, req.Code); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	codes, err := h.mfaService.RegenerateRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteSuccess(w, map[string][]string{"recovery_codes": codes})
+}
+
+// Disable removes the caller's second factor, given a current code
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.codeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.mfaService.Verify(r.Context(), userID, req.Code); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	if err := h.mfaService.Disable(r.Context(), userID, false); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// ResetUserMFA removes a user's second factor, for users who lost their
+// device and recovery codes. They enroll again at their next login if their
+// client requires MFA. Admins are limited to users of their own client.
+func (h *MFAHandler) ResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := h.userService.GetUserByID(r.Context(), userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if utils.GetUserRoleFromContext(r) != "super_admin" && user.ClientID != utils.GetClientIDFromContext(r) {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := h.mfaService.Disable(r.Context(), user.ID, true); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to reset MFA")
+		return
+	}
+
+	utils.WriteSuccess(w, map[string]string{"message": "Two-factor authentication reset"})
+}
+
+// codeRequest reads the caller and the code from a request
+func (h *MFAHandler) codeRequest(w http.ResponseWriter, r *http.Request) (int, *mfaCodeRequest, bool) {
+	userID := utils.GetUserIDFromContext(r)
+	if userID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User ID not found")
+		return 0, nil, false
+	}
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return 0, nil, false
+	}
+	if req.Code == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Code is required")
+		return 0, nil, false
+	}
+
+	return userID, &req, true
+}
+
+// writeMFAError maps second factor errors to responses
+func writeMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMFAToken):
+		utils.WriteError(w, http.StatusUnauthorized, "Invalid or expired MFA token, please log in again")
+	case errors.Is(err, services.ErrInvalidMFACode):
+		utils.WriteError(w, http.StatusUnauthorized, "Invalid code")
+	case errors.Is(err, services.ErrMFALocked):
+		utils.WriteError(w, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, services.ErrMFAAlreadyEnabled), errors.Is(err, services.ErrMFANotEnabled):
+		utils.WriteError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrMFARequired):
+		utils.WriteError(w, http.StatusForbidden, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Two-factor authentication failed")
+	}
+}
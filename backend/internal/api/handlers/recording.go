@@ -0,0 +1,540 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/recording"
+	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/storage"
+	"video-conference-backend/internal/utils"
+)
+
+// RecordingHandler handles recording endpoints
+type RecordingHandler struct {
+	recordingService services.RecordingService
+	meetingService   services.MeetingService
+	recorder         *recording.Manager
+	store            storage.Storage
+	linkExpiry       time.Duration
+}
+
+// NewRecordingHandler creates a new recording handler serving recordings from
+// store. Download links it issues expire after linkExpiry.
+func NewRecordingHandler(recordingService services.RecordingService, meetingService services.MeetingService, recorder *recording.Manager, store storage.Storage, linkExpiry time.Duration) *RecordingHandler {
+	return &RecordingHandler{
+		recordingService: recordingService,
+		meetingService:   meetingService,
+		recorder:         recorder,
+		store:            store,
+		linkExpiry:       linkExpiry,
+	}
+}
+
+// recordingResponse exposes whether a recording is password protected
+// without its password hash
+type recordingResponse struct {
+	*models.Recording
+	PasswordProtected bool `json:"password_protected"`
+}
+
+func newRecordingResponse(recording *models.Recording) recordingResponse {
+	return recordingResponse{Recording: recording, PasswordProtected: recording.HasPassword()}
+}
+
+func newRecordingResponses(recordings []*models.Recording) []recordingResponse {
+	responses := make([]recordingResponse, len(recordings))
+	for i, recording := range recordings {
+		responses[i] = newRecordingResponse(recording)
+	}
+	return responses
+}
+
+// ListRecordings lists the recordings of the user's tenant the user may view
+func (h *RecordingHandler) ListRecordings(w http.ResponseWriter, r *http.Request) {
+	userID := utils.GetUserIDFromContext(r)
+	if userID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User ID not found")
+		return
+	}
+
+	limit := 20 // default
+	offset := 0 // default
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	recordings, err := h.recordingService.GetRecordingsForUser(r.Context(), userID, limit, offset)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to get recordings")
+		return
+	}
+
+	utils.WriteSuccess(w, newRecordingResponses(recordings))
+}
+
+// ListMeetingRecordings lists the recordings of a meeting the user may view
+func (h *RecordingHandler) ListMeetingRecordings(w http.ResponseWriter, r *http.Request) {
+	meeting, ok := h.getMeeting(w, r)
+	if !ok {
+		return
+	}
+
+	recordings, err := h.recordingService.GetRecordingsByMeeting(r.Context(), meeting.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to get recordings")
+		return
+	}
+
+	userID := utils.GetUserIDFromContext(r)
+	visible := []*models.Recording{}
+	for _, rec := range recordings {
+		allowed, err := h.recordingService.CanAccessRecording(r.Context(), rec.ID, userID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to check recording access")
+			return
+		}
+		if allowed {
+			visible = append(visible, rec)
+		}
+	}
+
+	utils.WriteSuccess(w, newRecordingResponses(visible))
+}
+
+// StartRecording starts recording an active meeting. Only the meeting's
+// host or a co-host can start a recording.
+func (h *RecordingHandler) StartRecording(w http.ResponseWriter, r *http.Request) {
+	meeting, ok := h.getMeeting(w, r)
+	if !ok {
+		return
+	}
+
+	userID := utils.GetUserIDFromContext(r)
+	if meeting.CreatedByUserID != userID {
+		participant, err := h.meetingService.GetParticipant(r.Context(), meeting.ID, &userID, nil)
+		if err != nil || !participant.IsModerator() {
+			utils.WriteError(w, http.StatusForbidden, "Only the host can start a recording")
+			return
+		}
+	}
+
+	var req struct {
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	rec, err := h.recorder.Start(r.Context(), meeting, userID, req.Title)
+	if err != nil {
+		switch {
+		case errors.Is(err, recording.ErrRecordingDisabled):
+			utils.WriteError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, recording.ErrAlreadyRecording):
+			utils.WriteError(w, http.StatusConflict, err.Error())
+		default:
+			utils.WriteError(w, http.StatusBadRequest, "Failed to start recording: "+err.Error())
+		}
+		return
+	}
+
+	utils.WriteSuccess(w, newRecordingResponse(rec))
+}
+
+// StopRecording stops an active recording and queues it for processing
+func (h *RecordingHandler) StopRecording(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.getRecording(w, r, true)
+	if !ok {
+		return
+	}
+
+	err := h.recorder.Stop(r.Context(), rec.ID, utils.GetUserIDFromContext(r))
+	if err != nil {
+		if errors.Is(err, recording.ErrNotRecording) {
+			utils.WriteError(w, http.StatusConflict, err.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to stop recording: "+err.Error())
+		return
+	}
+
+	utils.WriteSuccess(w, map[string]interface{}{
+		"message":      "Recording stopped successfully",
+		"recording_id": rec.ID,
+		"status":       models.RecordingStatusProcessing,
+	})
+}
+
+// GetRecording gets a specific recording
+func (h *RecordingHandler) GetRecording(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.getRecording(w, r, false)
+	if !ok {
+		return
+	}
+
+	utils.WriteSuccess(w, newRecordingResponse(rec))
+}
+
+// UpdateRecording updates a recording's details and sharing. An empty
+// password removes the recording's password protection.
+func (h *RecordingHandler) UpdateRecording(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.getRecording(w, r, true)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Title       *string    `json:"title"`
+		Description *string    `json:"description"`
+		IsPublic    *bool      `json:"is_public"`
+		Password    *string    `json:"password"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Update fields if provided
+	if req.Title != nil {
+		rec.Title = *req.Title
+	}
+	if req.Description != nil {
+		rec.Description = req.Description
+	}
+	if req.IsPublic != nil {
+		rec.IsPublic = *req.IsPublic
+	}
+	if req.ExpiresAt != nil {
+		rec.ExpiresAt = req.ExpiresAt
+	}
+
+	if err := h.recordingService.UpdateRecording(r.Context(), rec); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update recording")
+		return
+	}
+
+	if req.Password != nil {
+		if err := h.recordingService.SetRecordingPassword(r.Context(), rec.ID, *req.Password); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to set recording password")
+			return
+		}
+	}
+
+	updated, err := h.recordingService.GetRecordingByID(r.Context(), rec.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to get recording")
+		return
+	}
+
+	utils.WriteSuccess(w, newRecordingResponse(updated))
+}
+
+// DeleteRecording deletes a recording and its files
+func (h *RecordingHandler) DeleteRecording(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.getRecording(w, r, true)
+	if !ok {
+		return
+	}
+
+	if rec.Status == models.RecordingStatusRecording {
+		utils.WriteError(w, http.StatusConflict, "Stop the recording before deleting it")
+		return
+	}
+
+	if err := h.recordingService.DeleteRecording(r.Context(), rec.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete recording")
+		return
+	}
+
+	utils.WriteSuccess(w, map[string]string{
+		"message": "Recording deleted successfully",
+	})
+}
+
+// CreateLinks issues signed download and streaming links for a recording.
+// Password protected recordings require the password unless the user can
+// manage the recording.
+func (h *RecordingHandler) CreateLinks(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.getRecording(w, r, false)
+	if !ok {
+		return
+	}
+
+	if rec.HasPassword() {
+		manager, err := h.recordingService.CanManageRecording(r.Context(), rec.ID, utils.GetUserIDFromContext(r))
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to check recording access")
+			return
+		}
+		if !manager && !h.checkPassword(w, r, rec) {
+			return
+		}
+	}
+
+	h.writeLinks(w, r, rec)
+}
+
+// CreatePublicLinks issues signed links for a public recording without
+// authentication, checking the recording's password if it has one
+func (h *RecordingHandler) CreatePublicLinks(w http.ResponseWriter, r *http.Request) {
+	recordingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	rec, err := h.recordingService.GetRecordingByID(r.Context(), recordingID)
+	if err != nil || !rec.IsPublic {
+		utils.WriteError(w, http.StatusNotFound, "Recording not found")
+		return
+	}
+
+	if rec.HasPassword() && !h.checkPassword(w, r, rec) {
+		return
+	}
+
+	h.writeLinks(w, r, rec)
+}
+
+// Download serves a track of a recording as an attachment through a signed link
+func (h *RecordingHandler) Download(w http.ResponseWriter, r *http.Request) {
+	h.serveTrack(w, r, services.RecordingURLDownload)
+}
+
+// Stream serves a track of a recording inline through a signed link. Range
+// requests let players seek without downloading the whole track.
+func (h *RecordingHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	h.serveTrack(w, r, services.RecordingURLStream)
+}
+
+// GetStorageUsage reports the recording statistics and storage used by the
+// admin's tenant
+func (h *RecordingHandler) GetStorageUsage(w http.ResponseWriter, r *http.Request) {
+	clientID := utils.GetClientIDFromContext(r)
+	if clientID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "Client ID not found")
+		return
+	}
+
+	usage, err := h.recordingService.GetStorageUsage(r.Context(), clientID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to get storage usage")
+		return
+	}
+
+	stats, err := h.recordingService.GetRecordingStats(r.Context(), clientID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to get recording stats")
+		return
+	}
+
+	utils.WriteSuccess(w, map[string]interface{}{
+		"storage": usage,
+		"stats":   stats,
+	})
+}
+
+// getMeeting loads the meeting named in the URL, which must belong to the
+// user's tenant. It writes the error response itself and returns false on
+// failure.
+func (h *RecordingHandler) getMeeting(w http.ResponseWriter, r *http.Request) (*models.Meeting, bool) {
+	meetingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid meeting ID")
+		return nil, false
+	}
+
+	userID := utils.GetUserIDFromContext(r)
+	clientID := utils.GetClientIDFromContext(r)
+	if userID == 0 || clientID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User or client ID not found")
+		return nil, false
+	}
+
+	meeting, err := h.meetingService.GetMeetingByID(r.Context(), meetingID)
+	if err != nil || meeting.ClientID != clientID {
+		utils.WriteError(w, http.StatusNotFound, "Meeting not found")
+		return nil, false
+	}
+
+	return meeting, true
+}
+
+// getRecording loads the recording named in the URL and checks that the
+// user may view it, or with manage change it. It writes the error response
+// itself and returns false on failure.
+func (h *RecordingHandler) getRecording(w http.ResponseWriter, r *http.Request, manage bool) (*models.Recording, bool) {
+	recordingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid recording ID")
+		return nil, false
+	}
+
+	userID := utils.GetUserIDFromContext(r)
+	if userID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User ID not found")
+		return nil, false
+	}
+
+	// Recordings of other tenants are reported as missing
+	canView, err := h.recordingService.CanAccessRecording(r.Context(), recordingID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to check recording access")
+		return nil, false
+	}
+	if !canView {
+		utils.WriteError(w, http.StatusNotFound, "Recording not found")
+		return nil, false
+	}
+
+	if manage {
+		canManage, err := h.recordingService.CanManageRecording(r.Context(), recordingID, userID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to check recording access")
+			return nil, false
+		}
+		if !canManage {
+			utils.WriteError(w, http.StatusForbidden, "Only the host can change the recording")
+			return nil, false
+		}
+	}
+
+	rec, err := h.recordingService.GetRecordingByID(r.Context(), recordingID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Recording not found")
+		return nil, false
+	}
+
+	return rec, true
+}
+
+// checkPassword verifies the password in the request body against the
+// recording's. It writes the error response itself and returns false on
+// failure.
+func (h *RecordingHandler) checkPassword(w http.ResponseWriter, r *http.Request, rec *models.Recording) bool {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+	if req.Password == "" {
+		utils.WriteError(w, http.StatusUnauthorized, "Recording password required")
+		return false
+	}
+
+	valid, err := h.recordingService.VerifyRecordingPassword(r.Context(), rec.ID, req.Password, utils.RemoteIP(r))
+	if errors.Is(err, services.ErrRecordingPasswordThrottled) {
+		utils.WriteError(w, http.StatusTooManyRequests, "Too many password attempts, please try again later")
+		return false
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to verify recording password")
+		return false
+	}
+	if !valid {
+		utils.WriteError(w, http.StatusUnauthorized, "Invalid recording password")
+		return false
+	}
+	return true
+}
+
+// writeLinks responds with signed links to a recording and its tracks. A
+// track other than the default is picked by adding ?track=<file> to a link.
+func (h *RecordingHandler) writeLinks(w http.ResponseWriter, r *http.Request, rec *models.Recording) {
+	downloadURL, err := h.recordingService.GenerateDownloadURL(r.Context(), rec.ID, h.linkExpiry)
+	if err != nil {
+		h.writeLinkError(w, err)
+		return
+	}
+	streamingURL, err := h.recordingService.GenerateStreamingURL(r.Context(), rec.ID)
+	if err != nil {
+		h.writeLinkError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, map[string]interface{}{
+		"download_url":  downloadURL,
+		"streaming_url": streamingURL,
+		"expires_at":    time.Now().Add(h.linkExpiry),
+		"tracks":        rec.Metadata["tracks"],
+	})
+}
+
+func (h *RecordingHandler) writeLinkError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrRecordingUnavailable) {
+		utils.WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+	utils.WriteError(w, http.StatusInternalServerError, "Failed to create recording links")
+}
+
+// serveTrack serves a recording track through a signed link issued for purpose
+func (h *RecordingHandler) serveTrack(w http.ResponseWriter, r *http.Request, purpose string) {
+	recordingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, services.ErrInvalidRecordingURL.Error())
+		return
+	}
+	if err := h.recordingService.VerifySignedURL(recordingID, purpose, expires, query.Get("signature")); err != nil {
+		utils.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	track, key, err := h.recordingService.GetRecordingTrack(r.Context(), recordingID, query.Get("track"))
+	if err != nil {
+		if errors.Is(err, services.ErrTrackNotFound) || errors.Is(err, services.ErrRecordingUnavailable) {
+			utils.WriteError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusNotFound, "Recording not found")
+		return
+	}
+
+	disposition := "inline"
+	if purpose == services.RecordingURLDownload {
+		disposition = "attachment"
+	}
+	disposition = fmt.Sprintf("%s; filename=%q", disposition, track.File)
+
+	// Storage that presigns links takes over for the rest of this link's life
+	expiresIn := time.Until(time.Unix(expires, 0))
+	if expiresIn < time.Minute {
+		expiresIn = time.Minute
+	}
+	err = storage.ServeObject(w, r, h.store, key, track.ContentType(), disposition, expiresIn)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			utils.WriteError(w, http.StatusNotFound, "Recording not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to read recording")
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+)
+
+// fakeRecordings serves public recording 1, protected by the password
+// "secret", and throttles the address 192.0.2.9
+type fakeRecordings struct {
+	services.RecordingService
+	attempts map[string]int // by IP address
+}
+
+func (s *fakeRecordings) GetRecordingByID(ctx context.Context, id int) (*models.Recording, error) {
+	password := "hash"
+	return &models.Recording{ID: id, IsPublic: true, Password: &password}, nil
+}
+
+func (s *fakeRecordings) VerifyRecordingPassword(ctx context.Context, recordingID int, password, ipAddress string) (bool, error) {
+	s.attempts[ipAddress]++
+	if ipAddress == "192.0.2.9" {
+		return false, services.ErrRecordingPasswordThrottled
+	}
+	return password == "secret", nil
+}
+
+func TestCreatePublicLinksThrottlesPasswordGuesses(t *testing.T) {
+	recordings := &fakeRecordings{attempts: make(map[string]int)}
+	h := NewRecordingHandler(recordings, nil, nil, nil, time.Hour)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		password   string
+		status     int
+	}{
+		{name: "wrong password", remoteAddr: "192.0.2.1:5000", password: "guess", status: http.StatusUnauthorized},
+		{name: "throttled address", remoteAddr: "192.0.2.9:5000", password: "secret", status: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/public/recordings/1/links", strings.NewReader(`{"password":"`+tt.password+`"}`))
+		r.RemoteAddr = tt.remoteAddr
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+
+		w := httptest.NewRecorder()
+		h.CreatePublicLinks(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+
+	// Attempts are counted by the caller's address, without its port
+	if recordings.attempts["192.0.2.1"] != 1 || recordings.attempts["192.0.2.9"] != 1 {
+		t.Fatalf("attempts by address %v", recordings.attempts)
+	}
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/utils"
+)
+
+// SSOHandler signs users in through their client's identity provider, and
+// lets admins configure it
+type SSOHandler struct {
+	ssoService  services.SSOService
+	authService services.AuthService
+}
+
+// NewSSOHandler creates a new single sign-on handler
+func NewSSOHandler(ssoService services.SSOService, authService services.AuthService) *SSOHandler {
+	return &SSOHandler{
+		ssoService:  ssoService,
+		authService: authService,
+	}
+}
+
+// ssoStateCookie holds the state of the sign-in a browser started. The
+// callback must come from the same browser, so an attacker cannot complete
+// their own sign-in in someone else's session.
+const ssoStateCookie = "sso_state"
+
+// ssoConfigRequest is a provider configuration as admins submit it.
+// Enabled defaults to true.
+type ssoConfigRequest struct {
+	Enabled          *bool        `json:"enabled"`
+	Issuer           string       `json:"issuer"`
+	OIDCClientID     string       `json:"oidc_client_id"`
+	OIDCClientSecret *string      `json:"oidc_client_secret"`
+	AllowedDomains   []string     `json:"allowed_domains"`
+	Scopes           []string     `json:"scopes"`
+	RoleClaim        *string      `json:"role_claim"`
+	RoleMapping      models.JSONB `json:"role_mapping"`
+	DefaultRole      string       `json:"default_role"`
+}
+
+// Start returns the URL of the identity provider to sign in at, for a
+// client_id or for the client whose provider handles an email's domain
+func (h *SSOHandler) Start(w http.ResponseWriter, r *http.Request) {
+	var req models.SSOStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.ClientID == 0 && req.Email == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Client ID or email is required")
+		return
+	}
+
+	response, err := h.ssoService.Start(r.Context(), &req)
+	if err != nil {
+		writeSSOError(w, err)
+		return
+	}
+
+	setSSOStateCookie(w, r, response.State, 0)
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteSuccess(w, response)
+}
+
+// Callback completes a sign-in with the code and state the identity
+// provider redirected the frontend back with
+func (h *SSOHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	var req models.SSOCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Code == "" || req.State == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Code and state are required")
+		return
+	}
+
+	cookie, err := r.Cookie(ssoStateCookie)
+	setSSOStateCookie(w, r, "", -1)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.State)) != 1 {
+		writeSSOError(w, services.ErrInvalidSSOState)
+		return
+	}
+
+	user, err := h.ssoService.Authenticate(r.Context(), req.Code, req.State)
+	if err != nil {
+		writeSSOError(w, err)
+		return
+	}
+
+	authResponse, err := h.authService.LoginWithSSO(r.Context(), user, sessionClient(r))
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, "Account is not active")
+		return
+	}
+
+	utils.WriteSuccess(w, authResponse)
+}
+
+// GetConfig returns a client's identity provider configuration. The client
+// secret is never returned.
+func (h *SSOHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := adminClientID(w, r)
+	if !ok {
+		return
+	}
+
+	config, err := h.ssoService.GetConfig(r.Context(), clientID)
+	if err != nil {
+		writeSSOError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, config)
+}
+
+// SaveConfig creates or replaces a client's identity provider
+// configuration. Leaving out the client secret keeps the current one.
+func (h *SSOHandler) SaveConfig(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := adminClientID(w, r)
+	if !ok {
+		return
+	}
+
+	var req ssoConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	config := &models.SSOConfig{
+		ClientID:         clientID,
+		Enabled:          req.Enabled == nil || *req.Enabled,
+		Issuer:           req.Issuer,
+		OIDCClientID:     req.OIDCClientID,
+		OIDCClientSecret: req.OIDCClientSecret,
+		AllowedDomains:   req.AllowedDomains,
+		Scopes:           req.Scopes,
+		RoleClaim:        req.RoleClaim,
+		RoleMapping:      req.RoleMapping,
+		DefaultRole:      req.DefaultRole,
+	}
+	if err := h.ssoService.SaveConfig(r.Context(), config); err != nil {
+		writeSSOError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, config)
+}
+
+// DeleteConfig removes a client's identity provider
+func (h *SSOHandler) DeleteConfig(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := adminClientID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.ssoService.DeleteConfig(r.Context(), clientID); err != nil {
+		writeSSOError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, map[string]string{"message": "Single sign-on removed"})
+}
+
+// VerifyDomain verifies a client's domain by the DNS TXT record listed in
+// its configuration
+func (h *SSOHandler) VerifyDomain(w http.ResponseWriter, r *http.Request) {
+	h.verifyDomain(w, r, nil)
+}
+
+// ApproveDomain verifies a client's domain without its DNS record. Only
+// platform admins may approve domains.
+func (h *SSOHandler) ApproveDomain(w http.ResponseWriter, r *http.Request) {
+	if utils.GetUserRoleFromContext(r) != "super_admin" {
+		utils.WriteError(w, http.StatusForbidden, "Only platform admins can approve domains")
+		return
+	}
+	approvedBy := utils.GetUserIDFromContext(r)
+	h.verifyDomain(w, r, &approvedBy)
+}
+
+func (h *SSOHandler) verifyDomain(w http.ResponseWriter, r *http.Request, approvedBy *int) {
+	clientID, ok := adminClientID(w, r)
+	if !ok {
+		return
+	}
+
+	domain, err := h.ssoService.VerifyDomain(r.Context(), clientID, mux.Vars(r)["domain"], approvedBy)
+	if err != nil {
+		writeSSOError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, domain)
+}
+
+// adminClientID reads the client from the path. Admins are limited to their
+// own client.
+func adminClientID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	clientID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid client ID")
+		return 0, false
+	}
+	if utils.GetUserRoleFromContext(r) != "super_admin" && clientID != utils.GetClientIDFromContext(r) {
+		utils.WriteError(w, http.StatusNotFound, "Client not found")
+		return 0, false
+	}
+	return clientID, true
+}
+
+// setSSOStateCookie sets the state cookie, or clears it with a negative
+// maxAge. It is only sent back to the sign-in endpoints.
+func setSSOStateCookie(w http.ResponseWriter, r *http.Request, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoStateCookie,
+		Value:    state,
+		Path:     "/api/v1/public/auth/sso",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// writeSSOError maps single sign-on errors to responses. Failures at the
+// provider are logged and reported without detail.
+func writeSSOError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrSSONotConfigured),
+		errors.Is(err, services.ErrSSODomainNotFound):
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrSSODomainUnverified):
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrSSODomainTaken):
+		utils.WriteError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidSSOConfig):
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrInvalidSSOState),
+		errors.Is(err, services.ErrSSODomainNotAllowed),
+		errors.Is(err, services.ErrSSOEmailUnverified):
+		utils.WriteError(w, http.StatusUnauthorized, err.Error())
+	default:
+		log.Printf("Single sign-on failed: %v", err)
+		utils.WriteError(w, http.StatusUnauthorized, "Single sign-on failed")
+	}
+}
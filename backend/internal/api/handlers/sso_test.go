@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+)
+
+// fakeSSO starts every sign-in with the same state and signs in one user
+type fakeSSO struct {
+	services.SSOService
+	authenticated int
+}
+
+func (s *fakeSSO) Start(ctx context.Context, req *models.SSOStartRequest) (*models.SSOStartResponse, error) {
+	return &models.SSOStartResponse{AuthorizationURL: "https://idp.example.com/authorize", State: "state-1"}, nil
+}
+
+func (s *fakeSSO) Authenticate(ctx context.Context, code, state string) (*models.User, error) {
+	s.authenticated++
+	return &models.User{ID: 1, ClientID: 1, Email: "jane@example.com"}, nil
+}
+
+type fakeSSOAuth struct{ services.AuthService }
+
+func (fakeSSOAuth) LoginWithSSO(ctx context.Context, user *models.User, client *models.SessionClient) (*models.AuthResponse, error) {
+	return &models.AuthResponse{AccessToken: "access-1"}, nil
+}
+
+func TestSSOStartSetsStateCookie(t *testing.T) {
+	h := NewSSOHandler(&fakeSSO{}, fakeSSOAuth{})
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/public/auth/sso/start", strings.NewReader(`{"client_id":1}`))
+	r.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	h.Start(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "state-1") {
+		t.Fatal("state returned in the response body")
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != ssoStateCookie || cookies[0].Value != "state-1" {
+		t.Fatalf("set cookies %v, want the state", cookies)
+	}
+	if cookie := cookies[0]; !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("state cookie %+v is not HttpOnly, Secure and SameSite=Lax", cookie)
+	}
+}
+
+func TestSSOCallbackRequiresStateCookie(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string
+		status int
+	}{
+		{name: "no cookie", status: http.StatusUnauthorized},
+		{name: "another sign-in's state", cookie: "state-2", status: http.StatusUnauthorized},
+		{name: "matching state", cookie: "state-1", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		sso := &fakeSSO{}
+		h := NewSSOHandler(sso, fakeSSOAuth{})
+
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/public/auth/sso/callback", strings.NewReader(`{"code":"code-1","state":"state-1"}`))
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: ssoStateCookie, Value: tt.cookie})
+		}
+		w := httptest.NewRecorder()
+		h.Callback(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if signedIn := sso.authenticated > 0; signedIn != (tt.status == http.StatusOK) {
+			t.Errorf("%s: code redeemed = %v", tt.name, signedIn)
+		}
+		// The state is single use either way
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != ssoStateCookie || cookies[0].MaxAge >= 0 {
+			t.Errorf("%s: set cookies %v, want the state cleared", tt.name, cookies)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/utils"
+)
+
+// WebRTCHandler hands clients the settings they connect their media with
+type WebRTCHandler struct {
+	turnService    services.TURNService
+	meetingService services.MeetingService
+}
+
+// NewWebRTCHandler creates a new WebRTC handler
+func NewWebRTCHandler(turnService services.TURNService, meetingService services.MeetingService) *WebRTCHandler {
+	return &WebRTCHandler{
+		turnService:    turnService,
+		meetingService: meetingService,
+	}
+}
+
+// GetICEServers returns the ICE servers for joining an active meeting, with
+// TURN credentials for the caller that expire after the configured TTL.
+// Participants also receive them on joining the meeting's room.
+func (h *WebRTCHandler) GetICEServers(w http.ResponseWriter, r *http.Request) {
+	meetingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid meeting ID")
+		return
+	}
+
+	userID := utils.GetUserIDFromContext(r)
+	clientID := utils.GetClientIDFromContext(r)
+	if userID == 0 || clientID == 0 {
+		utils.WriteError(w, http.StatusUnauthorized, "User or client ID not found")
+		return
+	}
+
+	meeting, err := h.meetingService.GetMeetingByID(r.Context(), meetingID)
+	if err != nil || meeting.ClientID != clientID {
+		utils.WriteError(w, http.StatusNotFound, "Meeting not found")
+		return
+	}
+	if !meeting.IsActive() {
+		utils.WriteError(w, http.StatusConflict, "Meeting is not active")
+		return
+	}
+
+	if meeting.CreatedByUserID != userID {
+		participant, err := h.meetingService.GetParticipant(r.Context(), meeting.ID, &userID, nil)
+		if err == nil && participant.Status == models.ParticipantStatusBanned {
+			utils.WriteError(w, http.StatusForbidden, "You have been removed from this meeting")
+			return
+		}
+	}
+
+	ice, err := h.turnService.ICEConfig(r.Context(), meeting.MeetingID, strconv.Itoa(userID))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to issue ICE servers")
+		return
+	}
+
+	// The credentials are personal and short-lived
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteSuccess(w, ice)
+}
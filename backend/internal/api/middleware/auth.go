@@ -48,12 +48,28 @@ func JWTAuth(authService services.AuthService) func(http.Handler) http.Handler {
 				jsonError(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
 				return
 			}
+			if claims.TokenType != "access" {
+				jsonError(w, "Invalid token: not an access token", http.StatusUnauthorized)
+				return
+			}
+
+			// Refuse tokens revoked by logout before they expire
+			revoked, err := authService.IsTokenRevoked(r.Context(), claims.ID)
+			if err != nil {
+				jsonError(w, "Failed to validate token", http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				jsonError(w, "Token has been revoked", http.StatusUnauthorized)
+				return
+			}
 
 			// Add claims to request context
 			ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
 			ctx = context.WithValue(ctx, "client_id", claims.ClientID)
 			ctx = context.WithValue(ctx, "email", claims.Email)
 			ctx = context.WithValue(ctx, "role", claims.Role)
+			ctx = context.WithValue(ctx, "token_id", claims.ID)
 
 			// Call next handler with updated context
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -167,4 +167,73 @@ func CompressResponse() func(http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 		})
 	}
-}
\ No newline at end of file
+}
+// RealIP sets RemoteAddr to the client address a trusted proxy forwarded.
+// Requests from any other address keep their own, whatever headers they
+// send, so RemoteAddr can key throttling.
+func RealIP(trustedProxies []string) func(http.Handler) http.Handler {
+	var trusted []*net.IPNet
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			log.Printf("Ignoring invalid trusted proxy %q", proxy)
+			continue
+		}
+		trusted = append(trusted, network)
+	}
+
+	isTrusted := func(ip net.IP) bool {
+		for _, network := range trusted {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			if ip := net.ParseIP(host); len(trusted) > 0 && ip != nil && isTrusted(ip) {
+				if client := forwardedClient(r, isTrusted); client != nil {
+					r.RemoteAddr = net.JoinHostPort(client.String(), "0")
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedClient returns the address the nearest untrusted hop of
+// X-Forwarded-For connected from, or X-Real-IP without one. Entries left of
+// it could have been written by the client.
+func forwardedClient(r *http.Request, isTrusted func(net.IP) bool) net.IP {
+	header := r.Header.Get("X-Forwarded-For")
+	if header == "" {
+		return net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+	}
+
+	hops := strings.Split(header, ",")
+	var client net.IP
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !isTrusted(ip) {
+			break
+		}
+	}
+	return client
+}
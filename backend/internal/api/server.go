@@ -1,32 +1,65 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"log"
 	"net/http"
 
 	"video-conference-backend/internal/api/handlers"
 	"video-conference-backend/internal/api/middleware"
 	"video-conference-backend/internal/config"
+	"video-conference-backend/internal/recording"
 	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/sfu"
+	"video-conference-backend/internal/signaling"
 
 	"github.com/gorilla/mux"
 )
 
 // Server represents the API server
 type Server struct {
-	config   *config.Config
-	services *services.Services
-	router   *mux.Router
+	config     *config.Config
+	services   *services.Services
+	router     *mux.Router
+	signaling  *signaling.Hub
+	recordings *recording.Manager
+	sfu        *sfu.Manager
 }
 
-// NewServer creates a new API server instance
-func NewServer(cfg *config.Config, svc *services.Services) *Server {
+// NewServer creates a new API server instance. The backplane links this
+// server's signaling rooms with other replicas.
+func NewServer(cfg *config.Config, svc *services.Services, backplane signaling.Backplane) *Server {
 	server := &Server{
 		config:   cfg,
 		services: svc,
 		router:   mux.NewRouter(),
 	}
 
+	if svc != nil {
+		signalingConfig := signaling.DefaultConfig()
+		signalingConfig.AllowedOrigins = cfg.Server.CORSOrigins
+		signalingConfig.NodeID = cfg.Signaling.NodeID
+		signalingConfig.PresenceTTL = cfg.Signaling.PresenceTTL
+		signalingConfig.Reactions = cfg.Features.Reactions
+		signalingConfig.BreakoutRooms = cfg.Features.BreakoutRooms
+		signalingConfig.ScreenSharing = cfg.Features.ScreenSharing
+		signalingConfig.MaxScreenShares = cfg.Features.MaxScreenShares
+		signalingConfig.MeshLimit = cfg.SFU.MeshLimit
+		server.signaling = signaling.NewHub(signalingConfig, svc, backplane)
+		server.recordings = recording.NewManager(cfg, svc, server.signaling)
+
+		if cfg.SFU.Enabled {
+			media, err := sfu.NewManager(cfg, server.signaling)
+			if err != nil {
+				log.Printf("SFU disabled, every room stays in mesh mode: %v", err)
+			} else {
+				server.sfu = media
+				server.signaling.SetMediaServer(media)
+			}
+		}
+	}
+
 	server.setupRoutes()
 	return server
 }
@@ -36,15 +69,31 @@ func (s *Server) Router() http.Handler {
 	return s.router
 }
 
+// Shutdown closes long-lived connections that http.Server.Shutdown does not
+// track, such as hijacked WebSocket connections
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.signaling == nil {
+		return nil
+	}
+	// Recorders are stopped first so they can finish their files
+	if err := s.recordings.Shutdown(ctx); err != nil {
+		return err
+	}
+	if s.sfu != nil {
+		if err := s.sfu.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return s.signaling.Shutdown(ctx)
+}
+
 // setupRoutes configures all API routes
 func (s *Server) setupRoutes() {
 	// Apply global middleware
+	s.router.Use(middleware.RealIP(s.config.Server.TrustedProxies))
 	s.router.Use(middleware.CORS(s.config.Server.CORSOrigins))
 	s.router.Use(middleware.Recovery())
 
-	// WebSocket route with simple handler (compatible with working frontend)
-	s.router.HandleFunc("/ws", handlers.HandleSimpleWebSocket).Methods("GET")
-
 	// API v1 routes with logging middleware
 	api := s.router.PathPrefix("/api/v1").Subrouter()
 	api.Use(middleware.Logging())
@@ -55,30 +104,66 @@ func (s *Server) setupRoutes() {
 
 	// Initialize handlers
 	if s.services != nil {
-		authHandler := handlers.NewAuthHandler(s.services.Auth, s.services.User)
+		authHandler := handlers.NewAuthHandler(s.services.Auth, s.services.User, s.services.Email, s.config.Server.FrontendURL, s.signaling)
 		userHandler := handlers.NewUserHandler(s.services.User)
+		mfaHandler := handlers.NewMFAHandler(s.services.MFA, s.services.User)
+		ssoHandler := handlers.NewSSOHandler(s.services.SSO, s.services.Auth)
 		clientHandler := handlers.NewClientHandler(s.services.Client)
 		meetingHandler := handlers.NewMeetingHandler(s.services.Meeting)
-		chatHandler := handlers.NewChatHandler(s.services.Chat)
+		chatHandler := handlers.NewChatHandler(s.services.Chat, s.services.Meeting, s.services.Client, s.services.User, s.services.Email, s.signaling, s.services.Storage.Uploads, s.config.Storage.MaxSizeMB)
 		invitationHandler := handlers.NewInvitationHandler(s.services.Invitation, s.services.User, s.services.Email, s.services.Calendar)
+		recordingHandler := handlers.NewRecordingHandler(s.services.Recording, s.services.Meeting, s.recordings, s.services.Storage.Recordings, s.config.Storage.SignedURLExpiry)
+		webrtcHandler := handlers.NewWebRTCHandler(s.services.TURN, s.services.Meeting)
+
+		// WebSocket signaling route (authenticated via access or invitation token)
+		s.router.Handle("/ws", s.signaling).Methods("GET")
+
 		// Public routes (no authentication required)
 		public := api.PathPrefix("/public").Subrouter()
 		public.HandleFunc("/auth/login", authHandler.Login).Methods("POST", "OPTIONS")
 		public.HandleFunc("/auth/refresh", authHandler.RefreshToken).Methods("POST", "OPTIONS")
 		public.HandleFunc("/auth/register", authHandler.Register).Methods("POST", "OPTIONS")
+		public.HandleFunc("/auth/mfa/verify", authHandler.VerifyMFA).Methods("POST", "OPTIONS")
+		public.HandleFunc("/auth/mfa/enroll", authHandler.SetupMFAEnrollment).Methods("POST", "OPTIONS")
+		public.HandleFunc("/auth/mfa/enroll/confirm", authHandler.ConfirmMFAEnrollment).Methods("POST", "OPTIONS")
+		public.HandleFunc("/auth/sso/start", ssoHandler.Start).Methods("POST", "OPTIONS")
+		public.HandleFunc("/auth/sso/callback", ssoHandler.Callback).Methods("POST", "OPTIONS")
+		public.HandleFunc("/auth/reset-password", authHandler.ResetPassword).Methods("POST", "OPTIONS")
+		public.HandleFunc("/auth/reset-password/verify", authHandler.VerifyResetToken).Methods("GET", "OPTIONS")
+		public.HandleFunc("/auth/reset-password/confirm", authHandler.CompleteResetPassword).Methods("POST", "OPTIONS")
 
 		// Public invitation routes
 		public.HandleFunc("/invitations/validate", invitationHandler.ValidateInvitation).Methods("GET", "OPTIONS")
 		public.HandleFunc("/invitations/{token}", invitationHandler.GetInvitationByToken).Methods("GET", "OPTIONS")
 
+		// Public recording routes (signed links and public recordings)
+		public.HandleFunc("/recordings/{id}/links", recordingHandler.CreatePublicLinks).Methods("POST", "OPTIONS")
+		public.HandleFunc("/recordings/{id}/download", recordingHandler.Download).Methods("GET", "HEAD", "OPTIONS")
+		public.HandleFunc("/recordings/{id}/stream", recordingHandler.Stream).Methods("GET", "HEAD", "OPTIONS")
+
+		// Chat attachments, through signed links handed out with messages
+		public.HandleFunc("/chat/attachments/{messageId}/{attachmentId}/{variant:file|thumbnail}", chatHandler.DownloadAttachment).Methods("GET", "HEAD", "OPTIONS")
+
 		// Protected routes (authentication required)
 		protected := api.PathPrefix("").Subrouter()
 		protected.Use(middleware.JWTAuth(s.services.Auth))
 
+		// Session routes
+		protected.HandleFunc("/auth/validate", authHandler.ValidateToken).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/auth/sessions", authHandler.ListSessions).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/auth/sessions", authHandler.RevokeAllSessions).Methods("DELETE", "OPTIONS")
+		protected.HandleFunc("/auth/sessions/{id}", authHandler.RevokeSession).Methods("DELETE", "OPTIONS")
+
 		// User routes
 		protected.HandleFunc("/users/me", userHandler.GetProfile).Methods("GET", "OPTIONS")
 		protected.HandleFunc("/users/me", userHandler.UpdateProfile).Methods("PUT", "OPTIONS")
 		protected.HandleFunc("/users/me/password", userHandler.ChangePassword).Methods("PUT", "OPTIONS")
+		protected.HandleFunc("/users/me/mfa", mfaHandler.GetStatus).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/users/me/mfa", mfaHandler.Disable).Methods("DELETE", "OPTIONS")
+		protected.HandleFunc("/users/me/mfa/setup", mfaHandler.Setup).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/users/me/mfa/enable", mfaHandler.Enable).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/users/me/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes).Methods("POST", "OPTIONS")
 
 		// Client routes (admin only)
 		admin := protected.PathPrefix("/admin").Subrouter()
@@ -87,6 +172,16 @@ func (s *Server) setupRoutes() {
 		admin.HandleFunc("/clients", clientHandler.CreateClient).Methods("POST", "OPTIONS")
 		admin.HandleFunc("/clients/{id}", clientHandler.GetClient).Methods("GET", "OPTIONS")
 		admin.HandleFunc("/clients/{id}", clientHandler.UpdateClient).Methods("PUT", "OPTIONS")
+		admin.HandleFunc("/clients/{id}/sso", ssoHandler.GetConfig).Methods("GET", "OPTIONS")
+		admin.HandleFunc("/clients/{id}/sso", ssoHandler.SaveConfig).Methods("PUT", "OPTIONS")
+		admin.HandleFunc("/clients/{id}/sso", ssoHandler.DeleteConfig).Methods("DELETE", "OPTIONS")
+		admin.HandleFunc("/clients/{id}/sso/domains/{domain}/verify", ssoHandler.VerifyDomain).Methods("POST", "OPTIONS")
+		admin.HandleFunc("/clients/{id}/sso/domains/{domain}/approve", ssoHandler.ApproveDomain).Methods("POST", "OPTIONS")
+		admin.HandleFunc("/users/{id}/logout", authHandler.ForceLogout).Methods("POST", "OPTIONS")
+		admin.HandleFunc("/users/{id}/mfa", mfaHandler.ResetUserMFA).Methods("DELETE", "OPTIONS")
+		admin.HandleFunc("/recordings/storage", recordingHandler.GetStorageUsage).Methods("GET", "OPTIONS")
+		admin.HandleFunc("/chat/moderation", chatHandler.GetModerationPolicy).Methods("GET", "OPTIONS")
+		admin.HandleFunc("/chat/moderation", chatHandler.UpdateModerationPolicy).Methods("PUT", "OPTIONS")
 
 		// Meeting routes
 		protected.HandleFunc("/meetings", meetingHandler.ListMeetings).Methods("GET", "OPTIONS")
@@ -95,18 +190,39 @@ func (s *Server) setupRoutes() {
 		protected.HandleFunc("/meetings/{id}", meetingHandler.UpdateMeeting).Methods("PUT", "OPTIONS")
 		protected.HandleFunc("/meetings/{id}/start", meetingHandler.StartMeeting).Methods("POST", "OPTIONS")
 		protected.HandleFunc("/meetings/{id}/end", meetingHandler.EndMeeting).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/engagement", meetingHandler.GetEngagement).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/audit", meetingHandler.GetAuditLog).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/occurrences", meetingHandler.ListOccurrences).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/occurrences/{occurrence}", meetingHandler.UpdateOccurrence).Methods("PUT", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/occurrences/{occurrence}", meetingHandler.CancelOccurrence).Methods("DELETE", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/ice-servers", webrtcHandler.GetICEServers).Methods("GET", "OPTIONS")
+
+		// Recording routes
+		protected.HandleFunc("/meetings/{id}/recordings", recordingHandler.ListMeetingRecordings).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/recordings", recordingHandler.StartRecording).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/recordings", recordingHandler.ListRecordings).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/recordings/{id}", recordingHandler.GetRecording).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/recordings/{id}", recordingHandler.UpdateRecording).Methods("PUT", "OPTIONS")
+		protected.HandleFunc("/recordings/{id}", recordingHandler.DeleteRecording).Methods("DELETE", "OPTIONS")
+		protected.HandleFunc("/recordings/{id}/stop", recordingHandler.StopRecording).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/recordings/{id}/links", recordingHandler.CreateLinks).Methods("POST", "OPTIONS")
 
 		// Chat routes
 		protected.HandleFunc("/meetings/{id}/chat", chatHandler.GetMessages).Methods("GET", "OPTIONS")
 		protected.HandleFunc("/meetings/{id}/chat", chatHandler.SendMessage).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/chat/attachments", chatHandler.UploadAttachment).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/chat/export", chatHandler.ExportTranscript).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/chat/search", chatHandler.SearchMessages).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/chat/search", chatHandler.Search).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/chat/moderation", chatHandler.GetReviewQueue).Methods("GET", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/chat/messages/{messageId}/hide", chatHandler.ModerateMessage).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/chat/messages/{messageId}/approve", chatHandler.ApproveMessage).Methods("POST", "OPTIONS")
+		protected.HandleFunc("/meetings/{id}/chat/export/email", chatHandler.EmailTranscript).Methods("POST", "OPTIONS")
 
 		// Invitation routes (protected)
 		protected.HandleFunc("/invitations", invitationHandler.CreateInvitation).Methods("POST", "OPTIONS")
 		protected.HandleFunc("/invitations/accept", invitationHandler.AcceptInvitation).Methods("POST", "OPTIONS")
 	}
-
-	// Serve static files for uploads
-	s.router.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.FileServer(http.Dir("./uploads/"))))
 }
 
 // healthCheck provides a health check endpoint
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -19,6 +20,9 @@ type Config struct {
 	WebRTC      WebRTCConfig
 	Storage     StorageConfig
 	Redis       RedisConfig
+	Signaling   SignalingConfig
+	SFU         SFUConfig
+	Chat        ChatConfig
 	Features    FeatureConfig
 	Development DevelopmentConfig
 }
@@ -28,6 +32,11 @@ type ServerConfig struct {
 	Environment string
 	Debug       bool
 	CORSOrigins []string
+	PublicURL   string // base URL clients reach this server at
+	FrontendURL string // base URL of the web app, for links in emails
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers are believed
+	TrustedProxies []string
 }
 
 type DatabaseConfig struct {
@@ -43,11 +52,17 @@ type DatabaseConfig struct {
 }
 
 type AuthConfig struct {
-	JWTSecret             string
-	AccessTokenExpiry     time.Duration
-	RefreshTokenExpiry    time.Duration
-	PasswordResetExpiry   time.Duration
-	BCryptCost            int
+	JWTSecret           string
+	AccessTokenExpiry   time.Duration
+	RefreshTokenExpiry  time.Duration
+	PasswordResetExpiry time.Duration
+	BCryptCost          int
+
+	// Password reset requests allowed per email and per IP address within
+	// the throttle window
+	PasswordResetMaxPerEmail int
+	PasswordResetMaxPerIP    int
+	PasswordResetWindow      time.Duration
 }
 
 type EmailConfig struct {
@@ -62,20 +77,40 @@ type EmailConfig struct {
 type WebRTCConfig struct {
 	STUNServers    []string
 	TURNServerURL  string
-	TURNUsername   string
+	TURNUsername   string // static credentials, used only by the server's own peers
 	TURNCredential string
+	// TURNSecret is the shared secret (coturn's static-auth-secret) that
+	// signs the short-lived TURN credentials handed to clients
+	TURNSecret string
+	// TURNRealm is the realm coturn looks rotated secrets up under
+	TURNRealm         string
+	TURNCredentialTTL time.Duration
+	// TURNSecretRotation replaces the shared secret this often, keeping the
+	// secrets in the turn_secret table coturn reads; zero uses TURNSecret
+	TURNSecretRotation time.Duration
 }
 
 type StorageConfig struct {
-	Type              string // "local" or "s3"
-	LocalPath         string
-	RecordingPath     string
-	MaxSizeMB         int
-	AllowedTypes      []string
-	AWSRegion         string
-	AWSBucket         string
-	AWSAccessKey      string
-	AWSSecretKey      string
+	Type            string // "local" or "s3"
+	LocalPath       string
+	RecordingPath   string
+	RecordingSpool  string // local directory recorders write to before upload
+	MaxSizeMB       int
+	AllowedTypes    []string // file extensions uploads may have
+	ClientQuotaMB   int      // uploads kept per client; 0 is unlimited
+	AWSRegion       string
+	AWSBucket       string
+	AWSAccessKey    string
+	AWSSecretKey    string
+	AWSEndpoint     string // S3-compatible endpoint, e.g. a MinIO server
+	AWSUseSSL       bool
+	SignedURLExpiry time.Duration // lifetime of signed recording links
+
+	// Wrong recording passwords allowed from one IP address within the
+	// throttle window, on one recording and across all recordings
+	RecordingPasswordMaxPerRecording int
+	RecordingPasswordMaxPerIP        int
+	RecordingPasswordWindow          time.Duration
 }
 
 type RedisConfig struct {
@@ -85,6 +120,32 @@ type RedisConfig struct {
 	MaxRetries int
 }
 
+type SignalingConfig struct {
+	Backplane   string // "memory" or "redis"
+	NodeID      string
+	PresenceTTL time.Duration
+}
+
+// SFUConfig configures the embedded selective forwarding unit that carries
+// the media of large meetings
+type SFUConfig struct {
+	Enabled bool
+	// MeshLimit is how many participants a meeting in automatic media mode
+	// holds before its media moves to the SFU
+	MeshLimit int
+	// PortMin and PortMax bound the UDP ports used for media; zero leaves
+	// the choice to the system
+	PortMin int
+	PortMax int
+	// PublicIPs are advertised in ICE candidates when the server sits
+	// behind a 1:1 NAT
+	PublicIPs []string
+}
+
+type ChatConfig struct {
+	SearchLanguage string // Postgres text search configuration, e.g. "english"
+}
+
 type FeatureConfig struct {
 	Chat          bool
 	Reactions     bool
@@ -92,6 +153,8 @@ type FeatureConfig struct {
 	Recording     bool
 	WaitingRoom   bool
 	BreakoutRooms bool
+	// MaxScreenShares is how many participants of a room may share at once
+	MaxScreenShares int
 }
 
 type DevelopmentConfig struct {
@@ -108,10 +171,13 @@ func Load() (*Config, error) {
 
 	config := &Config{
 		Server: ServerConfig{
-			Port:        getEnv("PORT", "8081"),
-			Environment: getEnv("ENV", "development"),
-			Debug:       getBoolEnv("DEBUG", true),
-			CORSOrigins: strings.Split(getEnv("CORS_ORIGINS", "http://localhost:3000,http://localhost:5173"), ","),
+			Port:           getEnv("PORT", "8081"),
+			Environment:    getEnv("ENV", "development"),
+			Debug:          getBoolEnv("DEBUG", true),
+			CORSOrigins:    strings.Split(getEnv("CORS_ORIGINS", "http://localhost:3000,http://localhost:5173"), ","),
+			PublicURL:      strings.TrimSuffix(getEnv("PUBLIC_URL", "http://localhost:"+getEnv("PORT", "8081")), "/"),
+			FrontendURL:    strings.TrimSuffix(getEnv("FRONTEND_URL", "http://localhost:3000"), "/"),
+			TrustedProxies: splitList(getEnv("TRUSTED_PROXIES", "")),
 		},
 		Database: DatabaseConfig{
 			Host:            getEnv("DB_HOST", "localhost"),
@@ -130,6 +196,10 @@ func Load() (*Config, error) {
 			RefreshTokenExpiry:  time.Duration(getIntEnv("JWT_REFRESH_EXPIRY_DAYS", 7)) * 24 * time.Hour,
 			PasswordResetExpiry: time.Duration(getIntEnv("PASSWORD_RESET_EXPIRY_HOURS", 1)) * time.Hour,
 			BCryptCost:          getIntEnv("BCRYPT_COST", 12),
+
+			PasswordResetMaxPerEmail: getIntEnv("PASSWORD_RESET_MAX_PER_EMAIL", 3),
+			PasswordResetMaxPerIP:    getIntEnv("PASSWORD_RESET_MAX_PER_IP", 10),
+			PasswordResetWindow:      time.Duration(getIntEnv("PASSWORD_RESET_WINDOW_MINUTES", 60)) * time.Minute,
 		},
 		Email: EmailConfig{
 			SMTPHost:     getEnv("SMTP_HOST", ""),
@@ -144,17 +214,31 @@ func Load() (*Config, error) {
 			TURNServerURL:  getEnv("TURN_SERVER_URL", ""),
 			TURNUsername:   getEnv("TURN_USERNAME", ""),
 			TURNCredential: getEnv("TURN_CREDENTIAL", ""),
+			TURNSecret:     getEnv("TURN_SECRET", ""),
+			TURNRealm:      getEnv("TURN_REALM", ""),
+
+			TURNCredentialTTL:  time.Duration(getIntEnv("TURN_CREDENTIAL_TTL_SECONDS", 3600)) * time.Second,
+			TURNSecretRotation: time.Duration(getIntEnv("TURN_SECRET_ROTATION_HOURS", 0)) * time.Hour,
 		},
 		Storage: StorageConfig{
-			Type:          getEnv("STORAGE_TYPE", "local"),
-			LocalPath:     getEnv("STORAGE_PATH", "./uploads"),
-			RecordingPath: getEnv("RECORDING_STORAGE_PATH", "./recordings"),
-			MaxSizeMB:     getIntEnv("UPLOAD_MAX_SIZE_MB", 100),
-			AllowedTypes:  strings.Split(getEnv("UPLOAD_ALLOWED_TYPES", "jpg,jpeg,png,gif,pdf,doc,docx"), ","),
-			AWSRegion:     getEnv("AWS_REGION", ""),
-			AWSBucket:     getEnv("AWS_S3_BUCKET", ""),
-			AWSAccessKey:  getEnv("AWS_ACCESS_KEY_ID", ""),
-			AWSSecretKey:  getEnv("AWS_SECRET_ACCESS_KEY", ""),
+			Type:            getEnv("STORAGE_TYPE", "local"),
+			LocalPath:       getEnv("STORAGE_PATH", "./uploads"),
+			RecordingPath:   getEnv("RECORDING_STORAGE_PATH", "./recordings"),
+			RecordingSpool:  getEnv("RECORDING_SPOOL_PATH", filepath.Join(os.TempDir(), "video-conference-recordings")),
+			MaxSizeMB:       getIntEnv("UPLOAD_MAX_SIZE_MB", 100),
+			AllowedTypes:    strings.Split(getEnv("UPLOAD_ALLOWED_TYPES", "jpg,jpeg,png,gif,pdf,doc,docx"), ","),
+			ClientQuotaMB:   getIntEnv("UPLOAD_CLIENT_QUOTA_MB", 1024),
+			AWSRegion:       getEnv("AWS_REGION", ""),
+			AWSBucket:       getEnv("AWS_S3_BUCKET", ""),
+			AWSAccessKey:    getEnv("AWS_ACCESS_KEY_ID", ""),
+			AWSSecretKey:    getEnv("AWS_SECRET_ACCESS_KEY", ""),
+			AWSEndpoint:     getEnv("AWS_S3_ENDPOINT", ""),
+			AWSUseSSL:       getBoolEnv("AWS_S3_USE_SSL", true),
+			SignedURLExpiry: time.Duration(getIntEnv("RECORDING_URL_EXPIRY_MINUTES", 60)) * time.Minute,
+
+			RecordingPasswordMaxPerRecording: getIntEnv("RECORDING_PASSWORD_MAX_PER_RECORDING", 5),
+			RecordingPasswordMaxPerIP:        getIntEnv("RECORDING_PASSWORD_MAX_PER_IP", 20),
+			RecordingPasswordWindow:          time.Duration(getIntEnv("RECORDING_PASSWORD_WINDOW_MINUTES", 15)) * time.Minute,
 		},
 		Redis: RedisConfig{
 			URL:        getEnv("REDIS_URL", "redis://localhost:6379"),
@@ -162,13 +246,29 @@ func Load() (*Config, error) {
 			DB:         getIntEnv("REDIS_DB", 0),
 			MaxRetries: getIntEnv("REDIS_MAX_RETRIES", 3),
 		},
+		Signaling: SignalingConfig{
+			Backplane:   getEnv("SIGNALING_BACKPLANE", "memory"),
+			NodeID:      getEnv("SIGNALING_NODE_ID", ""),
+			PresenceTTL: time.Duration(getIntEnv("SIGNALING_PRESENCE_TTL_SECONDS", 30)) * time.Second,
+		},
+		SFU: SFUConfig{
+			Enabled:   getBoolEnv("SFU_ENABLED", true),
+			MeshLimit: getIntEnv("SFU_MESH_LIMIT", 4),
+			PortMin:   getIntEnv("SFU_UDP_PORT_MIN", 0),
+			PortMax:   getIntEnv("SFU_UDP_PORT_MAX", 0),
+			PublicIPs: strings.Split(getEnv("SFU_PUBLIC_IPS", ""), ","),
+		},
+		Chat: ChatConfig{
+			SearchLanguage: getEnv("CHAT_SEARCH_LANGUAGE", "english"),
+		},
 		Features: FeatureConfig{
-			Chat:          getBoolEnv("FEATURE_CHAT", true),
-			Reactions:     getBoolEnv("FEATURE_REACTIONS", true),
-			ScreenSharing: getBoolEnv("FEATURE_SCREEN_SHARING", true),
-			Recording:     getBoolEnv("FEATURE_RECORDING", true),
-			WaitingRoom:   getBoolEnv("FEATURE_WAITING_ROOM", true),
-			BreakoutRooms: getBoolEnv("FEATURE_BREAKOUT_ROOMS", false),
+			Chat:            getBoolEnv("FEATURE_CHAT", true),
+			Reactions:       getBoolEnv("FEATURE_REACTIONS", true),
+			ScreenSharing:   getBoolEnv("FEATURE_SCREEN_SHARING", true),
+			Recording:       getBoolEnv("FEATURE_RECORDING", true),
+			WaitingRoom:     getBoolEnv("FEATURE_WAITING_ROOM", true),
+			BreakoutRooms:   getBoolEnv("FEATURE_BREAKOUT_ROOMS", false),
+			MaxScreenShares: getIntEnv("MAX_SCREEN_SHARES", 1),
 		},
 		Development: DevelopmentConfig{
 			AutoMigrate: getBoolEnv("DEV_AUTO_MIGRATE", true),
@@ -225,4 +325,15 @@ func getBoolEnv(key string, defaultValue bool) bool {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// splitList splits a comma separated list, leaving out empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
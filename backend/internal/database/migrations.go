@@ -30,6 +30,25 @@ func runMigrationsFromCode(db *DB) error {
 		{Version: 11, Description: "Create password_reset_tokens table", SQL: createPasswordResetTokensTable},
 		{Version: 12, Description: "Insert default client", SQL: insertDefaultClient},
 		{Version: 13, Description: "Add missing columns to invitations table", SQL: updateInvitationsTable},
+		{Version: 14, Description: "Add lobby statuses and missing columns to meeting_participants table", SQL: updateMeetingParticipantsForLobby},
+		{Version: 15, Description: "Create client_features table", SQL: createClientFeaturesTable},
+		{Version: 16, Description: "Add meeting lock, participant bans and meeting_audit_events table", SQL: createMeetingModeration},
+		{Version: 17, Description: "Add recurrence columns to meetings table", SQL: addMeetingRecurrence},
+		{Version: 18, Description: "Align recordings table with the recording model", SQL: updateRecordingsTable},
+		{Version: 19, Description: "Align chat_messages table with the chat message model", SQL: updateChatMessagesTable},
+		{Version: 20, Description: "Add private message recipients to chat_messages table", SQL: addChatMessageRecipients},
+		{Version: 21, Description: "Add full-text search to chat_messages table", SQL: addChatMessageSearch},
+		{Version: 22, Description: "Create chat_moderation_policies table", SQL: createChatModerationPoliciesTable},
+		{Version: 23, Description: "Create meeting_engagement_events table", SQL: createMeetingEngagementEventsTable},
+		{Version: 24, Description: "Create breakout room tables and scope chat to breakout rooms", SQL: createBreakoutRooms},
+		{Version: 25, Description: "Create turn_secret table", SQL: createTURNSecretTable},
+		{Version: 26, Description: "Add session columns to refresh_tokens table and create revoked_tokens table", SQL: addSessions},
+		{Version: 27, Description: "Hash password_reset_tokens and create password_reset_requests table", SQL: updatePasswordResets},
+		{Version: 28, Description: "Create user_mfa and user_recovery_codes tables and add require_mfa to clients table", SQL: createUserMFA},
+		{Version: 29, Description: "Create client_sso_configs, oidc_auth_requests and user_identities tables", SQL: createSSO},
+		{Version: 30, Description: "Enable waiting rooms for new clients by default", SQL: enableWaitingRooms},
+		{Version: 31, Description: "Create client_sso_domains table", SQL: createSSODomains},
+		{Version: 32, Description: "Create recording_password_attempts table", SQL: createRecordingPasswordAttempts},
 	}
 
 	// Execute migrations
@@ -388,3 +407,401 @@ CREATE INDEX IF NOT EXISTS idx_invitations_user_id ON invitations(user_id);
 CREATE INDEX IF NOT EXISTS idx_invitations_group_id ON invitations(group_id);
 `
 
+const updateMeetingParticipantsForLobby = `
+-- Columns the participant model expects
+ALTER TABLE meeting_participants
+ADD COLUMN IF NOT EXISTS guest_name VARCHAR(255),
+ADD COLUMN IF NOT EXISTS invited_by INTEGER REFERENCES users(id),
+ADD COLUMN IF NOT EXISTS invited_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+-- Waiting room decisions
+ALTER TABLE meeting_participants DROP CONSTRAINT IF EXISTS meeting_participants_status_check;
+ALTER TABLE meeting_participants
+ADD CONSTRAINT meeting_participants_status_check CHECK (status IN ('invited', 'accepted', 'declined', 'joined', 'left', 'waiting', 'admitted', 'denied'));
+`
+
+const createClientFeaturesTable = `
+CREATE TABLE IF NOT EXISTS client_features (
+	id SERIAL PRIMARY KEY,
+	client_id INTEGER NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+	chat_enabled BOOLEAN NOT NULL DEFAULT true,
+	reactions_enabled BOOLEAN NOT NULL DEFAULT true,
+	screen_sharing_enabled BOOLEAN NOT NULL DEFAULT true,
+	recording_enabled BOOLEAN NOT NULL DEFAULT false,
+	raise_hand_enabled BOOLEAN NOT NULL DEFAULT true,
+	waiting_room_enabled BOOLEAN NOT NULL DEFAULT false,
+	max_participants INTEGER NOT NULL DEFAULT 100,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_client_features_client_id ON client_features(client_id);
+
+-- Existing clients get the same defaults as newly created ones
+INSERT INTO client_features (client_id)
+SELECT id FROM clients c
+WHERE NOT EXISTS (SELECT 1 FROM client_features f WHERE f.client_id = c.id);
+`
+
+const createMeetingModeration = `
+ALTER TABLE meetings ADD COLUMN IF NOT EXISTS is_locked BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE meeting_participants DROP CONSTRAINT IF EXISTS meeting_participants_status_check;
+ALTER TABLE meeting_participants
+ADD CONSTRAINT meeting_participants_status_check CHECK (status IN ('invited', 'accepted', 'declined', 'joined', 'left', 'waiting', 'admitted', 'denied', 'banned'));
+
+CREATE TABLE IF NOT EXISTS meeting_audit_events (
+	id SERIAL PRIMARY KEY,
+	meeting_id INTEGER NOT NULL REFERENCES meetings(id) ON DELETE CASCADE,
+	actor_user_id INTEGER REFERENCES users(id),
+	actor_id VARCHAR(255) NOT NULL,
+	action VARCHAR(50) NOT NULL,
+	target_id VARCHAR(255),
+	details JSONB DEFAULT '{}',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_meeting_audit_events_meeting_id ON meeting_audit_events(meeting_id);
+`
+
+const addMeetingRecurrence = `
+ALTER TABLE meetings
+ADD COLUMN IF NOT EXISTS parent_meeting_id INTEGER REFERENCES meetings(id) ON DELETE CASCADE,
+ADD COLUMN IF NOT EXISTS recurrence_rule TEXT,
+ADD COLUMN IF NOT EXISTS recurrence_timezone VARCHAR(64),
+ADD COLUMN IF NOT EXISTS recurrence_exdates TEXT,
+ADD COLUMN IF NOT EXISTS recurrence_id TIMESTAMP WITH TIME ZONE;
+
+-- One materialized meeting per occurrence of a series
+CREATE UNIQUE INDEX IF NOT EXISTS idx_meetings_parent_recurrence ON meetings(parent_meeting_id, recurrence_id);
+`
+
+const updateRecordingsTable = `
+-- Columns the recording model expects
+ALTER TABLE recordings RENAME COLUMN started_by_user_id TO started_by;
+ALTER TABLE recordings RENAME COLUMN duration_seconds TO duration;
+ALTER TABLE recordings DROP COLUMN IF EXISTS file_name;
+ALTER TABLE recordings ALTER COLUMN file_size TYPE BIGINT;
+ALTER TABLE recordings ALTER COLUMN format SET DEFAULT 'webm';
+
+ALTER TABLE recordings
+ADD COLUMN IF NOT EXISTS client_id INTEGER REFERENCES clients(id) ON DELETE CASCADE,
+ADD COLUMN IF NOT EXISTS title VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS description TEXT,
+ADD COLUMN IF NOT EXISTS streaming_url TEXT,
+ADD COLUMN IF NOT EXISTS metadata JSONB DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS settings JSONB DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS stopped_by INTEGER REFERENCES users(id),
+ADD COLUMN IF NOT EXISTS is_public BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN IF NOT EXISTS password VARCHAR(255);
+
+-- Recording lifecycle
+ALTER TABLE recordings DROP CONSTRAINT IF EXISTS recordings_status_check;
+ALTER TABLE recordings
+ADD CONSTRAINT recordings_status_check CHECK (status IN ('pending', 'recording', 'processing', 'completed', 'failed', 'archived'));
+
+CREATE INDEX IF NOT EXISTS idx_recordings_client_id ON recordings(client_id);
+`
+
+const updateChatMessagesTable = `
+-- Columns the chat message model expects
+ALTER TABLE chat_messages RENAME COLUMN sender_user_id TO sender_id;
+ALTER TABLE chat_messages RENAME COLUMN content TO message;
+
+ALTER TABLE chat_messages
+ADD COLUMN IF NOT EXISTS client_id INTEGER REFERENCES clients(id) ON DELETE CASCADE,
+ADD COLUMN IF NOT EXISTS metadata JSONB DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS is_moderated BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN IF NOT EXISTS moderated_by INTEGER REFERENCES users(id),
+ADD COLUMN IF NOT EXISTS moderated_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS reply_to_id INTEGER REFERENCES chat_messages(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS attachments JSONB,
+ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE chat_messages c SET client_id = m.client_id FROM meetings m WHERE m.id = c.meeting_id AND c.client_id IS NULL;
+
+-- File columns become attachments
+UPDATE chat_messages
+SET attachments = jsonb_build_object('files', jsonb_build_array(
+	jsonb_build_object('url', file_url, 'name', file_name, 'size', file_size)))
+WHERE file_url IS NOT NULL;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS file_url;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS file_name;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS file_size;
+
+UPDATE chat_messages SET is_private = false WHERE is_private IS NULL;
+ALTER TABLE chat_messages ALTER COLUMN is_private SET NOT NULL;
+UPDATE chat_messages SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+ALTER TABLE chat_messages ALTER COLUMN created_at SET NOT NULL;
+
+ALTER TABLE chat_messages DROP CONSTRAINT IF EXISTS chat_messages_message_type_check;
+ALTER TABLE chat_messages
+ADD CONSTRAINT chat_messages_message_type_check CHECK (message_type IN ('text', 'file', 'image', 'emoji', 'system'));
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_client_id ON chat_messages(client_id);
+CREATE INDEX IF NOT EXISTS idx_chat_messages_reply_to_id ON chat_messages(reply_to_id);
+`
+
+const addChatMessageRecipients = `
+-- Signaling ID of a private message's recipient; guests have no users row.
+-- Private messages without a recipient go to the meeting's hosts.
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS recipient_id VARCHAR(255);
+
+UPDATE chat_messages SET recipient_id = recipient_user_id::text
+WHERE recipient_user_id IS NOT NULL AND recipient_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_recipient_id ON chat_messages(recipient_id);
+`
+
+const addChatMessageSearch = `
+-- Text search configuration each message is stemmed with
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS search_language REGCONFIG NOT NULL DEFAULT 'english';
+
+-- Message text outranks sender names, which are never stemmed
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+GENERATED ALWAYS AS (
+	setweight(to_tsvector(search_language, coalesce(message, '')), 'A') ||
+	setweight(to_tsvector('simple', coalesce(sender_name, '')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_search_vector ON chat_messages USING GIN(search_vector);
+CREATE INDEX IF NOT EXISTS idx_chat_messages_client_created ON chat_messages(client_id, created_at DESC);
+`
+
+const createChatModerationPoliciesTable = `
+CREATE TABLE IF NOT EXISTS chat_moderation_policies (
+	client_id INTEGER PRIMARY KEY REFERENCES clients(id) ON DELETE CASCADE,
+	enabled BOOLEAN NOT NULL DEFAULT true,
+	blocked_words TEXT[] NOT NULL DEFAULT '{}',
+	blocked_patterns TEXT[] NOT NULL DEFAULT '{}',
+	block_links BOOLEAN NOT NULL DEFAULT false,
+	allowed_domains TEXT[] NOT NULL DEFAULT '{}',
+	flood_messages INTEGER NOT NULL DEFAULT 0 CHECK (flood_messages >= 0),
+	flood_window_seconds INTEGER NOT NULL DEFAULT 0 CHECK (flood_window_seconds >= 0),
+	slow_mode_seconds INTEGER NOT NULL DEFAULT 0 CHECK (slow_mode_seconds >= 0),
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Flood limits and slow mode count a sender's recent messages
+CREATE INDEX IF NOT EXISTS idx_chat_messages_meeting_created ON chat_messages(meeting_id, created_at DESC);
+`
+
+const createMeetingEngagementEventsTable = `
+CREATE TABLE IF NOT EXISTS meeting_engagement_events (
+	id BIGSERIAL PRIMARY KEY,
+	meeting_id INTEGER NOT NULL REFERENCES meetings(id) ON DELETE CASCADE,
+	actor_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	actor_id VARCHAR(255) NOT NULL,
+	actor_name VARCHAR(255) NOT NULL DEFAULT '',
+	event_type VARCHAR(20) NOT NULL CHECK (event_type IN ('reaction', 'hand_raised', 'hand_lowered')),
+	value VARCHAR(32),
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_meeting_engagement_events_meeting ON meeting_engagement_events(meeting_id, created_at);
+`
+
+const createBreakoutRooms = `
+CREATE TABLE IF NOT EXISTS breakout_sessions (
+	id SERIAL PRIMARY KEY,
+	meeting_id INTEGER NOT NULL REFERENCES meetings(id) ON DELETE CASCADE,
+	mode VARCHAR(20) NOT NULL CHECK (mode IN ('manual', 'automatic', 'self_select')),
+	allow_return BOOLEAN NOT NULL DEFAULT true,
+	started_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	ends_at TIMESTAMP WITH TIME ZONE,
+	closed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- A meeting has at most one open session
+CREATE UNIQUE INDEX IF NOT EXISTS idx_breakout_sessions_open ON breakout_sessions(meeting_id) WHERE closed_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS breakout_rooms (
+	id SERIAL PRIMARY KEY,
+	session_id INTEGER NOT NULL REFERENCES breakout_sessions(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	position INTEGER NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (session_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS breakout_assignments (
+	session_id INTEGER NOT NULL REFERENCES breakout_sessions(id) ON DELETE CASCADE,
+	participant_id VARCHAR(255) NOT NULL,
+	breakout_room_id INTEGER NOT NULL REFERENCES breakout_rooms(id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	assigned_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (session_id, participant_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_breakout_assignments_room ON breakout_assignments(breakout_room_id);
+
+-- Messages sent in a breakout room stay in its chat
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS breakout_room_id INTEGER REFERENCES breakout_rooms(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_chat_messages_breakout_room_id ON chat_messages(breakout_room_id) WHERE breakout_room_id IS NOT NULL;
+`
+
+// turn_secret has the layout coturn reads with use-auth-secret, so coturn
+// accepts credentials signed with any secret still in the table
+const createTURNSecretTable = `
+CREATE TABLE IF NOT EXISTS turn_secret (
+	realm VARCHAR(127) NOT NULL DEFAULT '',
+	value VARCHAR(256) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	retired_at TIMESTAMP WITH TIME ZONE,
+	PRIMARY KEY (realm, value)
+);
+`
+
+const addSessions = `
+ALTER TABLE refresh_tokens
+ADD COLUMN IF NOT EXISTS user_agent TEXT,
+ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45),
+ADD COLUMN IF NOT EXISTS access_token_id VARCHAR(64),
+ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_access_token_id ON refresh_tokens(access_token_id);
+
+-- Access tokens revoked before they expire, by jti
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti VARCHAR(64) PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	revoked_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+`
+
+const updatePasswordResets = `
+-- Reset tokens are kept as SHA-256 hashes; links sent before cannot be redeemed
+DELETE FROM password_reset_tokens;
+ALTER TABLE password_reset_tokens RENAME COLUMN token TO token_hash;
+ALTER INDEX IF EXISTS idx_password_reset_tokens_token RENAME TO idx_password_reset_tokens_token_hash;
+
+-- Reset requests, including those for unknown emails, for throttling
+CREATE TABLE IF NOT EXISTS password_reset_requests (
+	id SERIAL PRIMARY KEY,
+	email VARCHAR(255) NOT NULL,
+	ip_address VARCHAR(45),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_requests_email ON password_reset_requests(email, created_at);
+CREATE INDEX IF NOT EXISTS idx_password_reset_requests_ip_address ON password_reset_requests(ip_address, created_at);
+`
+
+const createUserMFA = `
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS require_mfa BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- TOTP secrets, pending until enabled_at is set by a first valid code
+CREATE TABLE IF NOT EXISTS user_mfa (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret VARCHAR(64) NOT NULL,
+	enabled_at TIMESTAMP WITH TIME ZONE,
+	last_used_step BIGINT,
+	failed_attempts INTEGER NOT NULL DEFAULT 0,
+	last_failed_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash VARCHAR(64) NOT NULL,
+	used_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, code_hash)
+);
+`
+
+const createSSO = `
+-- A client's OpenID Connect identity provider
+CREATE TABLE IF NOT EXISTS client_sso_configs (
+	client_id INTEGER PRIMARY KEY REFERENCES clients(id) ON DELETE CASCADE,
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	issuer VARCHAR(500) NOT NULL,
+	oidc_client_id VARCHAR(255) NOT NULL,
+	oidc_client_secret VARCHAR(500),
+	allowed_domains TEXT[] NOT NULL DEFAULT '{}',
+	scopes TEXT[] NOT NULL DEFAULT '{openid,email,profile}',
+	role_claim VARCHAR(100),
+	role_mapping JSONB NOT NULL DEFAULT '{}',
+	default_role VARCHAR(50) NOT NULL DEFAULT 'user' CHECK (default_role IN ('user', 'admin')),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_client_sso_configs_allowed_domains ON client_sso_configs USING GIN (allowed_domains);
+
+-- Pending sign-ins, by a hash of their state, until the provider redirects back
+CREATE TABLE IF NOT EXISTS oidc_auth_requests (
+	state_hash VARCHAR(64) PRIMARY KEY,
+	client_id INTEGER NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+	nonce VARCHAR(100) NOT NULL,
+	code_verifier VARCHAR(100) NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_auth_requests_expires_at ON oidc_auth_requests(expires_at);
+
+-- Users signed in through a provider, by the provider's subject. Providers
+-- serving several clients may sign the same subject in to each.
+CREATE TABLE IF NOT EXISTS user_identities (
+	client_id INTEGER NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+	issuer VARCHAR(500) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	email VARCHAR(255),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	last_login_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (client_id, issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+`
+
+// New clients get waiting rooms; existing clients keep the setting they have
+const enableWaitingRooms = `
+ALTER TABLE client_features ALTER COLUMN waiting_room_enabled SET DEFAULT TRUE;
+`
+
+// Domains configured before verification existed start unverified, so they
+// stop routing sign-ins until they are verified
+const createSSODomains = `
+-- Domains a client claims for single sign-on. A domain routes sign-ins to
+-- the client once it is verified, by a DNS TXT record holding the
+-- verification token or by a platform admin.
+CREATE TABLE IF NOT EXISTS client_sso_domains (
+	client_id INTEGER NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+	domain VARCHAR(255) NOT NULL,
+	verification_token VARCHAR(100) NOT NULL,
+	verified_at TIMESTAMP WITH TIME ZONE,
+	verified_by INTEGER REFERENCES users(id) ON DELETE SET NULL, -- approving admin, NULL for DNS
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (client_id, domain)
+);
+
+-- A domain is verified for one client at most
+CREATE UNIQUE INDEX IF NOT EXISTS idx_client_sso_domains_verified ON client_sso_domains(domain) WHERE verified_at IS NOT NULL;
+
+INSERT INTO client_sso_domains (client_id, domain, verification_token)
+SELECT client_id, domain, md5(random()::text || clock_timestamp()::text || domain)
+FROM client_sso_configs, UNNEST(allowed_domains) AS domain
+ON CONFLICT DO NOTHING;
+`
+
+const createRecordingPasswordAttempts = `
+-- Wrong recording passwords, for throttling guesses
+CREATE TABLE IF NOT EXISTS recording_password_attempts (
+	id SERIAL PRIMARY KEY,
+	recording_id INTEGER NOT NULL REFERENCES recordings(id) ON DELETE CASCADE,
+	ip_address VARCHAR(45),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recording_password_attempts_recording_id ON recording_password_attempts(recording_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_recording_password_attempts_ip_address ON recording_password_attempts(ip_address, created_at);
+`
@@ -3,11 +3,14 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // JSONB is a custom type for PostgreSQL JSONB fields
@@ -36,6 +39,50 @@ func (j *JSONB) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, j)
 }
 
+// TimeList is a list of instants stored as comma-separated RFC 3339 text
+type TimeList []time.Time
+
+// Value implements the driver.Valuer interface
+func (l TimeList) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return nil, nil
+	}
+	parts := make([]string, len(l))
+	for i, t := range l {
+		parts[i] = t.UTC().Format(time.RFC3339)
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (l *TimeList) Scan(value interface{}) error {
+	*l = nil
+
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return nil
+	}
+
+	for _, part := range strings.Split(text, ",") {
+		if part == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, part)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, t)
+	}
+	return nil
+}
+
 // Client represents an organizational account
 type Client struct {
 	ID           int       `json:"id" db:"id"`
@@ -44,10 +91,50 @@ type Client struct {
 	LogoURL      *string   `json:"logo_url" db:"logo_url"`
 	Theme        string    `json:"theme" db:"theme"`
 	PrimaryColor string    `json:"primary_color" db:"primary_color"`
+	RequireMFA   bool      `json:"require_mfa" db:"require_mfa"` // users must sign in with a second factor
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// SSOConfig is a client's OpenID Connect identity provider. Users with an
+// email in one of its verified Domains sign in through it and are created on their
+// first login, with the role RoleMapping gives the values of their RoleClaim.
+type SSOConfig struct {
+	ClientID         int            `json:"client_id" db:"client_id"`
+	Enabled          bool           `json:"enabled" db:"enabled"`
+	Issuer           string         `json:"issuer" db:"issuer"`
+	OIDCClientID     string         `json:"oidc_client_id" db:"oidc_client_id"`
+	OIDCClientSecret *string        `json:"oidc_client_secret,omitempty" db:"oidc_client_secret"` // write only
+	HasClientSecret  bool           `json:"has_client_secret" db:"-"`
+	AllowedDomains   pq.StringArray `json:"allowed_domains" db:"allowed_domains"`
+	Scopes           pq.StringArray `json:"scopes" db:"scopes"`
+	RoleClaim        *string        `json:"role_claim" db:"role_claim"`     // e.g. "groups" or "roles"
+	RoleMapping      JSONB          `json:"role_mapping" db:"role_mapping"` // claim value to "user" or "admin"
+	DefaultRole      string         `json:"default_role" db:"default_role"`
+	Domains          []*SSODomain   `json:"domains" db:"-"`
+	CreatedAt        time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// SSODomain is one of a client's AllowedDomains. Sign-ins are only routed by
+// a domain, and users of it only signed in, once it is verified: by a TXT
+// record named VerificationName holding VerificationValue, or by a platform
+// admin's approval.
+type SSODomain struct {
+	ClientID          int        `json:"client_id" db:"client_id"`
+	Domain            string     `json:"domain" db:"domain"`
+	VerificationToken string     `json:"-" db:"verification_token"`
+	VerificationName  string     `json:"verification_name" db:"-"`
+	VerificationValue string     `json:"verification_value" db:"-"`
+	VerifiedAt        *time.Time `json:"verified_at" db:"verified_at"`
+	VerifiedBy        *int       `json:"verified_by,omitempty" db:"verified_by"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+}
+
+func (d *SSODomain) IsVerified() bool {
+	return d.VerifiedAt != nil
+}
+
 // ClientFeatures represents per-client feature toggles
 type ClientFeatures struct {
 	ID                    int       `json:"id" db:"id"`
@@ -123,10 +210,73 @@ type Meeting struct {
 	EnableScreenSharing    bool       `json:"enable_screen_sharing" db:"enable_screen_sharing"`
 	EnableRecording        bool       `json:"enable_recording" db:"enable_recording"`
 	Settings               JSONB      `json:"settings" db:"settings"`
+	IsLocked               bool       `json:"is_locked" db:"is_locked"`
+	// Recurrence: a series is a meeting with a RecurrenceRule; its occurrences
+	// are materialized as meetings pointing back at it through ParentMeetingID
+	ParentMeetingID        *int       `json:"parent_meeting_id,omitempty" db:"parent_meeting_id"`
+	RecurrenceRule         *string    `json:"recurrence_rule,omitempty" db:"recurrence_rule"` // RFC 5545 RRULE value
+	RecurrenceTimezone     *string    `json:"recurrence_timezone,omitempty" db:"recurrence_timezone"` // IANA zone the rule is expanded in
+	RecurrenceExDates      TimeList   `json:"recurrence_exdates,omitempty" db:"recurrence_exdates"`
+	RecurrenceID           *time.Time `json:"recurrence_id,omitempty" db:"recurrence_id"` // original start of an occurrence
 	CreatedAt              time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt              time.Time  `json:"updated_at" db:"updated_at"`
 }
 
+// MeetingAuditEvent records a moderation action taken during a meeting
+type MeetingAuditEvent struct {
+	ID          int       `json:"id" db:"id"`
+	MeetingID   int       `json:"meeting_id" db:"meeting_id"`
+	ActorUserID *int      `json:"actor_user_id" db:"actor_user_id"` // nil for guests
+	ActorID     string    `json:"actor_id" db:"actor_id"`           // signaling user ID of the actor
+	Action      string    `json:"action" db:"action"`
+	TargetID    *string   `json:"target_id" db:"target_id"`
+	Details     JSONB     `json:"details" db:"details"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// MeetingEngagementEvent records a reaction or raised hand during a meeting
+type MeetingEngagementEvent struct {
+	ID          int       `json:"id" db:"id"`
+	MeetingID   int       `json:"meeting_id" db:"meeting_id"`
+	ActorUserID *int      `json:"actor_user_id" db:"actor_user_id"` // nil for guests
+	ActorID     string    `json:"actor_id" db:"actor_id"`           // signaling user ID of the actor
+	ActorName   string    `json:"actor_name" db:"actor_name"`
+	EventType   string    `json:"event_type" db:"event_type"`
+	Value       *string   `json:"value" db:"value"` // the emoji of a reaction
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// BreakoutSession splits a live meeting into breakout rooms until it is
+// closed, by a host or when EndsAt passes
+type BreakoutSession struct {
+	ID              int        `json:"id" db:"id"`
+	MeetingID       int        `json:"meeting_id" db:"meeting_id"`
+	Mode            string     `json:"mode" db:"mode"`
+	AllowReturn     bool       `json:"allow_return" db:"allow_return"` // participants may go back to the main room
+	StartedByUserID *int       `json:"started_by_user_id" db:"started_by_user_id"`
+	StartedAt       time.Time  `json:"started_at" db:"started_at"`
+	EndsAt          *time.Time `json:"ends_at" db:"ends_at"`
+	ClosedAt        *time.Time `json:"closed_at" db:"closed_at"`
+}
+
+// BreakoutRoom is one of the rooms of a breakout session
+type BreakoutRoom struct {
+	ID        int       `json:"id" db:"id"`
+	SessionID int       `json:"session_id" db:"session_id"`
+	Name      string    `json:"name" db:"name"`
+	Position  int       `json:"position" db:"position"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// BreakoutAssignment places a participant in a breakout room
+type BreakoutAssignment struct {
+	SessionID      int       `json:"session_id" db:"session_id"`
+	ParticipantID  string    `json:"participant_id" db:"participant_id"` // signaling user ID
+	BreakoutRoomID int       `json:"breakout_room_id" db:"breakout_room_id"`
+	UserID         *int      `json:"user_id" db:"user_id"` // nil for guests
+	AssignedAt     time.Time `json:"assigned_at" db:"assigned_at"`
+}
+
 // Invitation represents an invitation to a meeting
 type Invitation struct {
 	ID              int       `json:"id" db:"id"`
@@ -182,10 +332,59 @@ type ChatMessage struct {
 	ModeratedAt  *time.Time `json:"moderated_at" db:"moderated_at"`
 	ReplyToID    *int      `json:"reply_to_id" db:"reply_to_id"`
 	Attachments  JSONB     `json:"attachments" db:"attachments"`
+	// Private messages go to RecipientID only, or to the meeting's hosts
+	// and co-hosts when it is nil
+	IsPrivate    bool      `json:"is_private" db:"is_private"`
+	RecipientID  *string   `json:"recipient_id,omitempty" db:"recipient_id"` // signaling ID (user ID, or guest_<invitation>)
+	RecipientUserID *int   `json:"recipient_user_id,omitempty" db:"recipient_user_id"`
+	// Full-text search: the text search configuration the message is
+	// stemmed with, and the vector Postgres generates from it
+	SearchLanguage string  `json:"search_language" db:"search_language"`
+	SearchVector   string  `json:"-" db:"search_vector"`
+	// BreakoutRoomID scopes a message to a breakout room's chat; nil is the
+	// main room's
+	BreakoutRoomID *int    `json:"breakout_room_id,omitempty" db:"breakout_room_id"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Chat message metadata keys
+const (
+	// ChatMetaSenderID holds the signaling ID of a message's sender, which
+	// guests have no account for
+	ChatMetaSenderID = "sender_wire_id"
+	// ChatMetaEdited marks a message its sender has edited
+	ChatMetaEdited = "edited"
+	// ChatMetaModerationReason says why a moderated message was hidden
+	ChatMetaModerationReason = "moderation_reason"
+)
+
+// Reasons a chat message was hidden
+const (
+	ModerationReasonManual      = "manual"
+	ModerationReasonBlockedWord = "blocked_word"
+	ModerationReasonPattern     = "blocked_pattern"
+	ModerationReasonLink        = "link"
+)
+
+// ChatModerationPolicy is how a client's meeting chat is moderated
+// automatically. Messages with blocked words, patterns or links are hidden
+// until a host reviews them; senders over the flood limit or inside slow mode
+// are refused. Hosts and co-hosts are exempt.
+type ChatModerationPolicy struct {
+	ClientID           int            `json:"client_id" db:"client_id"`
+	Enabled            bool           `json:"enabled" db:"enabled"`
+	BlockedWords       pq.StringArray `json:"blocked_words" db:"blocked_words"`         // whole words, case insensitive
+	BlockedPatterns    pq.StringArray `json:"blocked_patterns" db:"blocked_patterns"`   // regular expressions
+	BlockLinks         bool           `json:"block_links" db:"block_links"`
+	AllowedDomains     pq.StringArray `json:"allowed_domains" db:"allowed_domains"`     // links still allowed, with their subdomains
+	FloodMessages      int            `json:"flood_messages" db:"flood_messages"`       // per sender per window; 0 is unlimited
+	FloodWindowSeconds int            `json:"flood_window_seconds" db:"flood_window_seconds"`
+	SlowModeSeconds    int            `json:"slow_mode_seconds" db:"slow_mode_seconds"` // between a sender's messages; 0 is off
+	CreatedAt          time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at" db:"updated_at"`
+}
+
 // Recording represents a meeting recording
 type Recording struct {
 	ID           int       `json:"id" db:"id"`
@@ -198,7 +397,8 @@ type Recording struct {
 	EndedAt      *time.Time `json:"ended_at" db:"ended_at"`
 	Duration     *int      `json:"duration" db:"duration"` // in seconds
 	FileSize     *int64    `json:"file_size" db:"file_size"` // in bytes
-	FilePath     *string   `json:"file_path" db:"file_path"`
+	FilePath     *string   `json:"file_path" db:"file_path"` // storage key prefix of the recorded tracks
+	Format       string    `json:"format" db:"format"`
 	DownloadURL  *string   `json:"download_url" db:"download_url"`
 	StreamingURL *string   `json:"streaming_url" db:"streaming_url"`
 	Metadata     JSONB     `json:"metadata" db:"metadata"`
@@ -206,12 +406,24 @@ type Recording struct {
 	StartedBy    int       `json:"started_by" db:"started_by"`
 	StoppedBy    *int      `json:"stopped_by" db:"stopped_by"`
 	IsPublic     bool      `json:"is_public" db:"is_public"`
-	Password     *string   `json:"password,omitempty" db:"password"`
+	Password     *string   `json:"-" db:"password"` // bcrypt hash
 	ExpiresAt    *time.Time `json:"expires_at" db:"expires_at"`
+	ProcessedAt  *time.Time `json:"processed_at" db:"processed_at"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// RecordingTrack is one media track of a recording, written to its own file
+// in the recording's directory
+type RecordingTrack struct {
+	ParticipantID string  `json:"participant_id"`
+	Kind          string  `json:"kind"` // audio or video
+	Codec         string  `json:"codec"`
+	File          string  `json:"file"`
+	Duration      float64 `json:"duration"` // in seconds
+	Size          int64   `json:"size"`     // in bytes
+}
+
 // MeetingParticipant represents a participant in a meeting
 type MeetingParticipant struct {
 	ID        int       `json:"id" db:"id"`
@@ -220,7 +432,7 @@ type MeetingParticipant struct {
 	Email     *string   `json:"email" db:"email"`
 	GuestName *string   `json:"guest_name" db:"guest_name"`
 	Role      string    `json:"role" db:"role"` // host, co_host, presenter, attendee
-	Status    string    `json:"status" db:"status"` // invited, accepted, declined, joined, left
+	Status    string    `json:"status" db:"status"` // invited, accepted, declined, joined, left, waiting, admitted, denied, banned
 	JoinedAt  *time.Time `json:"joined_at" db:"joined_at"`
 	LeftAt    *time.Time `json:"left_at" db:"left_at"`
 	InvitedBy *int      `json:"invited_by" db:"invited_by"`
@@ -242,6 +454,21 @@ const (
 	MeetingStatusCancelled = "cancelled"
 )
 
+// Recurrence edit scopes
+const (
+	RecurrenceScopeThis      = "this"      // this occurrence only
+	RecurrenceScopeFollowing = "following" // this and following occurrences
+)
+
+// Recording status constants
+const (
+	RecordingStatusRecording  = "recording"
+	RecordingStatusProcessing = "processing"
+	RecordingStatusCompleted  = "completed"
+	RecordingStatusFailed     = "failed"
+	RecordingStatusArchived   = "archived"
+)
+
 // Invitation status constants
 const (
 	InvitationStatusPending   = "pending"
@@ -259,6 +486,42 @@ const (
 	ParticipantStatusDeclined = "declined"
 	ParticipantStatusJoined   = "joined"
 	ParticipantStatusLeft     = "left"
+	ParticipantStatusWaiting  = "waiting"
+	ParticipantStatusAdmitted = "admitted"
+	ParticipantStatusDenied   = "denied"
+	ParticipantStatusBanned   = "banned"
+)
+
+// Meeting audit actions
+const (
+	AuditActionMute          = "mute"
+	AuditActionDisableCamera = "disable_camera"
+	AuditActionRemove        = "remove"
+	AuditActionBan           = "ban"
+	AuditActionLock          = "lock"
+	AuditActionUnlock        = "unlock"
+	AuditActionEndMeeting    = "end_meeting"
+	AuditActionDeleteMessage = "delete_message"
+	AuditActionApproveMessage = "approve_message"
+	AuditActionOpenBreakouts  = "open_breakouts"
+	AuditActionCloseBreakouts = "close_breakouts"
+	AuditActionStopScreenShare = "stop_screen_share"
+	AuditActionGrantPresenter  = "grant_presenter"
+	AuditActionRevokePresenter = "revoke_presenter"
+)
+
+// Meeting engagement event types
+const (
+	EngagementReaction    = "reaction"
+	EngagementHandRaised  = "hand_raised"
+	EngagementHandLowered = "hand_lowered"
+)
+
+// Breakout assignment modes
+const (
+	BreakoutModeManual     = "manual"      // hosts place participants
+	BreakoutModeAutomatic  = "automatic"   // participants are spread evenly
+	BreakoutModeSelfSelect = "self_select" // participants pick a room
 )
 
 // Participant role constants
@@ -299,6 +562,92 @@ func (m *Meeting) IsScheduled() bool {
 	return m.Status == MeetingStatusScheduled
 }
 
+// HostReservedSlots is the number of seats kept free for hosts in a meeting
+// with a participant limit
+const HostReservedSlots = 1
+
+// ParticipantLimit returns the stricter of the meeting's and the tenant's
+// participant limits, or 0 when neither sets one
+func (m *Meeting) ParticipantLimit(features *ClientFeatures) int {
+	limit := m.MaxParticipants
+	if features != nil && features.MaxParticipants > 0 && (limit <= 0 || features.MaxParticipants < limit) {
+		limit = features.MaxParticipants
+	}
+	if limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// ChatAllowed reports whether the meeting and its tenant allow chat
+func (m *Meeting) ChatAllowed(features *ClientFeatures) bool {
+	return m.EnableChat && (features == nil || features.ChatEnabled)
+}
+
+// IsRecurring reports whether the meeting is the master of a recurring series
+func (m *Meeting) IsRecurring() bool {
+	return m.RecurrenceRule != nil && *m.RecurrenceRule != ""
+}
+
+// Duration returns the scheduled length of the meeting
+func (m *Meeting) Duration() time.Duration {
+	return m.ScheduledEnd.Sub(m.ScheduledStart)
+}
+
+// HasLobby reports whether joiners must wait to be admitted by a host
+func (m *Meeting) HasLobby() bool {
+	return m.EnableWaitingRoom || m.RequireApproval
+}
+
+// MeetingSettingMediaMode is the Settings key choosing how a meeting's
+// media flows
+const MeetingSettingMediaMode = "media_mode"
+
+// Media modes of a meeting: participants connect to each other, through the
+// server's SFU, or to each other until the room outgrows a mesh
+const (
+	MediaModeMesh = "mesh"
+	MediaModeSFU  = "sfu"
+	MediaModeAuto = "auto"
+)
+
+// MediaMode returns the meeting's media mode setting, defaulting to auto
+func (m *Meeting) MediaMode() string {
+	if mode, ok := m.Settings[MeetingSettingMediaMode].(string); ok {
+		switch mode {
+		case MediaModeMesh, MediaModeSFU, MediaModeAuto:
+			return mode
+		}
+	}
+	return MediaModeAuto
+}
+
+// ICEServer is a STUN or TURN server in the form RTCPeerConnection takes
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// ICEConfig is the ICE server list handed to a meeting participant. Its TURN
+// credentials stop working at ExpiresAt and must be fetched again.
+type ICEConfig struct {
+	ICEServers []ICEServer `json:"iceServers"`
+	TTL        int         `json:"ttl,omitempty"` // seconds the TURN credentials are valid
+	ExpiresAt  *time.Time  `json:"expiresAt,omitempty"`
+}
+
+// Helper methods for MeetingParticipant model
+func (p *MeetingParticipant) IsModerator() bool {
+	return p.Role == ParticipantRoleHost || p.Role == ParticipantRoleCoHost
+}
+
+// HoldsSeat reports whether the participant counts toward the meeting's
+// capacity. Invited, waiting and banned roster entries do not.
+func (p *MeetingParticipant) HoldsSeat() bool {
+	return p.Status == ParticipantStatusJoined || p.Status == ParticipantStatusAdmitted
+}
+
 func (m *Meeting) HasEnded() bool {
 	return m.Status == MeetingStatusEnded
 }
@@ -315,6 +664,65 @@ func (m *Meeting) GetDuration() *time.Duration {
 	return nil
 }
 
+// Helper methods for ChatMessage model
+
+// SenderWireID returns the signaling ID of the message's sender
+func (m *ChatMessage) SenderWireID() string {
+	if id, ok := m.Metadata[ChatMetaSenderID].(string); ok {
+		return id
+	}
+	if m.SenderID != nil {
+		return strconv.Itoa(*m.SenderID)
+	}
+	return ""
+}
+
+// ToHosts reports whether the message is private to the meeting's hosts
+func (m *ChatMessage) ToHosts() bool {
+	return m.IsPrivate && m.RecipientID == nil
+}
+
+// ModerationReason returns why the message was hidden, if it was
+func (m *ChatMessage) ModerationReason() string {
+	if !m.IsModerated {
+		return ""
+	}
+	reason, _ := m.Metadata[ChatMetaModerationReason].(string)
+	return reason
+}
+
+// Edited reports whether the sender has edited the message
+func (m *ChatMessage) Edited() bool {
+	edited, _ := m.Metadata[ChatMetaEdited].(bool)
+	return edited
+}
+
+// Helper methods for Recording model
+
+// IsAvailable reports whether the recording's media can be served
+func (r *Recording) IsAvailable() bool {
+	if r.ExpiresAt != nil && time.Now().After(*r.ExpiresAt) {
+		return false
+	}
+	return r.Status == RecordingStatusCompleted || r.Status == RecordingStatusArchived
+}
+
+// HasPassword reports whether the recording is password protected
+func (r *Recording) HasPassword() bool {
+	return r.Password != nil && *r.Password != ""
+}
+
+// ContentType returns the media type of the track's file
+func (t *RecordingTrack) ContentType() string {
+	switch filepath.Ext(t.File) {
+	case ".webm":
+		return "video/webm"
+	case ".ogg":
+		return "audio/ogg"
+	}
+	return "application/octet-stream"
+}
+
 // GenerateToken generates a unique token for invitations
 func GenerateToken() string {
 	return uuid.New().String()
@@ -335,17 +743,24 @@ type JWTClaims struct {
 	ClientID  int    `json:"client_id"`
 	Email     string `json:"email"`
 	Role      string `json:"role"`
-	TokenType string `json:"token_type"` // access, refresh, password_reset
+	TokenType string `json:"token_type"` // access, refresh, mfa_pending
 	jwt.RegisteredClaims
 }
 
-// AuthResponse represents the response for authentication requests
+// AuthResponse represents the response for authentication requests. When a
+// second factor is required it carries only an MFA token to complete the
+// login with.
 type AuthResponse struct {
-	AccessToken  string       `json:"access_token"`
-	RefreshToken string       `json:"refresh_token"`
-	TokenType    string       `json:"token_type"`
+	AccessToken  string       `json:"access_token,omitempty"`
+	RefreshToken string       `json:"refresh_token,omitempty"`
+	TokenType    string       `json:"token_type,omitempty"`
 	ExpiresIn    int          `json:"expires_in"`
-	User         *UserProfile `json:"user"`
+	User         *UserProfile `json:"user,omitempty"`
+
+	MFARequired           bool     `json:"mfa_required,omitempty"`
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required,omitempty"` // the client requires MFA and the user has none yet
+	MFAToken              string   `json:"mfa_token,omitempty"`
+	RecoveryCodes         []string `json:"recovery_codes,omitempty"` // shown once, on enrollment
 }
 
 // UserProfile represents user profile information returned in auth responses
@@ -381,26 +796,100 @@ type ChangePasswordRequest struct {
 	NewPassword string `json:"new_password" validate:"required,min=8"`
 }
 
+// MFARequest completes a login, or an enrollment, with a second factor
+type MFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code" validate:"required"` // TOTP or recovery code
+}
+
+// MFASetup is a TOTP secret pending confirmation. The provisioning URI is
+// rendered as a QR code for authenticator apps.
+type MFASetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFAStatus describes a user's second factor
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled" db:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty" db:"enabled_at"`
+	Required               bool       `json:"required" db:"required"` // enforced by the user's client
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining" db:"recovery_codes_remaining"`
+}
+
+// PasswordResetRequest represents a request for a password reset link
+type PasswordResetRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// CompletePasswordResetRequest sets a new password through a reset link
+type CompletePasswordResetRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8"`
+}
+
+// SSOStartRequest starts a single sign-on, for a client or for the client
+// whose provider handles an email's domain
+type SSOStartRequest struct {
+	ClientID int    `json:"client_id,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+// SSOStartResponse is where to send the user to sign in. State is kept in
+// a cookie rather than returned.
+type SSOStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"-"`
+}
+
+// SSOCallbackRequest carries the parameters the provider redirected back with
+type SSOCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
 // RefreshTokenRequest represents a token refresh request
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
-// RefreshToken represents a stored refresh token
+// RefreshToken represents a stored refresh token. Each one is a session of
+// its user, and AccessTokenID is the jti of the access token last issued to it.
 type RefreshToken struct {
-	ID        int       `json:"id" db:"id"`
-	UserID    int       `json:"user_id" db:"user_id"`
-	Token     string    `json:"token" db:"token"`
-	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID            int       `json:"id" db:"id"`
+	UserID        int       `json:"user_id" db:"user_id"`
+	Token         string    `json:"token" db:"token"`
+	UserAgent     *string   `json:"user_agent" db:"user_agent"`
+	IPAddress     *string   `json:"ip_address" db:"ip_address"`
+	AccessTokenID *string   `json:"access_token_id" db:"access_token_id"`
+	ExpiresAt     time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt    time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Session is a signed-in device of a user, as listed to them
+type Session struct {
+	ID         int       `json:"id" db:"id"`
+	UserAgent  *string   `json:"user_agent,omitempty" db:"user_agent"`
+	IPAddress  *string   `json:"ip_address,omitempty" db:"ip_address"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+	Current    bool      `json:"current" db:"current"`
+}
+
+// SessionClient describes the device a session is signed in from
+type SessionClient struct {
+	UserAgent string
+	IPAddress string
 }
 
 // PasswordResetToken represents a password reset token
 type PasswordResetToken struct {
 	ID        int       `json:"id" db:"id"`
 	UserID    int       `json:"user_id" db:"user_id"`
-	Token     string    `json:"token" db:"token"`
+	TokenHash string    `json:"-" db:"token_hash"`
 	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
 	UsedAt    *time.Time `json:"used_at" db:"used_at"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
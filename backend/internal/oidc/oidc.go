@@ -0,0 +1,357 @@
+// Package oidc is a minimal OpenID Connect relying party: provider
+// discovery, the authorization code flow with PKCE (RFC 7636) and ID token
+// validation against the provider's published keys.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// maxResponseSize bounds what is read from a provider
+	maxResponseSize = 1 << 20
+	// keysMaxAge is how long signing keys are used before being fetched
+	// again
+	keysMaxAge = time.Hour
+	// keysMinInterval limits refetching keys for tokens signed with an
+	// unknown key
+	keysMinInterval = time.Minute
+	// clockSkew is allowed between this server and the provider
+	clockSkew = time.Minute
+)
+
+// signingMethods are the ID token algorithms accepted. "none" and HMAC,
+// which would be keyed with the client secret, are not.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// ErrInvalidIDToken wraps every ID token validation failure
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Provider is an OpenID Connect provider, as described by its discovery
+// document
+type Provider struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+
+	client      *http.Client
+	mu          sync.Mutex
+	keys        map[string]interface{} // by key ID
+	keysFetched time.Time
+}
+
+// Token is the response of a provider's token endpoint
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// AuthRequest holds the parameters of an authorization request. State,
+// Nonce and the PKCE verifier the challenge was made from are kept by the
+// caller until the callback.
+type AuthRequest struct {
+	ClientID      string
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	Nonce         string
+	CodeChallenge string
+	LoginHint     string
+}
+
+// Discover fetches an issuer's discovery document. Providers must be served
+// over HTTPS, except on the loopback interface for local testing.
+func Discover(ctx context.Context, client *http.Client, issuer string) (*Provider, error) {
+	if err := checkURL(issuer); err != nil {
+		return nil, fmt.Errorf("invalid issuer: %w", err)
+	}
+
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	provider := &Provider{client: client}
+	if err := getJSON(ctx, client, wellKnown, provider); err != nil {
+		return nil, fmt.Errorf("failed to discover provider: %w", err)
+	}
+
+	// The document must be about the issuer it was fetched from
+	if provider.Issuer != issuer {
+		return nil, fmt.Errorf("provider issuer %q does not match %q", provider.Issuer, issuer)
+	}
+	for _, endpoint := range []string{provider.AuthorizationEndpoint, provider.TokenEndpoint, provider.JWKSURI} {
+		if err := checkURL(endpoint); err != nil {
+			return nil, fmt.Errorf("invalid provider endpoint: %w", err)
+		}
+	}
+	return provider, nil
+}
+
+// AuthCodeURL returns the URL to send the user to for signing in
+func (p *Provider) AuthCodeURL(req AuthRequest) string {
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", req.ClientID)
+	params.Set("redirect_uri", req.RedirectURI)
+	params.Set("scope", strings.Join(req.Scopes, " "))
+	params.Set("state", req.State)
+	params.Set("nonce", req.Nonce)
+	params.Set("code_challenge", req.CodeChallenge)
+	params.Set("code_challenge_method", "S256")
+	if req.LoginHint != "" {
+		params.Set("login_hint", req.LoginHint)
+	}
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + params.Encode()
+}
+
+// Exchange redeems an authorization code for tokens. Without a client
+// secret the client authenticates with the PKCE verifier alone.
+func (p *Provider) Exchange(ctx context.Context, clientID, clientSecret, code, redirectURI, verifier string) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", verifier)
+
+	// client_secret_basic unless the provider only takes client_secret_post
+	secretInBody := clientSecret != "" && len(p.TokenAuthMethods) > 0 &&
+		!slices.Contains(p.TokenAuthMethods, "client_secret_basic") &&
+		slices.Contains(p.TokenAuthMethods, "client_secret_post")
+	if clientSecret == "" || secretInBody {
+		form.Set("client_id", clientID)
+	}
+	if secretInBody {
+		form.Set("client_secret", clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if clientSecret != "" && !secretInBody {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		json.Unmarshal(body, &oauthErr)
+		return nil, fmt.Errorf("token request failed with status %d: %s %s", resp.StatusCode, oauthErr.Error, oauthErr.Description)
+	}
+
+	token := &Token{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("token response has no ID token")
+	}
+	return token, nil
+}
+
+// VerifyIDToken validates an ID token issued to clientID for the
+// authorization request with the given nonce, and returns its claims
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, clientID, nonce string) (Claims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	result := Claims(claims)
+	// A token for several audiences must name this client as its holder
+	if audiences, _ := claims.GetAudience(); len(audiences) > 1 && result.String("azp") != clientID {
+		return nil, fmt.Errorf("%w: issued to another party", ErrInvalidIDToken)
+	}
+	if result.String("nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	}
+	if result.String("sub") == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	return result, nil
+}
+
+// key returns the provider's verification key with the given ID, fetching
+// the key set when the key is unknown or the set is old
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	age := time.Since(p.keysFetched)
+	key, known := p.lookupKey(kid)
+	if known && age < keysMaxAge {
+		return key, nil
+	}
+	if age >= keysMinInterval {
+		keys, err := fetchKeys(ctx, p.client, p.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+		p.keys = keys
+		p.keysFetched = time.Now()
+		key, known = p.lookupKey(kid)
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// lookupKey finds a key by ID. Tokens without one may use the only key.
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// Claims are the claims of a validated ID token
+type Claims map[string]interface{}
+
+// String returns a string claim, or "" if it is missing
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// Strings returns a claim that is a string or a list of strings
+func (c Claims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Bool returns a boolean claim and whether it was present. Some providers
+// send booleans as strings.
+func (c Claims) Bool(name string) (bool, bool) {
+	switch value := c[name].(type) {
+	case bool:
+		return value, true
+	case string:
+		return value == "true", true
+	}
+	return false, false
+}
+
+// NewPKCE returns a PKCE code verifier and its S256 challenge
+func NewPKCE() (string, string, error) {
+	verifier, err := RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	return verifier, S256Challenge(verifier), nil
+}
+
+// S256Challenge returns the S256 code challenge of a verifier
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomString returns an unguessable URL-safe string, for states, nonces
+// and code verifiers
+func RandomString() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// checkURL requires HTTPS, except for loopback hosts
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute URL", raw)
+	}
+	if u.Scheme == "https" {
+		return nil
+	}
+	if u.Scheme == "http" {
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q must use https", raw)
+}
+
+// getJSON fetches and decodes a JSON document
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
@@ -0,0 +1,280 @@
+package oidc_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"video-conference-backend/internal/oidc"
+	"video-conference-backend/internal/oidc/mockidp"
+)
+
+const (
+	clientID     = "video-conference"
+	clientSecret = "test-secret"
+	redirectURI  = "http://127.0.0.1:3000/sso/callback"
+)
+
+// testProvider serves a mock provider over the loopback network and
+// discovers it
+func testProvider(t *testing.T) (*oidc.Provider, *mockidp.Server, *httptest.Server) {
+	t.Helper()
+
+	var idp *mockidp.Server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	idp, err := mockidp.New(server.URL, clientID, clientSecret)
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	idp.SetUser(map[string]interface{}{
+		"sub":            "test-user",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"groups":         []string{"staff", "admins"},
+	})
+
+	provider, err := oidc.Discover(t.Context(), server.Client(), server.URL)
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+	return provider, idp, server
+}
+
+// flow is a started sign-in, redirected back with its code
+type flow struct {
+	code     string
+	verifier string
+	nonce    string
+}
+
+// authorize starts a sign-in and follows it to the redirect back, the way
+// the browser and the frontend would
+func authorize(t *testing.T, provider *oidc.Provider) flow {
+	t.Helper()
+
+	state, _ := oidc.RandomString()
+	nonce, _ := oidc.RandomString()
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatalf("failed to create PKCE verifier: %v", err)
+	}
+	authURL := provider.AuthCodeURL(oidc.AuthRequest{
+		ClientID:      clientID,
+		RedirectURI:   redirectURI,
+		Scopes:        []string{"openid", "email", "profile"},
+		State:         state,
+		Nonce:         nonce,
+		CodeChallenge: challenge,
+	})
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization returned status %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+	if location.Query().Get("state") != state {
+		t.Fatalf("redirect carried state %q, want %q", location.Query().Get("state"), state)
+	}
+	return flow{code: location.Query().Get("code"), verifier: verifier, nonce: nonce}
+}
+
+func TestSignIn(t *testing.T) {
+	provider, _, _ := testProvider(t)
+	ctx := t.Context()
+
+	flow := authorize(t, provider)
+	token, err := provider.Exchange(ctx, clientID, clientSecret, flow.code, redirectURI, flow.verifier)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, clientID, flow.nonce)
+	if err != nil {
+		t.Fatalf("ID token rejected: %v", err)
+	}
+
+	if claims.String("sub") != "test-user" || claims.String("email") != "jane@example.com" {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+	if verified, ok := claims.Bool("email_verified"); !ok || !verified {
+		t.Fatalf("email_verified not carried: %v", claims)
+	}
+	if !slices.Contains(claims.Strings("groups"), "admins") {
+		t.Fatalf("groups not carried: %v", claims)
+	}
+
+	// A code is redeemed once
+	if _, err := provider.Exchange(ctx, clientID, clientSecret, flow.code, redirectURI, flow.verifier); err == nil {
+		t.Fatal("code was redeemed twice")
+	}
+}
+
+func TestExchangeRefusesMismatchedCodes(t *testing.T) {
+	provider, _, _ := testProvider(t)
+	ctx := t.Context()
+
+	// Codes are bound to the verifier, the client and the redirect URI
+	tests := []struct {
+		name        string
+		secret      string
+		redirectURI string
+		verifier    string
+	}{
+		{name: "wrong verifier", secret: clientSecret, redirectURI: redirectURI, verifier: "wrong-verifier"},
+		{name: "wrong secret", secret: "wrong-secret", redirectURI: redirectURI},
+		{name: "other redirect URI", secret: clientSecret, redirectURI: redirectURI + "/other"},
+	}
+	for _, tt := range tests {
+		flow := authorize(t, provider)
+		if tt.verifier == "" {
+			tt.verifier = flow.verifier
+		}
+		if _, err := provider.Exchange(ctx, clientID, tt.secret, flow.code, tt.redirectURI, tt.verifier); err == nil {
+			t.Errorf("%s: code was redeemed", tt.name)
+		}
+	}
+}
+
+func TestVerifyIDTokenRefusesTokensForOtherSignIns(t *testing.T) {
+	provider, idp, server := testProvider(t)
+	ctx := t.Context()
+
+	// The nonce ties the ID token to the sign-in that requested it
+	flow := authorize(t, provider)
+	token, err := provider.Exchange(ctx, clientID, clientSecret, flow.code, redirectURI, flow.verifier)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if _, err := provider.VerifyIDToken(ctx, token.IDToken, clientID, "other-nonce"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Errorf("accepted a token for another sign-in: %v", err)
+	}
+
+	// ID tokens the provider's key signed, but not for this sign-in
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": server.URL, "aud": clientID, "sub": "test-user", "nonce": "n",
+			"iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		}
+	}
+	forged := map[string]jwt.MapClaims{
+		"another audience":           withClaim(valid(), "aud", "other-client"),
+		"another issuer":             withClaim(valid(), "iss", "https://evil.example.com"),
+		"an expired token":           withClaim(valid(), "exp", now.Add(-time.Hour).Unix()),
+		"a token without expiry":     withClaim(valid(), "exp", nil),
+		"a token for another holder": withClaim(withClaim(valid(), "aud", []string{clientID, "other-client"}), "azp", "other-client"),
+		"a token without subject":    withClaim(valid(), "sub", nil),
+	}
+	for name, claims := range forged {
+		raw, err := idp.Sign(claims)
+		if err != nil {
+			t.Fatalf("failed to sign %s: %v", name, err)
+		}
+		if _, err := provider.VerifyIDToken(ctx, raw, clientID, "n"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Errorf("accepted %s: %v", name, err)
+		}
+	}
+
+	raw, err := idp.Sign(valid())
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if _, err := provider.VerifyIDToken(ctx, raw, clientID, "n"); err != nil {
+		t.Fatalf("rejected a valid token: %v", err)
+	}
+}
+
+func TestVerifyIDTokenRefusesTokensNotSignedByProvider(t *testing.T) {
+	provider, _, server := testProvider(t)
+	ctx := t.Context()
+
+	claims := jwt.MapClaims{
+		"iss": server.URL, "aud": clientID, "sub": "test-user", "nonce": "n",
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+	}
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(clientSecret))
+	noneToken, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	for name, raw := range map[string]string{
+		"an HMAC token keyed with the client secret": hmacToken,
+		"an unsigned token":                          noneToken,
+	} {
+		if _, err := provider.VerifyIDToken(ctx, raw, clientID, "n"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Errorf("accepted %s: %v", name, err)
+		}
+	}
+}
+
+func TestDiscoverRefusesUntrustedIssuers(t *testing.T) {
+	_, _, server := testProvider(t)
+	ctx := t.Context()
+
+	// Providers are only trusted for the issuer they were discovered from,
+	// and over HTTPS outside the loopback interface
+	if _, err := oidc.Discover(ctx, server.Client(), server.URL+"/"); err == nil {
+		t.Error("discovery accepted a mismatched issuer")
+	}
+	if _, err := oidc.Discover(ctx, server.Client(), "http://idp.example.com"); err == nil {
+		t.Error("discovery accepted a plain HTTP issuer")
+	}
+}
+
+func TestClaims(t *testing.T) {
+	claims := oidc.Claims{
+		"email":          "jane@example.com",
+		"groups":         []interface{}{"staff", 42, "admins"},
+		"role":           "admin",
+		"email_verified": "true",
+	}
+
+	if got := claims.Strings("groups"); !slices.Equal(got, []string{"staff", "admins"}) {
+		t.Errorf("Strings(groups) = %v", got)
+	}
+	if got := claims.Strings("role"); !slices.Equal(got, []string{"admin"}) {
+		t.Errorf("Strings(role) = %v", got)
+	}
+	if verified, ok := claims.Bool("email_verified"); !ok || !verified {
+		t.Error("a string boolean was not read")
+	}
+	if _, ok := claims.Bool("missing"); ok {
+		t.Error("a missing claim was reported present")
+	}
+	if claims.String("groups") != "" {
+		t.Error("a list was read as a string")
+	}
+}
+
+func TestS256Challenge(t *testing.T) {
+	// The example of RFC 7636, appendix B
+	if got := oidc.S256Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Fatalf("S256Challenge = %q", got)
+	}
+}
+
+func withClaim(claims jwt.MapClaims, name string, value interface{}) jwt.MapClaims {
+	if value == nil {
+		delete(claims, name)
+	} else {
+		claims[name] = value
+	}
+	return claims
+}
@@ -0,0 +1,256 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"video-conference-backend/internal/config"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/signaling"
+)
+
+// ErrRecordingDisabled is returned when recording is not allowed for a meeting
+var ErrRecordingDisabled = errors.New("recording is not enabled for this meeting")
+
+// ErrAlreadyRecording is returned when a meeting already has an active recording
+var ErrAlreadyRecording = errors.New("meeting is already being recorded")
+
+// Manager runs the recorders of this server. Each recording joins its
+// meeting's signaling room as a hidden peer; when it stops, its tracks are
+// finalized and a processing job fills in the recording's size and duration.
+type Manager struct {
+	config   *config.Config
+	services *services.Services
+	hub      *signaling.Hub
+	ice      webrtc.Configuration
+
+	mutex    sync.Mutex
+	sessions map[int]*session // by recording ID
+	wg       sync.WaitGroup
+}
+
+// session is an active recording
+type session struct {
+	recording *models.Recording
+	recorder  *Recorder
+	peer      *signaling.Peer
+}
+
+// NewManager creates a recording manager attached to the signaling hub
+func NewManager(cfg *config.Config, svc *services.Services, hub *signaling.Hub) *Manager {
+	return &Manager{
+		config:   cfg,
+		services: svc,
+		hub:      hub,
+		ice:      iceConfiguration(&cfg.WebRTC),
+		sessions: make(map[int]*session),
+	}
+}
+
+// iceConfiguration builds the recorder's ICE servers from the WebRTC settings
+func iceConfiguration(cfg *config.WebRTCConfig) webrtc.Configuration {
+	var servers []webrtc.ICEServer
+	for _, url := range cfg.STUNServers {
+		if url != "" {
+			servers = append(servers, webrtc.ICEServer{URLs: []string{url}})
+		}
+	}
+	if cfg.TURNServerURL != "" {
+		servers = append(servers, webrtc.ICEServer{
+			URLs:       []string{cfg.TURNServerURL},
+			Username:   cfg.TURNUsername,
+			Credential: cfg.TURNCredential,
+		})
+	}
+	return webrtc.Configuration{ICEServers: servers}
+}
+
+// Start begins recording an active meeting. The meeting must allow recording
+// and the tenant must have the recording feature.
+func (m *Manager) Start(ctx context.Context, meeting *models.Meeting, startedBy int, title string) (*models.Recording, error) {
+	if err := m.checkAllowed(ctx, meeting); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	for _, s := range m.sessions {
+		if s.recording.MeetingID == meeting.ID {
+			m.mutex.Unlock()
+			return nil, ErrAlreadyRecording
+		}
+	}
+	m.mutex.Unlock()
+
+	if title == "" {
+		title = meeting.Title
+	}
+	recording := &models.Recording{
+		ClientID:  meeting.ClientID,
+		MeetingID: meeting.ID,
+		Title:     title,
+		StartedBy: startedBy,
+		Metadata:  models.JSONB{},
+		Settings:  models.JSONB{},
+	}
+	if err := m.services.Recording.StartRecording(ctx, recording); err != nil {
+		return nil, err
+	}
+
+	s, err := m.attach(recording, meeting)
+	if err != nil {
+		// Nothing was captured; the processing job marks the recording failed
+		m.services.Recording.StopRecording(ctx, recording.ID, startedBy)
+		m.process(recording.ID)
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	m.sessions[recording.ID] = s
+	m.mutex.Unlock()
+
+	log.Printf("Recording %d started for meeting %s", recording.ID, meeting.MeetingID)
+	return recording, nil
+}
+
+func (m *Manager) checkAllowed(ctx context.Context, meeting *models.Meeting) error {
+	if !m.config.Features.Recording || !meeting.EnableRecording {
+		return ErrRecordingDisabled
+	}
+	if !meeting.IsActive() {
+		return fmt.Errorf("meeting is not active")
+	}
+
+	features, err := m.services.Client.GetClientFeatures(ctx, meeting.ClientID)
+	if err != nil {
+		return fmt.Errorf("failed to load client features: %w", err)
+	}
+	if !features.RecordingEnabled {
+		return ErrRecordingDisabled
+	}
+	return nil
+}
+
+// attach starts a recorder and joins it to the meeting's room
+func (m *Manager) attach(recording *models.Recording, meeting *models.Meeting) (*session, error) {
+	// Tracks are spooled on this server and uploaded to storage when processed
+	dir := filepath.Join(m.config.Storage.RecordingSpool, *recording.FilePath)
+	recorder, err := NewRecorder(dir, m.ice)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &signaling.Identity{
+		UserID:    "recorder_" + strconv.Itoa(recording.ID),
+		UserName:  "Recorder",
+		ClientID:  meeting.ClientID,
+		MeetingID: meeting.ID,
+	}
+
+	// The room closing under the recorder, e.g. when the meeting ends, stops it
+	peer, err := m.hub.AttachPeer(meeting.MeetingID, identity, recorder.HandleMessage, func() {
+		if err := m.Stop(context.Background(), recording.ID, 0); err != nil && !errors.Is(err, ErrNotRecording) {
+			log.Printf("Failed to stop recording %d: %v", recording.ID, err)
+		}
+	})
+	if err != nil {
+		recorder.Close()
+		return nil, fmt.Errorf("failed to join meeting room: %w", err)
+	}
+	recorder.Start(peer)
+
+	return &session{recording: recording, recorder: recorder, peer: peer}, nil
+}
+
+// ErrNotRecording is returned when stopping a recording this server is not running
+var ErrNotRecording = errors.New("recording is not active on this server")
+
+// Stop ends a recording and queues it for processing. stoppedBy is the user
+// who stopped it, or zero when it stopped on its own.
+func (m *Manager) Stop(ctx context.Context, recordingID, stoppedBy int) error {
+	m.mutex.Lock()
+	s, ok := m.sessions[recordingID]
+	delete(m.sessions, recordingID)
+	m.mutex.Unlock()
+
+	if !ok {
+		return ErrNotRecording
+	}
+
+	s.peer.Close()
+	tracks, err := s.recorder.Close()
+	if err != nil {
+		log.Printf("Recording %d finished with errors: %v", recordingID, err)
+	}
+
+	if err := m.services.Recording.StopRecording(ctx, recordingID, stoppedBy); err != nil {
+		return err
+	}
+
+	log.Printf("Recording %d stopped with %d tracks", recordingID, len(tracks))
+	m.process(recordingID)
+	return nil
+}
+
+// IsRecording reports whether the recording is running on this server
+func (m *Manager) IsRecording(recordingID int) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, ok := m.sessions[recordingID]
+	return ok
+}
+
+// processTimeout bounds a processing job, including the upload of its tracks
+const processTimeout = 30 * time.Minute
+
+// process runs the processing job of a stopped recording in the background
+func (m *Manager) process(recordingID int) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), processTimeout)
+		defer cancel()
+		if err := m.services.Recording.ProcessRecording(ctx, recordingID); err != nil {
+			log.Printf("Failed to process recording %d: %v", recordingID, err)
+			return
+		}
+		log.Printf("Recording %d processed", recordingID)
+	}()
+}
+
+// Shutdown stops every active recording and waits for processing to finish
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mutex.Lock()
+	ids := make([]int, 0, len(m.sessions))
+	for id := range m.sessions {
+		ids = append(ids, id)
+	}
+	m.mutex.Unlock()
+
+	for _, id := range ids {
+		if err := m.Stop(ctx, id, 0); err != nil && !errors.Is(err, ErrNotRecording) {
+			log.Printf("Failed to stop recording %d: %v", id, err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,442 @@
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/signaling"
+)
+
+// keyframeInterval is how often the recorder asks senders for a keyframe,
+// so a video track can be decoded from the start of every cluster
+const keyframeInterval = 3 * time.Second
+
+// Signaler carries the recorder's signaling messages into its room
+type Signaler interface {
+	Send(msg signaling.Message)
+}
+
+// Recorder captures the media of one room. It acts as a receive-only peer:
+// it offers a connection to every participant and writes each incoming
+// audio and video track to its own file in the recording directory.
+type Recorder struct {
+	dir    string
+	api    *webrtc.API
+	config webrtc.Configuration
+
+	signaler Signaler
+	started  chan struct{}
+
+	mutex  sync.Mutex
+	peers  map[string]*webrtc.PeerConnection
+	tracks []*recordedTrack
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// recordedTrack is a remote track being written to a file
+type recordedTrack struct {
+	mutex  sync.Mutex
+	info   models.RecordingTrack
+	writer trackWriter
+}
+
+// NewRecorder creates a recorder writing into dir. Only Opus audio and VP8
+// video are negotiated, the codecs the recorder can store.
+func NewRecorder(dir string, config webrtc.Configuration) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	mediaEngine := &webrtc.MediaEngine{}
+	err := mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: opusClockRate, Channels: 2},
+		PayloadType:        111,
+	}, webrtc.RTPCodecTypeAudio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register opus: %w", err)
+	}
+	err = mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: vp8ClockRate},
+		PayloadType:        96,
+	}, webrtc.RTPCodecTypeVideo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register vp8: %w", err)
+	}
+
+	return &Recorder{
+		dir:     dir,
+		api:     webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine)),
+		config:  config,
+		started: make(chan struct{}),
+		peers:   make(map[string]*webrtc.PeerConnection),
+	}, nil
+}
+
+// Start lets the recorder talk to the room. Messages handled before Start
+// wait for it.
+func (r *Recorder) Start(signaler Signaler) {
+	r.signaler = signaler
+	close(r.started)
+}
+
+// HandleMessage reacts to a signaling message delivered to the recorder
+func (r *Recorder) HandleMessage(msg signaling.Message) {
+	<-r.started
+
+	switch msg.Type {
+	case signaling.TypeJoined:
+		var payload signaling.JoinedPayload
+		if err := msg.DecodePayload(&payload); err != nil {
+			return
+		}
+		for _, p := range payload.Participants {
+			r.connectParticipant(p)
+		}
+
+	case signaling.TypeUserJoined:
+		var p signaling.Participant
+		if err := msg.DecodePayload(&p); err != nil {
+			return
+		}
+		r.connectParticipant(p)
+
+	case signaling.TypeUserLeft:
+		var payload signaling.UserLeftPayload
+		if err := msg.DecodePayload(&payload); err != nil {
+			return
+		}
+		r.disconnect(payload.UserID)
+
+	case signaling.TypeOffer, signaling.TypeAnswer, signaling.TypeICECandidate:
+		var payload signaling.RelayedSignalPayload
+		if err := msg.DecodePayload(&payload); err != nil {
+			return
+		}
+		if err := r.handleSignal(msg.Type, payload); err != nil {
+			log.Printf("Recorder failed to handle %s from %s: %v", msg.Type, payload.SenderID, err)
+		}
+	}
+}
+
+// connectParticipant offers a receive-only connection to a participant
+// that publishes media
+func (r *Recorder) connectParticipant(p signaling.Participant) {
+	if p.ViewOnly || p.UserID == "" {
+		return
+	}
+	if err := r.connect(p.UserID); err != nil {
+		log.Printf("Recorder failed to connect to %s: %v", p.UserID, err)
+	}
+}
+
+func (r *Recorder) connect(participantID string) error {
+	pc, created, err := r.peerConnection(participantID)
+	if err != nil || !created {
+		return err
+	}
+
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		_, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+		if err != nil {
+			return fmt.Errorf("failed to add %s transceiver: %w", kind, err)
+		}
+	}
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create offer: %w", err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("failed to set local description: %w", err)
+	}
+
+	return r.send(signaling.TypeOffer, participantID, &offer, nil)
+}
+
+// handleSignal applies an answer or ICE candidate from a participant, and
+// answers offers from participants that renegotiate
+func (r *Recorder) handleSignal(msgType string, payload signaling.RelayedSignalPayload) error {
+	switch msgType {
+	case signaling.TypeOffer:
+		var offer webrtc.SessionDescription
+		if err := json.Unmarshal(payload.SDP, &offer); err != nil {
+			return fmt.Errorf("invalid offer: %w", err)
+		}
+
+		pc, _, err := r.peerConnection(payload.SenderID)
+		if err != nil {
+			return err
+		}
+		if err := pc.SetRemoteDescription(offer); err != nil {
+			return fmt.Errorf("failed to set remote description: %w", err)
+		}
+
+		answer, err := pc.CreateAnswer(nil)
+		if err != nil {
+			return fmt.Errorf("failed to create answer: %w", err)
+		}
+		if err := pc.SetLocalDescription(answer); err != nil {
+			return fmt.Errorf("failed to set local description: %w", err)
+		}
+		return r.send(signaling.TypeAnswer, payload.SenderID, &answer, nil)
+
+	case signaling.TypeAnswer:
+		var answer webrtc.SessionDescription
+		if err := json.Unmarshal(payload.SDP, &answer); err != nil {
+			return fmt.Errorf("invalid answer: %w", err)
+		}
+
+		pc, ok := r.existingPeer(payload.SenderID)
+		if !ok {
+			return fmt.Errorf("no connection to %s", payload.SenderID)
+		}
+		return pc.SetRemoteDescription(answer)
+
+	case signaling.TypeICECandidate:
+		var candidate webrtc.ICECandidateInit
+		if err := json.Unmarshal(payload.Candidate, &candidate); err != nil {
+			return fmt.Errorf("invalid candidate: %w", err)
+		}
+
+		pc, ok := r.existingPeer(payload.SenderID)
+		if !ok {
+			return nil
+		}
+		return pc.AddICECandidate(candidate)
+	}
+	return nil
+}
+
+// peerConnection returns the connection to a participant, creating it if
+// needed and reporting whether it was created
+func (r *Recorder) peerConnection(participantID string) (*webrtc.PeerConnection, bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return nil, false, errors.New("recorder is closed")
+	}
+	if pc, ok := r.peers[participantID]; ok {
+		return pc, false, nil
+	}
+
+	pc, err := r.api.NewPeerConnection(r.config)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create peer connection: %w", err)
+	}
+
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		init := candidate.ToJSON()
+		if err := r.send(signaling.TypeICECandidate, participantID, nil, &init); err != nil {
+			log.Printf("Recorder failed to send ICE candidate to %s: %v", participantID, err)
+		}
+	})
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		r.record(participantID, pc, track)
+	})
+
+	r.peers[participantID] = pc
+	return pc, true, nil
+}
+
+func (r *Recorder) existingPeer(participantID string) (*webrtc.PeerConnection, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	pc, ok := r.peers[participantID]
+	return pc, ok
+}
+
+// disconnect closes the connection to a participant that left. Its tracks
+// end when their streams do.
+func (r *Recorder) disconnect(participantID string) {
+	r.mutex.Lock()
+	pc, ok := r.peers[participantID]
+	delete(r.peers, participantID)
+	r.mutex.Unlock()
+
+	if ok {
+		pc.Close()
+	}
+}
+
+func (r *Recorder) send(msgType, targetID string, sdp *webrtc.SessionDescription, candidate *webrtc.ICECandidateInit) error {
+	payload := signaling.SignalPayload{TargetID: targetID}
+
+	if sdp != nil {
+		data, err := json.Marshal(sdp)
+		if err != nil {
+			return err
+		}
+		payload.SDP = data
+	}
+	if candidate != nil {
+		data, err := json.Marshal(candidate)
+		if err != nil {
+			return err
+		}
+		payload.Candidate = data
+	}
+
+	msg, err := signaling.NewMessage(msgType, payload)
+	if err != nil {
+		return err
+	}
+	r.signaler.Send(msg)
+	return nil
+}
+
+// record writes a remote track to a new file until the track ends
+func (r *Recorder) record(participantID string, pc *webrtc.PeerConnection, track *webrtc.TrackRemote) {
+	codec := track.Codec().RTPCodecCapability
+	kind := track.Kind().String()
+
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return
+	}
+	name := fmt.Sprintf("%s_%s_%d", sanitizeFileName(participantID), kind, len(r.tracks)+1)
+	writer, ext, err := newTrackWriter(filepath.Join(r.dir, name), codec)
+	if err != nil {
+		r.mutex.Unlock()
+		log.Printf("Recorder cannot store %s track from %s: %v", kind, participantID, err)
+		return
+	}
+
+	recorded := &recordedTrack{
+		info: models.RecordingTrack{
+			ParticipantID: participantID,
+			Kind:          kind,
+			Codec:         codec.MimeType,
+			File:          name + ext,
+		},
+		writer: writer,
+	}
+	r.tracks = append(r.tracks, recorded)
+	r.wg.Add(1)
+	r.mutex.Unlock()
+
+	log.Printf("Recorder writing %s track from %s to %s", kind, participantID, recorded.info.File)
+
+	done := make(chan struct{})
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		go requestKeyframes(pc, track, done)
+	}
+
+	go func() {
+		defer r.wg.Done()
+		defer close(done)
+
+		for {
+			packet, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+
+			recorded.mutex.Lock()
+			err = recorded.writer.WriteRTP(packet)
+			recorded.mutex.Unlock()
+			if err != nil {
+				log.Printf("Recorder failed to write %s: %v", recorded.info.File, err)
+				return
+			}
+		}
+	}()
+}
+
+// requestKeyframes asks the sender for a keyframe now and then at every
+// keyframeInterval until done is closed
+func requestKeyframes(pc *webrtc.PeerConnection, track *webrtc.TrackRemote, done chan struct{}) {
+	ticker := time.NewTicker(keyframeInterval)
+	defer ticker.Stop()
+
+	for {
+		pli := []rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}}
+		if err := pc.WriteRTCP(pli); err != nil {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// Close disconnects from every participant, finishes the track files and
+// writes the manifest of what was captured
+func (r *Recorder) Close() ([]models.RecordingTrack, error) {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil, errors.New("recorder is already closed")
+	}
+	r.closed = true
+	peers := r.peers
+	r.peers = make(map[string]*webrtc.PeerConnection)
+	r.mutex.Unlock()
+
+	// Closing the connections ends every track read loop
+	for _, pc := range peers {
+		pc.Close()
+	}
+	r.wg.Wait()
+
+	tracks := make([]models.RecordingTrack, 0, len(r.tracks))
+	var errs []error
+	for _, t := range r.tracks {
+		t.mutex.Lock()
+		if err := t.writer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", t.info.File, err))
+		}
+		t.info.Duration = t.writer.Duration().Seconds()
+		t.mutex.Unlock()
+		tracks = append(tracks, t.info)
+	}
+
+	if err := writeManifest(r.dir, tracks); err != nil {
+		errs = append(errs, err)
+	}
+
+	return tracks, errors.Join(errs...)
+}
+
+// writeManifest lists the captured tracks for the processing job
+func writeManifest(dir string, tracks []models.RecordingTrack) error {
+	data, err := json.MarshalIndent(services.RecordingManifest{Tracks: tracks}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode track manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, services.RecordingManifestFile), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write track manifest: %w", err)
+	}
+	return nil
+}
+
+// sanitizeFileName keeps participant IDs safe to use in file names
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,109 @@
+package recording
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/signaling"
+	"video-conference-backend/internal/webrtctest"
+)
+
+const waitTimeout = 10 * time.Second
+
+// written reports how many tracks the recorder is writing
+func (r *Recorder) written() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.tracks)
+}
+
+func TestRecorderCapturesParticipantTracks(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+
+	// The recorder's messages go straight to alice, who publishes Opus
+	// audio and VP8 video
+	alice, err := webrtctest.NewPeer("alice", func(msg signaling.Message) {
+		go recorder.HandleMessage(msg)
+	}, t.Errorf)
+	if err != nil {
+		t.Fatalf("failed to create participant: %v", err)
+	}
+	t.Cleanup(alice.Close)
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		if err := alice.Publish(kind, kind.String(), "alice"); err != nil {
+			t.Fatalf("failed to publish %s: %v", kind, err)
+		}
+	}
+	recorder.Start(webrtctest.SignalerFunc(alice.Deliver))
+
+	joined, _ := signaling.NewMessage(signaling.TypeJoined, signaling.JoinedPayload{
+		Participants: []signaling.Participant{
+			{UserID: "alice"},
+			{UserID: "viewer", ViewOnly: true},
+		},
+	})
+	recorder.HandleMessage(joined)
+
+	if !webrtctest.Until(waitTimeout, func() bool { return recorder.written() >= 2 }) {
+		t.Fatalf("recorder is writing %d tracks, want 2", recorder.written())
+	}
+	// Let a second of media arrive
+	time.Sleep(time.Second)
+
+	tracks, err := recorder.Close()
+	if err != nil {
+		t.Fatalf("failed to close recorder: %v", err)
+	}
+	if _, err := recorder.Close(); err == nil {
+		t.Fatal("recorder closed twice")
+	}
+
+	kinds := make(map[string]models.RecordingTrack)
+	for _, track := range tracks {
+		kinds[track.Kind] = track
+	}
+	if len(tracks) != 2 || kinds["audio"].Codec != webrtc.MimeTypeOpus || kinds["video"].Codec != webrtc.MimeTypeVP8 {
+		t.Fatalf("recorded %+v, want alice's opus audio and vp8 video", tracks)
+	}
+	for _, track := range tracks {
+		if track.ParticipantID != "alice" {
+			t.Errorf("%s attributed to %q, want alice", track.File, track.ParticipantID)
+		}
+		if track.Duration <= 0 {
+			t.Errorf("%s has no media", track.File)
+		}
+		info, err := os.Stat(filepath.Join(dir, track.File))
+		if err != nil || info.Size() == 0 {
+			t.Errorf("%s was not written: %v", track.File, err)
+		}
+	}
+
+	var manifest services.RecordingManifest
+	if err := json.Unmarshal(readFile(t, filepath.Join(dir, services.RecordingManifestFile)), &manifest); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	if len(manifest.Tracks) != len(tracks) {
+		t.Fatalf("manifest lists %+v, want %+v", manifest.Tracks, tracks)
+	}
+	for i := range tracks {
+		if manifest.Tracks[i] != tracks[i] {
+			t.Fatalf("manifest lists %+v, want %+v", manifest.Tracks, tracks)
+		}
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	if got := sanitizeFileName("../guest:42/Jane Doe"); got != "___guest_42_Jane_Doe" {
+		t.Fatalf("sanitizeFileName = %q", got)
+	}
+}
@@ -0,0 +1,199 @@
+package recording
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/at-wat/ebml-go/webm"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+	"github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+)
+
+// Clock rates of the codecs the recorder negotiates
+const (
+	opusClockRate = 48000
+	vp8ClockRate  = 90000
+)
+
+// maxLatePackets is how many packets the VP8 sample builder holds back to
+// reorder late arrivals
+const maxLatePackets = 128
+
+// errUnsupportedCodec is returned for tracks the recorder cannot store
+var errUnsupportedCodec = errors.New("unsupported codec")
+
+// trackWriter stores the RTP packets of one remote track in a media file
+type trackWriter interface {
+	WriteRTP(packet *rtp.Packet) error
+	// Duration returns the media time written so far
+	Duration() time.Duration
+	Close() error
+}
+
+// newTrackWriter creates the writer for a codec: Opus goes to Ogg and VP8 to
+// WebM. It returns the file extension used.
+func newTrackWriter(path string, codec webrtc.RTPCodecCapability) (trackWriter, string, error) {
+	switch codec.MimeType {
+	case webrtc.MimeTypeOpus:
+		w, err := newOggTrackWriter(path+".ogg", codec)
+		return w, ".ogg", err
+	case webrtc.MimeTypeVP8:
+		w, err := newWebMTrackWriter(path + ".webm")
+		return w, ".webm", err
+	}
+	return nil, "", fmt.Errorf("%w %s", errUnsupportedCodec, codec.MimeType)
+}
+
+// rtpClock accumulates the media time covered by a stream of RTP timestamps
+type rtpClock struct {
+	rate    uint32
+	started bool
+	last    uint32
+	ticks   uint64
+}
+
+func (c *rtpClock) observe(timestamp uint32) {
+	if !c.started {
+		c.started = true
+		c.last = timestamp
+		return
+	}
+
+	// Unsigned subtraction handles wraparound; packets from the past are ignored
+	if delta := timestamp - c.last; delta < 1<<31 {
+		c.ticks += uint64(delta)
+		c.last = timestamp
+	}
+}
+
+func (c *rtpClock) duration() time.Duration {
+	return time.Duration(c.ticks) * time.Second / time.Duration(c.rate)
+}
+
+// oggTrackWriter writes an Opus track to an Ogg file
+type oggTrackWriter struct {
+	writer *oggwriter.OggWriter
+	clock  rtpClock
+}
+
+func newOggTrackWriter(path string, codec webrtc.RTPCodecCapability) (*oggTrackWriter, error) {
+	channels := codec.Channels
+	if channels == 0 {
+		channels = 2
+	}
+
+	writer, err := oggwriter.New(path, opusClockRate, channels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ogg file: %w", err)
+	}
+	return &oggTrackWriter{writer: writer, clock: rtpClock{rate: opusClockRate}}, nil
+}
+
+func (w *oggTrackWriter) WriteRTP(packet *rtp.Packet) error {
+	if len(packet.Payload) == 0 {
+		return nil
+	}
+	w.clock.observe(packet.Timestamp)
+	return w.writer.WriteRTP(packet)
+}
+
+func (w *oggTrackWriter) Duration() time.Duration {
+	return w.clock.duration()
+}
+
+func (w *oggTrackWriter) Close() error {
+	return w.writer.Close()
+}
+
+// webmTrackWriter writes a VP8 track to a WebM file. Frames before the first
+// keyframe are dropped, since the frame size is only known from a keyframe.
+type webmTrackWriter struct {
+	path     string
+	builder  *samplebuilder.SampleBuilder
+	file     *os.File
+	block    webm.BlockWriteCloser
+	elapsed  time.Duration
+	keyframe bool
+}
+
+func newWebMTrackWriter(path string) (*webmTrackWriter, error) {
+	// Create the file up front so a track that never sends a keyframe still
+	// shows up, empty, in the recording
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webm file: %w", err)
+	}
+
+	return &webmTrackWriter{
+		path:    path,
+		builder: samplebuilder.New(maxLatePackets, &codecs.VP8Packet{}, vp8ClockRate),
+		file:    file,
+	}, nil
+}
+
+func (w *webmTrackWriter) WriteRTP(packet *rtp.Packet) error {
+	w.builder.Push(packet)
+
+	for sample := w.builder.Pop(); sample != nil; sample = w.builder.Pop() {
+		if len(sample.Data) < 10 {
+			continue
+		}
+
+		// The VP8 payload header marks keyframes with a cleared low bit
+		keyframe := sample.Data[0]&0x1 == 0
+		if w.block == nil {
+			if !keyframe {
+				continue
+			}
+			if err := w.open(sample.Data); err != nil {
+				return err
+			}
+		} else {
+			w.elapsed += sample.Duration
+		}
+
+		if _, err := w.block.Write(keyframe, w.elapsed.Milliseconds(), sample.Data); err != nil {
+			return fmt.Errorf("failed to write webm frame: %w", err)
+		}
+	}
+	return nil
+}
+
+// open starts the WebM stream using the frame size of the first keyframe
+func (w *webmTrackWriter) open(keyframe []byte) error {
+	raw := uint(keyframe[6]) | uint(keyframe[7])<<8 | uint(keyframe[8])<<16 | uint(keyframe[9])<<24
+	width := uint64(raw & 0x3FFF)
+	height := uint64((raw >> 16) & 0x3FFF)
+
+	writers, err := webm.NewSimpleBlockWriter(w.file, []webm.TrackEntry{{
+		Name:        "Video",
+		TrackNumber: 1,
+		TrackUID:    1,
+		CodecID:     "V_VP8",
+		TrackType:   1,
+		Video:       &webm.Video{PixelWidth: width, PixelHeight: height},
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to start webm stream: %w", err)
+	}
+
+	w.block = writers[0]
+	return nil
+}
+
+func (w *webmTrackWriter) Duration() time.Duration {
+	return w.elapsed
+}
+
+func (w *webmTrackWriter) Close() error {
+	if w.block == nil {
+		return w.file.Close()
+	}
+	// Closing the block writer closes the file
+	return w.block.Close()
+}
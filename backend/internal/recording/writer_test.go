@@ -0,0 +1,152 @@
+package recording
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// Synthetic VP8 frames behind a payload descriptor starting a partition. The
+// keyframe is 640x480.
+var (
+	vp8Keyframe   = []byte{0x10, 0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01, 0x00}
+	vp8Interframe = []byte{0x10, 0x11, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	opusFrame     = []byte{0xf8, 0xff, 0xfe}
+)
+
+func writePackets(t *testing.T, w trackWriter, payloads [][]byte, first uint16, step uint32) {
+	t.Helper()
+	for i, payload := range payloads {
+		seq := first + uint16(i)
+		packet := &rtp.Packet{
+			Header:  rtp.Header{Version: 2, Marker: true, SequenceNumber: seq, Timestamp: uint32(seq) * step},
+			Payload: payload,
+		}
+		if err := w.WriteRTP(packet); err != nil {
+			t.Fatalf("failed to write packet %d: %v", seq, err)
+		}
+	}
+}
+
+func repeat(payload []byte, n int) [][]byte {
+	payloads := make([][]byte, n)
+	for i := range payloads {
+		payloads[i] = payload
+	}
+	return payloads
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return data
+}
+
+func TestRTPClock(t *testing.T) {
+	clock := rtpClock{rate: opusClockRate}
+	clock.observe(0xffffffff - 959)
+	clock.observe(0)
+	clock.observe(960)
+	// A packet from the past does not move the clock back
+	clock.observe(480)
+	clock.observe(1920)
+
+	if got, want := clock.duration(), 60*time.Millisecond; got != want {
+		t.Fatalf("duration across the wraparound = %v, want %v", got, want)
+	}
+}
+
+func TestNewTrackWriterRefusesUnsupportedCodecs(t *testing.T) {
+	_, _, err := newTrackWriter(filepath.Join(t.TempDir(), "track"), webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264})
+	if !errors.Is(err, errUnsupportedCodec) {
+		t.Fatalf("got %v, want %v", err, errUnsupportedCodec)
+	}
+}
+
+func TestOggTrackWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alice_audio_1")
+	w, ext, err := newTrackWriter(path, webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: opusClockRate, Channels: 2})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	if ext != ".ogg" {
+		t.Fatalf("opus written to %q, want .ogg", ext)
+	}
+
+	// Empty packets carry no media and do not count
+	writePackets(t, w, [][]byte{nil}, 0, 960)
+	writePackets(t, w, repeat(opusFrame, 51), 1, 960)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if got, want := w.Duration(), time.Second; got != want {
+		t.Fatalf("duration = %v, want %v", got, want)
+	}
+	if data := readFile(t, path+ext); !bytes.HasPrefix(data, []byte("OggS")) {
+		t.Fatalf("file does not start with an ogg page: %x", data[:min(len(data), 8)])
+	}
+}
+
+func TestWebMTrackWriterStartsAtKeyframe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alice_video_1")
+	w, ext, err := newTrackWriter(path, webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: vp8ClockRate})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	if ext != ".webm" {
+		t.Fatalf("vp8 written to %q, want .webm", ext)
+	}
+
+	writePackets(t, w, repeat(vp8Interframe, 10), 0, 3000)
+	if info, err := os.Stat(path + ext); err != nil || info.Size() != 0 {
+		t.Fatalf("frames before the first keyframe were written: %v %v", info, err)
+	}
+
+	payloads := append([][]byte{vp8Keyframe}, repeat(vp8Interframe, 30)...)
+	writePackets(t, w, payloads, 10, 3000)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// The last frame is held back until the next one shows where it ends
+	if got := w.Duration(); got < 900*time.Millisecond || got > time.Second {
+		t.Fatalf("duration = %v, want the 29 frames after the keyframe", got)
+	}
+	data := readFile(t, path+ext)
+	if !bytes.HasPrefix(data, []byte{0x1a, 0x45, 0xdf, 0xa3}) {
+		t.Fatalf("file does not start with an EBML header: %x", data[:min(len(data), 8)])
+	}
+	if !bytes.Contains(data, []byte("V_VP8")) {
+		t.Fatal("file does not declare a VP8 track")
+	}
+}
+
+func TestWebMTrackWriterWithoutKeyframe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alice_video_1")
+	w, ext, err := newTrackWriter(path, webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: vp8ClockRate})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	writePackets(t, w, repeat(vp8Interframe, 10), 0, 3000)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// The track still shows up in the recording, empty
+	if info, err := os.Stat(path + ext); err != nil || info.Size() != 0 {
+		t.Fatalf("got %v %v, want an empty file", info, err)
+	}
+	if w.Duration() != 0 {
+		t.Fatalf("duration = %v, want 0", w.Duration())
+	}
+}
@@ -2,27 +2,69 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 	"video-conference-backend/internal/config"
 	"video-conference-backend/internal/database"
 	"video-conference-backend/internal/models"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	// ErrPasswordResetThrottled is returned for reset requests over the
+	// per-email or per-IP limit
+	ErrPasswordResetThrottled = errors.New("too many password reset requests")
+	// ErrInvalidResetToken is returned for reset tokens that are unknown,
+	// used or expired
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+	// ErrInvalidMFAToken is returned for MFA tokens that are invalid or
+	// have expired
+	ErrInvalidMFAToken = errors.New("invalid or expired MFA token")
+)
+
+// mfaTokenExpiry is how long users have to enter their second factor
+const mfaTokenExpiry = 5 * time.Minute
+
+// AuthService issues and validates tokens. Every login starts a session,
+// backed by its refresh token, which can be revoked along with the access
+// token last issued to it. Users with a second factor, or whose client
+// requires one, log in in two steps: the password yields an mfa_pending
+// token, which a TOTP or recovery code exchanges for the session. Users
+// signing in through their client's identity provider do the same.
 type AuthService interface {
-	Login(ctx context.Context, email, password string) (*models.AuthResponse, error)
-	RefreshToken(ctx context.Context, refreshToken string) (*models.AuthResponse, error)
+	Login(ctx context.Context, email, password string, client *models.SessionClient) (*models.AuthResponse, error)
+	LoginWithMFA(ctx context.Context, mfaToken, code string, client *models.SessionClient) (*models.AuthResponse, error)
+	LoginWithSSO(ctx context.Context, user *models.User, client *models.SessionClient) (*models.AuthResponse, error)
+	BeginMFAEnrollment(ctx context.Context, mfaToken string) (*models.MFASetup, error)
+	CompleteMFAEnrollment(ctx context.Context, mfaToken, code string, client *models.SessionClient) (*models.AuthResponse, error)
+	RefreshToken(ctx context.Context, refreshToken string, client *models.SessionClient) (*models.AuthResponse, error)
 	ValidateToken(ctx context.Context, tokenString string) (*models.JWTClaims, error)
-	Logout(ctx context.Context, userID int, refreshToken string) error
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	Logout(ctx context.Context, userID int, refreshToken, tokenID string) error
+	ListSessions(ctx context.Context, userID int, tokenID string) ([]*models.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID int) error
+	RevokeAllSessions(ctx context.Context, userID int) (int, error)
 	RegisterUser(ctx context.Context, req *models.RegisterRequest) (*models.User, error)
-	ResetPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, email, ipAddress string) (*models.User, string, error)
+	VerifyPasswordResetToken(ctx context.Context, token string) (*models.User, error)
+	CompletePasswordReset(ctx context.Context, token, newPassword string) (*models.User, error)
 	ChangePassword(ctx context.Context, userID int, req *models.ChangePasswordRequest) error
 }
 
 type authService struct {
 	db      *database.DB
 	userSvc UserService
+	mfaSvc  MFAService
 	config  *config.AuthConfig
 }
 
@@ -30,24 +72,104 @@ func NewAuthService(db *database.DB, cfg *config.AuthConfig) AuthService {
 	return &authService{
 		db:      db,
 		userSvc: NewUserService(db),
+		mfaSvc:  NewMFAService(db),
 		config:  cfg,
 	}
 }
 
-func (s *authService) Login(ctx context.Context, email, password string) (*models.AuthResponse, error) {
+func (s *authService) Login(ctx context.Context, email, password string, client *models.SessionClient) (*models.AuthResponse, error) {
 	// Verify user credentials
 	user, err := s.userSvc.VerifyUserPassword(ctx, email, password)
 	if err != nil {
 		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
 
+	return s.completeLogin(ctx, user, client)
+}
+
+// LoginWithSSO completes the login of a user their client's identity
+// provider authenticated
+func (s *authService) LoginWithSSO(ctx context.Context, user *models.User, client *models.SessionClient) (*models.AuthResponse, error) {
+	return s.completeLogin(ctx, user, client)
+}
+
+// completeLogin starts a session for an authenticated user, or asks for
+// their second factor first
+func (s *authService) completeLogin(ctx context.Context, user *models.User, client *models.SessionClient) (*models.AuthResponse, error) {
 	// Check if user is active
 	if user.Status != "active" {
 		return nil, fmt.Errorf("user account is not active")
 	}
 
+	// A second factor, or enrolling one, completes the login
+	mfa, err := s.mfaSvc.GetStatus(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Enabled || mfa.Required {
+		mfaToken, err := s.generateMFAToken(user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate MFA token: %w", err)
+		}
+		return &models.AuthResponse{
+			ExpiresIn:             int(mfaTokenExpiry.Seconds()),
+			MFARequired:           true,
+			MFAEnrollmentRequired: !mfa.Enabled,
+			MFAToken:              mfaToken,
+		}, nil
+	}
+
+	return s.startSession(ctx, user, client)
+}
+
+// LoginWithMFA completes a login with a TOTP or recovery code
+func (s *authService) LoginWithMFA(ctx context.Context, mfaToken, code string, client *models.SessionClient) (*models.AuthResponse, error) {
+	user, err := s.mfaTokenUser(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaSvc.Verify(ctx, user.ID, code); err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, user, client)
+}
+
+// BeginMFAEnrollment starts enrolling a second factor for a user whose
+// client requires one, at login
+func (s *authService) BeginMFAEnrollment(ctx context.Context, mfaToken string) (*models.MFASetup, error) {
+	user, err := s.mfaTokenUser(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.mfaSvc.Setup(ctx, user)
+}
+
+// CompleteMFAEnrollment confirms the second factor enrolled at login and
+// completes the login, returning the recovery codes with the session
+func (s *authService) CompleteMFAEnrollment(ctx context.Context, mfaToken, code string, client *models.SessionClient) (*models.AuthResponse, error) {
+	user, err := s.mfaTokenUser(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := s.mfaSvc.Enable(ctx, user.ID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	response.RecoveryCodes = codes
+	return response, nil
+}
+
+// startSession issues a user's tokens, storing the refresh token as a new
+// session
+func (s *authService) startSession(ctx context.Context, user *models.User, client *models.SessionClient) (*models.AuthResponse, error) {
 	// Generate tokens
-	accessToken, err := s.generateAccessToken(user)
+	tokenID := uuid.New().String()
+	accessToken, err := s.generateAccessToken(user, tokenID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -58,7 +180,7 @@ func (s *authService) Login(ctx context.Context, email, password string) (*model
 	}
 
 	// Store refresh token in database
-	err = s.storeRefreshToken(ctx, user.ID, refreshToken)
+	err = s.storeRefreshToken(ctx, user.ID, refreshToken, tokenID, client)
 	if err != nil {
 		return nil, fmt.Errorf("failed to store refresh token: %w", err)
 	}
@@ -80,7 +202,7 @@ func (s *authService) Login(ctx context.Context, email, password string) (*model
 	}, nil
 }
 
-func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*models.AuthResponse, error) {
+func (s *authService) RefreshToken(ctx context.Context, refreshToken string, client *models.SessionClient) (*models.AuthResponse, error) {
 	// Validate refresh token
 	claims, err := s.validateRefreshToken(refreshToken)
 	if err != nil {
@@ -99,8 +221,19 @@ func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*m
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
 
+	// Sessions from before the client required MFA end with their access
+	// token, so the user logs in again and enrolls
+	mfa, err := s.mfaSvc.GetStatus(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Required && !mfa.Enabled {
+		return nil, ErrMFARequired
+	}
+
 	// Generate new tokens
-	newAccessToken, err := s.generateAccessToken(user)
+	tokenID := uuid.New().String()
+	newAccessToken, err := s.generateAccessToken(user, tokenID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -111,7 +244,7 @@ func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*m
 	}
 
 	// Update refresh token in database
-	err = s.updateRefreshToken(ctx, claims.UserID, refreshToken, newRefreshToken)
+	err = s.updateRefreshToken(ctx, claims.UserID, refreshToken, newRefreshToken, tokenID, client)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update refresh token: %w", err)
 	}
@@ -152,15 +285,72 @@ func (s *authService) ValidateToken(ctx context.Context, tokenString string) (*m
 	return nil, fmt.Errorf("invalid token")
 }
 
-func (s *authService) Logout(ctx context.Context, userID int, refreshToken string) error {
-	query := `DELETE FROM refresh_tokens WHERE user_id = $1 AND token = $2`
-	_, err := s.db.ExecContext(ctx, query, userID, refreshToken)
-	if err != nil {
+// IsTokenRevoked reports whether the access token with the given jti was
+// revoked. Tokens issued without a jti cannot be revoked.
+func (s *authService) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	if tokenID == "" {
+		return false, nil
+	}
+
+	var revoked bool
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1 AND expires_at > CURRENT_TIMESTAMP)`
+	if err := s.db.GetContext(ctx, &revoked, query, tokenID); err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+// Logout ends the session of the given refresh token, or else the one the
+// access token with the given jti was issued to, and revokes that access token
+func (s *authService) Logout(ctx context.Context, userID int, refreshToken, tokenID string) error {
+	if _, err := s.revokeSessions(ctx, userID, "(token = $3 OR access_token_id = $4)", refreshToken, tokenID); err != nil {
+		return fmt.Errorf("failed to logout: %w", err)
+	}
+	if err := s.revokeToken(ctx, userID, tokenID); err != nil {
 		return fmt.Errorf("failed to logout: %w", err)
 	}
 	return nil
 }
 
+// ListSessions returns the user's active sessions, most recently used first.
+// The session the access token with the given jti belongs to is marked current.
+func (s *authService) ListSessions(ctx context.Context, userID int, tokenID string) ([]*models.Session, error) {
+	query := `
+		SELECT id, user_agent, ip_address, created_at, last_used_at, expires_at,
+			COALESCE(access_token_id = $2, FALSE) AS current
+		FROM refresh_tokens
+		WHERE user_id = $1 AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_used_at DESC`
+
+	sessions := []*models.Session{}
+	if err := s.db.SelectContext(ctx, &sessions, query, userID, tokenID); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one of the user's sessions
+func (s *authService) RevokeSession(ctx context.Context, userID, sessionID int) error {
+	revoked, err := s.revokeSessions(ctx, userID, "id = $3", sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if revoked == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
+}
+
+// RevokeAllSessions ends every session of the user and returns how many
+// there were
+func (s *authService) RevokeAllSessions(ctx context.Context, userID int) (int, error) {
+	revoked, err := s.revokeSessions(ctx, userID, "TRUE")
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return revoked, nil
+}
+
 func (s *authService) RegisterUser(ctx context.Context, req *models.RegisterRequest) (*models.User, error) {
 	user := &models.User{
 		ClientID:  req.ClientID,
@@ -180,37 +370,133 @@ func (s *authService) RegisterUser(ctx context.Context, req *models.RegisterRequ
 	return user, nil
 }
 
-func (s *authService) ResetPassword(ctx context.Context, email string) error {
+// ResetPassword records a reset request for throttling and, when the email
+// belongs to an active user, issues them a single-use reset token of which
+// only the hash is stored. Unknown emails return no user and no error, so
+// callers can answer both alike.
+func (s *authService) ResetPassword(ctx context.Context, email, ipAddress string) (*models.User, string, error) {
+	email = strings.TrimSpace(email)
+	if err := s.throttlePasswordReset(ctx, strings.ToLower(email), ipAddress); err != nil {
+		return nil, "", err
+	}
+
 	user, err := s.userSvc.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user.Status != "active") {
+		return nil, "", nil
+	}
 	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		return nil, "", err
 	}
 
 	// Generate reset token
-	resetToken, err := s.generatePasswordResetToken(user)
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	resetToken := base64.RawURLEncoding.EncodeToString(key)
+
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to generate reset token: %w", err)
+		return nil, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Only the latest link works
+	if _, err := tx.ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`, user.ID); err != nil {
+		return nil, "", fmt.Errorf("failed to replace reset token: %w", err)
 	}
 
-	// Store reset token with expiry
 	query := `
-		INSERT INTO password_reset_tokens (user_id, token, expires_at)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (user_id) DO UPDATE SET
-			token = EXCLUDED.token,
-			expires_at = EXCLUDED.expires_at,
-			created_at = CURRENT_TIMESTAMP`
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)`
 
 	expiresAt := time.Now().Add(s.config.PasswordResetExpiry)
-	_, err = s.db.ExecContext(ctx, query, user.ID, resetToken, expiresAt)
+	if _, err := tx.ExecContext(ctx, query, user.ID, hashToken(resetToken), expiresAt); err != nil {
+		return nil, "", fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return user, resetToken, nil
+}
+
+// VerifyPasswordResetToken returns the user a reset token was issued to,
+// without redeeming it
+func (s *authService) VerifyPasswordResetToken(ctx context.Context, token string) (*models.User, error) {
+	var userID int
+	query := `
+		SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+
+	err := s.db.GetContext(ctx, &userID, query, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reset token: %w", err)
+	}
+
+	user, err := s.userSvc.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != "active" {
+		return nil, ErrInvalidResetToken
+	}
+	return user, nil
+}
+
+// CompletePasswordReset redeems a reset token, sets the user's new password
+// and signs them out of every session
+func (s *authService) CompletePasswordReset(ctx context.Context, token, newPassword string) (*models.User, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash new password: %w", err)
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to store reset token: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	// TODO: Send email with reset token
-	// This would integrate with the email service
+	var userID int
+	query := `
+		UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id`
 
-	return nil
+	err = tx.GetContext(ctx, &userID, query, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem reset token: %w", err)
+	}
+
+	query = `
+		UPDATE users
+		SET password_hash = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'active'`
+
+	result, err := tx.ExecContext(ctx, query, userID, string(hashedPassword))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update password: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return nil, ErrInvalidResetToken
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// Whoever knew the old password is signed out
+	if _, err := s.RevokeAllSessions(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.userSvc.GetUserByID(ctx, userID)
 }
 
 func (s *authService) ChangePassword(ctx context.Context, userID int, req *models.ChangePasswordRequest) error {
@@ -219,7 +505,7 @@ func (s *authService) ChangePassword(ctx context.Context, userID int, req *model
 
 // Helper methods
 
-func (s *authService) generateAccessToken(user *models.User) (string, error) {
+func (s *authService) generateAccessToken(user *models.User, tokenID string) (string, error) {
 	claims := &models.JWTClaims{
 		UserID:   user.ID,
 		ClientID: user.ClientID,
@@ -227,6 +513,7 @@ func (s *authService) generateAccessToken(user *models.User) (string, error) {
 		Role:     user.Role,
 		TokenType: "access",
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.AccessTokenExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "video-conference-platform",
@@ -245,6 +532,7 @@ func (s *authService) generateRefreshToken(user *models.User) (string, error) {
 		Role:     user.Role,
 		TokenType: "refresh",
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.RefreshTokenExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "video-conference-platform",
@@ -255,13 +543,16 @@ func (s *authService) generateRefreshToken(user *models.User) (string, error) {
 	return token.SignedString([]byte(s.config.JWTSecret))
 }
 
-func (s *authService) generatePasswordResetToken(user *models.User) (string, error) {
+func (s *authService) generateMFAToken(user *models.User) (string, error) {
 	claims := &models.JWTClaims{
-		UserID:   user.ID,
-		Email:    user.Email,
-		TokenType: "password_reset",
+		UserID:    user.ID,
+		ClientID:  user.ClientID,
+		Email:     user.Email,
+		Role:      user.Role,
+		TokenType: "mfa_pending",
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.PasswordResetExpiry)),
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaTokenExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "video-conference-platform",
 		},
@@ -271,6 +562,20 @@ func (s *authService) generatePasswordResetToken(user *models.User) (string, err
 	return token.SignedString([]byte(s.config.JWTSecret))
 }
 
+// mfaTokenUser returns the active user an mfa_pending token was issued to
+func (s *authService) mfaTokenUser(ctx context.Context, mfaToken string) (*models.User, error) {
+	claims, err := s.ValidateToken(ctx, mfaToken)
+	if err != nil || claims.TokenType != "mfa_pending" {
+		return nil, ErrInvalidMFAToken
+	}
+
+	user, err := s.userSvc.GetUserByID(ctx, claims.UserID)
+	if err != nil || user.Status != "active" {
+		return nil, ErrInvalidMFAToken
+	}
+	return user, nil
+}
+
 func (s *authService) validateRefreshToken(tokenString string) (*models.JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(s.config.JWTSecret), nil
@@ -287,13 +592,14 @@ func (s *authService) validateRefreshToken(tokenString string) (*models.JWTClaim
 	return nil, fmt.Errorf("invalid refresh token")
 }
 
-func (s *authService) storeRefreshToken(ctx context.Context, userID int, token string) error {
+func (s *authService) storeRefreshToken(ctx context.Context, userID int, token, tokenID string, client *models.SessionClient) error {
 	query := `
-		INSERT INTO refresh_tokens (user_id, token, expires_at)
-		VALUES ($1, $2, $3)`
+		INSERT INTO refresh_tokens (user_id, token, expires_at, access_token_id, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6)`
 
 	expiresAt := time.Now().Add(s.config.RefreshTokenExpiry)
-	_, err := s.db.ExecContext(ctx, query, userID, token, expiresAt)
+	userAgent, ipAddress := sessionClientColumns(client)
+	_, err := s.db.ExecContext(ctx, query, userID, token, expiresAt, tokenID, userAgent, ipAddress)
 	return err
 }
 
@@ -307,13 +613,154 @@ func (s *authService) isRefreshTokenValid(ctx context.Context, userID int, token
 	return count > 0, err
 }
 
-func (s *authService) updateRefreshToken(ctx context.Context, userID int, oldToken, newToken string) error {
+// updateRefreshToken rotates a session's tokens. The access token issued
+// before is deny-listed, so revoking the session later catches every access
+// token it ever had.
+func (s *authService) updateRefreshToken(ctx context.Context, userID int, oldToken, newToken, tokenID string, client *models.SessionClient) error {
 	query := `
-		UPDATE refresh_tokens 
-		SET token = $3, expires_at = $4, updated_at = CURRENT_TIMESTAMP
-		WHERE user_id = $1 AND token = $2`
+		WITH previous AS (
+			SELECT id, access_token_id FROM refresh_tokens
+			WHERE user_id = $1 AND token = $2
+			FOR UPDATE
+		), rotated AS (
+			UPDATE refresh_tokens r
+			SET token = $3, expires_at = $4, access_token_id = $5,
+				user_agent = COALESCE($6, r.user_agent), ip_address = COALESCE($7, r.ip_address),
+				last_used_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			FROM previous
+			WHERE r.id = previous.id
+			RETURNING previous.access_token_id
+		), denied AS (
+			INSERT INTO revoked_tokens (jti, user_id, expires_at)
+			SELECT access_token_id, $1, CURRENT_TIMESTAMP + $8 * INTERVAL '1 second'
+			FROM rotated
+			WHERE access_token_id IS NOT NULL
+			ON CONFLICT (jti) DO NOTHING
+		)
+		SELECT COUNT(*) FROM rotated`
 
 	expiresAt := time.Now().Add(s.config.RefreshTokenExpiry)
-	_, err := s.db.ExecContext(ctx, query, userID, oldToken, newToken, expiresAt)
+	userAgent, ipAddress := sessionClientColumns(client)
+	var rotated int
+	err := s.db.GetContext(ctx, &rotated, query, userID, oldToken, newToken, expiresAt, tokenID, userAgent, ipAddress,
+		int(s.config.AccessTokenExpiry.Seconds()))
+	if err != nil {
+		return err
+	}
+	// The session may have been revoked since the token was checked
+	if rotated == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
+}
+
+// sessionClientColumns returns the user_agent and ip_address to store for a
+// session, NULL where unknown
+func sessionClientColumns(client *models.SessionClient) (*string, *string) {
+	if client == nil {
+		return nil, nil
+	}
+	var userAgent, ipAddress *string
+	if client.UserAgent != "" {
+		userAgent = &client.UserAgent
+	}
+	if client.IPAddress != "" {
+		ipAddress = &client.IPAddress
+	}
+	return userAgent, ipAddress
+}
+
+// revokeSessions deletes the user's sessions matching condition, a fixed
+// filter on refresh_tokens whose arguments start at $3, and deny-lists the
+// access tokens last issued to them. Any access token expires within the
+// access token lifetime from now, so deny-list entries are kept that long.
+func (s *authService) revokeSessions(ctx context.Context, userID int, condition string, args ...interface{}) (int, error) {
+	query := fmt.Sprintf(`
+		WITH ended AS (
+			DELETE FROM refresh_tokens
+			WHERE user_id = $1 AND %s
+			RETURNING access_token_id
+		), denied AS (
+			INSERT INTO revoked_tokens (jti, user_id, expires_at)
+			SELECT access_token_id, $1, CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+			FROM ended
+			WHERE access_token_id IS NOT NULL
+			ON CONFLICT (jti) DO NOTHING
+		)
+		SELECT COUNT(*) FROM ended`, condition)
+
+	var revoked int
+	args = append([]interface{}{userID, int(s.config.AccessTokenExpiry.Seconds())}, args...)
+	if err := s.db.GetContext(ctx, &revoked, query, args...); err != nil {
+		return 0, err
+	}
+
+	s.pruneExpired(ctx)
+	return revoked, nil
+}
+
+// revokeToken deny-lists a single access token
+func (s *authService) revokeToken(ctx context.Context, userID int, tokenID string) error {
+	if tokenID == "" {
+		return nil
+	}
+
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + $3 * INTERVAL '1 second')
+		ON CONFLICT (jti) DO NOTHING`
+
+	_, err := s.db.ExecContext(ctx, query, tokenID, userID, int(s.config.AccessTokenExpiry.Seconds()))
 	return err
+}
+
+// pruneExpired drops sessions and deny-list entries that have expired
+func (s *authService) pruneExpired(ctx context.Context) {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= CURRENT_TIMESTAMP`); err != nil {
+		log.Printf("Failed to prune revoked tokens: %v", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE expires_at <= CURRENT_TIMESTAMP`); err != nil {
+		log.Printf("Failed to prune expired sessions: %v", err)
+	}
+}
+
+// throttlePasswordReset refuses a reset request when its email or IP address
+// is over the limit within the window, and records it otherwise. Requests
+// for unknown emails count the same.
+func (s *authService) throttlePasswordReset(ctx context.Context, email, ipAddress string) error {
+	since := time.Now().Add(-s.config.PasswordResetWindow)
+	var recent struct {
+		Email int `db:"email"`
+		IP    int `db:"ip"`
+	}
+	query := `
+		SELECT COUNT(*) FILTER (WHERE email = $1) AS email,
+			COUNT(*) FILTER (WHERE ip_address = $2) AS ip
+		FROM password_reset_requests
+		WHERE created_at > $3 AND (email = $1 OR ip_address = $2)`
+
+	if err := s.db.GetContext(ctx, &recent, query, email, ipAddress, since); err != nil {
+		return fmt.Errorf("failed to check password reset rate: %w", err)
+	}
+	if s.config.PasswordResetMaxPerEmail > 0 && recent.Email >= s.config.PasswordResetMaxPerEmail {
+		return ErrPasswordResetThrottled
+	}
+	if s.config.PasswordResetMaxPerIP > 0 && ipAddress != "" && recent.IP >= s.config.PasswordResetMaxPerIP {
+		return ErrPasswordResetThrottled
+	}
+
+	query = `INSERT INTO password_reset_requests (email, ip_address) VALUES ($1, NULLIF($2, ''))`
+	if _, err := s.db.ExecContext(ctx, query, email, ipAddress); err != nil {
+		return fmt.Errorf("failed to record password reset request: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM password_reset_requests WHERE created_at <= $1`, since); err != nil {
+		log.Printf("Failed to prune password reset requests: %v", err)
+	}
+	return nil
+}
+
+// hashToken returns the form reset tokens and SSO states are stored in
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
\ No newline at end of file
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"video-conference-backend/internal/database"
+	"video-conference-backend/internal/models"
+)
+
+var (
+	// ErrBreakoutNotFound is returned when a meeting has no open breakout
+	// session, or a participant no assignment in it
+	ErrBreakoutNotFound = errors.New("breakout session not found")
+	// ErrBreakoutsOpen is returned when opening a session for a meeting that
+	// already has one open
+	ErrBreakoutsOpen = errors.New("breakout rooms are already open")
+)
+
+// BreakoutService persists breakout sessions, their rooms and who is
+// assigned to each, so reconnecting participants return to their room
+type BreakoutService interface {
+	OpenSession(ctx context.Context, session *models.BreakoutSession, plan []*BreakoutRoomPlan) error
+	GetOpenSession(ctx context.Context, meetingID int) (*models.BreakoutSession, error)
+	CloseSession(ctx context.Context, sessionID int) (bool, error)
+
+	ListRooms(ctx context.Context, sessionID int) ([]*models.BreakoutRoom, error)
+	ListAssignments(ctx context.Context, sessionID int) ([]*models.BreakoutAssignment, error)
+	GetAssignment(ctx context.Context, sessionID int, participantID string) (*models.BreakoutAssignment, error)
+	Assign(ctx context.Context, assignment *models.BreakoutAssignment) error
+	Unassign(ctx context.Context, sessionID int, participantID string) error
+}
+
+// BreakoutRoomPlan is a room to open with the participants placed in it
+type BreakoutRoomPlan struct {
+	Room        *models.BreakoutRoom
+	Assignments []*models.BreakoutAssignment
+}
+
+type breakoutService struct {
+	db *database.DB
+}
+
+// NewBreakoutService creates a new breakout service
+func NewBreakoutService(db *database.DB) BreakoutService {
+	return &breakoutService{db: db}
+}
+
+// OpenSession stores a new session with its rooms and initial assignments
+func (s *breakoutService) OpenSession(ctx context.Context, session *models.BreakoutSession, plan []*BreakoutRoomPlan) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the meeting row so two hosts cannot open sessions at once
+	var open bool
+	err = tx.QueryRowxContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM breakout_sessions WHERE meeting_id = m.id AND closed_at IS NULL)
+		FROM meetings m
+		WHERE m.id = $1
+		FOR UPDATE OF m`, session.MeetingID).Scan(&open)
+	if err != nil {
+		return fmt.Errorf("failed to get meeting: %w", err)
+	}
+	if open {
+		return ErrBreakoutsOpen
+	}
+
+	err = tx.GetContext(ctx, session, `
+		INSERT INTO breakout_sessions (meeting_id, mode, allow_return, started_by_user_id, ends_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, started_at`,
+		session.MeetingID, session.Mode, session.AllowReturn, session.StartedByUserID, session.EndsAt)
+	if err != nil {
+		return fmt.Errorf("failed to open breakout session: %w", err)
+	}
+
+	for _, planned := range plan {
+		room := planned.Room
+		room.SessionID = session.ID
+		err = tx.GetContext(ctx, room, `
+			INSERT INTO breakout_rooms (session_id, name, position)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at`, room.SessionID, room.Name, room.Position)
+		if err != nil {
+			return fmt.Errorf("failed to create breakout room: %w", err)
+		}
+
+		for _, assignment := range planned.Assignments {
+			assignment.SessionID = session.ID
+			assignment.BreakoutRoomID = room.ID
+			err = tx.GetContext(ctx, assignment, `
+				INSERT INTO breakout_assignments (session_id, participant_id, breakout_room_id, user_id)
+				VALUES ($1, $2, $3, $4)
+				RETURNING assigned_at`,
+				assignment.SessionID, assignment.ParticipantID, assignment.BreakoutRoomID, assignment.UserID)
+			if err != nil {
+				return fmt.Errorf("failed to assign breakout room: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *breakoutService) GetOpenSession(ctx context.Context, meetingID int) (*models.BreakoutSession, error) {
+	session := &models.BreakoutSession{}
+	query := `SELECT * FROM breakout_sessions WHERE meeting_id = $1 AND closed_at IS NULL`
+
+	err := s.db.GetContext(ctx, session, query, meetingID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBreakoutNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get breakout session: %w", err)
+	}
+
+	return session, nil
+}
+
+// CloseSession closes a session, reporting whether this call closed it
+func (s *breakoutService) CloseSession(ctx context.Context, sessionID int) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE breakout_sessions SET closed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND closed_at IS NULL`, sessionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to close breakout session: %w", err)
+	}
+
+	closed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to close breakout session: %w", err)
+	}
+	return closed > 0, nil
+}
+
+func (s *breakoutService) ListRooms(ctx context.Context, sessionID int) ([]*models.BreakoutRoom, error) {
+	rooms := []*models.BreakoutRoom{}
+	query := `SELECT * FROM breakout_rooms WHERE session_id = $1 ORDER BY position`
+
+	err := s.db.SelectContext(ctx, &rooms, query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list breakout rooms: %w", err)
+	}
+
+	return rooms, nil
+}
+
+func (s *breakoutService) ListAssignments(ctx context.Context, sessionID int) ([]*models.BreakoutAssignment, error) {
+	assignments := []*models.BreakoutAssignment{}
+	query := `SELECT * FROM breakout_assignments WHERE session_id = $1 ORDER BY assigned_at`
+
+	err := s.db.SelectContext(ctx, &assignments, query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list breakout assignments: %w", err)
+	}
+
+	return assignments, nil
+}
+
+func (s *breakoutService) GetAssignment(ctx context.Context, sessionID int, participantID string) (*models.BreakoutAssignment, error) {
+	assignment := &models.BreakoutAssignment{}
+	query := `SELECT * FROM breakout_assignments WHERE session_id = $1 AND participant_id = $2`
+
+	err := s.db.GetContext(ctx, assignment, query, sessionID, participantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBreakoutNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get breakout assignment: %w", err)
+	}
+
+	return assignment, nil
+}
+
+// Assign places a participant in a room of the session, moving them out of
+// any room they were in
+func (s *breakoutService) Assign(ctx context.Context, assignment *models.BreakoutAssignment) error {
+	query := `
+		INSERT INTO breakout_assignments (session_id, participant_id, breakout_room_id, user_id)
+		SELECT $1, $2, id, $4 FROM breakout_rooms WHERE id = $3 AND session_id = $1
+		ON CONFLICT (session_id, participant_id) DO UPDATE SET
+			breakout_room_id = EXCLUDED.breakout_room_id, assigned_at = CURRENT_TIMESTAMP
+		RETURNING assigned_at`
+
+	err := s.db.GetContext(ctx, assignment, query,
+		assignment.SessionID, assignment.ParticipantID, assignment.BreakoutRoomID, assignment.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrBreakoutNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to assign breakout room: %w", err)
+	}
+
+	return nil
+}
+
+func (s *breakoutService) Unassign(ctx context.Context, sessionID int, participantID string) error {
+	query := `DELETE FROM breakout_assignments WHERE session_id = $1 AND participant_id = $2`
+
+	_, err := s.db.ExecContext(ctx, query, sessionID, participantID)
+	if err != nil {
+		return fmt.Errorf("failed to remove breakout assignment: %w", err)
+	}
+
+	return nil
+}
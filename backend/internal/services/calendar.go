@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"video-conference-backend/internal/models"
@@ -60,7 +61,7 @@ func (s *CalendarService) CreateCalendarEvent(meeting *models.Meeting, inviterEm
 	// Create Google Calendar event structure
 	event := &GoogleCalendarEvent{
 		Summary:     meeting.Title,
-		Description: fmt.Sprintf("%s\n\nJoin meeting: %s", meeting.Description, meetingLink),
+		Description: fmt.Sprintf("%s\n\nJoin meeting: %s", derefString(meeting.Description), meetingLink),
 		Start: GoogleCalendarDateTime{
 			DateTime: meeting.ScheduledStart.Format(time.RFC3339),
 			TimeZone: "UTC", // You can make this configurable
@@ -96,16 +97,18 @@ func (s *CalendarService) CreateCalendarEvent(meeting *models.Meeting, inviterEm
 	return event, nil
 }
 
-// GenerateICSContent generates ICS (iCalendar) content for email attachments
+// GenerateICSContent generates ICS (iCalendar) content for email attachments.
+// A recurring series carries its RRULE and EXDATEs, with times given in the
+// series' time zone so that clients expand it the same way the server does.
+// The zone is described by a VTIMEZONE, as RFC 5545 requires for a TZID.
 func (s *CalendarService) GenerateICSContent(meeting *models.Meeting, meetingLink string) string {
 	// Generate a simple ICS file content
 	icsContent := fmt.Sprintf(`BEGIN:VCALENDAR
 VERSION:2.0
 PRODID:-//Video Conference Platform//EN
-BEGIN:VEVENT
+%sBEGIN:VEVENT
 UID:meeting-%s@videoconference.platform
-DTSTART:%s
-DTEND:%s
+%s
 SUMMARY:%s
 DESCRIPTION:%s\n\nJoin meeting: %s
 LOCATION:Video Conference Platform
@@ -118,11 +121,11 @@ DESCRIPTION:Meeting reminder: %s
 END:VALARM
 END:VEVENT
 END:VCALENDAR`,
+		icsTimezone(meeting),
 		meeting.MeetingID,
-		meeting.ScheduledStart.Format("20060102T150405Z"),
-		meeting.ScheduledEnd.Format("20060102T150405Z"),
+		icsSchedule(meeting),
 		meeting.Title,
-		meeting.Description,
+		derefString(meeting.Description),
 		meetingLink,
 		meeting.Title,
 	)
@@ -130,6 +133,122 @@ END:VCALENDAR`,
 	return icsContent
 }
 
+// icsSchedule returns the DTSTART and DTEND lines of a meeting, followed by
+// RRULE and EXDATE lines when it is a recurring series
+func icsSchedule(meeting *models.Meeting) string {
+	if !meeting.IsRecurring() {
+		return fmt.Sprintf("DTSTART:%s\nDTEND:%s",
+			meeting.ScheduledStart.UTC().Format(icsDateTimeUTC),
+			meeting.ScheduledEnd.UTC().Format(icsDateTimeUTC))
+	}
+
+	// Times in a zone other than UTC are written as local times with a TZID
+	format := func(name string, t time.Time) string {
+		return fmt.Sprintf("%s:%s", name, t.UTC().Format(icsDateTimeUTC))
+	}
+	if loc := icsLocation(meeting); loc != nil {
+		format = func(name string, t time.Time) string {
+			return fmt.Sprintf("%s;TZID=%s:%s", name, loc.String(), t.In(loc).Format(icsDateTimeLocal))
+		}
+	}
+
+	lines := []string{
+		format("DTSTART", meeting.ScheduledStart),
+		format("DTEND", meeting.ScheduledEnd),
+		"RRULE:" + *meeting.RecurrenceRule,
+	}
+	for _, exdate := range meeting.RecurrenceExDates {
+		lines = append(lines, format("EXDATE", exdate))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// icsTimezoneYears is how far ahead the VTIMEZONE of a series without an
+// end lists the zone's offset changes
+const icsTimezoneYears = 10
+
+// icsLocation returns the zone a recurring series is written in, or nil when
+// its times are written in UTC
+func icsLocation(meeting *models.Meeting) *time.Location {
+	if !meeting.IsRecurring() || meeting.RecurrenceTimezone == nil {
+		return nil
+	}
+	loc, err := time.LoadLocation(*meeting.RecurrenceTimezone)
+	if err != nil || loc == time.UTC {
+		return nil
+	}
+	return loc
+}
+
+// icsTimezone returns the VTIMEZONE of a series written in a local zone,
+// listing each change of offset from the series' start to its end, or an
+// empty string when the meeting's times are in UTC
+func icsTimezone(meeting *models.Meeting) string {
+	loc := icsLocation(meeting)
+	if loc == nil {
+		return ""
+	}
+
+	from := meeting.ScheduledStart.In(loc)
+	to := from.AddDate(icsTimezoneYears, 0, 0)
+	if rule, err := ParseRecurrenceRule(*meeting.RecurrenceRule); err == nil {
+		switch {
+		case rule.Until != nil:
+			to = rule.Until.Add(meeting.Duration())
+		case rule.Count > 0:
+			// COUNT ends the expansion long before the century is out
+			occurrences := rule.Occurrences(meeting.ScheduledStart, loc, nil, meeting.ScheduledStart, from.AddDate(100, 0, 0))
+			if len(occurrences) > 0 {
+				to = occurrences[len(occurrences)-1].Add(meeting.Duration())
+			}
+		}
+	}
+
+	// An observance starts at a local time read in the offset it replaces
+	observance := func(at time.Time, offsetFrom int) string {
+		kind := "STANDARD"
+		if at.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		name, offsetTo := at.Zone()
+		return strings.Join([]string{
+			"BEGIN:" + kind,
+			"DTSTART:" + at.In(time.FixedZone("", offsetFrom)).Format(icsDateTimeLocal),
+			"TZOFFSETFROM:" + icsOffset(offsetFrom),
+			"TZOFFSETTO:" + icsOffset(offsetTo),
+			"TZNAME:" + name,
+			"END:" + kind,
+		}, "\n")
+	}
+
+	_, offset := from.Zone()
+	lines := []string{"BEGIN:VTIMEZONE", "TZID:" + loc.String(), observance(from, offset)}
+	for at := from; ; {
+		_, next := at.ZoneBounds()
+		if next.IsZero() || next.After(to) {
+			break
+		}
+		_, offset := at.Zone()
+		at = next.In(loc)
+		lines = append(lines, observance(at, offset))
+	}
+	lines = append(lines, "END:VTIMEZONE")
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// icsOffset formats a UTC offset in seconds as RFC 5545 UTC-OFFSET
+func icsOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	offset := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		offset += fmt.Sprintf("%02d", seconds%60)
+	}
+	return offset
+}
+
 // GoogleCalendarWebhook represents a webhook payload for Google Calendar
 type GoogleCalendarWebhook struct {
 	Event       GoogleCalendarEvent `json:"event"`
@@ -206,7 +325,7 @@ func (s *CalendarService) CreateOutlookEvent(meeting *models.Meeting, attendeeEm
 		Subject: meeting.Title,
 		Body: OutlookEventBody{
 			ContentType: "HTML",
-			Content:     fmt.Sprintf("<p>%s</p><p><a href=\"%s\">Join Meeting</a></p>", meeting.Description, meetingLink),
+			Content:     fmt.Sprintf("<p>%s</p><p><a href=\"%s\">Join Meeting</a></p>", derefString(meeting.Description), meetingLink),
 		},
 		Start: OutlookDateTime{
 			DateTime: meeting.ScheduledStart.Format(time.RFC3339),
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// Moderation policy limits, keeping every message check cheap
+const (
+	maxBlockedWords    = 500
+	maxBlockedPatterns = 50
+	maxPatternLength   = 500
+)
+
+// policyCacheTTL is how long a client's compiled policy is reused. Updates
+// made on this node apply at once; other nodes pick them up within the TTL.
+const policyCacheTTL = 30 * time.Second
+
+// ErrInvalidModerationPolicy is returned for policies that cannot be applied
+var ErrInvalidModerationPolicy = errors.New("invalid moderation policy")
+
+// ErrChatRateLimited is wrapped by RateLimitError
+var ErrChatRateLimited = errors.New("sending messages too quickly")
+
+// RateLimitError refuses a message from a sender over the flood limit or
+// inside slow mode
+type RateLimitError struct {
+	SlowMode   bool
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	wait := int((e.RetryAfter + time.Second - 1) / time.Second)
+	if e.SlowMode {
+		return fmt.Sprintf("slow mode is on: wait %d seconds between messages", wait)
+	}
+	return fmt.Sprintf("too many messages: try again in %d seconds", wait)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrChatRateLimited
+}
+
+var (
+	// linkPattern finds URLs, capturing their host
+	linkPattern = regexp.MustCompile(`(?i)(?:https?://|\bwww\.)([a-z0-9.-]+)`)
+	// domainPattern finds bare domains under common top-level domains
+	domainPattern = regexp.MustCompile(`(?i)\b((?:[a-z0-9-]+\.)+(?:com|net|org|io|co|info|biz|xyz|ru|me|ly|gg|app|dev|link|site|online|top|club|shop|live))\b`)
+)
+
+// moderationPolicy is a policy with its rules compiled
+type moderationPolicy struct {
+	*models.ChatModerationPolicy
+	words    *regexp.Regexp
+	patterns []*regexp.Regexp
+	loadedAt time.Time
+}
+
+// policyCache holds compiled policies by client
+type policyCache struct {
+	mu       sync.Mutex
+	policies map[int]*moderationPolicy
+}
+
+func compilePolicy(policy *models.ChatModerationPolicy) (*moderationPolicy, error) {
+	if len(policy.BlockedWords) > maxBlockedWords {
+		return nil, fmt.Errorf("%w: at most %d blocked words", ErrInvalidModerationPolicy, maxBlockedWords)
+	}
+	if len(policy.BlockedPatterns) > maxBlockedPatterns {
+		return nil, fmt.Errorf("%w: at most %d blocked patterns", ErrInvalidModerationPolicy, maxBlockedPatterns)
+	}
+	if policy.FloodMessages < 0 || policy.FloodWindowSeconds < 0 || policy.SlowModeSeconds < 0 {
+		return nil, fmt.Errorf("%w: limits cannot be negative", ErrInvalidModerationPolicy)
+	}
+	if policy.FloodMessages > 0 && policy.FloodWindowSeconds == 0 {
+		return nil, fmt.Errorf("%w: a flood limit needs a window", ErrInvalidModerationPolicy)
+	}
+
+	compiled := &moderationPolicy{ChatModerationPolicy: policy, loadedAt: time.Now()}
+
+	words := []string{}
+	for _, word := range policy.BlockedWords {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, regexp.QuoteMeta(word))
+		}
+	}
+	if len(words) > 0 {
+		// \b only knows ASCII, so word boundaries are spelled out
+		compiled.words = regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}_])(?:` + strings.Join(words, "|") + `)(?:$|[^\p{L}\p{N}_])`)
+	}
+
+	for _, pattern := range policy.BlockedPatterns {
+		if len(pattern) > maxPatternLength {
+			return nil, fmt.Errorf("%w: patterns are limited to %d characters", ErrInvalidModerationPolicy, maxPatternLength)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: pattern %q: %v", ErrInvalidModerationPolicy, pattern, err)
+		}
+		compiled.patterns = append(compiled.patterns, re)
+	}
+
+	return compiled, nil
+}
+
+// check returns why text breaks the policy's content rules, or "" if it
+// does not
+func (p *moderationPolicy) check(text string) string {
+	if p.words != nil && p.words.MatchString(text) {
+		return models.ModerationReasonBlockedWord
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(text) {
+			return models.ModerationReasonPattern
+		}
+	}
+	if p.BlockLinks {
+		for _, re := range []*regexp.Regexp{linkPattern, domainPattern} {
+			for _, match := range re.FindAllStringSubmatch(text, -1) {
+				if !p.allowedDomain(match[1]) {
+					return models.ModerationReasonLink
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func (p *moderationPolicy) allowedDomain(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range p.AllowedDomains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *chatService) GetModerationPolicy(ctx context.Context, clientID int) (*models.ChatModerationPolicy, error) {
+	policy := &models.ChatModerationPolicy{}
+	query := `SELECT * FROM chat_moderation_policies WHERE client_id = $1`
+
+	err := s.db.GetContext(ctx, policy, query, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Clients start without automatic moderation
+		return &models.ChatModerationPolicy{
+			ClientID:        clientID,
+			BlockedWords:    []string{},
+			BlockedPatterns: []string{},
+			AllowedDomains:  []string{},
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moderation policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+func (s *chatService) UpdateModerationPolicy(ctx context.Context, policy *models.ChatModerationPolicy) error {
+	compiled, err := compilePolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO chat_moderation_policies (client_id, enabled, blocked_words, blocked_patterns,
+		                                      block_links, allowed_domains, flood_messages,
+		                                      flood_window_seconds, slow_mode_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (client_id) DO UPDATE SET
+			enabled = EXCLUDED.enabled, blocked_words = EXCLUDED.blocked_words,
+			blocked_patterns = EXCLUDED.blocked_patterns, block_links = EXCLUDED.block_links,
+			allowed_domains = EXCLUDED.allowed_domains, flood_messages = EXCLUDED.flood_messages,
+			flood_window_seconds = EXCLUDED.flood_window_seconds,
+			slow_mode_seconds = EXCLUDED.slow_mode_seconds, updated_at = CURRENT_TIMESTAMP
+		RETURNING created_at, updated_at`
+
+	err = s.db.GetContext(ctx, policy, query,
+		policy.ClientID, policy.Enabled, policy.BlockedWords, policy.BlockedPatterns,
+		policy.BlockLinks, policy.AllowedDomains, policy.FloodMessages,
+		policy.FloodWindowSeconds, policy.SlowModeSeconds)
+	if err != nil {
+		return fmt.Errorf("failed to update moderation policy: %w", err)
+	}
+
+	s.policies.mu.Lock()
+	s.policies.policies[policy.ClientID] = compiled
+	s.policies.mu.Unlock()
+	return nil
+}
+
+// moderationPolicy returns the client's compiled policy, loading it when
+// the cached copy has expired
+func (s *chatService) moderationPolicy(ctx context.Context, clientID int) (*moderationPolicy, error) {
+	s.policies.mu.Lock()
+	cached, ok := s.policies.policies[clientID]
+	s.policies.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < policyCacheTTL {
+		return cached, nil
+	}
+
+	policy, err := s.GetModerationPolicy(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := compilePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	s.policies.mu.Lock()
+	s.policies.policies[clientID] = compiled
+	s.policies.mu.Unlock()
+	return compiled, nil
+}
+
+// moderate applies the client's policy to a message about to be stored. It
+// hides messages breaking the content rules and, for new messages, refuses
+// senders over the rate limits.
+func (s *chatService) moderate(ctx context.Context, message *models.ChatMessage, rateLimit bool) error {
+	if message.MessageType == "system" {
+		return nil
+	}
+
+	policy, err := s.moderationPolicy(ctx, message.ClientID)
+	if err != nil {
+		return err
+	}
+	if !policy.Enabled {
+		return nil
+	}
+
+	if message.SenderID != nil {
+		exempt, err := s.isMeetingModerator(ctx, message.MeetingID, *message.SenderID)
+		if err != nil {
+			return err
+		}
+		if exempt {
+			return nil
+		}
+	}
+
+	if rateLimit {
+		if err := s.checkRate(ctx, policy, message); err != nil {
+			return err
+		}
+	}
+
+	text := message.Message
+	for _, attachment := range decodeAttachments(message.Attachments) {
+		text += "\n" + attachment.Name
+	}
+	if reason := policy.check(text); reason != "" {
+		now := time.Now()
+		message.IsModerated = true
+		message.ModeratedAt = &now
+		if message.Metadata == nil {
+			message.Metadata = models.JSONB{}
+		}
+		message.Metadata[models.ChatMetaModerationReason] = reason
+	}
+	return nil
+}
+
+// checkRate refuses a message when the sender is over the flood limit or
+// sent their last message within slow mode
+func (s *chatService) checkRate(ctx context.Context, policy *moderationPolicy, message *models.ChatMessage) error {
+	flood := time.Duration(policy.FloodWindowSeconds) * time.Second
+	slow := time.Duration(policy.SlowModeSeconds) * time.Second
+	if policy.FloodMessages == 0 {
+		flood = 0
+	}
+	if flood == 0 && slow == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var recent struct {
+		Count int        `db:"count"`
+		Last  *time.Time `db:"last"`
+	}
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) FILTER (WHERE created_at > $3) AS count, MAX(created_at) AS last
+		FROM chat_messages
+		WHERE meeting_id = $1 AND (metadata->>'%s' = $2 OR sender_id::text = $2)
+		AND created_at > $4`, models.ChatMetaSenderID)
+
+	err := s.db.GetContext(ctx, &recent, query,
+		message.MeetingID, message.SenderWireID(), now.Add(-flood), now.Add(-max(flood, slow)))
+	if err != nil {
+		return fmt.Errorf("failed to check chat rate: %w", err)
+	}
+
+	if slow > 0 && recent.Last != nil && now.Sub(*recent.Last) < slow {
+		return &RateLimitError{SlowMode: true, RetryAfter: slow - now.Sub(*recent.Last)}
+	}
+	if flood > 0 && recent.Count >= policy.FloodMessages {
+		return &RateLimitError{RetryAfter: flood}
+	}
+	return nil
+}
+
+// isMeetingModerator reports whether the user created or hosts the meeting
+func (s *chatService) isMeetingModerator(ctx context.Context, meetingID, userID int) (bool, error) {
+	var moderator bool
+	query := `
+		SELECT EXISTS (SELECT 1 FROM meetings WHERE id = $1 AND created_by_user_id = $2)
+		    OR EXISTS (SELECT 1 FROM meeting_participants
+		               WHERE meeting_id = $1 AND user_id = $2 AND role IN ($3, $4))`
+
+	err := s.db.GetContext(ctx, &moderator, query, meetingID, userID, models.ParticipantRoleHost, models.ParticipantRoleCoHost)
+	if err != nil {
+		return false, fmt.Errorf("failed to check meeting role: %w", err)
+	}
+	return moderator, nil
+}
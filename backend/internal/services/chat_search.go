@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// SearchLanguages are the built-in Postgres text search configurations
+// chat messages can be stemmed with
+var SearchLanguages = []string{
+	"simple", "arabic", "armenian", "basque", "catalan", "danish", "dutch",
+	"english", "finnish", "french", "german", "greek", "hindi", "hungarian",
+	"indonesian", "irish", "italian", "lithuanian", "nepali", "norwegian",
+	"portuguese", "romanian", "russian", "serbian", "spanish", "swedish",
+	"tamil", "turkish", "yiddish",
+}
+
+// ValidSearchLanguage reports whether language is one of SearchLanguages
+func ValidSearchLanguage(language string) bool {
+	for _, known := range SearchLanguages {
+		if language == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Snippets mark matches with these private use characters, which are turned
+// into <mark> tags once the rest of the text is escaped
+const (
+	snippetStart = "\ue000"
+	snippetStop  = "\ue001"
+	snippetOpts  = "StartSel=" + snippetStart + ", StopSel=" + snippetStop + ", MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=\" … \""
+)
+
+// ChatSearch is a full-text search over chat messages. The query uses web
+// search syntax: quoted phrases, "or" and a leading - to exclude a word.
+type ChatSearch struct {
+	Query       string
+	Language    string // text search configuration; the server default if empty
+	MeetingID   *int
+	SenderID    string // signaling ID: a user ID, or guest_<id>
+	MessageType string
+	From        *time.Time
+	To          *time.Time
+	Limit       int
+	Offset      int
+}
+
+// ChatSearchResult is a message matching a search. Snippet is HTML, with
+// matches wrapped in <mark>.
+type ChatSearchResult struct {
+	models.ChatMessage
+	MeetingTitle string  `json:"meeting_title" db:"meeting_title"`
+	Snippet      string  `json:"snippet" db:"snippet"`
+	Rank         float64 `json:"rank" db:"rank"`
+}
+
+// searchLanguage returns language if it is a known configuration, and the
+// configured default otherwise
+func (s *chatService) searchLanguage(language string) string {
+	if ValidSearchLanguage(language) {
+		return language
+	}
+	if ValidSearchLanguage(s.chat.SearchLanguage) {
+		return s.chat.SearchLanguage
+	}
+	return "simple"
+}
+
+// Search finds the messages the user may read in the client's meetings they
+// created or joined, best matches first
+func (s *chatService) Search(ctx context.Context, userID, clientID int, search *ChatSearch) ([]*ChatSearchResult, error) {
+	args := []interface{}{clientID, userID, strconv.Itoa(userID), s.searchLanguage(search.Language), search.Query, snippetOpts}
+
+	filters := ""
+	filter := func(condition string, value interface{}) {
+		args = append(args, value)
+		filters += "\n\t\tAND " + strings.ReplaceAll(condition, "$?", fmt.Sprintf("$%d", len(args)))
+	}
+	if search.MeetingID != nil {
+		filter("cm.meeting_id = $?", *search.MeetingID)
+	}
+	if search.SenderID != "" {
+		filter(fmt.Sprintf("(cm.sender_id::text = $? OR cm.metadata->>'%s' = $?)", models.ChatMetaSenderID), search.SenderID)
+	}
+	if search.MessageType != "" {
+		filter("cm.message_type = $?", search.MessageType)
+	}
+	if search.From != nil {
+		filter("cm.created_at >= $?", *search.From)
+	}
+	if search.To != nil {
+		filter("cm.created_at < $?", *search.To)
+	}
+
+	// The user attended the meeting, reads breakout rooms' chat where they
+	// were placed in the room, and hosts' messages where they hosted it
+	query := fmt.Sprintf(`
+		SELECT cm.*, m.title AS meeting_title,
+		       ts_headline($4::regconfig, cm.message, q.query, $6) AS snippet,
+		       ts_rank(cm.search_vector, q.query) AS rank
+		FROM chat_messages cm
+		JOIN meetings m ON m.id = cm.meeting_id
+		CROSS JOIN websearch_to_tsquery($4::regconfig, $5) AS q(query)
+		WHERE cm.client_id = $1 AND m.client_id = $1
+		AND cm.is_moderated = false
+		AND cm.search_vector @@ q.query
+		AND (m.created_by_user_id = $2 OR EXISTS (
+			SELECT 1 FROM meeting_participants mp
+			WHERE mp.meeting_id = m.id AND mp.user_id = $2 AND mp.joined_at IS NOT NULL))
+		AND (cm.breakout_room_id IS NULL OR cm.sender_id = $2 OR EXISTS (
+			SELECT 1 FROM breakout_assignments ba
+			WHERE ba.breakout_room_id = cm.breakout_room_id AND (ba.user_id = $2 OR ba.participant_id = $3)))
+		AND (cm.is_private = false
+		     OR cm.recipient_id = $3 OR cm.metadata->>'%[1]s' = $3
+		     OR cm.sender_id = $2
+		     OR (cm.recipient_id IS NULL AND (m.created_by_user_id = $2 OR EXISTS (
+				SELECT 1 FROM meeting_participants mp
+				WHERE mp.meeting_id = m.id AND mp.user_id = $2 AND mp.role IN ('%[2]s', '%[3]s')))))%[4]s
+		ORDER BY rank DESC, cm.created_at DESC
+		LIMIT $%[5]d OFFSET $%[6]d`,
+		models.ChatMetaSenderID, models.ParticipantRoleHost, models.ParticipantRoleCoHost,
+		filters, len(args)+1, len(args)+2)
+
+	results := []*ChatSearchResult{}
+	err := s.db.SelectContext(ctx, &results, query, append(args, search.Limit, search.Offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	for _, result := range results {
+		result.Snippet = highlight(result.Snippet)
+	}
+	return results, nil
+}
+
+// highlight escapes a snippet for HTML and marks its matches
+func highlight(snippet string) string {
+	return strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>").Replace(html.EscapeString(snippet))
+}
@@ -1,10 +1,29 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"video-conference-backend/internal/config"
 	"video-conference-backend/internal/database"
 	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/storage"
+	"video-conference-backend/internal/thumbnail"
+
+	"github.com/google/uuid"
 )
 
 type ChatService interface {
@@ -13,32 +32,102 @@ type ChatService interface {
 	UpdateMessage(ctx context.Context, message *models.ChatMessage) error
 	DeleteMessage(ctx context.Context, id int, userID int) error
 	
-	// Message queries
-	GetMessagesByMeeting(ctx context.Context, meetingID int, limit, offset int) ([]*models.ChatMessage, error)
+	// Message queries. Meeting queries only return the private messages the
+	// viewer may read; a nil viewer reads every message.
+	GetMessagesByMeeting(ctx context.Context, meetingID int, viewer *ChatViewer, limit, offset int) ([]*models.ChatMessage, error)
 	GetMessagesBySender(ctx context.Context, senderID int, limit, offset int) ([]*models.ChatMessage, error)
-	GetRecentMessages(ctx context.Context, meetingID int, limit int) ([]*models.ChatMessage, error)
-	GetMessagesByType(ctx context.Context, meetingID int, messageType string, limit, offset int) ([]*models.ChatMessage, error)
-	SearchMessages(ctx context.Context, meetingID int, query string, limit, offset int) ([]*models.ChatMessage, error)
+	GetRecentMessages(ctx context.Context, meetingID int, viewer *ChatViewer, limit int) ([]*models.ChatMessage, error)
+	GetMessagesByType(ctx context.Context, meetingID int, viewer *ChatViewer, messageType string, limit, offset int) ([]*models.ChatMessage, error)
+	SearchMessages(ctx context.Context, meetingID int, viewer *ChatViewer, query string, limit, offset int) ([]*models.ChatMessage, error)
+	// Search finds messages across the meetings a user attended
+	Search(ctx context.Context, userID, clientID int, search *ChatSearch) ([]*ChatSearchResult, error)
 	
 	// Message moderation
 	ModerateMessage(ctx context.Context, messageID, moderatorID int) error
 	UnmoderateMessage(ctx context.Context, messageID int) error
-	GetModeratedMessages(ctx context.Context, meetingID int, limit, offset int) ([]*models.ChatMessage, error)
+	GetModeratedMessages(ctx context.Context, meetingID int, viewer *ChatViewer, limit, offset int) ([]*models.ChatMessage, error)
+	
+	// Automatic moderation, applied by SendMessage
+	GetModerationPolicy(ctx context.Context, clientID int) (*models.ChatModerationPolicy, error)
+	UpdateModerationPolicy(ctx context.Context, policy *models.ChatModerationPolicy) error
 	
 	// Message threads (replies)
 	GetMessageReplies(ctx context.Context, parentMessageID int, limit, offset int) ([]*models.ChatMessage, error)
 	GetMessageThread(ctx context.Context, rootMessageID int) ([]*models.ChatMessage, error)
 	
+	// Transcripts, with replies nested and moderated messages redacted
+	GetTranscript(ctx context.Context, meeting *models.Meeting, viewer *ChatViewer, loc *time.Location) (*ChatTranscript, error)
+	
 	// File attachments
 	AddAttachment(ctx context.Context, messageID int, attachment map[string]interface{}) error
 	RemoveAttachment(ctx context.Context, messageID int, attachmentID string) error
 	GetMessageAttachments(ctx context.Context, messageID int) ([]map[string]interface{}, error)
+	UploadAttachment(ctx context.Context, upload *AttachmentUpload) error
+	GetAttachment(ctx context.Context, messageID int, attachmentID string) (*ChatAttachment, error)
+	AttachmentLinks(message *models.ChatMessage) []ChatAttachment
+	VerifyAttachmentURL(messageID int, attachmentID, variant string, expires int64, signature string) error
 	
 	// Chat statistics
 	GetChatStats(ctx context.Context, meetingID int) (*ChatStats, error)
 	GetUserChatStats(ctx context.Context, meetingID int, userID int) (*UserChatStats, error)
 }
 
+// ChatViewer is someone reading a meeting's chat
+type ChatViewer struct {
+	UserID    *int   // users.id, nil for guests
+	WireID    string // signaling ID private messages are addressed to
+	Moderator bool   // hosts and co-hosts also read messages sent to the hosts
+	// BreakoutRoomID is the breakout room whose chat the viewer reads; nil
+	// reads the main room's
+	BreakoutRoomID *int
+}
+
+// CanRead reports whether the viewer may read the message
+func (v *ChatViewer) CanRead(message *models.ChatMessage) bool {
+	if v == nil {
+		return true
+	}
+	if !sameRoom(v.BreakoutRoomID, message.BreakoutRoomID) {
+		return false
+	}
+	if !message.IsPrivate {
+		return true
+	}
+	if message.SenderWireID() == v.WireID {
+		return true
+	}
+	if message.ToHosts() {
+		return v.Moderator
+	}
+	return *message.RecipientID == v.WireID
+}
+
+// visibility returns the condition limiting messages to those the viewer
+// may read, appending its arguments. It mirrors CanRead.
+func (v *ChatViewer) visibility(args []interface{}) (string, []interface{}) {
+	if v == nil {
+		return "", args
+	}
+
+	args = append(args, v.WireID, v.UserID, v.Moderator, v.BreakoutRoomID)
+	wire, user, moderator, room := len(args)-3, len(args)-2, len(args)-1, len(args)
+	condition := fmt.Sprintf(`
+		AND breakout_room_id IS NOT DISTINCT FROM $%[5]d::integer
+		AND (is_private = false
+		     OR recipient_id = $%[1]d OR metadata->>'%[4]s' = $%[1]d
+		     OR sender_id = $%[2]d
+		     OR ($%[3]d AND recipient_id IS NULL))`,
+		wire, user, moderator, models.ChatMetaSenderID, room)
+	return condition, args
+}
+
+func sameRoom(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
 type ChatStats struct {
 	TotalMessages     int                    `json:"total_messages"`
 	TotalParticipants int                    `json:"total_participants"`
@@ -63,24 +152,52 @@ type UserMessageCount struct {
 }
 
 type chatService struct {
-	db *database.DB
+	db         *database.DB
+	chat       *config.ChatConfig
+	config     *config.StorageConfig
+	store      storage.Storage
+	publicURL  string
+	signingKey []byte
+	policies   *policyCache
 }
 
-func NewChatService(db *database.DB) ChatService {
-	return &chatService{db: db}
+// NewChatService creates the chat service. Attachments are kept in store and
+// served through links signed with signingKey.
+func NewChatService(db *database.DB, chatCfg *config.ChatConfig, cfg *config.StorageConfig, store storage.Storage, publicURL, signingKey string) ChatService {
+	return &chatService{
+		db:         db,
+		chat:       chatCfg,
+		config:     cfg,
+		store:      store,
+		publicURL:  publicURL,
+		signingKey: []byte(signingKey),
+		policies:   &policyCache{policies: map[int]*moderationPolicy{}},
+	}
 }
 
+// SendMessage stores a message after applying the client's moderation
+// policy. Senders over its rate limits get a *RateLimitError; messages
+// breaking its content rules are stored hidden, with IsModerated set.
 func (s *chatService) SendMessage(ctx context.Context, message *models.ChatMessage) error {
+	if err := s.moderate(ctx, message, true); err != nil {
+		return err
+	}
+	message.SearchLanguage = s.searchLanguage(message.SearchLanguage)
+
 	query := `
 		INSERT INTO chat_messages (client_id, meeting_id, sender_id, sender_email, sender_name, 
-		                          message, message_type, metadata, reply_to_id, attachments)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		                          message, message_type, metadata, reply_to_id, attachments,
+		                          is_private, recipient_id, recipient_user_id, search_language,
+		                          is_moderated, moderated_at, breakout_room_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 		RETURNING id, created_at, updated_at`
 	
 	err := s.db.GetContext(ctx, message, query,
 		message.ClientID, message.MeetingID, message.SenderID, message.SenderEmail,
 		message.SenderName, message.Message, message.MessageType, message.Metadata,
-		message.ReplyToID, message.Attachments)
+		message.ReplyToID, message.Attachments,
+		message.IsPrivate, message.RecipientID, message.RecipientUserID, message.SearchLanguage,
+		message.IsModerated, message.ModeratedAt, message.BreakoutRoomID)
 	if err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
 	}
@@ -100,13 +217,21 @@ func (s *chatService) GetMessageByID(ctx context.Context, id int) (*models.ChatM
 	return message, nil
 }
 
+// UpdateMessage stores changes to a message, hiding it if it now breaks the
+// client's moderation policy
 func (s *chatService) UpdateMessage(ctx context.Context, message *models.ChatMessage) error {
+	if err := s.moderate(ctx, message, false); err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE chat_messages 
-		SET message = $2, metadata = $3, attachments = $4, updated_at = CURRENT_TIMESTAMP
+		SET message = $2, metadata = $3, attachments = $4, is_moderated = $5, moderated_at = $6,
+		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1`
 	
-	_, err := s.db.ExecContext(ctx, query, message.ID, message.Message, message.Metadata, message.Attachments)
+	_, err := s.db.ExecContext(ctx, query, message.ID, message.Message, message.Metadata, message.Attachments,
+		message.IsModerated, message.ModeratedAt)
 	if err != nil {
 		return fmt.Errorf("failed to update message: %w", err)
 	}
@@ -116,30 +241,34 @@ func (s *chatService) UpdateMessage(ctx context.Context, message *models.ChatMes
 
 func (s *chatService) DeleteMessage(ctx context.Context, id int, userID int) error {
 	// Only allow users to delete their own messages or allow moderators
-	query := `DELETE FROM chat_messages WHERE id = $1 AND sender_id = $2`
+	query := `DELETE FROM chat_messages WHERE id = $1 AND sender_id = $2 RETURNING attachments`
 	
-	result, err := s.db.ExecContext(ctx, query, id, userID)
+	var attachments models.JSONB
+	err := s.db.GetContext(ctx, &attachments, query, id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("message not found or user not authorized to delete")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete message: %w", err)
 	}
 	
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("message not found or user not authorized to delete")
+	for _, attachment := range decodeAttachments(attachments) {
+		s.deleteAttachmentObjects(ctx, attachment)
 	}
 	
 	return nil
 }
 
-func (s *chatService) GetMessagesByMeeting(ctx context.Context, meetingID int, limit, offset int) ([]*models.ChatMessage, error) {
+func (s *chatService) GetMessagesByMeeting(ctx context.Context, meetingID int, viewer *ChatViewer, limit, offset int) ([]*models.ChatMessage, error) {
 	messages := []*models.ChatMessage{}
-	query := `
+	visible, args := viewer.visibility([]interface{}{meetingID})
+	query := fmt.Sprintf(`
 		SELECT * FROM chat_messages 
-		WHERE meeting_id = $1 AND is_moderated = false
+		WHERE meeting_id = $1 AND is_moderated = false %s
 		ORDER BY created_at ASC 
-		LIMIT $2 OFFSET $3`
+		LIMIT $%d OFFSET $%d`, visible, len(args)+1, len(args)+2)
 	
-	err := s.db.SelectContext(ctx, &messages, query, meetingID, limit, offset)
+	err := s.db.SelectContext(ctx, &messages, query, append(args, limit, offset)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages by meeting: %w", err)
 	}
@@ -163,15 +292,16 @@ func (s *chatService) GetMessagesBySender(ctx context.Context, senderID int, lim
 	return messages, nil
 }
 
-func (s *chatService) GetRecentMessages(ctx context.Context, meetingID int, limit int) ([]*models.ChatMessage, error) {
+func (s *chatService) GetRecentMessages(ctx context.Context, meetingID int, viewer *ChatViewer, limit int) ([]*models.ChatMessage, error) {
 	messages := []*models.ChatMessage{}
-	query := `
+	visible, args := viewer.visibility([]interface{}{meetingID})
+	query := fmt.Sprintf(`
 		SELECT * FROM chat_messages 
-		WHERE meeting_id = $1 AND is_moderated = false
+		WHERE meeting_id = $1 AND is_moderated = false %s
 		ORDER BY created_at DESC 
-		LIMIT $2`
+		LIMIT $%d`, visible, len(args)+1)
 	
-	err := s.db.SelectContext(ctx, &messages, query, meetingID, limit)
+	err := s.db.SelectContext(ctx, &messages, query, append(args, limit)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recent messages: %w", err)
 	}
@@ -185,15 +315,16 @@ func (s *chatService) GetRecentMessages(ctx context.Context, meetingID int, limi
 	return messages, nil
 }
 
-func (s *chatService) GetMessagesByType(ctx context.Context, meetingID int, messageType string, limit, offset int) ([]*models.ChatMessage, error) {
+func (s *chatService) GetMessagesByType(ctx context.Context, meetingID int, viewer *ChatViewer, messageType string, limit, offset int) ([]*models.ChatMessage, error) {
 	messages := []*models.ChatMessage{}
-	query := `
+	visible, args := viewer.visibility([]interface{}{meetingID, messageType})
+	query := fmt.Sprintf(`
 		SELECT * FROM chat_messages 
-		WHERE meeting_id = $1 AND message_type = $2 AND is_moderated = false
+		WHERE meeting_id = $1 AND message_type = $2 AND is_moderated = false %s
 		ORDER BY created_at ASC 
-		LIMIT $3 OFFSET $4`
+		LIMIT $%d OFFSET $%d`, visible, len(args)+1, len(args)+2)
 	
-	err := s.db.SelectContext(ctx, &messages, query, meetingID, messageType, limit, offset)
+	err := s.db.SelectContext(ctx, &messages, query, append(args, limit, offset)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages by type: %w", err)
 	}
@@ -201,17 +332,17 @@ func (s *chatService) GetMessagesByType(ctx context.Context, meetingID int, mess
 	return messages, nil
 }
 
-func (s *chatService) SearchMessages(ctx context.Context, meetingID int, query string, limit, offset int) ([]*models.ChatMessage, error) {
+func (s *chatService) SearchMessages(ctx context.Context, meetingID int, viewer *ChatViewer, query string, limit, offset int) ([]*models.ChatMessage, error) {
 	messages := []*models.ChatMessage{}
-	searchQuery := `
+	visible, args := viewer.visibility([]interface{}{meetingID, s.searchLanguage(""), query})
+	searchQuery := fmt.Sprintf(`
 		SELECT * FROM chat_messages 
 		WHERE meeting_id = $1 AND is_moderated = false 
-		AND (message ILIKE $2 OR sender_name ILIKE $2)
-		ORDER BY created_at DESC 
-		LIMIT $3 OFFSET $4`
+		AND search_vector @@ websearch_to_tsquery($2::regconfig, $3) %s
+		ORDER BY ts_rank(search_vector, websearch_to_tsquery($2::regconfig, $3)) DESC, created_at DESC 
+		LIMIT $%d OFFSET $%d`, visible, len(args)+1, len(args)+2)
 	
-	searchTerm := "%" + query + "%"
-	err := s.db.SelectContext(ctx, &messages, searchQuery, meetingID, searchTerm, limit, offset)
+	err := s.db.SelectContext(ctx, &messages, searchQuery, append(args, limit, offset)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search messages: %w", err)
 	}
@@ -223,10 +354,11 @@ func (s *chatService) ModerateMessage(ctx context.Context, messageID, moderatorI
 	query := `
 		UPDATE chat_messages 
 		SET is_moderated = true, moderated_by = $2, moderated_at = CURRENT_TIMESTAMP, 
+		    metadata = COALESCE(metadata, '{}'::jsonb) || jsonb_build_object($3::text, $4::text),
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1`
 	
-	_, err := s.db.ExecContext(ctx, query, messageID, moderatorID)
+	_, err := s.db.ExecContext(ctx, query, messageID, moderatorID, models.ChatMetaModerationReason, models.ModerationReasonManual)
 	if err != nil {
 		return fmt.Errorf("failed to moderate message: %w", err)
 	}
@@ -238,10 +370,10 @@ func (s *chatService) UnmoderateMessage(ctx context.Context, messageID int) erro
 	query := `
 		UPDATE chat_messages 
 		SET is_moderated = false, moderated_by = NULL, moderated_at = NULL, 
-		    updated_at = CURRENT_TIMESTAMP
+		    metadata = metadata - $2::text, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1`
 	
-	_, err := s.db.ExecContext(ctx, query, messageID)
+	_, err := s.db.ExecContext(ctx, query, messageID, models.ChatMetaModerationReason)
 	if err != nil {
 		return fmt.Errorf("failed to unmoderate message: %w", err)
 	}
@@ -249,15 +381,16 @@ func (s *chatService) UnmoderateMessage(ctx context.Context, messageID int) erro
 	return nil
 }
 
-func (s *chatService) GetModeratedMessages(ctx context.Context, meetingID int, limit, offset int) ([]*models.ChatMessage, error) {
+func (s *chatService) GetModeratedMessages(ctx context.Context, meetingID int, viewer *ChatViewer, limit, offset int) ([]*models.ChatMessage, error) {
 	messages := []*models.ChatMessage{}
-	query := `
+	visible, args := viewer.visibility([]interface{}{meetingID})
+	query := fmt.Sprintf(`
 		SELECT * FROM chat_messages 
-		WHERE meeting_id = $1 AND is_moderated = true
+		WHERE meeting_id = $1 AND is_moderated = true %s
 		ORDER BY moderated_at DESC 
-		LIMIT $2 OFFSET $3`
+		LIMIT $%d OFFSET $%d`, visible, len(args)+1, len(args)+2)
 	
-	err := s.db.SelectContext(ctx, &messages, query, meetingID, limit, offset)
+	err := s.db.SelectContext(ctx, &messages, query, append(args, limit, offset)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get moderated messages: %w", err)
 	}
@@ -287,15 +420,16 @@ func (s *chatService) GetMessageThread(ctx context.Context, rootMessageID int) (
 	// Use recursive CTE to get the full thread
 	query := `
 		WITH RECURSIVE message_thread AS (
-			SELECT *, 0 as level FROM chat_messages WHERE id = $1
+			SELECT id, 0 as level FROM chat_messages WHERE id = $1
 			UNION ALL
-			SELECT cm.*, mt.level + 1 
+			SELECT cm.id, mt.level + 1 
 			FROM chat_messages cm
 			INNER JOIN message_thread mt ON cm.reply_to_id = mt.id
 		)
-		SELECT * FROM message_thread 
-		WHERE is_moderated = false
-		ORDER BY level, created_at ASC`
+		SELECT cm.* FROM message_thread mt
+		JOIN chat_messages cm ON cm.id = mt.id
+		WHERE cm.is_moderated = false
+		ORDER BY mt.level, cm.created_at ASC`
 	
 	err := s.db.SelectContext(ctx, &messages, query, rootMessageID)
 	if err != nil {
@@ -334,27 +468,34 @@ func (s *chatService) AddAttachment(ctx context.Context, messageID int, attachme
 	return nil
 }
 
+// RemoveAttachment detaches a file from a message and deletes its stored objects
 func (s *chatService) RemoveAttachment(ctx context.Context, messageID int, attachmentID string) error {
-	// This is a simplified implementation
-	// In production, you'd want proper attachment management
 	message, err := s.GetMessageByID(ctx, messageID)
 	if err != nil {
 		return fmt.Errorf("failed to get message: %w", err)
 	}
 
-	attachments := message.Attachments
-	if attachments == nil {
-		return fmt.Errorf("no attachments found")
+	var removed *ChatAttachment
+	kept := []ChatAttachment{}
+	for _, attachment := range decodeAttachments(message.Attachments) {
+		if attachment.ID == attachmentID {
+			removed = &attachment
+			continue
+		}
+		kept = append(kept, attachment)
+	}
+	if removed == nil {
+		return ErrAttachmentNotFound
 	}
 
-	// Remove attachment logic would go here
-	// For now, just update the message
-	query := `UPDATE chat_messages SET attachments = $2 WHERE id = $1`
-	_, err = s.db.ExecContext(ctx, query, messageID, attachments)
+	message.Attachments["files"] = encodeAttachments(kept)
+	query := `UPDATE chat_messages SET attachments = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err = s.db.ExecContext(ctx, query, messageID, message.Attachments)
 	if err != nil {
 		return fmt.Errorf("failed to remove attachment: %w", err)
 	}
-	
+
+	s.deleteAttachmentObjects(ctx, *removed)
 	return nil
 }
 
@@ -506,4 +647,342 @@ func (s *chatService) GetUserChatStats(ctx context.Context, meetingID int, userI
 	stats.LastMessageAt = last
 
 	return stats, nil
-}
\ No newline at end of file
+}
+// Chat attachment errors
+var (
+	ErrAttachmentTooLarge   = errors.New("file is too large")
+	ErrAttachmentType       = errors.New("file type is not allowed")
+	ErrAttachmentQuota      = errors.New("upload quota exceeded")
+	ErrAttachmentNotFound   = errors.New("attachment not found")
+	ErrInvalidAttachmentURL = errors.New("invalid or expired attachment link")
+)
+
+// Variants of an attachment served through signed links
+const (
+	AttachmentFile      = "file"
+	AttachmentThumbnail = "thumbnail"
+)
+
+const (
+	// chatAttachmentPrefix is where attachments are kept in the uploads
+	// store, below chat/<client>/<meeting>/<attachment>/
+	chatAttachmentPrefix = "chat/"
+	// thumbnailSize bounds the width and height of image thumbnails
+	thumbnailSize = 320
+	// attachmentLinkExpiry is how long signed attachment links stay valid
+	attachmentLinkExpiry = 12 * time.Hour
+)
+
+// oleMagic starts legacy Office documents (.doc, .xls, .ppt)
+var oleMagic = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+
+// attachmentTypes lists, by file extension, the content types an upload
+// may sniff as. Uploads whose extension is missing here are refused even
+// if allowed by configuration, as their content cannot be checked.
+var attachmentTypes = map[string][]string{
+	"jpg":  {"image/jpeg"},
+	"jpeg": {"image/jpeg"},
+	"png":  {"image/png"},
+	"gif":  {"image/gif"},
+	"webp": {"image/webp"},
+	"bmp":  {"image/bmp"},
+	"pdf":  {"application/pdf"},
+	"doc":  {"application/x-ole-storage"},
+	"xls":  {"application/x-ole-storage"},
+	"ppt":  {"application/x-ole-storage"},
+	"docx": {"application/zip"},
+	"xlsx": {"application/zip"},
+	"pptx": {"application/zip"},
+	"zip":  {"application/zip"},
+	"txt":  {"text/plain"},
+	"csv":  {"text/plain"},
+	"md":   {"text/plain"},
+	"mp3":  {"audio/mpeg"},
+	"wav":  {"audio/wave"},
+	"ogg":  {"application/ogg", "audio/ogg"},
+	"mp4":  {"video/mp4"},
+	"webm": {"video/webm"},
+}
+
+// ChatAttachment is a file attached to a chat message. Attachments are kept
+// in the message's attachments under "files".
+type ChatAttachment struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	Key          string `json:"key,omitempty"`
+	ThumbnailKey string `json:"thumbnail_key,omitempty"`
+
+	// Signed links, filled in for readers rather than stored
+	URL          string     `json:"url,omitempty"`
+	ThumbnailURL string     `json:"thumbnail_url,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+// IsImage reports whether the attachment can be shown inline as an image
+func (a *ChatAttachment) IsImage() bool {
+	switch a.ContentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp", "image/bmp":
+		return true
+	}
+	return false
+}
+
+// AttachmentUpload is a file posted to a meeting's chat
+type AttachmentUpload struct {
+	// Message is posted with the file attached; its type is set from the
+	// file and its text defaults to the file name
+	Message  *models.ChatMessage
+	FileName string
+	Size     int64
+	Body     io.Reader
+}
+
+// UploadAttachment checks an uploaded file against the storage limits,
+// stores it with a thumbnail for images and posts it as a chat message
+func (s *chatService) UploadAttachment(ctx context.Context, upload *AttachmentUpload) error {
+	if s.config.MaxSizeMB > 0 && upload.Size > int64(s.config.MaxSizeMB)<<20 {
+		return fmt.Errorf("%w: the limit is %d MB", ErrAttachmentTooLarge, s.config.MaxSizeMB)
+	}
+
+	name := attachmentName(upload.FileName)
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	if !s.allowedExtension(ext) {
+		return fmt.Errorf("%w: %q", ErrAttachmentType, name)
+	}
+
+	// The content decides the type, not the name or the client's header
+	head := make([]byte, 512)
+	n, err := io.ReadFull(upload.Body, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+	head = head[:n]
+	sniffed := sniffContentType(head)
+	if !matchesExtension(ext, sniffed) {
+		return fmt.Errorf("%w: %q is not a .%s file", ErrAttachmentType, name, ext)
+	}
+
+	message := upload.Message
+	clientPrefix := fmt.Sprintf("%s%d/", chatAttachmentPrefix, message.ClientID)
+	if s.config.ClientQuotaMB > 0 {
+		used, err := storage.PrefixSize(ctx, s.store, clientPrefix)
+		if err != nil {
+			return fmt.Errorf("failed to check upload quota: %w", err)
+		}
+		if used+upload.Size > int64(s.config.ClientQuotaMB)<<20 {
+			return ErrAttachmentQuota
+		}
+	}
+
+	attachment := ChatAttachment{
+		ID:          uuid.New().String(),
+		Name:        name,
+		ContentType: attachmentContentType(ext, sniffed),
+		Size:        upload.Size,
+	}
+	dir := fmt.Sprintf("%s%d/%s/", clientPrefix, message.MeetingID, attachment.ID)
+	attachment.Key = dir + "file." + ext
+
+	body := io.MultiReader(bytes.NewReader(head), upload.Body)
+	if err := s.store.Put(ctx, attachment.Key, body, upload.Size, attachment.ContentType); err != nil {
+		return fmt.Errorf("failed to store attachment: %w", err)
+	}
+
+	if thumbnail.Supported(attachment.ContentType) {
+		s.addThumbnail(ctx, &attachment, dir+"thumbnail.jpg")
+	}
+
+	message.MessageType = "file"
+	if attachment.IsImage() {
+		message.MessageType = "image"
+	}
+	if message.Message == "" {
+		message.Message = attachment.Name
+	}
+	message.Attachments = models.JSONB{"files": encodeAttachments([]ChatAttachment{attachment})}
+
+	if err := s.SendMessage(ctx, message); err != nil {
+		s.deleteAttachmentObjects(ctx, attachment)
+		return err
+	}
+	return nil
+}
+
+// addThumbnail renders and stores a thumbnail of an image attachment. An
+// image that cannot be thumbnailed is still posted, without one.
+func (s *chatService) addThumbnail(ctx context.Context, attachment *ChatAttachment, key string) {
+	object, err := s.store.Open(ctx, attachment.Key)
+	if err != nil {
+		log.Printf("Failed to open attachment %s for a thumbnail: %v", attachment.ID, err)
+		return
+	}
+	defer object.Close()
+
+	thumb, width, height, err := thumbnail.Generate(object, thumbnailSize)
+	if err != nil {
+		log.Printf("Failed to create thumbnail of attachment %s: %v", attachment.ID, err)
+		return
+	}
+	if err := s.store.Put(ctx, key, bytes.NewReader(thumb), int64(len(thumb)), thumbnail.ContentType); err != nil {
+		log.Printf("Failed to store thumbnail of attachment %s: %v", attachment.ID, err)
+		return
+	}
+
+	attachment.ThumbnailKey = key
+	attachment.Width = width
+	attachment.Height = height
+}
+
+// GetAttachment returns an attachment of a message that has not been moderated
+func (s *chatService) GetAttachment(ctx context.Context, messageID int, attachmentID string) (*ChatAttachment, error) {
+	message, err := s.GetMessageByID(ctx, messageID)
+	if err != nil || message.IsModerated {
+		return nil, ErrAttachmentNotFound
+	}
+
+	for _, attachment := range decodeAttachments(message.Attachments) {
+		if attachment.ID == attachmentID {
+			return &attachment, nil
+		}
+	}
+	return nil, ErrAttachmentNotFound
+}
+
+// AttachmentLinks returns the message's attachments with signed links to
+// them in place of their storage keys
+func (s *chatService) AttachmentLinks(message *models.ChatMessage) []ChatAttachment {
+	attachments := decodeAttachments(message.Attachments)
+	expiresAt := time.Now().Add(attachmentLinkExpiry).Truncate(time.Second)
+
+	for i := range attachments {
+		attachment := &attachments[i]
+		attachment.URL = s.attachmentURL(message.ID, attachment.ID, AttachmentFile, expiresAt.Unix())
+		if attachment.ThumbnailKey != "" {
+			attachment.ThumbnailURL = s.attachmentURL(message.ID, attachment.ID, AttachmentThumbnail, expiresAt.Unix())
+		}
+		attachment.ExpiresAt = &expiresAt
+		attachment.Key = ""
+		attachment.ThumbnailKey = ""
+	}
+	return attachments
+}
+
+func (s *chatService) attachmentURL(messageID int, attachmentID, variant string, expires int64) string {
+	return fmt.Sprintf("%s/api/v1/public/chat/attachments/%d/%s/%s?expires=%d&signature=%s",
+		s.publicURL, messageID, attachmentID, variant, expires, s.sign(messageID, attachmentID, variant, expires))
+}
+
+// VerifyAttachmentURL checks the expiry and signature of a signed attachment link
+func (s *chatService) VerifyAttachmentURL(messageID int, attachmentID, variant string, expires int64, signature string) error {
+	if time.Now().Unix() > expires {
+		return ErrInvalidAttachmentURL
+	}
+
+	expected := s.sign(messageID, attachmentID, variant, expires)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidAttachmentURL
+	}
+	return nil
+}
+
+func (s *chatService) sign(messageID int, attachmentID, variant string, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	fmt.Fprintf(mac, "chat-attachment:%d:%s:%s:%d", messageID, attachmentID, variant, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *chatService) allowedExtension(ext string) bool {
+	if _, known := attachmentTypes[ext]; !known {
+		return false
+	}
+	for _, allowed := range s.config.AllowedTypes {
+		if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(allowed), "."), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *chatService) deleteAttachmentObjects(ctx context.Context, attachment ChatAttachment) {
+	for _, key := range []string{attachment.Key, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.store.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete attachment object %s: %v", key, err)
+		}
+	}
+}
+
+// sniffContentType returns the media type of content from its first bytes
+func sniffContentType(head []byte) string {
+	if bytes.HasPrefix(head, oleMagic) {
+		return "application/x-ole-storage"
+	}
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+func matchesExtension(ext, sniffed string) bool {
+	for _, contentType := range attachmentTypes[ext] {
+		if contentType == sniffed {
+			return true
+		}
+	}
+	return false
+}
+
+// attachmentContentType picks the type an attachment is served as. Sniffing
+// only tells containers apart, so the extension refines it, e.g. a zip
+// named .docx is served as a Word document.
+func attachmentContentType(ext, sniffed string) string {
+	if byExt := mime.TypeByExtension("." + ext); byExt != "" {
+		if mediaType, _, err := mime.ParseMediaType(byExt); err == nil {
+			return mediaType
+		}
+	}
+	return sniffed
+}
+
+// attachmentName strips any directories a browser sent with the file name
+func attachmentName(name string) string {
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." {
+		return "file"
+	}
+	return name
+}
+
+// decodeAttachments reads the files kept in a message's attachments
+func decodeAttachments(attachments models.JSONB) []ChatAttachment {
+	files, ok := attachments["files"]
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(files)
+	if err != nil {
+		return nil
+	}
+	var decoded []ChatAttachment
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// encodeAttachments converts attachments to their JSONB form
+func encodeAttachments(attachments []ChatAttachment) []interface{} {
+	data, _ := json.Marshal(attachments)
+	var encoded []interface{}
+	json.Unmarshal(data, &encoded)
+	return encoded
+}
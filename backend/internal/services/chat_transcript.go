@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// Chat transcript formats
+const (
+	TranscriptJSON = "json"
+	TranscriptText = "txt"
+	TranscriptHTML = "html"
+	TranscriptCSV  = "csv"
+)
+
+// transcriptPageSize is how many messages are loaded per query while
+// building a transcript
+const transcriptPageSize = 500
+
+// redactedMessage replaces the text of moderated messages in transcripts
+const redactedMessage = "[message removed by a moderator]"
+
+// ChatTranscript is the chat log of a meeting, with replies nested under
+// the messages they answer
+type ChatTranscript struct {
+	MeetingID   int                `json:"meeting_id"`
+	Title       string             `json:"title"`
+	TimeZone    string             `json:"time_zone"`
+	GeneratedAt time.Time          `json:"generated_at"`
+	Messages    []*TranscriptEntry `json:"messages"`
+}
+
+// TranscriptEntry is a message in a transcript. Times are in the
+// transcript's time zone.
+type TranscriptEntry struct {
+	ID          int                `json:"id"`
+	ReplyToID   *int               `json:"reply_to_id,omitempty"`
+	SenderName  string             `json:"sender_name"`
+	Message     string             `json:"message"`
+	MessageType string             `json:"message_type"`
+	Private     bool               `json:"private,omitempty"`
+	Edited      bool               `json:"edited,omitempty"`
+	Redacted    bool               `json:"redacted,omitempty"`
+	Attachments []string           `json:"attachments,omitempty"`
+	SentAt      time.Time          `json:"sent_at"`
+	Replies     []*TranscriptEntry `json:"replies,omitempty"`
+}
+
+// ValidTranscriptFormat reports whether format is a supported transcript format
+func ValidTranscriptFormat(format string) bool {
+	switch format {
+	case TranscriptJSON, TranscriptText, TranscriptHTML, TranscriptCSV:
+		return true
+	}
+	return false
+}
+
+// TranscriptContentType returns the media type of a transcript format
+func TranscriptContentType(format string) string {
+	switch format {
+	case TranscriptJSON:
+		return "application/json; charset=utf-8"
+	case TranscriptHTML:
+		return "text/html; charset=utf-8"
+	case TranscriptCSV:
+		return "text/csv; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// GetTranscript builds the meeting's chat transcript as the viewer may read
+// it. Moderated messages keep their place but lose their content.
+func (s *chatService) GetTranscript(ctx context.Context, meeting *models.Meeting, viewer *ChatViewer, loc *time.Location) (*ChatTranscript, error) {
+	messages := []*models.ChatMessage{}
+	for offset := 0; ; offset += transcriptPageSize {
+		page, err := s.GetMessagesByMeeting(ctx, meeting.ID, viewer, transcriptPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, page...)
+		if len(page) < transcriptPageSize {
+			break
+		}
+	}
+
+	for offset := 0; ; offset += transcriptPageSize {
+		page, err := s.GetModeratedMessages(ctx, meeting.ID, viewer, transcriptPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, page...)
+		if len(page) < transcriptPageSize {
+			break
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].CreatedAt.Equal(messages[j].CreatedAt) {
+			return messages[i].ID < messages[j].ID
+		}
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+
+	transcript := &ChatTranscript{
+		MeetingID:   meeting.ID,
+		Title:       meeting.Title,
+		TimeZone:    loc.String(),
+		GeneratedAt: time.Now().In(loc),
+		Messages:    []*TranscriptEntry{},
+	}
+
+	// Messages come oldest first, so a reply's parent is always seen first
+	entries := make(map[int]*TranscriptEntry, len(messages))
+	for _, message := range messages {
+		entry := transcriptEntry(message, loc)
+		entries[message.ID] = entry
+
+		if message.ReplyToID != nil {
+			if parent, ok := entries[*message.ReplyToID]; ok {
+				parent.Replies = append(parent.Replies, entry)
+				continue
+			}
+		}
+		transcript.Messages = append(transcript.Messages, entry)
+	}
+
+	return transcript, nil
+}
+
+func transcriptEntry(message *models.ChatMessage, loc *time.Location) *TranscriptEntry {
+	entry := &TranscriptEntry{
+		ID:          message.ID,
+		ReplyToID:   message.ReplyToID,
+		SenderName:  message.SenderName,
+		Message:     message.Message,
+		MessageType: message.MessageType,
+		Private:     message.IsPrivate,
+		Edited:      message.Edited(),
+		SentAt:      message.CreatedAt.In(loc),
+	}
+
+	if message.IsModerated {
+		entry.Message = redactedMessage
+		entry.Redacted = true
+		return entry
+	}
+
+	for _, attachment := range decodeAttachments(message.Attachments) {
+		entry.Attachments = append(entry.Attachments, attachment.Name)
+	}
+	return entry
+}
+
+// Write renders the transcript in the given format
+func (t *ChatTranscript) Write(w io.Writer, format string) error {
+	switch format {
+	case TranscriptJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(t)
+	case TranscriptText:
+		return t.writeText(w)
+	case TranscriptHTML:
+		return transcriptTemplate.Execute(w, t)
+	case TranscriptCSV:
+		return t.writeCSV(w)
+	}
+	return fmt.Errorf("unsupported transcript format %q", format)
+}
+
+// walk visits every entry depth first, in transcript order
+func (t *ChatTranscript) walk(visit func(entry *TranscriptEntry, depth int) error) error {
+	var walk func(entries []*TranscriptEntry, depth int) error
+	walk = func(entries []*TranscriptEntry, depth int) error {
+		for _, entry := range entries {
+			if err := visit(entry, depth); err != nil {
+				return err
+			}
+			if err := walk(entry.Replies, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(t.Messages, 0)
+}
+
+func (t *ChatTranscript) writeText(w io.Writer) error {
+	fmt.Fprintf(w, "Chat transcript: %s\nTimes are in %s\n\n", t.Title, t.TimeZone)
+
+	return t.walk(func(entry *TranscriptEntry, depth int) error {
+		indent := strings.Repeat("    ", depth)
+		// Continuation lines of multi-line messages stay under their message
+		message := strings.ReplaceAll(entry.Message, "\n", "\n"+indent+"    ")
+		line := fmt.Sprintf("%s[%s] %s: %s", indent, entry.SentAt.Format("2006-01-02 15:04"), entry.SenderName, message)
+		if entry.Private {
+			line += " (private)"
+		}
+		if entry.Edited {
+			line += " (edited)"
+		}
+		for _, name := range entry.Attachments {
+			line += fmt.Sprintf(" [attachment: %s]", name)
+		}
+		_, err := fmt.Fprintln(w, line)
+		return err
+	})
+}
+
+func (t *ChatTranscript) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "reply_to_id", "sent_at", "sender", "message", "type", "private", "edited", "redacted", "attachments"})
+
+	err := t.walk(func(entry *TranscriptEntry, depth int) error {
+		replyTo := ""
+		if entry.ReplyToID != nil {
+			replyTo = strconv.Itoa(*entry.ReplyToID)
+		}
+		return writer.Write([]string{
+			strconv.Itoa(entry.ID),
+			replyTo,
+			entry.SentAt.Format(time.RFC3339),
+			csvSafe(entry.SenderName),
+			csvSafe(entry.Message),
+			entry.MessageType,
+			strconv.FormatBool(entry.Private),
+			strconv.FormatBool(entry.Edited),
+			strconv.FormatBool(entry.Redacted),
+			csvSafe(strings.Join(entry.Attachments, "; ")),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvSafe keeps spreadsheets from evaluating user text as a formula
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+var transcriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Chat transcript: {{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 48em; margin: 2em auto; color: #222; }
+ul { list-style: none; padding-left: 0; }
+ul ul { padding-left: 1.5em; border-left: 2px solid #ddd; }
+li { margin: 0.5em 0; }
+.meta { color: #666; font-size: 0.85em; }
+.redacted { color: #999; font-style: italic; }
+</style>
+</head>
+<body>
+<h1>Chat transcript: {{.Title}}</h1>
+<p class="meta">Times are in {{.TimeZone}}</p>
+{{template "entries" .Messages}}
+</body>
+</html>
+{{define "entries"}}{{if .}}<ul>
+{{range .}}<li>
+<div class="meta">{{.SentAt.Format "2006-01-02 15:04"}} &middot; <strong>{{.SenderName}}</strong>{{if .Private}} &middot; private{{end}}{{if .Edited}} &middot; edited{{end}}</div>
+<div{{if .Redacted}} class="redacted"{{end}}>{{.Message}}</div>
+{{range .Attachments}}<div class="meta">Attachment: {{.}}</div>
+{{end}}{{template "entries" .Replies}}</li>
+{{end}}</ul>
+{{end}}{{end}}`))
@@ -28,12 +28,12 @@ func NewClientService(db *database.DB) ClientService {
 
 func (s *clientService) CreateClient(ctx context.Context, client *models.Client) error {
 	query := `
-		INSERT INTO clients (email, app_name, logo_url, theme, primary_color)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO clients (email, app_name, logo_url, theme, primary_color, require_mfa)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id, created_at, updated_at`
 	
 	err := s.db.GetContext(ctx, client, query,
-		client.Email, client.AppName, client.LogoURL, client.Theme, client.PrimaryColor)
+		client.Email, client.AppName, client.LogoURL, client.Theme, client.PrimaryColor, client.RequireMFA)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
@@ -46,7 +46,7 @@ func (s *clientService) CreateClient(ctx context.Context, client *models.Client)
 		ScreenSharingEnabled:  true,
 		RecordingEnabled:      false,
 		RaiseHandEnabled:      true,
-		WaitingRoomEnabled:    false,
+		WaitingRoomEnabled:    true,
 		MaxParticipants:       100,
 	}
 
@@ -80,11 +80,11 @@ func (s *clientService) GetClientByEmail(ctx context.Context, email string) (*mo
 func (s *clientService) UpdateClient(ctx context.Context, client *models.Client) error {
 	query := `
 		UPDATE clients 
-		SET email = $2, app_name = $3, logo_url = $4, theme = $5, primary_color = $6
+		SET email = $2, app_name = $3, logo_url = $4, theme = $5, primary_color = $6, require_mfa = $7
 		WHERE id = $1`
 	
 	_, err := s.db.ExecContext(ctx, query,
-		client.ID, client.Email, client.AppName, client.LogoURL, client.Theme, client.PrimaryColor)
+		client.ID, client.Email, client.AppName, client.LogoURL, client.Theme, client.PrimaryColor, client.RequireMFA)
 	if err != nil {
 		return fmt.Errorf("failed to update client: %w", err)
 	}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"html"
 	"log"
 	"net/smtp"
 	"strings"
@@ -181,10 +182,68 @@ func (s *EmailService) SendPasswordResetEmail(to, resetLink string) error {
 	return s.SendEmail(msg)
 }
 
+// SendPasswordChangedEmail confirms a password reset to the account owner
+func (s *EmailService) SendPasswordChangedEmail(to, name string) error {
+	subject := "Your Password Was Changed"
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background-color: #4F46E5; color: white; padding: 20px; text-align: center; }
+        .content { padding: 20px; background-color: #f9f9f9; }
+        .footer { text-align: center; padding: 20px; color: #666; font-size: 14px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h2>Password Changed</h2>
+        </div>
+        <div class="content">
+            <p>Hi %s,</p>
+            <p>The password for your Video Conference Platform account was just reset, and every device signed in to it has been signed out.</p>
+            <p>If you didn't reset your password, please contact your administrator right away.</p>
+        </div>
+        <div class="footer">
+            <p>Video Conference Platform Team</p>
+        </div>
+    </div>
+</body>
+</html>
+`, html.EscapeString(name))
+
+	msg := EmailMessage{
+		To:      []string{to},
+		Subject: subject,
+		Body:    htmlBody,
+		IsHTML:  true,
+	}
+
+	return s.SendEmail(msg)
+}
+
 // EmailContent represents the content structure for emails
 type EmailContent struct {
 	Subject     string
 	Body        string
 	HTMLBody    string
 	MeetingLink string
-}
\ No newline at end of file
+}
+// SendChatTranscriptEmail sends a meeting's chat transcript, rendered as HTML
+func (s *EmailService) SendChatTranscriptEmail(to, meetingTitle, transcript string) error {
+	// The title is user input and ends up in a header
+	title := strings.Join(strings.Fields(meetingTitle), " ")
+
+	msg := EmailMessage{
+		To:      []string{to},
+		Subject: fmt.Sprintf("Chat transcript: %s", title),
+		Body:    transcript,
+		IsHTML:  true,
+	}
+
+	return s.SendEmail(msg)
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"video-conference-backend/internal/models"
+)
+
+// engagementBatchSize bounds the rows written by one insert
+const engagementBatchSize = 500
+
+// EngagementSummary reports how participants engaged with a meeting
+type EngagementSummary struct {
+	MeetingID        int                      `json:"meeting_id"`
+	Reactions        int                      `json:"reactions"`
+	ReactionsByEmoji []*EmojiCount            `json:"reactions_by_emoji"`
+	HandsRaised      int                      `json:"hands_raised"`
+	Participants     []*ParticipantEngagement `json:"participants"`
+}
+
+// EmojiCount is how often one emoji was sent
+type EmojiCount struct {
+	Emoji string `json:"emoji" db:"emoji"`
+	Count int    `json:"count" db:"count"`
+}
+
+// ParticipantEngagement counts one participant's reactions and raised hands
+type ParticipantEngagement struct {
+	ActorID     string `json:"actor_id" db:"actor_id"`
+	ActorUserID *int   `json:"actor_user_id" db:"actor_user_id"`
+	ActorName   string `json:"actor_name" db:"actor_name"`
+	Reactions   int    `json:"reactions" db:"reactions"`
+	HandsRaised int    `json:"hands_raised" db:"hands_raised"`
+}
+
+// RecordEngagementEvents stores a batch of reactions and hand events
+func (s *meetingService) RecordEngagementEvents(ctx context.Context, events []*models.MeetingEngagementEvent) error {
+	for start := 0; start < len(events); start += engagementBatchSize {
+		batch := events[start:min(start+engagementBatchSize, len(events))]
+
+		rows := make([]string, 0, len(batch))
+		args := make([]interface{}, 0, len(batch)*7)
+		for _, event := range batch {
+			n := len(args)
+			rows = append(rows, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+			args = append(args, event.MeetingID, event.ActorUserID, event.ActorID, event.ActorName,
+				event.EventType, event.Value, event.CreatedAt)
+		}
+
+		query := `
+			INSERT INTO meeting_engagement_events (meeting_id, actor_user_id, actor_id, actor_name, event_type, value, created_at)
+			VALUES ` + strings.Join(rows, ", ")
+
+		if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to record engagement events: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetEngagementSummary totals the meeting's reactions and raised hands,
+// most engaged participants first
+func (s *meetingService) GetEngagementSummary(ctx context.Context, meetingID int) (*EngagementSummary, error) {
+	summary := &EngagementSummary{MeetingID: meetingID}
+
+	query := `
+		SELECT value AS emoji, COUNT(*) AS count
+		FROM meeting_engagement_events
+		WHERE meeting_id = $1 AND event_type = $2
+		GROUP BY value
+		ORDER BY count DESC, emoji`
+
+	summary.ReactionsByEmoji = []*EmojiCount{}
+	err := s.db.SelectContext(ctx, &summary.ReactionsByEmoji, query, meetingID, models.EngagementReaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count reactions: %w", err)
+	}
+
+	query = `
+		SELECT actor_id, MAX(actor_user_id) AS actor_user_id,
+		       (ARRAY_AGG(actor_name ORDER BY created_at DESC))[1] AS actor_name,
+		       COUNT(*) FILTER (WHERE event_type = $2) AS reactions,
+		       COUNT(*) FILTER (WHERE event_type = $3) AS hands_raised
+		FROM meeting_engagement_events
+		WHERE meeting_id = $1
+		GROUP BY actor_id
+		HAVING COUNT(*) FILTER (WHERE event_type IN ($2, $3)) > 0
+		ORDER BY COUNT(*) FILTER (WHERE event_type IN ($2, $3)) DESC, actor_id`
+
+	summary.Participants = []*ParticipantEngagement{}
+	err = s.db.SelectContext(ctx, &summary.Participants, query, meetingID, models.EngagementReaction, models.EngagementHandRaised)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize engagement: %w", err)
+	}
+
+	for _, participant := range summary.Participants {
+		summary.Reactions += participant.Reactions
+		summary.HandsRaised += participant.HandsRaised
+	}
+
+	return summary, nil
+}
@@ -253,7 +253,7 @@ Best regards,
 		meeting.Title,
 		meeting.ScheduledStart.Format("Monday, January 2, 2006 at 3:04 PM MST"),
 		meeting.ScheduledEnd.Sub(meeting.ScheduledStart).String(),
-		meeting.Description,
+		derefString(meeting.Description),
 		invitationLink,
 		inviterName)
 
@@ -302,7 +302,7 @@ Best regards,
 		meeting.Title,
 		meeting.ScheduledStart.Format("Monday, January 2, 2006 at 3:04 PM MST"),
 		meeting.ScheduledEnd.Sub(meeting.ScheduledStart).String(),
-		meeting.Description,
+		derefString(meeting.Description),
 		invitationLink,
 		inviterName)
 
@@ -312,4 +312,12 @@ Best regards,
 		HTMLBody:    htmlBody,
 		MeetingLink: invitationLink,
 	}
-}
\ No newline at end of file
+}
+
+// derefString returns the value of an optional string, or "" when it is nil
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
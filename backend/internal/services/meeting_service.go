@@ -2,10 +2,13 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"time"
 	"video-conference-backend/internal/database"
 	"video-conference-backend/internal/models"
+
+	"github.com/jmoiron/sqlx"
 )
 
 type MeetingService interface {
@@ -19,6 +22,7 @@ type MeetingService interface {
 	// Meeting lifecycle
 	StartMeeting(ctx context.Context, meetingID string, hostID int) error
 	EndMeeting(ctx context.Context, meetingID string) error
+	SetMeetingLocked(ctx context.Context, meetingID string, locked bool) error
 	
 	// Meeting queries
 	ListMeetingsByClient(ctx context.Context, clientID int, limit, offset int) ([]*models.Meeting, error)
@@ -32,10 +36,66 @@ type MeetingService interface {
 	GetMeetingParticipants(ctx context.Context, meetingID int) ([]*models.MeetingParticipant, error)
 	UpdateParticipantStatus(ctx context.Context, meetingID int, userID *int, email *string, status string) error
 	UpdateParticipantRole(ctx context.Context, meetingID int, userID *int, email *string, role string) error
+	GetParticipant(ctx context.Context, meetingID int, userID *int, email *string) (*models.MeetingParticipant, error)
+	RecordParticipantStatus(ctx context.Context, participant *models.MeetingParticipant) error
+
+	// Moderation audit trail
+	RecordAuditEvent(ctx context.Context, event *models.MeetingAuditEvent) error
+	ListAuditEvents(ctx context.Context, meetingID int) ([]*models.MeetingAuditEvent, error)
+
+	// Engagement analytics
+	RecordEngagementEvents(ctx context.Context, events []*models.MeetingEngagementEvent) error
+	GetEngagementSummary(ctx context.Context, meetingID int) (*EngagementSummary, error)
 	
 	// Recurrence
 	CreateRecurringMeetings(ctx context.Context, parentMeeting *models.Meeting) ([]*models.Meeting, error)
 	GetRecurringMeetingInstances(ctx context.Context, parentMeetingID int) ([]*models.Meeting, error)
+	ListOccurrences(ctx context.Context, parentMeetingID int, from, to time.Time) ([]*models.Meeting, error)
+	UpdateOccurrence(ctx context.Context, parentMeetingID int, occurrence time.Time, update *OccurrenceUpdate, scope string) (*models.Meeting, error)
+	CancelOccurrence(ctx context.Context, parentMeetingID int, occurrence time.Time, scope string) error
+}
+
+// OccurrenceUpdate holds the fields that can be changed on occurrences of a series
+type OccurrenceUpdate struct {
+	Title          *string
+	Description    *string
+	ScheduledStart *time.Time
+	ScheduledEnd   *time.Time
+}
+
+// apply copies the update onto a meeting. Moving the start without an
+// explicit end keeps the meeting's duration.
+func (u *OccurrenceUpdate) apply(meeting *models.Meeting) {
+	if u.Title != nil {
+		meeting.Title = *u.Title
+	}
+	if u.Description != nil {
+		meeting.Description = u.Description
+	}
+	if u.ScheduledStart != nil {
+		duration := meeting.Duration()
+		meeting.ScheduledStart = *u.ScheduledStart
+		meeting.ScheduledEnd = u.ScheduledStart.Add(duration)
+	}
+	if u.ScheduledEnd != nil {
+		meeting.ScheduledEnd = *u.ScheduledEnd
+	}
+}
+
+const (
+	// recurrenceHorizon is how far ahead occurrences are materialized by default
+	recurrenceHorizon = 30 * 24 * time.Hour
+	// maxOccurrenceWindow bounds how many days of occurrences one request may materialize
+	maxOccurrenceWindow = 366 * 24 * time.Hour
+)
+
+// RoomFullError is returned when a meeting has no seat left for a participant
+type RoomFullError struct {
+	Limit int
+}
+
+func (e *RoomFullError) Error() string {
+	return fmt.Sprintf("meeting is full (limit %d participants)", e.Limit)
 }
 
 type meetingService struct {
@@ -47,6 +107,10 @@ func NewMeetingService(db *database.DB) MeetingService {
 }
 
 func (s *meetingService) CreateMeeting(ctx context.Context, meeting *models.Meeting) error {
+	return s.insertMeeting(ctx, s.db, meeting)
+}
+
+func (s *meetingService) insertMeeting(ctx context.Context, q sqlx.QueryerContext, meeting *models.Meeting) error {
 	// Generate unique meeting ID if not provided
 	if meeting.MeetingID == "" {
 		meeting.MeetingID = models.GenerateMeetingID()
@@ -56,16 +120,18 @@ func (s *meetingService) CreateMeeting(ctx context.Context, meeting *models.Meet
 		INSERT INTO meetings (client_id, title, description, created_by_user_id, meeting_id, password, 
 		                     scheduled_start, scheduled_end, status, max_participants, allow_anonymous,
 		                     require_approval, enable_waiting_room, enable_chat, enable_screen_sharing,
-		                     enable_recording, settings)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		                     enable_recording, settings, parent_meeting_id, recurrence_rule,
+		                     recurrence_timezone, recurrence_exdates, recurrence_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
 		RETURNING id, created_at, updated_at`
 	
-	err := s.db.GetContext(ctx, meeting, query,
+	err := sqlx.GetContext(ctx, q, meeting, query,
 		meeting.ClientID, meeting.Title, meeting.Description, meeting.CreatedByUserID, meeting.MeetingID,
 		meeting.Password, meeting.ScheduledStart, meeting.ScheduledEnd, meeting.Status,
 		meeting.MaxParticipants, meeting.AllowAnonymous, meeting.RequireApproval,
 		meeting.EnableWaitingRoom, meeting.EnableChat, meeting.EnableScreenSharing,
-		meeting.EnableRecording, meeting.Settings)
+		meeting.EnableRecording, meeting.Settings, meeting.ParentMeetingID, meeting.RecurrenceRule,
+		meeting.RecurrenceTimezone, meeting.RecurrenceExDates, meeting.RecurrenceID)
 	if err != nil {
 		return fmt.Errorf("failed to create meeting: %w", err)
 	}
@@ -172,11 +238,30 @@ func (s *meetingService) EndMeeting(ctx context.Context, meetingID string) error
 	return nil
 }
 
+// SetMeetingLocked locks or unlocks a meeting to new joins by non-moderators
+func (s *meetingService) SetMeetingLocked(ctx context.Context, meetingID string, locked bool) error {
+	query := `
+		UPDATE meetings 
+		SET is_locked = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE meeting_id = $1`
+	
+	_, err := s.db.ExecContext(ctx, query, meetingID, locked)
+	if err != nil {
+		return fmt.Errorf("failed to set meeting lock: %w", err)
+	}
+	
+	return nil
+}
+
+// ListMeetingsByClient lists the client's meetings, latest first. Like the
+// other listings it leaves out series masters, whose occurrences are listed
+// in their place.
 func (s *meetingService) ListMeetingsByClient(ctx context.Context, clientID int, limit, offset int) ([]*models.Meeting, error) {
 	meetings := []*models.Meeting{}
 	query := `
 		SELECT * FROM meetings 
 		WHERE client_id = $1 
+		AND (recurrence_rule IS NULL OR parent_meeting_id IS NOT NULL)
 		ORDER BY scheduled_start DESC 
 		LIMIT $2 OFFSET $3`
 	
@@ -193,6 +278,7 @@ func (s *meetingService) ListMeetingsByHost(ctx context.Context, hostID int, lim
 	query := `
 		SELECT * FROM meetings 
 		WHERE created_by_user_id = $1 
+		AND (recurrence_rule IS NULL OR parent_meeting_id IS NOT NULL)
 		ORDER BY scheduled_start DESC 
 		LIMIT $2 OFFSET $3`
 	
@@ -210,6 +296,7 @@ func (s *meetingService) GetUpcomingMeetings(ctx context.Context, clientID int,
 		SELECT * FROM meetings 
 		WHERE client_id = $1 AND scheduled_start > CURRENT_TIMESTAMP 
 		AND status IN ($2, $3)
+		AND (recurrence_rule IS NULL OR parent_meeting_id IS NOT NULL)
 		ORDER BY scheduled_start ASC 
 		LIMIT $4`
 	
@@ -227,6 +314,7 @@ func (s *meetingService) GetMeetingsByDateRange(ctx context.Context, clientID in
 	query := `
 		SELECT * FROM meetings 
 		WHERE client_id = $1 AND scheduled_start >= $2 AND scheduled_start <= $3
+		AND (recurrence_rule IS NULL OR parent_meeting_id IS NOT NULL)
 		ORDER BY scheduled_start ASC`
 	
 	err := s.db.SelectContext(ctx, &meetings, query, clientID, start, end)
@@ -237,19 +325,71 @@ func (s *meetingService) GetMeetingsByDateRange(ctx context.Context, clientID in
 	return meetings, nil
 }
 
+// AddParticipant adds a participant to the meeting roster. Joined and
+// admitted participants hold a seat: adding one returns a *RoomFullError
+// when the meeting's or the tenant's participant limit is reached, and the
+// last models.HostReservedSlots seats are kept for hosts. Invitations do
+// not take seats.
 func (s *meetingService) AddParticipant(ctx context.Context, participant *models.MeetingParticipant) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the meeting row so concurrent adds see each other's seats
+	var meetingLimit int
+	var tenantLimit sql.NullInt64
+	err = tx.QueryRowxContext(ctx, `
+		SELECT m.max_participants, f.max_participants
+		FROM meetings m
+		LEFT JOIN client_features f ON f.client_id = m.client_id
+		WHERE m.id = $1
+		FOR UPDATE OF m`, participant.MeetingID).Scan(&meetingLimit, &tenantLimit)
+	if err != nil {
+		return fmt.Errorf("failed to get meeting: %w", err)
+	}
+
+	meeting := &models.Meeting{MaxParticipants: meetingLimit}
+	features := &models.ClientFeatures{MaxParticipants: int(tenantLimit.Int64)}
+	if limit := meeting.ParticipantLimit(features); limit > 0 && participant.HoldsSeat() {
+		var seated, moderators int
+		err = tx.QueryRowxContext(ctx, `
+			SELECT COUNT(*), COUNT(*) FILTER (WHERE role IN ($2, $3))
+			FROM meeting_participants
+			WHERE meeting_id = $1 AND status IN ($4, $5)`,
+			participant.MeetingID, models.ParticipantRoleHost, models.ParticipantRoleCoHost,
+			models.ParticipantStatusJoined, models.ParticipantStatusAdmitted,
+		).Scan(&seated, &moderators)
+		if err != nil {
+			return fmt.Errorf("failed to count participants: %w", err)
+		}
+
+		available := limit
+		if !participant.IsModerator() && moderators < models.HostReservedSlots {
+			available -= models.HostReservedSlots - moderators
+		}
+		if seated >= available {
+			return &RoomFullError{Limit: limit}
+		}
+	}
+
 	query := `
 		INSERT INTO meeting_participants (meeting_id, user_id, email, guest_name, role, status, invited_by)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, invited_at`
 	
-	err := s.db.GetContext(ctx, participant, query,
+	err = tx.GetContext(ctx, participant, query,
 		participant.MeetingID, participant.UserID, participant.Email, participant.GuestName,
 		participant.Role, participant.Status, participant.InvitedBy)
 	if err != nil {
 		return fmt.Errorf("failed to add participant: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
 
@@ -334,12 +474,471 @@ func (s *meetingService) UpdateParticipantRole(ctx context.Context, meetingID in
 	return nil
 }
 
+// participantColumns lists the meeting_participants columns mapped by models.MeetingParticipant
+const participantColumns = `id, meeting_id, user_id, email, COALESCE(guest_name, name) AS guest_name, role, status,
+		joined_at, left_at, invited_by, COALESCE(invited_at, created_at) AS invited_at`
+
+func (s *meetingService) GetParticipant(ctx context.Context, meetingID int, userID *int, email *string) (*models.MeetingParticipant, error) {
+	var query string
+	var args []interface{}
+
+	if userID != nil {
+		query = `SELECT ` + participantColumns + ` FROM meeting_participants WHERE meeting_id = $1 AND user_id = $2 ORDER BY id DESC LIMIT 1`
+		args = []interface{}{meetingID, *userID}
+	} else if email != nil {
+		query = `SELECT ` + participantColumns + ` FROM meeting_participants WHERE meeting_id = $1 AND email = $2 ORDER BY id DESC LIMIT 1`
+		args = []interface{}{meetingID, *email}
+	} else {
+		return nil, fmt.Errorf("either user_id or email must be provided")
+	}
+
+	participant := &models.MeetingParticipant{}
+	err := s.db.GetContext(ctx, participant, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get participant: %w", err)
+	}
+
+	return participant, nil
+}
+
+// RecordParticipantStatus sets the status of a participant, creating the
+// participant record if the meeting has none for this user or email yet.
+// Seated statuses also stamp joined_at on the first join.
+func (s *meetingService) RecordParticipantStatus(ctx context.Context, participant *models.MeetingParticipant) error {
+	var query string
+	var args []interface{}
+
+	if participant.UserID != nil {
+		query = `
+			UPDATE meeting_participants SET status = $3,
+				joined_at = CASE WHEN $4::boolean THEN COALESCE(joined_at, CURRENT_TIMESTAMP) ELSE joined_at END,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE meeting_id = $1 AND user_id = $2`
+		args = []interface{}{participant.MeetingID, *participant.UserID, participant.Status, participant.HoldsSeat()}
+	} else if participant.Email != nil {
+		query = `
+			UPDATE meeting_participants SET status = $3,
+				joined_at = CASE WHEN $4::boolean THEN COALESCE(joined_at, CURRENT_TIMESTAMP) ELSE joined_at END,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE meeting_id = $1 AND email = $2 AND user_id IS NULL`
+		args = []interface{}{participant.MeetingID, *participant.Email, participant.Status, participant.HoldsSeat()}
+	} else {
+		return fmt.Errorf("either user_id or email must be provided")
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to record participant status: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	if participant.Role == "" {
+		participant.Role = models.ParticipantRoleAttendee
+	}
+
+	insert := `
+		INSERT INTO meeting_participants (meeting_id, user_id, email, name, guest_name, role, status, is_anonymous, joined_at)
+		VALUES ($1, $2, $3, $4, $4, $5, $6, $7, CASE WHEN $8::boolean THEN CURRENT_TIMESTAMP END)`
+
+	_, err = s.db.ExecContext(ctx, insert,
+		participant.MeetingID, participant.UserID, participant.Email, participant.GuestName,
+		participant.Role, participant.Status, participant.UserID == nil, participant.HoldsSeat())
+	if err != nil {
+		return fmt.Errorf("failed to record participant status: %w", err)
+	}
+
+	return nil
+}
+
+func (s *meetingService) RecordAuditEvent(ctx context.Context, event *models.MeetingAuditEvent) error {
+	if event.Details == nil {
+		event.Details = models.JSONB{}
+	}
+
+	query := `
+		INSERT INTO meeting_audit_events (meeting_id, actor_user_id, actor_id, action, target_id, details)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	err := s.db.GetContext(ctx, event, query,
+		event.MeetingID, event.ActorUserID, event.ActorID, event.Action, event.TargetID, event.Details)
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+
+	return nil
+}
+
+func (s *meetingService) ListAuditEvents(ctx context.Context, meetingID int) ([]*models.MeetingAuditEvent, error) {
+	events := []*models.MeetingAuditEvent{}
+	query := `
+		SELECT * FROM meeting_audit_events 
+		WHERE meeting_id = $1 
+		ORDER BY created_at ASC, id ASC`
+
+	err := s.db.SelectContext(ctx, &events, query, meetingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	return events, nil
+}
+
+// CreateRecurringMeetings creates a recurring series, or validates an
+// existing one, and materializes its occurrences for the coming weeks.
+// Later occurrences are materialized on demand by ListOccurrences.
 func (s *meetingService) CreateRecurringMeetings(ctx context.Context, parentMeeting *models.Meeting) ([]*models.Meeting, error) {
-	// Recurring meetings not implemented yet - return empty slice
-	return []*models.Meeting{}, nil
+	if !parentMeeting.IsRecurring() {
+		return nil, fmt.Errorf("meeting has no recurrence rule")
+	}
+
+	rule, _, err := seriesRule(parentMeeting)
+	if err != nil {
+		return nil, err
+	}
+	normalized := rule.String()
+	parentMeeting.RecurrenceRule = &normalized
+
+	if parentMeeting.ID == 0 {
+		if err := s.CreateMeeting(ctx, parentMeeting); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	return s.ListOccurrences(ctx, parentMeeting.ID, now, now.Add(recurrenceHorizon))
 }
 
+// GetRecurringMeetingInstances returns the occurrences of a series in the coming weeks
 func (s *meetingService) GetRecurringMeetingInstances(ctx context.Context, parentMeetingID int) ([]*models.Meeting, error) {
-	// Recurring meetings not implemented yet - return empty slice
-	return []*models.Meeting{}, nil
-}
\ No newline at end of file
+	now := time.Now()
+	return s.ListOccurrences(ctx, parentMeetingID, now, now.Add(recurrenceHorizon))
+}
+
+// ListOccurrences materializes the occurrences of a series starting in
+// [from, to) and returns them, including occurrences moved into the window
+func (s *meetingService) ListOccurrences(ctx context.Context, parentMeetingID int, from, to time.Time) ([]*models.Meeting, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("occurrence window is empty")
+	}
+	if to.Sub(from) > maxOccurrenceWindow {
+		return nil, fmt.Errorf("occurrence window cannot exceed %d days", int(maxOccurrenceWindow.Hours()/24))
+	}
+
+	master, err := s.GetMeetingByID(ctx, parentMeetingID)
+	if err != nil {
+		return nil, err
+	}
+	rule, loc, err := seriesRule(master)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, occurrence := range rule.Occurrences(master.ScheduledStart, loc, master.RecurrenceExDates, from, to) {
+		if err := s.materializeOccurrence(ctx, s.db, master, occurrence); err != nil {
+			return nil, err
+		}
+	}
+
+	occurrences := []*models.Meeting{}
+	query := `
+		SELECT * FROM meetings 
+		WHERE parent_meeting_id = $1 AND status != $2
+		AND ((recurrence_id >= $3 AND recurrence_id < $4) OR (scheduled_start >= $3 AND scheduled_start < $4))
+		ORDER BY scheduled_start ASC`
+
+	err = s.db.SelectContext(ctx, &occurrences, query, parentMeetingID, models.MeetingStatusCancelled, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list occurrences: %w", err)
+	}
+
+	return occurrences, nil
+}
+
+// UpdateOccurrence changes one occurrence of a series, or with scope
+// "following" that occurrence and every later one. The latter splits the
+// series in two at the occurrence and returns the new series.
+func (s *meetingService) UpdateOccurrence(ctx context.Context, parentMeetingID int, occurrence time.Time, update *OccurrenceUpdate, scope string) (*models.Meeting, error) {
+	master, rule, loc, err := s.seriesOccurrence(ctx, parentMeetingID, occurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	switch scope {
+	case models.RecurrenceScopeThis:
+		if err := s.materializeOccurrence(ctx, s.db, master, occurrence); err != nil {
+			return nil, err
+		}
+		instance, err := s.getOccurrence(ctx, parentMeetingID, occurrence)
+		if err != nil {
+			return nil, err
+		}
+		update.apply(instance)
+		if err := s.UpdateMeeting(ctx, instance); err != nil {
+			return nil, err
+		}
+		return instance, nil
+
+	case models.RecurrenceScopeFollowing:
+		tx, err := s.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		// Unstarted occurrences from here on are rematerialized from the new details
+		if err := s.deleteScheduledOccurrences(ctx, tx, master.ID, occurrence); err != nil {
+			return nil, err
+		}
+
+		var series *models.Meeting
+		before := rule.OccurrencesBefore(master.ScheduledStart, loc, occurrence)
+		if before == 0 {
+			// Editing from the first occurrence edits the whole series
+			update.apply(master)
+			if err := s.updateSeries(ctx, tx, master); err != nil {
+				return nil, err
+			}
+			series = master
+		} else {
+			series, err = s.splitSeries(ctx, tx, master, rule, before, occurrence)
+			if err != nil {
+				return nil, err
+			}
+			update.apply(series)
+			if err := s.updateSeries(ctx, tx, series); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return series, nil
+	}
+
+	return nil, fmt.Errorf("invalid recurrence scope %q", scope)
+}
+
+// CancelOccurrence cancels one occurrence of a series by adding an EXDATE,
+// or with scope "following" ends the series before the occurrence
+func (s *meetingService) CancelOccurrence(ctx context.Context, parentMeetingID int, occurrence time.Time, scope string) error {
+	master, rule, loc, err := s.seriesOccurrence(ctx, parentMeetingID, occurrence)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	switch scope {
+	case models.RecurrenceScopeThis:
+		master.RecurrenceExDates = append(master.RecurrenceExDates, occurrence)
+		if err := s.updateSeries(ctx, tx, master); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE meetings SET status = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE parent_meeting_id = $1 AND recurrence_id = $2`,
+			master.ID, occurrence, models.MeetingStatusCancelled)
+		if err != nil {
+			return fmt.Errorf("failed to cancel occurrence: %w", err)
+		}
+
+	case models.RecurrenceScopeFollowing:
+		if rule.OccurrencesBefore(master.ScheduledStart, loc, occurrence) == 0 {
+			master.Status = models.MeetingStatusCancelled
+			_, err = tx.ExecContext(ctx, `
+				UPDATE meetings SET status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+				master.ID, models.MeetingStatusCancelled)
+		} else {
+			s.truncateSeries(master, rule, occurrence)
+			err = s.updateSeries(ctx, tx, master)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to cancel series: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE meetings SET status = $4, updated_at = CURRENT_TIMESTAMP
+			WHERE parent_meeting_id = $1 AND recurrence_id >= $2 AND status = $3`,
+			master.ID, occurrence, models.MeetingStatusScheduled, models.MeetingStatusCancelled)
+		if err != nil {
+			return fmt.Errorf("failed to cancel occurrences: %w", err)
+		}
+
+	default:
+		return fmt.Errorf("invalid recurrence scope %q", scope)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// seriesRule parses a series' recurrence rule and loads its time zone
+func seriesRule(master *models.Meeting) (*RecurrenceRule, *time.Location, error) {
+	if !master.IsRecurring() {
+		return nil, nil, fmt.Errorf("meeting is not a recurring series")
+	}
+
+	rule, err := ParseRecurrenceRule(*master.RecurrenceRule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loc := time.UTC
+	if master.RecurrenceTimezone != nil && *master.RecurrenceTimezone != "" {
+		loc, err = time.LoadLocation(*master.RecurrenceTimezone)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid recurrence timezone %q", *master.RecurrenceTimezone)
+		}
+	}
+
+	return rule, loc, nil
+}
+
+// seriesOccurrence loads a series and checks that occurrence is one of its
+// occurrences that has not been cancelled
+func (s *meetingService) seriesOccurrence(ctx context.Context, parentMeetingID int, occurrence time.Time) (*models.Meeting, *RecurrenceRule, *time.Location, error) {
+	master, err := s.GetMeetingByID(ctx, parentMeetingID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rule, loc, err := seriesRule(master)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	occurrences := rule.Occurrences(master.ScheduledStart, loc, master.RecurrenceExDates, occurrence, occurrence.Add(time.Second))
+	if len(occurrences) == 0 {
+		return nil, nil, nil, fmt.Errorf("no occurrence of the series starts at %s", occurrence.Format(time.RFC3339))
+	}
+
+	return master, rule, loc, nil
+}
+
+// materializeOccurrence stores an occurrence as its own meeting, copying the
+// series details, unless it already exists
+func (s *meetingService) materializeOccurrence(ctx context.Context, q sqlx.ExecerContext, master *models.Meeting, occurrence time.Time) error {
+	query := `
+		INSERT INTO meetings (client_id, title, description, created_by_user_id, meeting_id, password,
+		                     scheduled_start, scheduled_end, status, max_participants, allow_anonymous,
+		                     require_approval, enable_waiting_room, enable_chat, enable_screen_sharing,
+		                     enable_recording, settings, parent_meeting_id, recurrence_id)
+		SELECT client_id, title, description, created_by_user_id, $2, password,
+		       $3, $4, $5, max_participants, allow_anonymous,
+		       require_approval, enable_waiting_room, enable_chat, enable_screen_sharing,
+		       enable_recording, settings, id, $3
+		FROM meetings WHERE id = $1
+		ON CONFLICT (parent_meeting_id, recurrence_id) DO NOTHING`
+
+	_, err := q.ExecContext(ctx, query, master.ID, models.GenerateMeetingID(),
+		occurrence, occurrence.Add(master.Duration()), models.MeetingStatusScheduled)
+	if err != nil {
+		return fmt.Errorf("failed to materialize occurrence: %w", err)
+	}
+	return nil
+}
+
+func (s *meetingService) getOccurrence(ctx context.Context, parentMeetingID int, occurrence time.Time) (*models.Meeting, error) {
+	meeting := &models.Meeting{}
+	query := `SELECT * FROM meetings WHERE parent_meeting_id = $1 AND recurrence_id = $2`
+
+	err := s.db.GetContext(ctx, meeting, query, parentMeetingID, occurrence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get occurrence: %w", err)
+	}
+	return meeting, nil
+}
+
+func (s *meetingService) deleteScheduledOccurrences(ctx context.Context, q sqlx.ExecerContext, parentMeetingID int, from time.Time) error {
+	query := `
+		DELETE FROM meetings 
+		WHERE parent_meeting_id = $1 AND recurrence_id >= $2 AND status = $3`
+
+	_, err := q.ExecContext(ctx, query, parentMeetingID, from, models.MeetingStatusScheduled)
+	if err != nil {
+		return fmt.Errorf("failed to delete occurrences: %w", err)
+	}
+	return nil
+}
+
+// truncateSeries ends the series just before occurrence and keeps only the
+// exception dates that still apply to it
+func (s *meetingService) truncateSeries(master *models.Meeting, rule *RecurrenceRule, occurrence time.Time) {
+	truncated := *rule
+	until := occurrence.Add(-time.Second)
+	truncated.Count = 0
+	truncated.Until = &until
+	value := truncated.String()
+	master.RecurrenceRule = &value
+
+	var exdates models.TimeList
+	for _, t := range master.RecurrenceExDates {
+		if t.Before(occurrence) {
+			exdates = append(exdates, t)
+		}
+	}
+	master.RecurrenceExDates = exdates
+}
+
+// splitSeries ends the series before occurrence and creates a new series
+// that continues from it with the remaining occurrences
+func (s *meetingService) splitSeries(ctx context.Context, tx *sqlx.Tx, master *models.Meeting, rule *RecurrenceRule, before int, occurrence time.Time) (*models.Meeting, error) {
+	continued := *rule
+	if rule.Count > 0 {
+		continued.Count = rule.Count - before
+	}
+	continuedRule := continued.String()
+
+	series := *master
+	series.ID = 0
+	series.MeetingID = ""
+	series.Status = models.MeetingStatusScheduled
+	series.ActualStart = nil
+	series.ActualEnd = nil
+	series.ScheduledStart = occurrence
+	series.ScheduledEnd = occurrence.Add(master.Duration())
+	series.RecurrenceRule = &continuedRule
+	series.RecurrenceExDates = nil
+	for _, t := range master.RecurrenceExDates {
+		if !t.Before(occurrence) {
+			series.RecurrenceExDates = append(series.RecurrenceExDates, t)
+		}
+	}
+
+	s.truncateSeries(master, rule, occurrence)
+	if err := s.updateSeries(ctx, tx, master); err != nil {
+		return nil, err
+	}
+	if err := s.insertMeeting(ctx, tx, &series); err != nil {
+		return nil, err
+	}
+
+	return &series, nil
+}
+
+// updateSeries saves a series' details and recurrence
+func (s *meetingService) updateSeries(ctx context.Context, q sqlx.ExecerContext, master *models.Meeting) error {
+	query := `
+		UPDATE meetings 
+		SET title = $2, description = $3, scheduled_start = $4, scheduled_end = $5,
+		    recurrence_rule = $6, recurrence_exdates = $7, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	_, err := q.ExecContext(ctx, query,
+		master.ID, master.Title, master.Description, master.ScheduledStart, master.ScheduledEnd,
+		master.RecurrenceRule, master.RecurrenceExDates)
+	if err != nil {
+		return fmt.Errorf("failed to update series: %w", err)
+	}
+	return nil
+}
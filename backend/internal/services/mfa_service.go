@@ -0,0 +1,378 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"video-conference-backend/internal/database"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/totp"
+)
+
+const (
+	// recoveryCodeCount is how many recovery codes a user holds at once
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet leaves out characters that are easily confused
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	// mfaMaxAttempts wrong codes in a row lock the second factor for mfaLockout
+	mfaMaxAttempts = 5
+	mfaLockout     = 15 * time.Minute
+	// mfaSkew accepts codes one period either side, for clock drift
+	mfaSkew = 1
+	// defaultMFAIssuer names accounts in authenticator apps when the
+	// client has no app name
+	defaultMFAIssuer = "Video Conference Platform"
+)
+
+// Errors returned for second factors in the wrong state or wrong codes
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFARequired       = errors.New("two-factor authentication is required by your organization")
+	ErrInvalidMFACode    = errors.New("invalid two-factor authentication code")
+	ErrMFALocked         = errors.New("too many invalid codes, please try again later")
+)
+
+// MFAService manages TOTP second factors (RFC 6238) and their one-time
+// recovery codes, which are stored hashed
+type MFAService interface {
+	GetStatus(ctx context.Context, userID int) (*models.MFAStatus, error)
+	Setup(ctx context.Context, user *models.User) (*models.MFASetup, error)
+	Enable(ctx context.Context, userID int, code string) ([]string, error)
+	Verify(ctx context.Context, userID int, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID int) ([]string, error)
+	Disable(ctx context.Context, userID int, force bool) error
+}
+
+type mfaService struct {
+	db *database.DB
+}
+
+// userMFA is a row of user_mfa
+type userMFA struct {
+	Secret         string     `db:"secret"`
+	EnabledAt      *time.Time `db:"enabled_at"`
+	LastUsedStep   *int64     `db:"last_used_step"`
+	FailedAttempts int        `db:"failed_attempts"`
+	LastFailedAt   *time.Time `db:"last_failed_at"`
+}
+
+// NewMFAService creates a new two-factor authentication service
+func NewMFAService(db *database.DB) MFAService {
+	return &mfaService{db: db}
+}
+
+// GetStatus returns whether the user has a second factor and whether their
+// client requires one
+func (s *mfaService) GetStatus(ctx context.Context, userID int) (*models.MFAStatus, error) {
+	status := &models.MFAStatus{}
+	query := `
+		SELECT m.enabled_at IS NOT NULL AS enabled, m.enabled_at,
+			COALESCE(c.require_mfa, FALSE) AS required,
+			(SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = u.id AND used_at IS NULL) AS recovery_codes_remaining
+		FROM users u
+		LEFT JOIN clients c ON c.id = u.client_id
+		LEFT JOIN user_mfa m ON m.user_id = u.id AND m.enabled_at IS NOT NULL
+		WHERE u.id = $1`
+
+	if err := s.db.GetContext(ctx, status, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to get MFA status: %w", err)
+	}
+	return status, nil
+}
+
+// Setup starts enrollment with a new secret, replacing any pending one. It
+// takes effect once confirmed by Enable.
+func (s *mfaService) Setup(ctx context.Context, user *models.User) (*models.MFASetup, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO user_mfa (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret = EXCLUDED.secret,
+			last_used_step = NULL,
+			failed_attempts = 0,
+			last_failed_at = NULL,
+			created_at = CURRENT_TIMESTAMP
+		WHERE user_mfa.enabled_at IS NULL`
+
+	result, err := s.db.ExecContext(ctx, query, user.ID, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store MFA secret: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	issuer := defaultMFAIssuer
+	var appName string
+	if err := s.db.GetContext(ctx, &appName, `SELECT app_name FROM clients WHERE id = $1`, user.ClientID); err == nil && appName != "" {
+		issuer = appName
+	}
+
+	return &models.MFASetup{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(issuer, user.Email, secret),
+	}, nil
+}
+
+// Enable confirms a pending secret with a code from it and returns the
+// user's recovery codes, which are only ever shown here
+func (s *mfaService) Enable(ctx context.Context, userID int, code string) ([]string, error) {
+	mfa, err := s.load(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMFANotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mfa.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err := s.checkTOTP(ctx, userID, mfa, code); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE user_mfa SET enabled_at = CURRENT_TIMESTAMP WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to enable MFA: %w", err)
+	}
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return codes, nil
+}
+
+// Verify checks a TOTP or recovery code for a user with MFA enabled. Each
+// code works once.
+func (s *mfaService) Verify(ctx context.Context, userID int, code string) error {
+	mfa, err := s.load(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if mfa.EnabledAt == nil {
+		return ErrMFANotEnabled
+	}
+
+	code = normalizeMFACode(code)
+	if len(code) == totp.Digits {
+		return s.checkTOTP(ctx, userID, mfa, code)
+	}
+
+	if mfaLocked(mfa) {
+		return ErrMFALocked
+	}
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE user_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, hashRecoveryCode(code))
+	if err != nil {
+		return fmt.Errorf("failed to redeem recovery code: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		s.recordFailure(ctx, userID)
+		return ErrInvalidMFACode
+	}
+	return s.resetFailures(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return codes, nil
+}
+
+// Disable removes the user's second factor and recovery codes. Unless
+// forced, as by an admin resetting a lost device, it is refused while the
+// user's client requires MFA.
+func (s *mfaService) Disable(ctx context.Context, userID int, force bool) error {
+	if !force {
+		status, err := s.GetStatus(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if status.Required {
+			return ErrMFARequired
+		}
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to disable MFA: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Helper methods
+
+func (s *mfaService) load(ctx context.Context, userID int) (*userMFA, error) {
+	mfa := &userMFA{}
+	query := `
+		SELECT secret, enabled_at, last_used_step, failed_attempts, last_failed_at
+		FROM user_mfa WHERE user_id = $1`
+
+	err := s.db.GetContext(ctx, mfa, query, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get MFA secret: %w", err)
+	}
+	return mfa, err
+}
+
+// checkTOTP verifies a TOTP code and marks its time step used, so a code
+// seen by someone else cannot be replayed
+func (s *mfaService) checkTOTP(ctx context.Context, userID int, mfa *userMFA, code string) error {
+	if mfaLocked(mfa) {
+		return ErrMFALocked
+	}
+
+	step, ok := totp.Validate(mfa.Secret, normalizeMFACode(code), time.Now(), mfaSkew)
+	if !ok || (mfa.LastUsedStep != nil && step <= *mfa.LastUsedStep) {
+		s.recordFailure(ctx, userID)
+		return ErrInvalidMFACode
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE user_mfa SET last_used_step = $2, failed_attempts = 0, last_failed_at = NULL
+		WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2)`, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to record MFA code: %w", err)
+	}
+	// Another request used the code first
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// recordFailure counts a wrong code towards the lockout. Failures from
+// before the lockout window start a new count.
+func (s *mfaService) recordFailure(ctx context.Context, userID int) {
+	query := `
+		UPDATE user_mfa SET
+			failed_attempts = CASE WHEN last_failed_at > CURRENT_TIMESTAMP - $2 * INTERVAL '1 second'
+				THEN failed_attempts + 1 ELSE 1 END,
+			last_failed_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1`
+
+	if _, err := s.db.ExecContext(ctx, query, userID, int(mfaLockout.Seconds())); err != nil {
+		log.Printf("Failed to record MFA failure for user %d: %v", userID, err)
+	}
+}
+
+func (s *mfaService) resetFailures(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE user_mfa SET failed_attempts = 0, last_failed_at = NULL WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to reset MFA attempts: %w", err)
+	}
+	return nil
+}
+
+// mfaLocked reports whether too many wrong codes were entered recently
+func mfaLocked(mfa *userMFA) bool {
+	return mfa.FailedAttempts >= mfaMaxAttempts && mfa.LastFailedAt != nil && time.Since(*mfa.LastFailedAt) < mfaLockout
+}
+
+// replaceRecoveryCodes generates a new set of recovery codes, storing only
+// their hashes
+func replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID int) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, hashRecoveryCode(normalizeMFACode(code))); err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code like "k7m2p-x9qrt"
+func generateRecoveryCode() (string, error) {
+	const length = 10
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+
+	code := make([]byte, 0, length+1)
+	for i := 0; i < length; i++ {
+		if i == length/2 {
+			code = append(code, '-')
+		}
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code = append(code, recoveryCodeAlphabet[n.Int64()])
+	}
+	return string(code), nil
+}
+
+// normalizeMFACode drops the spaces and dashes people type codes with
+func normalizeMFACode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// hashRecoveryCode returns the form recovery codes are stored in. They are
+// random enough that a fast hash suffices.
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
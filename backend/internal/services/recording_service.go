@@ -2,13 +2,24 @@ package services
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"time"
 	"video-conference-backend/internal/config"
 	"video-conference-backend/internal/database"
 	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/storage"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type RecordingService interface {
@@ -21,6 +32,7 @@ type RecordingService interface {
 	// Recording queries
 	GetRecordingsByMeeting(ctx context.Context, meetingID int) ([]*models.Recording, error)
 	GetRecordingsByClient(ctx context.Context, clientID int, limit, offset int) ([]*models.Recording, error)
+	GetRecordingsForUser(ctx context.Context, userID int, limit, offset int) ([]*models.Recording, error)
 	GetPublicRecordings(ctx context.Context, clientID int, limit, offset int) ([]*models.Recording, error)
 	GetRecordingsByStatus(ctx context.Context, status string, limit, offset int) ([]*models.Recording, error)
 	GetRecordingsByDateRange(ctx context.Context, clientID int, start, end time.Time) ([]*models.Recording, error)
@@ -29,16 +41,19 @@ type RecordingService interface {
 	ProcessRecording(ctx context.Context, recordingID int) error
 	GenerateDownloadURL(ctx context.Context, recordingID int, expiresIn time.Duration) (string, error)
 	GenerateStreamingURL(ctx context.Context, recordingID int) (string, error)
+	VerifySignedURL(recordingID int, purpose string, expires int64, signature string) error
 	
 	// File management
 	GetRecordingFilePath(ctx context.Context, recordingID int) (string, error)
+	GetRecordingTrack(ctx context.Context, recordingID int, name string) (*models.RecordingTrack, string, error)
 	DeleteRecordingFile(ctx context.Context, recordingID int) error
 	GetRecordingFileSize(ctx context.Context, recordingID int) (int64, error)
 	
 	// Recording permissions
 	CanAccessRecording(ctx context.Context, recordingID, userID int) (bool, error)
+	CanManageRecording(ctx context.Context, recordingID, userID int) (bool, error)
 	SetRecordingPassword(ctx context.Context, recordingID int, password string) error
-	VerifyRecordingPassword(ctx context.Context, recordingID int, password string) (bool, error)
+	VerifyRecordingPassword(ctx context.Context, recordingID int, password, ipAddress string) (bool, error)
 	
 	// Recording statistics
 	GetRecordingStats(ctx context.Context, clientID int) (*RecordingStats, error)
@@ -49,6 +64,40 @@ type RecordingService interface {
 	ArchiveOldRecordings(ctx context.Context, olderThan time.Duration) error
 }
 
+// RecordingManifestFile is written by the recorder into a recording's spool
+// directory and lists the tracks it captured
+const RecordingManifestFile = "tracks.json"
+
+// recordingArchivePrefix is the storage key prefix of archived recordings.
+// On S3 a bucket lifecycle rule can move it to a colder storage class.
+const recordingArchivePrefix = "archive/"
+
+// RecordingManifest describes the tracks captured for a recording
+type RecordingManifest struct {
+	Tracks []models.RecordingTrack `json:"tracks"`
+}
+
+// Purposes of signed recording URLs; a signature is only valid for the
+// purpose it was issued for
+const (
+	RecordingURLDownload = "download"
+	RecordingURLStream   = "stream"
+)
+
+// ErrInvalidRecordingURL is returned for signed recording URLs that are
+// expired or were not issued by this server
+var ErrInvalidRecordingURL = errors.New("invalid or expired recording link")
+
+// ErrRecordingUnavailable is returned when a recording has no media to serve yet
+var ErrRecordingUnavailable = errors.New("recording is not available")
+
+// ErrTrackNotFound is returned when a recording has no track of the given name
+var ErrTrackNotFound = errors.New("recording track not found")
+
+// ErrRecordingPasswordThrottled is returned for password attempts from an
+// IP address over its limit of wrong guesses
+var ErrRecordingPasswordThrottled = errors.New("too many recording password attempts")
+
 type RecordingStats struct {
 	TotalRecordings      int                    `json:"total_recordings"`
 	TotalDurationMinutes int                    `json:"total_duration_minutes"`
@@ -76,38 +125,50 @@ type MonthlyRecordings struct {
 }
 
 type recordingService struct {
-	db     *database.DB
-	config *config.StorageConfig
+	db         *database.DB
+	config     *config.StorageConfig
+	store      storage.Storage
+	publicURL  string
+	signingKey []byte
 }
 
-func NewRecordingService(db *database.DB, cfg *config.StorageConfig) RecordingService {
+// NewRecordingService creates the recording service. Finished recordings are
+// kept in store. Download and streaming links point at publicURL and are
+// signed with signingKey.
+func NewRecordingService(db *database.DB, cfg *config.StorageConfig, store storage.Storage, publicURL, signingKey string) RecordingService {
 	return &recordingService{
-		db:     db,
-		config: cfg,
+		db:         db,
+		config:     cfg,
+		store:      store,
+		publicURL:  publicURL,
+		signingKey: []byte(signingKey),
 	}
 }
 
 func (s *recordingService) StartRecording(ctx context.Context, recording *models.Recording) error {
 	// Set initial status and start time
-	recording.Status = "recording"
+	recording.Status = models.RecordingStatusRecording
 	now := time.Now()
 	recording.StartedAt = &now
 
-	// Generate file path
+	// Generate the directory the tracks are written to
 	if recording.FilePath == nil {
 		filePath := s.generateFilePath(recording.MeetingID)
 		recording.FilePath = &filePath
 	}
+	if recording.Format == "" {
+		recording.Format = "webm"
+	}
 
 	query := `
 		INSERT INTO recordings (client_id, meeting_id, title, description, status, started_at, 
-		                       file_path, metadata, settings, started_by, is_public, password, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		                       file_path, format, metadata, settings, started_by, is_public, password, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		RETURNING id, created_at, updated_at`
 	
 	err := s.db.GetContext(ctx, recording, query,
 		recording.ClientID, recording.MeetingID, recording.Title, recording.Description,
-		recording.Status, recording.StartedAt, recording.FilePath, recording.Metadata,
+		recording.Status, recording.StartedAt, recording.FilePath, recording.Format, recording.Metadata,
 		recording.Settings, recording.StartedBy, recording.IsPublic, recording.Password,
 		recording.ExpiresAt)
 	if err != nil {
@@ -126,7 +187,7 @@ func (s *recordingService) StopRecording(ctx context.Context, recordingID int, s
 		return fmt.Errorf("failed to get recording: %w", err)
 	}
 
-	if recording.Status != "recording" {
+	if recording.Status != models.RecordingStatusRecording {
 		return fmt.Errorf("recording is not currently active")
 	}
 
@@ -142,14 +203,17 @@ func (s *recordingService) StopRecording(ctx context.Context, recordingID int, s
 		SET status = $2, ended_at = $3, duration = $4, stopped_by = $5, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1`
 	
-	_, err = s.db.ExecContext(ctx, query, recordingID, "processing", now, duration, stoppedBy)
+	// A recording that stopped on its own has no user who stopped it
+	var stopper *int
+	if stoppedBy != 0 {
+		stopper = &stoppedBy
+	}
+
+	_, err = s.db.ExecContext(ctx, query, recordingID, models.RecordingStatusProcessing, now, duration, stopper)
 	if err != nil {
 		return fmt.Errorf("failed to stop recording: %w", err)
 	}
 
-	// Update file size if file exists
-	go s.updateFileSize(recordingID)
-
 	return nil
 }
 
@@ -285,79 +349,163 @@ func (s *recordingService) GetRecordingsByDateRange(ctx context.Context, clientI
 	return recordings, nil
 }
 
+// ProcessRecording finalizes a stopped recording from the manifest its
+// recorder wrote to the spool directory: every track is uploaded to storage
+// with its size and duration recorded, and the recording is marked
+// completed, or failed if no media was captured. It runs on the server that
+// made the recording.
 func (s *recordingService) ProcessRecording(ctx context.Context, recordingID int) error {
 	recording, err := s.GetRecordingByID(ctx, recordingID)
 	if err != nil {
 		return fmt.Errorf("failed to get recording: %w", err)
 	}
 
-	if recording.Status != "processing" {
+	if recording.Status != models.RecordingStatusProcessing {
 		return fmt.Errorf("recording is not in processing state")
 	}
+	if recording.FilePath == nil {
+		return fmt.Errorf("recording file path not found")
+	}
 
-	// Simulate processing (in reality, this would involve video transcoding, etc.)
-	// Update status to completed
-	query := `
-		UPDATE recordings 
-		SET status = $2, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $1`
-	
-	_, err = s.db.ExecContext(ctx, query, recordingID, "completed")
+	spool := filepath.Join(s.config.RecordingSpool, *recording.FilePath)
+	manifest, err := readRecordingManifest(spool)
 	if err != nil {
-		return fmt.Errorf("failed to update recording status: %w", err)
+		return s.failRecording(ctx, recordingID, err)
+	}
+
+	var totalSize int64
+	var longest float64
+	tracks := make([]interface{}, 0, len(manifest.Tracks))
+	for _, track := range manifest.Tracks {
+		info, err := os.Stat(filepath.Join(spool, track.File))
+		if err != nil {
+			return s.failRecording(ctx, recordingID, fmt.Errorf("track %s is missing: %w", track.File, err))
+		}
+		track.Size = info.Size()
+		totalSize += track.Size
+		if track.Duration > longest {
+			longest = track.Duration
+		}
+		tracks = append(tracks, track)
 	}
 
-	// Generate URLs
-	downloadURL, _ := s.GenerateDownloadURL(ctx, recordingID, 24*time.Hour)
-	streamingURL, _ := s.GenerateStreamingURL(ctx, recordingID)
+	if totalSize == 0 {
+		os.RemoveAll(spool)
+		return s.failRecording(ctx, recordingID, fmt.Errorf("no media was captured"))
+	}
 
-	// Update URLs
-	query = `
+	// The spool is kept if an upload fails so the tracks can be recovered
+	for _, track := range manifest.Tracks {
+		if err := s.uploadTrack(ctx, spool, *recording.FilePath, &track); err != nil {
+			return s.failRecording(ctx, recordingID, err)
+		}
+	}
+
+	// Media time is more accurate than the wall clock kept when recording stopped
+	duration := recording.Duration
+	if longest > 0 {
+		seconds := int(longest + 0.5)
+		duration = &seconds
+	}
+
+	metadata := recording.Metadata
+	if metadata == nil {
+		metadata = models.JSONB{}
+	}
+	metadata["tracks"] = tracks
+
+	query := `
 		UPDATE recordings 
-		SET download_url = $2, streaming_url = $3, updated_at = CURRENT_TIMESTAMP
+		SET status = $2, file_size = $3, duration = $4, metadata = $5, 
+		    processed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1`
 	
-	_, err = s.db.ExecContext(ctx, query, recordingID, downloadURL, streamingURL)
+	_, err = s.db.ExecContext(ctx, query, recordingID, models.RecordingStatusCompleted, totalSize, duration, metadata)
 	if err != nil {
-		return fmt.Errorf("failed to update recording URLs: %w", err)
+		return fmt.Errorf("failed to update recording status: %w", err)
 	}
 
+	if err := os.RemoveAll(spool); err != nil {
+		fmt.Printf("Failed to remove recording spool %s: %v\n", spool, err)
+	}
+
+	// Links are signed with an expiry, so they are issued on request rather
+	// than stored with the recording
 	return nil
 }
 
-func (s *recordingService) GenerateDownloadURL(ctx context.Context, recordingID int, expiresIn time.Duration) (string, error) {
-	recording, err := s.GetRecordingByID(ctx, recordingID)
+// uploadTrack copies a track file from the spool to storage
+func (s *recordingService) uploadTrack(ctx context.Context, spool, prefix string, track *models.RecordingTrack) error {
+	file, err := os.Open(filepath.Join(spool, track.File))
 	if err != nil {
-		return "", fmt.Errorf("failed to get recording: %w", err)
+		return fmt.Errorf("failed to open track %s: %w", track.File, err)
 	}
+	defer file.Close()
 
-	if recording.FilePath == nil {
-		return "", fmt.Errorf("recording file path not found")
+	err = s.store.Put(ctx, path.Join(prefix, track.File), file, track.Size, track.ContentType())
+	if err != nil {
+		return fmt.Errorf("failed to upload track %s: %w", track.File, err)
 	}
+	return nil
+}
 
-	// Generate a temporary download URL
-	// This is a simplified implementation - in production, you'd use signed URLs
-	baseURL := "http://localhost:8081" // TODO: Make configurable
-	downloadURL := fmt.Sprintf("%s/api/recordings/%d/download", baseURL, recordingID)
+// failRecording marks a recording that could not be processed as failed
+// and returns the reason
+func (s *recordingService) failRecording(ctx context.Context, recordingID int, reason error) error {
+	query := `
+		UPDATE recordings 
+		SET status = $2, processed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
 	
-	return downloadURL, nil
+	if _, err := s.db.ExecContext(ctx, query, recordingID, models.RecordingStatusFailed); err != nil {
+		return fmt.Errorf("failed to mark recording as failed: %w", err)
+	}
+	return fmt.Errorf("recording processing failed: %w", reason)
 }
 
+// GenerateDownloadURL issues a signed link that downloads the recording's
+// tracks until it expires. Callers must have checked access to the recording.
+func (s *recordingService) GenerateDownloadURL(ctx context.Context, recordingID int, expiresIn time.Duration) (string, error) {
+	return s.signedURL(ctx, recordingID, RecordingURLDownload, expiresIn)
+}
+
+// GenerateStreamingURL issues a signed link that plays the recording's tracks
+// inline, valid for the configured link lifetime
 func (s *recordingService) GenerateStreamingURL(ctx context.Context, recordingID int) (string, error) {
+	return s.signedURL(ctx, recordingID, RecordingURLStream, s.config.SignedURLExpiry)
+}
+
+func (s *recordingService) signedURL(ctx context.Context, recordingID int, purpose string, expiresIn time.Duration) (string, error) {
 	recording, err := s.GetRecordingByID(ctx, recordingID)
 	if err != nil {
 		return "", fmt.Errorf("failed to get recording: %w", err)
 	}
+	if !recording.IsAvailable() {
+		return "", ErrRecordingUnavailable
+	}
 
-	if recording.FilePath == nil {
-		return "", fmt.Errorf("recording file path not found")
+	expires := time.Now().Add(expiresIn).Unix()
+	return fmt.Sprintf("%s/api/v1/public/recordings/%d/%s?expires=%d&signature=%s",
+		s.publicURL, recordingID, purpose, expires, s.sign(recordingID, purpose, expires)), nil
+}
+
+// VerifySignedURL checks the expiry and signature of a signed recording link
+func (s *recordingService) VerifySignedURL(recordingID int, purpose string, expires int64, signature string) error {
+	if time.Now().Unix() > expires {
+		return ErrInvalidRecordingURL
 	}
 
-	// Generate a streaming URL
-	baseURL := "http://localhost:8081" // TODO: Make configurable
-	streamingURL := fmt.Sprintf("%s/api/recordings/%d/stream", baseURL, recordingID)
-	
-	return streamingURL, nil
+	expected := s.sign(recordingID, purpose, expires)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidRecordingURL
+	}
+	return nil
+}
+
+func (s *recordingService) sign(recordingID int, purpose string, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	fmt.Fprintf(mac, "recording:%d:%s:%d", recordingID, purpose, expires)
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 func (s *recordingService) GetRecordingFilePath(ctx context.Context, recordingID int) (string, error) {
@@ -373,15 +521,37 @@ func (s *recordingService) GetRecordingFilePath(ctx context.Context, recordingID
 	return *recording.FilePath, nil
 }
 
+// GetRecordingTrack finds a track of an available recording and returns its
+// storage key. An empty name picks the first video track, or the first track
+// if there is none. Only tracks listed in the recording can be found.
+func (s *recordingService) GetRecordingTrack(ctx context.Context, recordingID int, name string) (*models.RecordingTrack, string, error) {
+	recording, err := s.GetRecordingByID(ctx, recordingID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get recording: %w", err)
+	}
+	if !recording.IsAvailable() || recording.FilePath == nil {
+		return nil, "", ErrRecordingUnavailable
+	}
+
+	tracks, err := recordingTracks(recording)
+	if err != nil {
+		return nil, "", err
+	}
+
+	track := pickRecordingTrack(tracks, name)
+	if track == nil {
+		return nil, "", ErrTrackNotFound
+	}
+	return track, path.Join(*recording.FilePath, track.File), nil
+}
+
 func (s *recordingService) DeleteRecordingFile(ctx context.Context, recordingID int) error {
 	filePath, err := s.GetRecordingFilePath(ctx, recordingID)
 	if err != nil {
 		return fmt.Errorf("failed to get file path: %w", err)
 	}
 
-	fullPath := filepath.Join(s.config.RecordingPath, filePath)
-	err = os.Remove(fullPath)
-	if err != nil && !os.IsNotExist(err) {
+	if err := storage.DeletePrefix(ctx, s.store, filePath+"/"); err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 
@@ -394,48 +564,93 @@ func (s *recordingService) GetRecordingFileSize(ctx context.Context, recordingID
 		return 0, fmt.Errorf("failed to get file path: %w", err)
 	}
 
-	fullPath := filepath.Join(s.config.RecordingPath, filePath)
-	fileInfo, err := os.Stat(fullPath)
+	// A recording is a key prefix holding one object per track
+	size, err := storage.PrefixSize(ctx, s.store, filePath+"/")
 	if err != nil {
 		return 0, fmt.Errorf("failed to get file info: %w", err)
 	}
 
-	return fileInfo.Size(), nil
+	return size, nil
 }
 
+// Recording access is scoped to the recording's tenant. The joins bind $2 to
+// a user of the same client as the recording r and its meeting m.
+const (
+	// recordingManagerCondition matches users who may change or stop a
+	// recording: whoever started it, the meeting host and tenant admins
+	recordingManagerCondition = `
+		(r.started_by = $2 OR m.created_by_user_id = $2 OR u.role IN ('admin', 'super_admin'))`
+
+	// recordingViewerCondition additionally matches the meeting's
+	// participants and, for public recordings, the whole tenant
+	recordingViewerCondition = `
+		(r.is_public OR r.started_by = $2 OR m.created_by_user_id = $2 OR u.role IN ('admin', 'super_admin')
+		 OR EXISTS (SELECT 1 FROM meeting_participants mp WHERE mp.meeting_id = m.id AND mp.user_id = $2))`
+)
+
 func (s *recordingService) CanAccessRecording(ctx context.Context, recordingID, userID int) (bool, error) {
-	recording, err := s.GetRecordingByID(ctx, recordingID)
-	if err != nil {
-		return false, fmt.Errorf("failed to get recording: %w", err)
-	}
+	return s.checkRecordingAccess(ctx, recordingID, userID, recordingViewerCondition)
+}
 
-	// Check if recording is public
-	if recording.IsPublic {
-		return true, nil
-	}
+func (s *recordingService) CanManageRecording(ctx context.Context, recordingID, userID int) (bool, error) {
+	return s.checkRecordingAccess(ctx, recordingID, userID, recordingManagerCondition)
+}
 
-	// Check if user is the meeting host or participant
+func (s *recordingService) checkRecordingAccess(ctx context.Context, recordingID, userID int, condition string) (bool, error) {
 	query := `
-		SELECT COUNT(*) FROM meetings m
-		LEFT JOIN meeting_participants mp ON m.id = mp.meeting_id
-		WHERE m.id = $1 AND (m.host_id = $2 OR mp.user_id = $2)`
+		SELECT EXISTS (
+			SELECT 1 FROM recordings r
+			JOIN meetings m ON m.id = r.meeting_id
+			JOIN users u ON u.id = $2 AND u.client_id = r.client_id
+			WHERE r.id = $1 AND ` + condition + `)`
 	
-	var count int
-	err = s.db.GetContext(ctx, &count, query, recording.MeetingID, userID)
+	var allowed bool
+	err := s.db.GetContext(ctx, &allowed, query, recordingID, userID)
 	if err != nil {
 		return false, fmt.Errorf("failed to check access: %w", err)
 	}
 
-	return count > 0, nil
+	return allowed, nil
+}
+
+// GetRecordingsForUser lists the recordings of the user's tenant the user may view
+func (s *recordingService) GetRecordingsForUser(ctx context.Context, userID int, limit, offset int) ([]*models.Recording, error) {
+	recordings := []*models.Recording{}
+	query := `
+		SELECT r.* FROM recordings r
+		JOIN meetings m ON m.id = r.meeting_id
+		JOIN users u ON u.id = $2 AND u.client_id = r.client_id
+		WHERE ` + recordingViewerCondition + `
+		ORDER BY r.started_at DESC 
+		LIMIT $1 OFFSET $3`
+	
+	err := s.db.SelectContext(ctx, &recordings, query, limit, userID, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recordings for user: %w", err)
+	}
+	
+	return recordings, nil
 }
 
+// SetRecordingPassword protects a recording with a password, stored hashed.
+// An empty password removes the protection.
 func (s *recordingService) SetRecordingPassword(ctx context.Context, recordingID int, password string) error {
+	var hash *string
+	if password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+		h := string(hashed)
+		hash = &h
+	}
+
 	query := `
 		UPDATE recordings 
 		SET password = $2, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1`
 	
-	_, err := s.db.ExecContext(ctx, query, recordingID, password)
+	_, err := s.db.ExecContext(ctx, query, recordingID, hash)
 	if err != nil {
 		return fmt.Errorf("failed to set recording password: %w", err)
 	}
@@ -443,17 +658,62 @@ func (s *recordingService) SetRecordingPassword(ctx context.Context, recordingID
 	return nil
 }
 
-func (s *recordingService) VerifyRecordingPassword(ctx context.Context, recordingID int, password string) (bool, error) {
+// VerifyRecordingPassword checks a password for a recording. Wrong guesses
+// are throttled per IP address, on the recording and across recordings, so
+// one guesser cannot lock other viewers out. Passwords stored in plain text
+// before they were hashed are hashed on their first correct use.
+func (s *recordingService) VerifyRecordingPassword(ctx context.Context, recordingID int, password, ipAddress string) (bool, error) {
 	recording, err := s.GetRecordingByID(ctx, recordingID)
 	if err != nil {
 		return false, fmt.Errorf("failed to get recording: %w", err)
 	}
 
-	if recording.Password == nil {
+	if !recording.HasPassword() {
 		return true, nil // No password required
 	}
 
-	return *recording.Password == password, nil
+	since := time.Now().Add(-s.config.RecordingPasswordWindow)
+	if ipAddress != "" {
+		var recent struct {
+			Recording int `db:"recording"`
+			IP        int `db:"ip"`
+		}
+		query := `
+			SELECT COUNT(*) FILTER (WHERE recording_id = $1) AS recording, COUNT(*) AS ip
+			FROM recording_password_attempts
+			WHERE ip_address = $2 AND created_at > $3`
+
+		if err := s.db.GetContext(ctx, &recent, query, recordingID, ipAddress, since); err != nil {
+			return false, fmt.Errorf("failed to check recording password attempts: %w", err)
+		}
+		if s.config.RecordingPasswordMaxPerRecording > 0 && recent.Recording >= s.config.RecordingPasswordMaxPerRecording {
+			return false, ErrRecordingPasswordThrottled
+		}
+		if s.config.RecordingPasswordMaxPerIP > 0 && recent.IP >= s.config.RecordingPasswordMaxPerIP {
+			return false, ErrRecordingPasswordThrottled
+		}
+	}
+
+	stored := []byte(*recording.Password)
+	if _, err := bcrypt.Cost(stored); err != nil {
+		if subtle.ConstantTimeCompare(stored, []byte(password)) == 1 {
+			if err := s.SetRecordingPassword(ctx, recordingID, password); err != nil {
+				log.Printf("Failed to hash password of recording %d: %v", recordingID, err)
+			}
+			return true, nil
+		}
+	} else if bcrypt.CompareHashAndPassword(stored, []byte(password)) == nil {
+		return true, nil
+	}
+
+	query := `INSERT INTO recording_password_attempts (recording_id, ip_address) VALUES ($1, NULLIF($2, ''))`
+	if _, err := s.db.ExecContext(ctx, query, recordingID, ipAddress); err != nil {
+		return false, fmt.Errorf("failed to record recording password attempt: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM recording_password_attempts WHERE created_at <= $1`, since); err != nil {
+		log.Printf("Failed to prune recording password attempts: %v", err)
+	}
+	return false, nil
 }
 
 func (s *recordingService) GetRecordingStats(ctx context.Context, clientID int) (*RecordingStats, error) {
@@ -561,38 +821,111 @@ func (s *recordingService) CleanupExpiredRecordings(ctx context.Context) error {
 	return nil
 }
 
+// ArchiveOldRecordings moves the tracks of completed recordings older than
+// olderThan under the archive prefix of storage and marks them archived.
+// Archived recordings can still be downloaded.
 func (s *recordingService) ArchiveOldRecordings(ctx context.Context, olderThan time.Duration) error {
 	cutoffTime := time.Now().Add(-olderThan)
 	
 	query := `
-		UPDATE recordings 
-		SET status = 'archived', updated_at = CURRENT_TIMESTAMP
-		WHERE created_at < $1 AND status = 'completed'`
+		SELECT id, file_path FROM recordings 
+		WHERE created_at < $1 AND status = 'completed' AND file_path IS NOT NULL`
 	
-	_, err := s.db.ExecContext(ctx, query, cutoffTime)
+	var recordings []struct {
+		ID       int    `db:"id"`
+		FilePath string `db:"file_path"`
+	}
+	err := s.db.SelectContext(ctx, &recordings, query, cutoffTime)
 	if err != nil {
-		return fmt.Errorf("failed to archive old recordings: %w", err)
+		return fmt.Errorf("failed to get old recordings: %w", err)
+	}
+
+	for _, recording := range recordings {
+		if err := s.archiveRecording(ctx, recording.ID, recording.FilePath); err != nil {
+			fmt.Printf("Failed to archive recording %d: %v\n", recording.ID, err)
+		}
 	}
 	
 	return nil
 }
 
+func (s *recordingService) archiveRecording(ctx context.Context, recordingID int, filePath string) error {
+	objects, err := s.store.List(ctx, filePath+"/")
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := s.store.Move(ctx, object.Key, recordingArchivePrefix+object.Key); err != nil {
+			return fmt.Errorf("failed to move %s: %w", object.Key, err)
+		}
+	}
+
+	query := `
+		UPDATE recordings 
+		SET status = 'archived', file_path = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+	
+	_, err = s.db.ExecContext(ctx, query, recordingID, recordingArchivePrefix+filePath)
+	if err != nil {
+		return fmt.Errorf("failed to archive recording: %w", err)
+	}
+	return nil
+}
+
 // Helper methods
 
 func (s *recordingService) generateFilePath(meetingID int) string {
 	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("meeting_%d_%s.mp4", meetingID, timestamp)
-	return filename
+	return fmt.Sprintf("meeting_%d_%s", meetingID, timestamp)
 }
 
-func (s *recordingService) updateFileSize(recordingID int) {
-	ctx := context.Background()
-	
-	fileSize, err := s.GetRecordingFileSize(ctx, recordingID)
+// recordingTracks returns the tracks stored in a processed recording's metadata
+func recordingTracks(recording *models.Recording) ([]models.RecordingTrack, error) {
+	data, err := json.Marshal(recording.Metadata["tracks"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording tracks: %w", err)
+	}
+
+	var tracks []models.RecordingTrack
+	if err := json.Unmarshal(data, &tracks); err != nil {
+		return nil, fmt.Errorf("failed to read recording tracks: %w", err)
+	}
+	return tracks, nil
+}
+
+// pickRecordingTrack finds a track by file name, or picks the default track
+// when name is empty
+func pickRecordingTrack(tracks []models.RecordingTrack, name string) *models.RecordingTrack {
+	if name != "" {
+		for i := range tracks {
+			if tracks[i].File == name {
+				return &tracks[i]
+			}
+		}
+		return nil
+	}
+
+	for i := range tracks {
+		if tracks[i].Kind == "video" {
+			return &tracks[i]
+		}
+	}
+	if len(tracks) > 0 {
+		return &tracks[0]
+	}
+	return nil
+}
+
+// readRecordingManifest loads the track manifest from a recording directory
+func readRecordingManifest(dir string) (*RecordingManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, RecordingManifestFile))
 	if err != nil {
-		return
+		return nil, fmt.Errorf("failed to read track manifest: %w", err)
 	}
 
-	query := `UPDATE recordings SET file_size = $2 WHERE id = $1`
-	s.db.ExecContext(ctx, query, recordingID, fileSize)
-}
\ No newline at end of file
+	manifest := &RecordingManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse track manifest: %w", err)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies supported in meeting RRULEs
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+// maxRecurrencePeriods bounds the expansion of rules that rarely or never match
+const maxRecurrencePeriods = 5000
+
+// icsDateTimeUTC and icsDateTimeLocal are the RFC 5545 DATE-TIME forms
+const (
+	icsDateTimeUTC   = "20060102T150405Z"
+	icsDateTimeLocal = "20060102T150405"
+	icsDate          = "20060102"
+)
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+var icsWeekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// RecurrenceWeekday is a BYDAY entry. N selects the nth weekday of the
+// month (negative counts from the end); zero means every such weekday.
+type RecurrenceWeekday struct {
+	N       int
+	Weekday time.Weekday
+}
+
+func (d RecurrenceWeekday) String() string {
+	if d.N == 0 {
+		return icsWeekdayNames[d.Weekday]
+	}
+	return strconv.Itoa(d.N) + icsWeekdayNames[d.Weekday]
+}
+
+// RecurrenceRule is the subset of an RFC 5545 RRULE supported for meetings:
+// FREQ (DAILY, WEEKLY, MONTHLY), INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL.
+// Weeks start on Monday.
+type RecurrenceRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []RecurrenceWeekday
+	ByMonthDay []int
+	Count      int
+	Until      *time.Time
+}
+
+// ParseRecurrenceRule parses an RRULE value, with or without the "RRULE:" prefix
+func ParseRecurrenceRule(value string) (*RecurrenceRule, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return nil, fmt.Errorf("recurrence rule is empty")
+	}
+
+	rule := &RecurrenceRule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok || val == "" {
+			return nil, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(val)
+			if rule.Freq != FreqDaily && rule.Freq != FreqWeekly && rule.Freq != FreqMonthly {
+				return nil, fmt.Errorf("unsupported recurrence frequency %q", val)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(val)
+			if err != nil || interval < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", val)
+			}
+			rule.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(val)
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", val)
+			}
+			rule.Count = count
+		case "UNTIL":
+			until, err := parseICSTime(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q", val)
+			}
+			rule.Until = &until
+		case "BYDAY":
+			for _, entry := range strings.Split(strings.ToUpper(val), ",") {
+				day, err := parseRecurrenceWeekday(entry)
+				if err != nil {
+					return nil, err
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, entry := range strings.Split(val, ",") {
+				day, err := strconv.Atoi(entry)
+				if err != nil || day == 0 || day < -31 || day > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q", entry)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, day)
+			}
+		case "WKST":
+			if strings.ToUpper(val) != "MO" {
+				return nil, fmt.Errorf("only WKST=MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported recurrence rule part %q", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("recurrence rule requires FREQ")
+	}
+	if rule.Count > 0 && rule.Until != nil {
+		return nil, fmt.Errorf("COUNT and UNTIL cannot both be set")
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq != FreqMonthly {
+		return nil, fmt.Errorf("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	for _, day := range rule.ByDay {
+		if day.N != 0 && rule.Freq != FreqMonthly {
+			return nil, fmt.Errorf("numbered BYDAY is only supported with FREQ=MONTHLY")
+		}
+	}
+
+	return rule, nil
+}
+
+func parseRecurrenceWeekday(entry string) (RecurrenceWeekday, error) {
+	if len(entry) < 2 {
+		return RecurrenceWeekday{}, fmt.Errorf("invalid BYDAY %q", entry)
+	}
+
+	weekday, ok := icsWeekdays[entry[len(entry)-2:]]
+	if !ok {
+		return RecurrenceWeekday{}, fmt.Errorf("invalid BYDAY %q", entry)
+	}
+
+	n := 0
+	if prefix := entry[:len(entry)-2]; prefix != "" {
+		var err error
+		n, err = strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return RecurrenceWeekday{}, fmt.Errorf("invalid BYDAY %q", entry)
+		}
+	}
+
+	return RecurrenceWeekday{N: n, Weekday: weekday}, nil
+}
+
+// parseICSTime parses an RFC 5545 DATE or DATE-TIME. Floating times are
+// read as UTC and a DATE covers the whole day.
+func parseICSTime(value string) (time.Time, error) {
+	if t, err := time.Parse(icsDateTimeUTC, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(icsDateTimeLocal, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(icsDate, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Add(24*time.Hour - time.Second), nil
+}
+
+// String formats the rule as an RRULE value
+func (r *RecurrenceRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = day.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(icsDateTimeUTC))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrences expands the rule for a series starting at dtstart and returns
+// the occurrence starts in [from, to) that are not excluded. Expansion runs
+// on the wall clock of loc, so a 09:00 meeting stays at 09:00 across DST
+// changes. As in RFC 5545, excluded occurrences still count towards COUNT.
+func (r *RecurrenceRule) Occurrences(dtstart time.Time, loc *time.Location, exdates []time.Time, from, to time.Time) []time.Time {
+	start := dtstart.In(loc)
+
+	excluded := make(map[int64]bool, len(exdates))
+	for _, t := range exdates {
+		excluded[t.Unix()] = true
+	}
+
+	var occurrences []time.Time
+	count := 0
+	for period := 0; period < maxRecurrencePeriods; period++ {
+		for _, t := range r.candidates(start, period) {
+			if t.Before(start) {
+				continue
+			}
+			if r.Until != nil && t.After(*r.Until) {
+				return occurrences
+			}
+			count++
+			if r.Count > 0 && count > r.Count {
+				return occurrences
+			}
+			if !t.Before(to) {
+				return occurrences
+			}
+			if !t.Before(from) && !excluded[t.Unix()] {
+				occurrences = append(occurrences, t)
+			}
+		}
+	}
+	return occurrences
+}
+
+// OccurrencesBefore returns how many occurrences, excluded ones included,
+// start before t
+func (r *RecurrenceRule) OccurrencesBefore(dtstart time.Time, loc *time.Location, t time.Time) int {
+	return len(r.Occurrences(dtstart, loc, nil, dtstart, t))
+}
+
+// IsOccurrence reports whether t is a start generated by the rule
+func (r *RecurrenceRule) IsOccurrence(dtstart time.Time, loc *time.Location, t time.Time) bool {
+	return len(r.Occurrences(dtstart, loc, nil, t, t.Add(time.Second))) == 1
+}
+
+// candidates returns the sorted occurrence candidates of the nth period
+func (r *RecurrenceRule) candidates(start time.Time, period int) []time.Time {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+
+	var days []time.Time
+	switch r.Freq {
+	case FreqDaily:
+		day := at(start.Year(), start.Month(), start.Day()+period*r.Interval)
+		if len(r.ByDay) == 0 || r.matchesWeekday(day.Weekday()) {
+			days = append(days, day)
+		}
+
+	case FreqWeekly:
+		monday := start.Day() - (int(start.Weekday())+6)%7 + period*r.Interval*7
+		weekdays := []time.Weekday{start.Weekday()}
+		if len(r.ByDay) > 0 {
+			weekdays = weekdays[:0]
+			for _, d := range r.ByDay {
+				weekdays = append(weekdays, d.Weekday)
+			}
+		}
+		for _, weekday := range weekdays {
+			days = append(days, at(start.Year(), start.Month(), monday+(int(weekday)+6)%7))
+		}
+
+	case FreqMonthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(period*r.Interval), 1, 0, 0, 0, 0, start.Location())
+		year, month := first.Year(), first.Month()
+		daysInMonth := time.Date(year, month+1, 0, 0, 0, 0, 0, start.Location()).Day()
+
+		switch {
+		case len(r.ByDay) > 0:
+			for _, d := range r.ByDay {
+				for _, day := range nthWeekdays(year, month, daysInMonth, d, start.Location()) {
+					days = append(days, at(year, month, day))
+				}
+			}
+		case len(r.ByMonthDay) > 0:
+			for _, d := range r.ByMonthDay {
+				if d < 0 {
+					d = daysInMonth + d + 1
+				}
+				if d >= 1 && d <= daysInMonth {
+					days = append(days, at(year, month, d))
+				}
+			}
+		default:
+			// Months without the start day (e.g. the 31st) are skipped
+			if start.Day() <= daysInMonth {
+				days = append(days, at(year, month, start.Day()))
+			}
+		}
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	unique := days[:0]
+	for i, day := range days {
+		if i == 0 || !day.Equal(days[i-1]) {
+			unique = append(unique, day)
+		}
+	}
+	return unique
+}
+
+func (r *RecurrenceRule) matchesWeekday(weekday time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d.Weekday == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// nthWeekdays returns the days of the month matching a BYDAY entry
+func nthWeekdays(year int, month time.Month, daysInMonth int, d RecurrenceWeekday, loc *time.Location) []int {
+	firstWeekday := time.Date(year, month, 1, 0, 0, 0, 0, loc).Weekday()
+	firstMatch := 1 + (int(d.Weekday)-int(firstWeekday)+7)%7
+
+	var matches []int
+	for day := firstMatch; day <= daysInMonth; day += 7 {
+		matches = append(matches, day)
+	}
+
+	switch {
+	case d.N == 0:
+		return matches
+	case d.N > 0 && d.N <= len(matches):
+		return []int{matches[d.N-1]}
+	case d.N < 0 && -d.N <= len(matches):
+		return []int{matches[len(matches)+d.N]}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+func TestParseRecurrenceRule(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string // the rule formatted back; empty when the value is refused
+	}{
+		{value: "RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR", want: "FREQ=WEEKLY;BYDAY=MO,WE,FR"},
+		{value: "freq=daily;interval=2;count=10", want: "FREQ=DAILY;INTERVAL=2;COUNT=10"},
+		{value: "FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20261231T235959Z", want: "FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20261231T235959Z"},
+		{value: "FREQ=MONTHLY;BYMONTHDAY=1,-1;WKST=MO", want: "FREQ=MONTHLY;BYMONTHDAY=1,-1"},
+		// A DATE UNTIL covers the whole day
+		{value: "FREQ=DAILY;UNTIL=20260110", want: "FREQ=DAILY;UNTIL=20260110T235959Z"},
+
+		{value: ""},
+		{value: "INTERVAL=2"},
+		{value: "FREQ=YEARLY"},
+		{value: "FREQ=DAILY;INTERVAL=0"},
+		{value: "FREQ=DAILY;COUNT=3;UNTIL=20260110T000000Z"},
+		{value: "FREQ=WEEKLY;BYDAY=XX"},
+		{value: "FREQ=WEEKLY;BYDAY=2MO"},
+		{value: "FREQ=MONTHLY;BYDAY=6MO"},
+		{value: "FREQ=WEEKLY;BYMONTHDAY=1"},
+		{value: "FREQ=MONTHLY;BYMONTHDAY=32"},
+		{value: "FREQ=WEEKLY;WKST=SU"},
+		{value: "FREQ=DAILY;BYHOUR=9"},
+	}
+
+	for _, tt := range tests {
+		rule, err := ParseRecurrenceRule(tt.value)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("%q: accepted as %s", tt.value, rule)
+		case tt.want != "" && err != nil:
+			t.Errorf("%q: %v", tt.value, err)
+		case tt.want != "" && rule.String() != tt.want:
+			t.Errorf("%q: parsed as %s, want %s", tt.value, rule, tt.want)
+		}
+	}
+}
+
+func TestRecurrenceOccurrences(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	utc := func(value string) time.Time {
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatalf("invalid time %q: %v", value, err)
+		}
+		return at
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart string
+		loc     *time.Location
+		exdates []string
+		from    string // defaults to dtstart
+		to      string // defaults to a year after dtstart
+		want    []string
+	}{
+		{
+			name:    "BYDAY",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=5",
+			dtstart: "2026-01-05T09:00:00Z",
+			want:    []string{"2026-01-05T09:00:00Z", "2026-01-07T09:00:00Z", "2026-01-09T09:00:00Z", "2026-01-12T09:00:00Z", "2026-01-14T09:00:00Z"},
+		},
+		{
+			name:    "BYDAY skips days before the start",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,FR;INTERVAL=2;COUNT=3",
+			dtstart: "2026-01-07T09:00:00Z",
+			want:    []string{"2026-01-09T09:00:00Z", "2026-01-19T09:00:00Z", "2026-01-23T09:00:00Z"},
+		},
+		{
+			name:    "COUNT",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: "2026-01-05T09:00:00Z",
+			want:    []string{"2026-01-05T09:00:00Z", "2026-01-06T09:00:00Z", "2026-01-07T09:00:00Z"},
+		},
+		{
+			name:    "UNTIL includes its own time",
+			rule:    "FREQ=DAILY;UNTIL=20260107T090000Z",
+			dtstart: "2026-01-05T09:00:00Z",
+			want:    []string{"2026-01-05T09:00:00Z", "2026-01-06T09:00:00Z", "2026-01-07T09:00:00Z"},
+		},
+		{
+			name:    "EXDATE counts towards COUNT",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: "2026-01-05T09:00:00Z",
+			exdates: []string{"2026-01-06T09:00:00Z"},
+			want:    []string{"2026-01-05T09:00:00Z", "2026-01-07T09:00:00Z"},
+		},
+		{
+			name:    "EXDATE within UNTIL",
+			rule:    "FREQ=WEEKLY;UNTIL=20260126T090000Z",
+			dtstart: "2026-01-05T09:00:00Z",
+			exdates: []string{"2026-01-12T09:00:00Z", "2026-01-13T09:00:00Z"},
+			want:    []string{"2026-01-05T09:00:00Z", "2026-01-19T09:00:00Z", "2026-01-26T09:00:00Z"},
+		},
+		{
+			name:    "a window of the series",
+			rule:    "FREQ=DAILY",
+			dtstart: "2026-01-05T09:00:00Z",
+			from:    "2026-02-01T00:00:00Z",
+			to:      "2026-02-03T09:00:00Z",
+			want:    []string{"2026-02-01T09:00:00Z", "2026-02-02T09:00:00Z"},
+		},
+		{
+			// 09:00 EST, then 09:00 EDT after the change on March 8
+			name:    "DST transition",
+			rule:    "FREQ=WEEKLY;COUNT=3",
+			dtstart: "2026-03-02T14:00:00Z",
+			loc:     newYork,
+			want:    []string{"2026-03-02T14:00:00Z", "2026-03-09T13:00:00Z", "2026-03-16T13:00:00Z"},
+		},
+		{
+			name:    "EXDATE after a DST transition",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: "2026-03-07T14:00:00Z",
+			loc:     newYork,
+			exdates: []string{"2026-03-08T13:00:00Z"},
+			want:    []string{"2026-03-07T14:00:00Z", "2026-03-09T13:00:00Z"},
+		},
+		{
+			name:    "last weekday of the month",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			dtstart: "2026-01-30T09:00:00Z",
+			want:    []string{"2026-01-30T09:00:00Z", "2026-02-27T09:00:00Z", "2026-03-27T09:00:00Z"},
+		},
+		{
+			name:    "months without the start day are skipped",
+			rule:    "FREQ=MONTHLY;COUNT=3",
+			dtstart: "2026-01-31T09:00:00Z",
+			want:    []string{"2026-01-31T09:00:00Z", "2026-03-31T09:00:00Z", "2026-05-31T09:00:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		rule, err := ParseRecurrenceRule(tt.rule)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		loc := tt.loc
+		if loc == nil {
+			loc = time.UTC
+		}
+		dtstart := utc(tt.dtstart)
+		from, to := dtstart, dtstart.AddDate(1, 0, 0)
+		if tt.from != "" {
+			from = utc(tt.from)
+		}
+		if tt.to != "" {
+			to = utc(tt.to)
+		}
+		var exdates []time.Time
+		for _, exdate := range tt.exdates {
+			exdates = append(exdates, utc(exdate))
+		}
+
+		var got []string
+		for _, occurrence := range rule.Occurrences(dtstart, loc, exdates, from, to) {
+			got = append(got, occurrence.UTC().Format(time.RFC3339))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecurrenceOccurrencesBefore(t *testing.T) {
+	rule, err := ParseRecurrenceRule("FREQ=WEEKLY;BYDAY=TU,TH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dtstart := time.Date(2026, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	if n := rule.OccurrencesBefore(dtstart, time.UTC, time.Date(2026, 1, 13, 9, 0, 0, 0, time.UTC)); n != 2 {
+		t.Errorf("OccurrencesBefore = %d, want 2", n)
+	}
+	if !rule.IsOccurrence(dtstart, time.UTC, time.Date(2026, 1, 15, 9, 0, 0, 0, time.UTC)) {
+		t.Error("a Thursday at 09:00 is not an occurrence")
+	}
+	if rule.IsOccurrence(dtstart, time.UTC, time.Date(2026, 1, 14, 9, 0, 0, 0, time.UTC)) {
+		t.Error("a Wednesday is an occurrence")
+	}
+}
+
+func TestICSScheduleDeclaresTimezone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	rule, zone := "FREQ=WEEKLY;COUNT=52", "America/New_York"
+	meeting := &models.Meeting{
+		MeetingID:          "series",
+		ScheduledStart:     time.Date(2026, 1, 5, 9, 0, 0, 0, newYork),
+		ScheduledEnd:       time.Date(2026, 1, 5, 10, 0, 0, 0, newYork),
+		RecurrenceRule:     &rule,
+		RecurrenceTimezone: &zone,
+	}
+
+	ics := NewCalendarService().GenerateICSContent(meeting, "https://example.com/join")
+	for _, want := range []string{
+		"BEGIN:VTIMEZONE\nTZID:America/New_York\n",
+		"BEGIN:DAYLIGHT\nDTSTART:20260308T020000\nTZOFFSETFROM:-0500\nTZOFFSETTO:-0400\nTZNAME:EDT\nEND:DAYLIGHT",
+		"BEGIN:STANDARD\nDTSTART:20261101T020000\nTZOFFSETFROM:-0400\nTZOFFSETTO:-0500\nTZNAME:EST\nEND:STANDARD",
+		"DTSTART;TZID=America/New_York:20260105T090000\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("ICS lacks %q:\n%s", want, ics)
+		}
+	}
+	if strings.Index(ics, "END:VTIMEZONE") > strings.Index(ics, "BEGIN:VEVENT") {
+		t.Error("VTIMEZONE follows the event it describes")
+	}
+
+	// A single meeting is written in UTC, without a zone
+	single := &models.Meeting{MeetingID: "single", ScheduledStart: meeting.ScheduledStart, ScheduledEnd: meeting.ScheduledEnd}
+	if ics := NewCalendarService().GenerateICSContent(single, "https://example.com/join"); strings.Contains(ics, "VTIMEZONE") || !strings.Contains(ics, "DTSTART:20260105T140000Z") {
+		t.Errorf("unexpected single meeting schedule:\n%s", ics)
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"video-conference-backend/internal/config"
 	"video-conference-backend/internal/database"
+	"video-conference-backend/internal/storage"
 )
 
 // Services holds all service dependencies
@@ -10,6 +11,8 @@ type Services struct {
 	Client      ClientService
 	User        UserService
 	Auth        AuthService
+	MFA         MFAService
+	SSO         SSOService
 	Meeting     MeetingService
 	Invitation  *InvitationService
 	Email       *EmailService
@@ -17,26 +20,36 @@ type Services struct {
 	Chat        ChatService
 	Recording   RecordingService
 	Group       GroupService
+	Breakout    BreakoutService
+	TURN        TURNService
+	Storage     *storage.Stores
 }
 
-// NewServices creates a new services instance
-func NewServices(db *database.DB, cfg *config.Config) *Services {
+// NewServices creates a new services instance. Recordings and uploads are
+// kept in stores.
+func NewServices(db *database.DB, cfg *config.Config, stores *storage.Stores) *Services {
 	// Initialize individual services in proper order to avoid circular dependencies
 	clientService := NewClientService(db)
 	userService := NewUserService(db)
 	authService := NewAuthService(db, &cfg.Auth)
+	mfaService := NewMFAService(db)
+	ssoService := NewSSOService(db, userService, cfg.Server.FrontendURL+"/sso/callback")
 	emailService := NewEmailService(&cfg.Email)
 	groupService := NewGroupService(db)
 	meetingService := NewMeetingService(db)
 	invitationService := NewInvitationService(db, cfg.Auth.JWTSecret)
 	calendarService := NewCalendarService()
-	chatService := NewChatService(db)
-	recordingService := NewRecordingService(db, &cfg.Storage)
+	chatService := NewChatService(db, &cfg.Chat, &cfg.Storage, stores.Uploads, cfg.Server.PublicURL, cfg.Auth.JWTSecret)
+	breakoutService := NewBreakoutService(db)
+	turnService := NewTURNService(db, &cfg.WebRTC)
+	recordingService := NewRecordingService(db, &cfg.Storage, stores.Recordings, cfg.Server.PublicURL, cfg.Auth.JWTSecret)
 
 	return &Services{
 		Client:     clientService,
 		User:       userService,
 		Auth:       authService,
+		MFA:        mfaService,
+		SSO:        ssoService,
 		Meeting:    meetingService,
 		Invitation: invitationService,
 		Email:      emailService,
@@ -44,5 +57,8 @@ func NewServices(db *database.DB, cfg *config.Config) *Services {
 		Chat:       chatService,
 		Recording:  recordingService,
 		Group:      groupService,
+		Breakout:   breakoutService,
+		TURN:       turnService,
+		Storage:    stores,
 	}
 }
\ No newline at end of file
@@ -0,0 +1,653 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"video-conference-backend/internal/database"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/oidc"
+)
+
+const (
+	// ssoRequestExpiry is how long users have to sign in at their provider
+	ssoRequestExpiry = 10 * time.Minute
+	// ssoDiscoveryMaxAge is how long a provider's discovery document is used
+	ssoDiscoveryMaxAge = time.Hour
+	// ssoHTTPTimeout bounds each request to a provider
+	ssoHTTPTimeout = 10 * time.Second
+	// maxNameLength is the length of users' first_name and last_name
+	maxNameLength = 100
+	// ssoDomainRecordPrefix names the TXT record that verifies a domain
+	ssoDomainRecordPrefix = "_video-conference-sso."
+	// ssoDomainRecordValue prefixes the verification token in the record
+	ssoDomainRecordValue = "video-conference-sso-verification="
+)
+
+// defaultSSOScopes are requested when a client configures none
+var defaultSSOScopes = []string{"openid", "email", "profile"}
+
+// Errors returned for sign-ins that cannot complete
+var (
+	ErrSSONotConfigured    = errors.New("single sign-on is not configured")
+	ErrInvalidSSOConfig    = errors.New("invalid single sign-on configuration")
+	ErrInvalidSSOState     = errors.New("invalid or expired sign-in, please try again")
+	ErrSSODomainNotAllowed = errors.New("email domain is not allowed for single sign-on")
+	ErrSSOEmailUnverified  = errors.New("email is not verified by the identity provider")
+	ErrSSODomainNotFound   = errors.New("domain is not configured for single sign-on")
+	ErrSSODomainUnverified = errors.New("domain verification record not found")
+	ErrSSODomainTaken      = errors.New("domain is verified by another client")
+)
+
+// SSOService signs users in through their client's OpenID Connect provider
+// with the authorization code flow and PKCE. Users are matched by the
+// provider's subject, linked by email on their first sign-in, or created.
+type SSOService interface {
+	GetConfig(ctx context.Context, clientID int) (*models.SSOConfig, error)
+	SaveConfig(ctx context.Context, config *models.SSOConfig) error
+	DeleteConfig(ctx context.Context, clientID int) error
+	Start(ctx context.Context, req *models.SSOStartRequest) (*models.SSOStartResponse, error)
+	Authenticate(ctx context.Context, code, state string) (*models.User, error)
+	VerifyDomain(ctx context.Context, clientID int, domain string, approvedBy *int) (*models.SSODomain, error)
+}
+
+type ssoService struct {
+	db          *database.DB
+	userSvc     UserService
+	redirectURL string
+	httpClient  *http.Client
+	lookupTXT   func(ctx context.Context, name string) ([]string, error)
+
+	providersMutex sync.Mutex
+	providers      map[string]*discoveredProvider // by issuer
+}
+
+// discoveredProvider is a cached discovery document, with its keys
+type discoveredProvider struct {
+	provider     *oidc.Provider
+	discoveredAt time.Time
+}
+
+// oidcAuthRequest is a row of oidc_auth_requests
+type oidcAuthRequest struct {
+	ClientID     int       `db:"client_id"`
+	Nonce        string    `db:"nonce"`
+	CodeVerifier string    `db:"code_verifier"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
+
+// NewSSOService creates a new single sign-on service. Providers redirect
+// users back to redirectURL, the frontend's callback page.
+func NewSSOService(db *database.DB, userSvc UserService, redirectURL string) SSOService {
+	return &ssoService{
+		db:          db,
+		userSvc:     userSvc,
+		redirectURL: redirectURL,
+		httpClient:  &http.Client{Timeout: ssoHTTPTimeout},
+		lookupTXT:   net.DefaultResolver.LookupTXT,
+		providers:   make(map[string]*discoveredProvider),
+	}
+}
+
+// GetConfig returns a client's provider configuration, without its secret
+// and with its domains' verification status
+func (s *ssoService) GetConfig(ctx context.Context, clientID int) (*models.SSOConfig, error) {
+	config, err := s.loadConfig(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	config.OIDCClientSecret = nil
+	if config.Domains, err = s.loadDomains(ctx, s.db, clientID); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SaveConfig creates or replaces a client's provider configuration. The
+// issuer must be discoverable. A nil secret keeps the current one, and an
+// empty one removes it. Newly added domains start unverified.
+func (s *ssoService) SaveConfig(ctx context.Context, config *models.SSOConfig) error {
+	if err := s.validateConfig(ctx, config); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO client_sso_configs (client_id, enabled, issuer, oidc_client_id, oidc_client_secret,
+			allowed_domains, scopes, role_claim, role_mapping, default_role)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10)
+		ON CONFLICT (client_id) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			issuer = EXCLUDED.issuer,
+			oidc_client_id = EXCLUDED.oidc_client_id,
+			oidc_client_secret = CASE WHEN $5::text IS NULL THEN client_sso_configs.oidc_client_secret ELSE EXCLUDED.oidc_client_secret END,
+			allowed_domains = EXCLUDED.allowed_domains,
+			scopes = EXCLUDED.scopes,
+			role_claim = EXCLUDED.role_claim,
+			role_mapping = EXCLUDED.role_mapping,
+			default_role = EXCLUDED.default_role,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING created_at, updated_at, oidc_client_secret IS NOT NULL`
+
+	err = tx.QueryRowxContext(ctx, query,
+		config.ClientID, config.Enabled, config.Issuer, config.OIDCClientID, config.OIDCClientSecret,
+		config.AllowedDomains, config.Scopes, config.RoleClaim, config.RoleMapping, config.DefaultRole,
+	).Scan(&config.CreatedAt, &config.UpdatedAt, &config.HasClientSecret)
+	if err != nil {
+		return fmt.Errorf("failed to save SSO config: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM client_sso_domains WHERE client_id = $1 AND domain <> ALL($2)`,
+		config.ClientID, config.AllowedDomains)
+	if err != nil {
+		return fmt.Errorf("failed to remove SSO domains: %w", err)
+	}
+	for _, domain := range config.AllowedDomains {
+		token, err := oidc.RandomString()
+		if err != nil {
+			return err
+		}
+		query := `
+			INSERT INTO client_sso_domains (client_id, domain, verification_token)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (client_id, domain) DO NOTHING`
+		if _, err := tx.ExecContext(ctx, query, config.ClientID, domain, token); err != nil {
+			return fmt.Errorf("failed to add SSO domain: %w", err)
+		}
+	}
+	if config.Domains, err = s.loadDomains(ctx, tx, config.ClientID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	config.OIDCClientSecret = nil
+	return nil
+}
+
+// DeleteConfig removes a client's provider. Its users keep their accounts
+// and can reset their password to sign in.
+func (s *ssoService) DeleteConfig(ctx context.Context, clientID int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM client_sso_configs WHERE client_id = $1`, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete SSO config: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrSSONotConfigured
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM client_sso_domains WHERE client_id = $1`, clientID); err != nil {
+		return fmt.Errorf("failed to delete SSO domains: %w", err)
+	}
+	return nil
+}
+
+// VerifyDomain verifies one of a client's domains, by its DNS TXT record or,
+// with approvedBy, by a platform admin's approval
+func (s *ssoService) VerifyDomain(ctx context.Context, clientID int, domain string, approvedBy *int) (*models.SSODomain, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+
+	record := &models.SSODomain{}
+	query := `SELECT * FROM client_sso_domains WHERE client_id = $1 AND domain = $2`
+	if err := s.db.GetContext(ctx, record, query, clientID, domain); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSSODomainNotFound
+		}
+		return nil, fmt.Errorf("failed to get SSO domain: %w", err)
+	}
+	if record.IsVerified() {
+		setVerificationRecord(record)
+		return record, nil
+	}
+
+	if approvedBy == nil {
+		lookupCtx, cancel := context.WithTimeout(ctx, ssoHTTPTimeout)
+		defer cancel()
+		values, err := s.lookupTXT(lookupCtx, ssoDomainRecordPrefix+domain)
+		if err != nil {
+			log.Printf("Failed to look up SSO verification record of %s: %v", domain, err)
+		}
+		if !slices.Contains(values, ssoDomainRecordValue+record.VerificationToken) {
+			return nil, ErrSSODomainUnverified
+		}
+	}
+
+	query = `
+		UPDATE client_sso_domains SET verified_at = CURRENT_TIMESTAMP, verified_by = $3
+		WHERE client_id = $1 AND domain = $2
+		RETURNING *`
+	if err := s.db.GetContext(ctx, record, query, clientID, domain, approvedBy); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, ErrSSODomainTaken
+		}
+		return nil, fmt.Errorf("failed to verify SSO domain: %w", err)
+	}
+
+	log.Printf("Verified SSO domain %s for client %d", domain, clientID)
+	setVerificationRecord(record)
+	return record, nil
+}
+
+// Start begins a sign-in for a client, or for the client whose provider
+// handles an email's domain, and returns the provider's authorization URL
+func (s *ssoService) Start(ctx context.Context, req *models.SSOStartRequest) (*models.SSOStartResponse, error) {
+	var config *models.SSOConfig
+	var err error
+	if req.ClientID != 0 {
+		config, err = s.loadConfig(ctx, req.ClientID)
+	} else {
+		config, err = s.configForDomain(ctx, emailDomain(req.Email))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return nil, ErrSSONotConfigured
+	}
+
+	provider, err := s.provider(ctx, config.Issuer, false)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return nil, err
+	}
+
+	s.pruneAuthRequests(ctx)
+	query := `
+		INSERT INTO oidc_auth_requests (state_hash, client_id, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + $5 * INTERVAL '1 second')`
+	_, err = s.db.ExecContext(ctx, query, hashToken(state), config.ClientID, nonce, verifier, int(ssoRequestExpiry.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store SSO request: %w", err)
+	}
+
+	return &models.SSOStartResponse{
+		AuthorizationURL: provider.AuthCodeURL(oidc.AuthRequest{
+			ClientID:      config.OIDCClientID,
+			RedirectURI:   s.redirectURL,
+			Scopes:        config.Scopes,
+			State:         state,
+			Nonce:         nonce,
+			CodeChallenge: challenge,
+			LoginHint:     strings.TrimSpace(req.Email),
+		}),
+		State: state,
+	}, nil
+}
+
+// Authenticate completes a sign-in with the code and state the provider
+// redirected back with, and returns the signed-in user
+func (s *ssoService) Authenticate(ctx context.Context, code, state string) (*models.User, error) {
+	// Each state is redeemed once
+	request := &oidcAuthRequest{}
+	query := `
+		DELETE FROM oidc_auth_requests WHERE state_hash = $1
+		RETURNING client_id, nonce, code_verifier, expires_at`
+	if err := s.db.GetContext(ctx, request, query, hashToken(state)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidSSOState
+		}
+		return nil, fmt.Errorf("failed to get SSO request: %w", err)
+	}
+	if time.Now().After(request.ExpiresAt) {
+		return nil, ErrInvalidSSOState
+	}
+
+	config, err := s.loadConfig(ctx, request.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return nil, ErrSSONotConfigured
+	}
+
+	provider, err := s.provider(ctx, config.Issuer, false)
+	if err != nil {
+		return nil, err
+	}
+	var secret string
+	if config.OIDCClientSecret != nil {
+		secret = *config.OIDCClientSecret
+	}
+	token, err := provider.Exchange(ctx, config.OIDCClientID, secret, code, s.redirectURL, request.CodeVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange SSO code: %w", err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, config.OIDCClientID, request.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(claims.String("email")))
+	if email == "" {
+		return nil, fmt.Errorf("identity provider returned no email")
+	}
+	if verified, ok := claims.Bool("email_verified"); ok && !verified {
+		return nil, ErrSSOEmailUnverified
+	}
+	var allowed bool
+	query = `
+		SELECT EXISTS (SELECT 1 FROM client_sso_domains
+			WHERE client_id = $1 AND domain = $2 AND verified_at IS NOT NULL)`
+	if err := s.db.GetContext(ctx, &allowed, query, config.ClientID, emailDomain(email)); err != nil {
+		return nil, fmt.Errorf("failed to check SSO domain: %w", err)
+	}
+	if !allowed {
+		return nil, ErrSSODomainNotAllowed
+	}
+
+	user, err := s.identityUser(ctx, config, provider.Issuer, claims, email)
+	if err != nil {
+		return nil, err
+	}
+
+	// With a role claim, the provider manages roles at every sign-in
+	role := mapSSORole(config, claims)
+	if config.RoleClaim != nil && user.Role != role && user.Role != "super_admin" {
+		if err := s.userSvc.UpdateUserRole(ctx, user.ID, role); err != nil {
+			return nil, err
+		}
+		user.Role = role
+	}
+
+	return user, nil
+}
+
+// identityUser returns the user signed in as a provider's subject, linking
+// the client's user with the same email or creating one on their first
+// sign-in. Linking takes over an existing account, so it requires the
+// provider to assert email_verified.
+func (s *ssoService) identityUser(ctx context.Context, config *models.SSOConfig, issuer string, claims oidc.Claims, email string) (*models.User, error) {
+	subject := claims.String("sub")
+
+	var userID int
+	query := `
+		UPDATE user_identities SET email = $4, last_login_at = CURRENT_TIMESTAMP
+		WHERE client_id = $1 AND issuer = $2 AND subject = $3
+		RETURNING user_id`
+	err := s.db.GetContext(ctx, &userID, query, config.ClientID, issuer, subject, email)
+	if err == nil {
+		return s.userSvc.GetUserByID(ctx, userID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+
+	user := &models.User{}
+	query = `SELECT * FROM users WHERE client_id = $1 AND LOWER(email) = $2`
+	err = s.db.GetContext(ctx, user, query, config.ClientID, email)
+	if err == nil {
+		if verified, _ := claims.Bool("email_verified"); !verified {
+			return nil, ErrSSOEmailUnverified
+		}
+	} else if errors.Is(err, sql.ErrNoRows) {
+		user, err = s.createUser(ctx, config, claims, email)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSO user: %w", err)
+	}
+
+	query = `
+		INSERT INTO user_identities (client_id, issuer, subject, user_id, email)
+		VALUES ($1, $2, $3, $4, $5)`
+	if _, err := s.db.ExecContext(ctx, query, config.ClientID, issuer, subject, user.ID, email); err != nil {
+		return nil, fmt.Errorf("failed to link user identity: %w", err)
+	}
+
+	log.Printf("Linked user %d of client %d to SSO subject %s", user.ID, config.ClientID, subject)
+	return user, nil
+}
+
+// createUser provisions a user from their ID token. Their random password
+// is never told to them; they sign in through the provider.
+func (s *ssoService) createUser(ctx context.Context, config *models.SSOConfig, claims oidc.Claims, email string) (*models.User, error) {
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	firstName, lastName := claims.String("given_name"), claims.String("family_name")
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(strings.TrimSpace(claims.String("name")), " ")
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(email, "@")
+	}
+
+	user := &models.User{
+		ClientID:  config.ClientID,
+		Email:     email,
+		Password:  password,
+		FirstName: truncate(firstName, maxNameLength),
+		LastName:  truncate(lastName, maxNameLength),
+		Role:      mapSSORole(config, claims),
+		Status:    "active",
+	}
+	if err := s.userSvc.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// mapSSORole returns the highest role the values of the role claim map to,
+// or the default role
+func mapSSORole(config *models.SSOConfig, claims oidc.Claims) string {
+	if config.RoleClaim == nil {
+		return config.DefaultRole
+	}
+
+	role := ""
+	for _, value := range claims.Strings(*config.RoleClaim) {
+		switch config.RoleMapping[value] {
+		case "admin":
+			return "admin"
+		case "user":
+			role = "user"
+		}
+	}
+	if role == "" {
+		return config.DefaultRole
+	}
+	return role
+}
+
+// validateConfig normalizes a configuration and checks its provider can be
+// discovered
+func (s *ssoService) validateConfig(ctx context.Context, config *models.SSOConfig) error {
+	config.Issuer = strings.TrimSpace(config.Issuer)
+	config.OIDCClientID = strings.TrimSpace(config.OIDCClientID)
+	if config.Issuer == "" || config.OIDCClientID == "" {
+		return fmt.Errorf("%w: issuer and oidc_client_id are required", ErrInvalidSSOConfig)
+	}
+
+	domains := pq.StringArray{}
+	for _, domain := range config.AllowedDomains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@ /") {
+			return fmt.Errorf("%w: invalid domain %q", ErrInvalidSSOConfig, domain)
+		}
+		if !slices.Contains(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) == 0 {
+		return fmt.Errorf("%w: at least one allowed domain is required", ErrInvalidSSOConfig)
+	}
+	config.AllowedDomains = domains
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = defaultSSOScopes
+	}
+	if !slices.Contains(config.Scopes, "openid") {
+		return fmt.Errorf("%w: scopes must include openid", ErrInvalidSSOConfig)
+	}
+
+	if config.RoleClaim != nil {
+		if claim := strings.TrimSpace(*config.RoleClaim); claim != "" {
+			config.RoleClaim = &claim
+		} else {
+			config.RoleClaim = nil
+		}
+	}
+	if config.RoleMapping == nil {
+		config.RoleMapping = models.JSONB{}
+	}
+	for value, role := range config.RoleMapping {
+		if role != "user" && role != "admin" {
+			return fmt.Errorf("%w: %q must map to user or admin", ErrInvalidSSOConfig, value)
+		}
+	}
+	if config.DefaultRole == "" {
+		config.DefaultRole = "user"
+	}
+	if config.DefaultRole != "user" && config.DefaultRole != "admin" {
+		return fmt.Errorf("%w: default_role must be user or admin", ErrInvalidSSOConfig)
+	}
+
+	// A domain signs in to the one client that verified it
+	var taken string
+	query := `
+		SELECT domain FROM client_sso_domains
+		WHERE client_id <> $1 AND verified_at IS NOT NULL AND domain = ANY($2)
+		LIMIT 1`
+	err := s.db.GetContext(ctx, &taken, query, config.ClientID, config.AllowedDomains)
+	if err == nil {
+		return fmt.Errorf("%w: domain %s is verified by another client", ErrInvalidSSOConfig, taken)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to check SSO domains: %w", err)
+	}
+
+	if _, err := s.provider(ctx, config.Issuer, true); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSSOConfig, err)
+	}
+	return nil
+}
+
+// loadConfig returns a client's provider configuration with its secret
+func (s *ssoService) loadConfig(ctx context.Context, clientID int) (*models.SSOConfig, error) {
+	config := &models.SSOConfig{}
+	query := `SELECT * FROM client_sso_configs WHERE client_id = $1`
+	if err := s.db.GetContext(ctx, config, query, clientID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSSONotConfigured
+		}
+		return nil, fmt.Errorf("failed to get SSO config: %w", err)
+	}
+	config.HasClientSecret = config.OIDCClientSecret != nil
+	return config, nil
+}
+
+// configForDomain returns the enabled configuration of the client that
+// verified a domain
+func (s *ssoService) configForDomain(ctx context.Context, domain string) (*models.SSOConfig, error) {
+	if domain == "" {
+		return nil, ErrSSONotConfigured
+	}
+
+	config := &models.SSOConfig{}
+	query := `
+		SELECT c.* FROM client_sso_configs c
+		JOIN client_sso_domains d ON d.client_id = c.client_id
+		WHERE c.enabled AND d.domain = $1 AND d.verified_at IS NOT NULL`
+	if err := s.db.GetContext(ctx, config, query, domain); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSSONotConfigured
+		}
+		return nil, fmt.Errorf("failed to get SSO config: %w", err)
+	}
+	return config, nil
+}
+
+// loadDomains returns a client's domains with the records that verify them
+func (s *ssoService) loadDomains(ctx context.Context, db sqlx.QueryerContext, clientID int) ([]*models.SSODomain, error) {
+	domains := []*models.SSODomain{}
+	query := `SELECT * FROM client_sso_domains WHERE client_id = $1 ORDER BY domain`
+	if err := sqlx.SelectContext(ctx, db, &domains, query, clientID); err != nil {
+		return nil, fmt.Errorf("failed to get SSO domains: %w", err)
+	}
+	for _, domain := range domains {
+		setVerificationRecord(domain)
+	}
+	return domains, nil
+}
+
+// setVerificationRecord fills in the TXT record that verifies a domain
+func setVerificationRecord(domain *models.SSODomain) {
+	domain.VerificationName = ssoDomainRecordPrefix + domain.Domain
+	domain.VerificationValue = ssoDomainRecordValue + domain.VerificationToken
+}
+
+// provider returns an issuer's provider, discovering it when it is not
+// cached, its document is old, or refresh is set
+func (s *ssoService) provider(ctx context.Context, issuer string, refresh bool) (*oidc.Provider, error) {
+	s.providersMutex.Lock()
+	cached, ok := s.providers[issuer]
+	s.providersMutex.Unlock()
+	if ok && !refresh && time.Since(cached.discoveredAt) < ssoDiscoveryMaxAge {
+		return cached.provider, nil
+	}
+
+	provider, err := oidc.Discover(ctx, s.httpClient, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	s.providersMutex.Lock()
+	s.providers[issuer] = &discoveredProvider{provider: provider, discoveredAt: time.Now()}
+	s.providersMutex.Unlock()
+	return provider, nil
+}
+
+// pruneAuthRequests deletes sign-ins that were never completed
+func (s *ssoService) pruneAuthRequests(ctx context.Context) {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM oidc_auth_requests WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		log.Printf("Failed to prune SSO requests: %v", err)
+	}
+}
+
+// emailDomain returns the lowercased domain of an email address
+func emailDomain(email string) string {
+	_, domain, found := strings.Cut(strings.TrimSpace(email), "@")
+	if !found {
+		return ""
+	}
+	return strings.ToLower(domain)
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
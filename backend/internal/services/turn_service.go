@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"video-conference-backend/internal/config"
+	"video-conference-backend/internal/database"
+	"video-conference-backend/internal/models"
+)
+
+// TURNService hands out ICE server lists with short-lived TURN credentials,
+// in the TURN REST API scheme coturn implements as use-auth-secret. The
+// username is "<expiry>:<meetingId>:<participantId>" and the password the
+// HMAC-SHA1 of the username under a secret shared with the TURN server, so
+// the secret itself never leaves this server.
+type TURNService interface {
+	ICEConfig(ctx context.Context, meetingID, participantID string) (*models.ICEConfig, error)
+}
+
+type turnService struct {
+	db  *database.DB
+	cfg *config.WebRTCConfig
+}
+
+// NewTURNService creates a new TURN credential service
+func NewTURNService(db *database.DB, cfg *config.WebRTCConfig) TURNService {
+	return &turnService{db: db, cfg: cfg}
+}
+
+// ICEConfig returns the STUN servers and, when a shared secret is
+// configured, a TURN server with credentials for one participant of a
+// meeting. The static TURN credentials are never handed out.
+func (s *turnService) ICEConfig(ctx context.Context, meetingID, participantID string) (*models.ICEConfig, error) {
+	ice := &models.ICEConfig{ICEServers: []models.ICEServer{}}
+	for _, url := range s.cfg.STUNServers {
+		if url != "" {
+			ice.ICEServers = append(ice.ICEServers, models.ICEServer{URLs: []string{url}})
+		}
+	}
+	if s.cfg.TURNServerURL == "" {
+		return ice, nil
+	}
+
+	secret, err := s.currentSecret(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return ice, nil
+	}
+
+	expiresAt := time.Now().Add(s.cfg.TURNCredentialTTL).UTC().Truncate(time.Second)
+	username := fmt.Sprintf("%d:%s:%s", expiresAt.Unix(), meetingID, participantID)
+	ice.ICEServers = append(ice.ICEServers, models.ICEServer{
+		URLs:       []string{s.cfg.TURNServerURL},
+		Username:   username,
+		Credential: turnCredential(secret, username),
+	})
+	ice.TTL = int(s.cfg.TURNCredentialTTL.Seconds())
+	ice.ExpiresAt = &expiresAt
+	return ice, nil
+}
+
+// turnCredential signs a TURN REST API username with the shared secret
+func turnCredential(secret, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// currentSecret returns the secret to sign with. With rotation on it is the
+// newest secret in turn_secret, replaced once it is older than the rotation
+// interval.
+func (s *turnService) currentSecret(ctx context.Context) (string, error) {
+	if s.cfg.TURNSecretRotation <= 0 {
+		return s.cfg.TURNSecret, nil
+	}
+
+	secret, err := s.activeSecret(ctx, s.db)
+	if err == nil {
+		return secret, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return s.rotateSecret(ctx)
+}
+
+// activeSecret loads the realm's current secret if it is not yet due for
+// rotation
+func (s *turnService) activeSecret(ctx context.Context, q sqlx.QueryerContext) (string, error) {
+	var secret string
+	err := sqlx.GetContext(ctx, q, &secret, `
+		SELECT value FROM turn_secret
+		WHERE realm = $1 AND retired_at IS NULL AND created_at > NOW() - $2 * INTERVAL '1 second'
+		ORDER BY created_at DESC
+		LIMIT 1`, s.cfg.TURNRealm, int(s.cfg.TURNSecretRotation.Seconds()))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to get TURN secret: %w", err)
+	}
+	return secret, err
+}
+
+// rotateSecret replaces the realm's current secret with a new one. Retired
+// secrets stay in the table, and so valid on the TURN server, until every
+// credential they signed has expired.
+func (s *turnService) rotateSecret(ctx context.Context) (string, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Replicas rotating at once queue here and the later ones use the
+	// secret the first created
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE turn_secret IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return "", fmt.Errorf("failed to lock TURN secrets: %w", err)
+	}
+	secret, err := s.activeSecret(ctx, tx)
+	if err == nil {
+		return secret, tx.Commit()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate TURN secret: %w", err)
+	}
+	secret = hex.EncodeToString(key)
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE turn_secret SET retired_at = NOW()
+		WHERE realm = $1 AND retired_at IS NULL`, s.cfg.TURNRealm); err != nil {
+		return "", fmt.Errorf("failed to retire TURN secret: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO turn_secret (realm, value) VALUES ($1, $2)`, s.cfg.TURNRealm, secret); err != nil {
+		return "", fmt.Errorf("failed to store TURN secret: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM turn_secret
+		WHERE realm = $1 AND retired_at < NOW() - $2 * INTERVAL '1 second'`,
+		s.cfg.TURNRealm, int(s.cfg.TURNCredentialTTL.Seconds())); err != nil {
+		return "", fmt.Errorf("failed to delete expired TURN secrets: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return secret, nil
+}
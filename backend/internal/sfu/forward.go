@@ -0,0 +1,294 @@
+package sfu
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// keyframeRequestInterval throttles the keyframe requests sent to a
+// publisher for one layer, however many subscribers are waiting on it
+const keyframeRequestInterval = 500 * time.Millisecond
+
+// switchTimestampGap is added to a track's timestamps when it moves to
+// another layer, so the subscriber sees a fresh frame rather than a jump back
+const switchTimestampGap = 3000
+
+// layerPreference orders simulcast layers by RID, best first. A track sent
+// without simulcast has the single layer "".
+var layerPreference = []string{"f", "h", "q", ""}
+
+// publishedTrack is a participant's audio or video track, received as one
+// or more simulcast layers and forwarded to every other participant
+type publishedTrack struct {
+	id        string // "<publisher>:<trackId>"
+	streamID  string // "<publisher>:<streamId>"
+	publisher *peer
+	codec     webrtc.RTPCodecCapability
+	video     bool
+	screen    bool // video from the publisher's announced screen share
+
+	mutex       sync.Mutex
+	layers      map[string]webrtc.SSRC // by RID
+	requested   map[string]time.Time   // last keyframe request by RID
+	subscribers map[string]*downTrack  // by subscriber ID
+	preferences map[string]string      // requested layer by subscriber ID
+}
+
+func newPublishedTrack(publisher *peer, track *webrtc.TrackRemote) *publishedTrack {
+	return &publishedTrack{
+		id:          publisher.id + ":" + track.ID(),
+		streamID:    publisher.id + ":" + track.StreamID(),
+		publisher:   publisher,
+		codec:       track.Codec().RTPCodecCapability,
+		video:       track.Kind() == webrtc.RTPCodecTypeVideo,
+		layers:      make(map[string]webrtc.SSRC),
+		requested:   make(map[string]time.Time),
+		subscribers: make(map[string]*downTrack),
+		preferences: make(map[string]string),
+	}
+}
+
+// bestLayer picks the layer to forward to a subscriber that asked for the
+// given one: that layer if it is being received, otherwise the best there is.
+// t.mutex must be held.
+func (t *publishedTrack) bestLayer(preferred string) string {
+	if _, ok := t.layers[preferred]; ok {
+		return preferred
+	}
+	for _, rid := range layerPreference {
+		if _, ok := t.layers[rid]; ok {
+			return rid
+		}
+	}
+
+	rids := make([]string, 0, len(t.layers))
+	for rid := range t.layers {
+		rids = append(rids, rid)
+	}
+	sort.Strings(rids)
+	if len(rids) == 0 {
+		return ""
+	}
+	return rids[0]
+}
+
+// addLayer starts receiving a layer, moving subscribers onto it if it is
+// the one they want
+func (t *publishedTrack) addLayer(track *webrtc.TrackRemote) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.layers[track.RID()] = track.SSRC()
+	for id, d := range t.subscribers {
+		d.setTarget(t.bestLayer(t.preferences[id]))
+	}
+}
+
+// removeLayer stops receiving a layer, moving its subscribers to another,
+// and returns how many layers are left
+func (t *publishedTrack) removeLayer(rid string) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.layers, rid)
+	for id, d := range t.subscribers {
+		d.setTarget(t.bestLayer(t.preferences[id]))
+	}
+	return len(t.layers)
+}
+
+func (t *publishedTrack) addSubscriber(subscriberID string, d *downTrack) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.subscribers[subscriberID] = d
+	d.setTarget(t.bestLayer(t.preferences[subscriberID]))
+}
+
+func (t *publishedTrack) removeSubscriber(subscriberID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.subscribers, subscriberID)
+	delete(t.preferences, subscriberID)
+}
+
+// takeSubscribers detaches every subscriber, for a track that has ended
+func (t *publishedTrack) takeSubscribers() map[string]*downTrack {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	subscribers := t.subscribers
+	t.subscribers = make(map[string]*downTrack)
+	return subscribers
+}
+
+// selectLayer records the layer a subscriber asked for. The switch happens
+// at that layer's next keyframe, which the forwarding loop asks for.
+func (t *publishedTrack) selectLayer(subscriberID, rid string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	d, ok := t.subscribers[subscriberID]
+	if !ok {
+		return
+	}
+	t.preferences[subscriberID] = rid
+	d.setTarget(t.bestLayer(rid))
+}
+
+// downTracks returns a snapshot of the subscribers' tracks
+func (t *publishedTrack) downTracks() []*downTrack {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tracks := make([]*downTrack, 0, len(t.subscribers))
+	for _, d := range t.subscribers {
+		tracks = append(tracks, d)
+	}
+	return tracks
+}
+
+// requestKeyframe asks the publisher for a keyframe of a layer, at most once
+// per keyframeRequestInterval
+func (t *publishedTrack) requestKeyframe(rid string) {
+	if !t.video {
+		return
+	}
+
+	t.mutex.Lock()
+	ssrc, ok := t.layers[rid]
+	if !ok || time.Since(t.requested[rid]) < keyframeRequestInterval {
+		t.mutex.Unlock()
+		return
+	}
+	t.requested[rid] = time.Now()
+	t.mutex.Unlock()
+
+	// Fails only once the publisher has gone, which ends the track anyway
+	_ = t.publisher.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(ssrc)}})
+}
+
+// downTrack is a published track as sent to one subscriber. It forwards a
+// single layer at a time, rewriting sequence numbers and timestamps so the
+// subscriber sees one continuous stream across layer switches.
+type downTrack struct {
+	track  *webrtc.TrackLocalStaticRTP
+	sender *webrtc.RTPSender
+	video  bool
+
+	mutex     sync.Mutex
+	layer     string // the layer being forwarded
+	target    string // the layer to switch to at its next keyframe
+	started   bool
+	seqOffset uint16
+	tsOffset  uint32
+	lastSeq   uint16
+	lastTS    uint32
+}
+
+// setTarget picks the layer to forward from now on
+func (d *downTrack) setTarget(rid string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.target = rid
+}
+
+// current returns the layer the subscriber is being sent, or is waiting for
+func (d *downTrack) current() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.started {
+		return d.layer
+	}
+	return d.target
+}
+
+// write forwards a packet of the given layer, reporting whether the track is
+// waiting for a keyframe of that layer before it can switch to it
+func (d *downTrack) write(rid string, packet *rtp.Packet, keyframe bool) bool {
+	d.mutex.Lock()
+	if !d.started || rid != d.layer {
+		if rid != d.target {
+			d.mutex.Unlock()
+			return false
+		}
+		// Video can only be joined at a keyframe
+		if d.video && !keyframe {
+			d.mutex.Unlock()
+			return true
+		}
+		if d.started {
+			d.seqOffset = d.lastSeq + 1 - packet.SequenceNumber
+			d.tsOffset = d.lastTS + switchTimestampGap - packet.Timestamp
+		}
+		d.started = true
+		d.layer = rid
+	}
+
+	out := rtp.Packet{Header: packet.Header, Payload: packet.Payload}
+	out.SequenceNumber = packet.SequenceNumber + d.seqOffset
+	out.Timestamp = packet.Timestamp + d.tsOffset
+	// Header extension IDs were negotiated with the publisher, not the subscriber
+	out.Extension = false
+	out.ExtensionProfile = 0
+	out.Extensions = nil
+	d.lastSeq = out.SequenceNumber
+	d.lastTS = out.Timestamp
+	d.mutex.Unlock()
+
+	// Errors only mean the subscriber is going away
+	_ = d.track.WriteRTP(&out)
+	return false
+}
+
+// isVP8Keyframe reports whether an RTP payload starts a VP8 keyframe
+// (RFC 7741 section 4.2 for the descriptor, RFC 6386 section 9.1 for the
+// frame tag)
+func isVP8Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	descriptor := payload[0]
+	// Only the first packet of a partition carries the frame header
+	if descriptor&0x10 == 0 || descriptor&0x07 != 0 {
+		return false
+	}
+
+	i := 1
+	if descriptor&0x80 != 0 {
+		if len(payload) <= i {
+			return false
+		}
+		extension := payload[i]
+		i++
+		if extension&0x80 != 0 { // PictureID
+			if len(payload) <= i {
+				return false
+			}
+			if payload[i]&0x80 != 0 {
+				i += 2
+			} else {
+				i++
+			}
+		}
+		if extension&0x40 != 0 { // TL0PICIDX
+			i++
+		}
+		if extension&0x30 != 0 { // TID/KEYIDX
+			i++
+		}
+	}
+
+	if len(payload) <= i {
+		return false
+	}
+	// The P bit of the frame tag is clear on keyframes
+	return payload[i]&0x01 == 0
+}
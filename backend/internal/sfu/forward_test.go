@@ -0,0 +1,78 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestIsVP8Keyframe(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{"keyframe", []byte{0x10, 0x00, 0x00, 0x9d}, true},
+		{"interframe", []byte{0x10, 0x01, 0x00}, false},
+		{"continuation packet", []byte{0x00, 0x00, 0x00}, false},
+		{"second partition", []byte{0x11, 0x00, 0x00}, false},
+		{"short picture ID", []byte{0x90, 0x80, 0x05, 0x00}, true},
+		{"long picture ID", []byte{0x90, 0x80, 0x85, 0x05, 0x00}, true},
+		{"all extensions", []byte{0x90, 0xf0, 0x85, 0x05, 0x01, 0x02, 0x01}, false},
+		{"truncated", []byte{0x90, 0x80}, false},
+		{"empty", nil, false},
+	}
+	for _, tt := range tests {
+		if got := isVP8Keyframe(tt.payload); got != tt.want {
+			t.Errorf("%s: isVP8Keyframe(%x) = %v, want %v", tt.name, tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestBestLayer(t *testing.T) {
+	track := &publishedTrack{layers: map[string]webrtc.SSRC{"q": 1, "h": 2}}
+
+	if got := track.bestLayer("q"); got != "q" {
+		t.Errorf("bestLayer(q) = %q, want the requested layer", got)
+	}
+	if got := track.bestLayer("f"); got != "h" {
+		t.Errorf("bestLayer(f) = %q, want the best layer received", got)
+	}
+}
+
+func TestDownTrackSwitchesLayersAtKeyframes(t *testing.T) {
+	local, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &downTrack{track: local, video: true, target: "h"}
+	packet := func(seq uint16, timestamp uint32) *rtp.Packet {
+		return &rtp.Packet{Header: rtp.Header{SequenceNumber: seq, Timestamp: timestamp}}
+	}
+
+	if waiting := d.write("h", packet(100, 1000), false); !waiting {
+		t.Fatal("joined a layer without a keyframe")
+	}
+	d.write("h", packet(101, 4000), true)
+	d.write("h", packet(102, 7000), false)
+	if d.current() != "h" || d.lastSeq != 102 {
+		t.Fatalf("forwarding %q up to %d, want h up to 102", d.current(), d.lastSeq)
+	}
+
+	d.setTarget("q")
+	if waiting := d.write("q", packet(500, 90000), false); !waiting {
+		t.Fatal("switched layers without a keyframe")
+	}
+	d.write("h", packet(103, 10000), false)
+	d.write("q", packet(501, 93000), true)
+
+	// The subscriber sees one stream, moved on by switchTimestampGap
+	if d.current() != "q" || d.lastSeq != 104 || d.lastTS != 10000+switchTimestampGap {
+		t.Fatalf("after switching got layer %q, seq %d, timestamp %d", d.current(), d.lastSeq, d.lastTS)
+	}
+	d.write("h", packet(104, 13000), true)
+	if d.lastSeq != 104 {
+		t.Fatal("forwarded the layer it switched away from")
+	}
+}
@@ -0,0 +1,191 @@
+package sfu
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v4"
+	"video-conference-backend/internal/config"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/signaling"
+)
+
+// idleTimeout is how long a router waits for a participant to connect, or
+// reconnect, before it leaves its room
+const idleTimeout = 30 * time.Second
+
+// Manager runs the routers of the rooms in SFU mode on this server. Each
+// router joins its room as a hidden peer, the way a recorder does.
+type Manager struct {
+	hub *signaling.Hub
+	api *webrtc.API
+	ice webrtc.Configuration
+
+	mutex    sync.Mutex
+	sessions map[string]*session // by room ID
+}
+
+// session is a router attached to its room
+type session struct {
+	router *Router
+	peer   *signaling.Peer
+}
+
+// NewManager creates an SFU manager attached to the signaling hub
+func NewManager(cfg *config.Config, hub *signaling.Hub) (*Manager, error) {
+	api, err := NewAPI(uint16(cfg.SFU.PortMin), uint16(cfg.SFU.PortMax), cfg.SFU.PublicIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clients reach the router on its public addresses, so STUN is enough
+	var servers []webrtc.ICEServer
+	for _, url := range cfg.WebRTC.STUNServers {
+		if url != "" {
+			servers = append(servers, webrtc.ICEServer{URLs: []string{url}})
+		}
+	}
+
+	return &Manager{
+		hub:      hub,
+		api:      api,
+		ice:      webrtc.Configuration{ICEServers: servers},
+		sessions: make(map[string]*session),
+	}, nil
+}
+
+// NewAPI creates the WebRTC API routers run on. Only Opus audio and VP8
+// video are negotiated: switching simulcast layers needs the router to spot
+// keyframes, which it does for VP8. portMin and portMax bound the UDP ports
+// used when both are set, and publicIPs are advertised in place of the
+// host's own addresses when the server sits behind NAT.
+func NewAPI(portMin, portMax uint16, publicIPs []string) (*webrtc.API, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	err := mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2},
+		PayloadType:        111,
+	}, webrtc.RTPCodecTypeAudio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register opus: %w", err)
+	}
+	err = mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		PayloadType:        96,
+	}, webrtc.RTPCodecTypeVideo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register vp8: %w", err)
+	}
+
+	// NACK, RTCP reports and the simulcast header extensions
+	registry := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, registry); err != nil {
+		return nil, fmt.Errorf("failed to register interceptors: %w", err)
+	}
+
+	settings := webrtc.SettingEngine{}
+	if portMin > 0 && portMax >= portMin {
+		if err := settings.SetEphemeralUDPPortRange(portMin, portMax); err != nil {
+			return nil, fmt.Errorf("invalid UDP port range: %w", err)
+		}
+	}
+	var ips []string
+	for _, ip := range publicIPs {
+		if ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) > 0 {
+		settings.SetNAT1To1IPs(ips, webrtc.ICECandidateTypeHost)
+	}
+
+	return webrtc.NewAPI(
+		webrtc.WithMediaEngine(mediaEngine),
+		webrtc.WithInterceptorRegistry(registry),
+		webrtc.WithSettingEngine(settings),
+	), nil
+}
+
+// Attach starts a router for a room and joins it as peerID. It does nothing
+// if the room already has one on this server. onClose runs once the router
+// has left the room, whether it went idle or the room closed.
+func (m *Manager) Attach(roomID string, meeting *models.Meeting, peerID string, onClose func()) error {
+	m.mutex.Lock()
+	if _, ok := m.sessions[roomID]; ok {
+		m.mutex.Unlock()
+		return nil
+	}
+	s := &session{}
+	m.sessions[roomID] = s
+	m.mutex.Unlock()
+
+	s.router = NewRouter(m.api, m.ice, idleTimeout, func() {
+		log.Printf("SFU for room %s is idle", roomID)
+		m.detach(roomID, s)
+	})
+
+	identity := &signaling.Identity{
+		UserID:    peerID,
+		UserName:  "Media server",
+		ClientID:  meeting.ClientID,
+		MeetingID: meeting.ID,
+	}
+
+	peer, err := m.hub.AttachPeer(roomID, identity, s.router.HandleMessage, func() {
+		m.mutex.Lock()
+		if m.sessions[roomID] == s {
+			delete(m.sessions, roomID)
+		}
+		m.mutex.Unlock()
+
+		s.router.Close()
+		log.Printf("SFU for room %s stopped", roomID)
+		if onClose != nil {
+			onClose()
+		}
+	})
+	if err != nil {
+		m.mutex.Lock()
+		delete(m.sessions, roomID)
+		m.mutex.Unlock()
+		s.router.Close()
+		return fmt.Errorf("failed to join meeting room: %w", err)
+	}
+
+	m.mutex.Lock()
+	s.peer = peer
+	m.mutex.Unlock()
+	s.router.Start(peer)
+
+	log.Printf("SFU for room %s started as %s", roomID, peerID)
+	return nil
+}
+
+// detach takes a router out of its room
+func (m *Manager) detach(roomID string, s *session) {
+	m.mutex.Lock()
+	peer := s.peer
+	m.mutex.Unlock()
+
+	if peer != nil {
+		peer.Close()
+	}
+}
+
+// Shutdown takes every router out of its room
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mutex.Lock()
+	sessions := make(map[string]*session, len(m.sessions))
+	for roomID, s := range m.sessions {
+		sessions[roomID] = s
+	}
+	m.mutex.Unlock()
+
+	for roomID, s := range sessions {
+		m.detach(roomID, s)
+	}
+	return ctx.Err()
+}
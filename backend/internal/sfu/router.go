@@ -0,0 +1,667 @@
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+	"video-conference-backend/internal/signaling"
+)
+
+// Signaler carries the router's signaling messages into its room
+type Signaler interface {
+	Send(msg signaling.Message)
+}
+
+// Router forwards the media of one room. Every participant holds a single
+// connection to it: the tracks a participant publishes arrive on that
+// connection and the other participants' tracks are added to it as they
+// come and go, with the router renegotiating each time.
+type Router struct {
+	api         *webrtc.API
+	config      webrtc.Configuration
+	idleTimeout time.Duration
+	onIdle      func()
+
+	signaler Signaler
+	started  chan struct{}
+
+	mutex   sync.Mutex
+	peers   map[string]*peer
+	tracks  map[string]*publishedTrack // by forwarded track ID
+	screens map[string]string          // shared stream ID by participant, as the hub announced
+	idle    *time.Timer
+	closed  bool
+}
+
+// peer is a participant's connection to the router
+type peer struct {
+	id     string
+	pc     *webrtc.PeerConnection
+	router *Router
+
+	// mutex serializes negotiation on the connection
+	camera string // stream carrying the participant's camera video
+
+	mutex      sync.Mutex
+	offering   bool // the router's offer awaits an answer
+	pending    bool // tracks changed since the last offer
+	candidates []webrtc.ICECandidateInit
+}
+
+// NewRouter creates a router for one room. onIdle runs once the room has
+// had no connected participants for idleTimeout.
+func NewRouter(api *webrtc.API, config webrtc.Configuration, idleTimeout time.Duration, onIdle func()) *Router {
+	r := &Router{
+		api:         api,
+		config:      config,
+		idleTimeout: idleTimeout,
+		onIdle:      onIdle,
+		started:     make(chan struct{}),
+		peers:       make(map[string]*peer),
+		tracks:      make(map[string]*publishedTrack),
+		screens:     make(map[string]string),
+	}
+	r.startIdle()
+	return r
+}
+
+// Start lets the router talk to the room. Messages handled before Start
+// wait for it.
+func (r *Router) Start(signaler Signaler) {
+	r.signaler = signaler
+	close(r.started)
+}
+
+// HandleMessage reacts to a signaling message delivered to the router
+func (r *Router) HandleMessage(msg signaling.Message) {
+	<-r.started
+
+	switch msg.Type {
+	case signaling.TypeUserLeft:
+		var payload signaling.UserLeftPayload
+		if err := msg.DecodePayload(&payload); err != nil {
+			return
+		}
+		r.removePeer(payload.UserID)
+
+	case signaling.TypeScreenShares:
+		var payload signaling.ScreenSharesPayload
+		if err := msg.DecodePayload(&payload); err != nil {
+			return
+		}
+		for _, share := range payload.Shares {
+			r.startScreenShare(share.UserID, share.StreamID)
+		}
+
+	case signaling.TypeScreenShareStarted:
+		var payload signaling.ScreenSharePayload
+		if err := msg.DecodePayload(&payload); err != nil {
+			return
+		}
+		r.startScreenShare(payload.UserID, payload.StreamID)
+
+	case signaling.TypeScreenShareStopped:
+		var payload signaling.ScreenShareStoppedPayload
+		if err := msg.DecodePayload(&payload); err != nil {
+			return
+		}
+		r.stopScreenShare(payload.UserID)
+
+	case signaling.TypeOffer, signaling.TypeAnswer, signaling.TypeICECandidate:
+		var payload signaling.RelayedSignalPayload
+		if err := msg.DecodePayload(&payload); err != nil {
+			return
+		}
+		if err := r.handleSignal(msg.Type, payload); err != nil {
+			log.Printf("SFU failed to handle %s from %s: %v", msg.Type, payload.SenderID, err)
+		}
+
+	case signaling.TypeSelectLayer:
+		var payload signaling.RelayedLayerPayload
+		if err := msg.DecodePayload(&payload); err != nil {
+			return
+		}
+		r.mutex.Lock()
+		t, ok := r.tracks[payload.TrackID]
+		r.mutex.Unlock()
+		if ok {
+			t.selectLayer(payload.SenderID, payload.Layer)
+		}
+	}
+}
+
+// handleSignal answers a participant's offer, connecting it on the first
+// one, and applies its answers and ICE candidates
+func (r *Router) handleSignal(msgType string, payload signaling.RelayedSignalPayload) error {
+	switch msgType {
+	case signaling.TypeOffer:
+		var offer webrtc.SessionDescription
+		if err := json.Unmarshal(payload.SDP, &offer); err != nil {
+			return fmt.Errorf("invalid offer: %w", err)
+		}
+
+		p, created, err := r.peer(payload.SenderID)
+		if err != nil {
+			return err
+		}
+		if err := p.acceptOffer(offer); err != nil {
+			return err
+		}
+		// A new participant receives everything already being forwarded
+		if created {
+			r.subscribeAll(p)
+		}
+		return nil
+
+	case signaling.TypeAnswer:
+		var answer webrtc.SessionDescription
+		if err := json.Unmarshal(payload.SDP, &answer); err != nil {
+			return fmt.Errorf("invalid answer: %w", err)
+		}
+
+		p, ok := r.existingPeer(payload.SenderID)
+		if !ok {
+			return fmt.Errorf("no connection to %s", payload.SenderID)
+		}
+		return p.acceptAnswer(answer)
+
+	case signaling.TypeICECandidate:
+		var candidate webrtc.ICECandidateInit
+		if err := json.Unmarshal(payload.Candidate, &candidate); err != nil {
+			return fmt.Errorf("invalid candidate: %w", err)
+		}
+
+		p, ok := r.existingPeer(payload.SenderID)
+		if !ok {
+			return nil
+		}
+		return p.addCandidate(candidate)
+	}
+	return nil
+}
+
+// peer returns the connection to a participant, creating it if needed and
+// reporting whether it was created
+func (r *Router) peer(participantID string) (*peer, bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return nil, false, errors.New("router is closed")
+	}
+	if p, ok := r.peers[participantID]; ok {
+		return p, false, nil
+	}
+
+	pc, err := r.api.NewPeerConnection(r.config)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create peer connection: %w", err)
+	}
+	p := &peer{id: participantID, pc: pc, router: r}
+
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		init := candidate.ToJSON()
+		if err := r.send(signaling.TypeICECandidate, participantID, nil, &init); err != nil {
+			log.Printf("SFU failed to send ICE candidate to %s: %v", participantID, err)
+		}
+	})
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		r.publish(p, track)
+	})
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed {
+			log.Printf("SFU connection to %s failed", participantID)
+			r.removePeer(participantID)
+		}
+	})
+
+	r.peers[participantID] = p
+	if r.idle != nil {
+		r.idle.Stop()
+	}
+	return p, true, nil
+}
+
+func (r *Router) existingPeer(participantID string) (*peer, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	p, ok := r.peers[participantID]
+	return p, ok
+}
+
+// removePeer disconnects a participant, unsubscribing it from every track
+// and ending the tracks it published
+func (r *Router) removePeer(participantID string) {
+	r.mutex.Lock()
+	p, ok := r.peers[participantID]
+	if !ok {
+		r.mutex.Unlock()
+		return
+	}
+	delete(r.peers, participantID)
+	delete(r.screens, participantID)
+
+	var published []*publishedTrack
+	for _, t := range r.tracks {
+		if t.publisher == p {
+			published = append(published, t)
+		} else {
+			t.removeSubscriber(participantID)
+		}
+	}
+	if len(r.peers) == 0 {
+		r.startIdle()
+	}
+	r.mutex.Unlock()
+
+	p.pc.Close()
+	for _, t := range published {
+		r.unpublish(t)
+	}
+}
+
+// startIdle arms the idle timer. r.mutex must be held, or the router not
+// yet shared.
+func (r *Router) startIdle() {
+	if r.idleTimeout <= 0 || r.onIdle == nil || r.closed {
+		return
+	}
+	if r.idle != nil {
+		r.idle.Stop()
+	}
+	r.idle = time.AfterFunc(r.idleTimeout, func() {
+		r.mutex.Lock()
+		idle := len(r.peers) == 0 && !r.closed
+		r.mutex.Unlock()
+		if idle {
+			r.onIdle()
+		}
+	})
+}
+
+// publish starts forwarding a layer of a participant's track. The first
+// layer of a track subscribes every other participant to it.
+func (r *Router) publish(p *peer, track *webrtc.TrackRemote) {
+	r.mutex.Lock()
+	if r.closed || r.peers[p.id] != p {
+		r.mutex.Unlock()
+		return
+	}
+	t, ok := r.tracks[p.id+":"+track.ID()]
+	if !ok {
+		t = newPublishedTrack(p, track)
+		if t.video {
+			screen, allowed := r.admitVideo(p, track.StreamID())
+			if !allowed {
+				r.mutex.Unlock()
+				log.Printf("SFU refused video track %s of %s: stream %s is neither its camera nor a screen share", track.ID(), p.id, track.StreamID())
+				return
+			}
+			t.screen = screen
+		}
+		r.tracks[t.id] = t
+	}
+	t.addLayer(track)
+
+	var subscribers []*peer
+	if !ok {
+		for _, other := range r.peers {
+			if other != p {
+				subscribers = append(subscribers, other)
+			}
+		}
+	}
+	r.mutex.Unlock()
+
+	log.Printf("SFU forwarding %s track %s (layer %q)", track.Kind(), t.id, track.RID())
+
+	for _, s := range subscribers {
+		if r.subscribe(s, t) {
+			s.negotiate()
+		}
+	}
+
+	go r.forward(t, track)
+}
+
+// admitVideo decides whether a new video track in the given stream is
+// forwarded, and whether it is a screen share. A participant sends video in
+// one camera stream, and in the stream of its screen share while the hub has
+// it down as sharing; video in any other stream would be a share that
+// bypasses the room's limit. r.mutex must be held.
+func (r *Router) admitVideo(p *peer, streamID string) (screen bool, allowed bool) {
+	if shared, ok := r.screens[p.id]; ok && shared == streamID {
+		return true, true
+	}
+	if p.camera == "" {
+		p.camera = streamID
+	}
+	return false, p.camera == streamID
+}
+
+// startScreenShare lets a participant's video in streamID through as its
+// screen share, ending a share it restarted in another stream
+func (r *Router) startScreenShare(participantID, streamID string) {
+	r.mutex.Lock()
+	r.screens[participantID] = streamID
+	ended := r.screenTracks(participantID, streamID)
+	r.mutex.Unlock()
+
+	for _, t := range ended {
+		r.unpublish(t)
+	}
+}
+
+// stopScreenShare stops forwarding a participant's screen share
+func (r *Router) stopScreenShare(participantID string) {
+	r.mutex.Lock()
+	delete(r.screens, participantID)
+	ended := r.screenTracks(participantID, "")
+	r.mutex.Unlock()
+
+	for _, t := range ended {
+		r.unpublish(t)
+	}
+}
+
+// screenTracks returns a participant's screen share tracks outside the given
+// stream. r.mutex must be held.
+func (r *Router) screenTracks(participantID, keepStreamID string) []*publishedTrack {
+	var tracks []*publishedTrack
+	for _, t := range r.tracks {
+		if t.screen && t.publisher.id == participantID && t.streamID != participantID+":"+keepStreamID {
+			tracks = append(tracks, t)
+		}
+	}
+	return tracks
+}
+
+// forward copies a layer's packets to the subscribers of its track until
+// the layer ends, and ends the track with its last layer
+func (r *Router) forward(t *publishedTrack, track *webrtc.TrackRemote) {
+	rid := track.RID()
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			break
+		}
+
+		keyframe := t.video && isVP8Keyframe(packet.Payload)
+		for _, d := range t.downTracks() {
+			if d.write(rid, packet, keyframe) {
+				t.requestKeyframe(rid)
+			}
+		}
+	}
+
+	if t.removeLayer(rid) == 0 {
+		r.unpublish(t)
+	}
+}
+
+// unpublish stops forwarding a track, removing it from every subscriber
+func (r *Router) unpublish(t *publishedTrack) {
+	r.mutex.Lock()
+	if r.tracks[t.id] == t {
+		delete(r.tracks, t.id)
+	}
+	subscribers := t.takeSubscribers()
+	peers := make(map[string]*peer, len(subscribers))
+	for id := range subscribers {
+		if p, ok := r.peers[id]; ok {
+			peers[id] = p
+		}
+	}
+	r.mutex.Unlock()
+
+	if len(subscribers) == 0 {
+		return
+	}
+	log.Printf("SFU stopped forwarding track %s", t.id)
+
+	for id, d := range subscribers {
+		p, ok := peers[id]
+		if !ok {
+			continue
+		}
+		if err := p.pc.RemoveTrack(d.sender); err != nil {
+			log.Printf("SFU failed to remove track %s from %s: %v", t.id, id, err)
+			continue
+		}
+		p.negotiate()
+	}
+}
+
+// subscribe adds a track to a participant's connection, reporting whether
+// it was added. The caller renegotiates.
+func (r *Router) subscribe(p *peer, t *publishedTrack) bool {
+	local, err := webrtc.NewTrackLocalStaticRTP(t.codec, t.id, t.streamID)
+	if err != nil {
+		log.Printf("SFU failed to create track %s for %s: %v", t.id, p.id, err)
+		return false
+	}
+	sender, err := p.pc.AddTrack(local)
+	if err != nil {
+		log.Printf("SFU failed to add track %s for %s: %v", t.id, p.id, err)
+		return false
+	}
+	d := &downTrack{track: local, sender: sender, video: t.video}
+
+	// Either side may have gone while the track was being added
+	r.mutex.Lock()
+	if r.peers[p.id] != p || r.tracks[t.id] != t {
+		r.mutex.Unlock()
+		_ = p.pc.RemoveTrack(sender)
+		return false
+	}
+	t.addSubscriber(p.id, d)
+	r.mutex.Unlock()
+
+	go r.readRTCP(t, d)
+	return true
+}
+
+// subscribeAll adds every track published by others to a participant's
+// connection
+func (r *Router) subscribeAll(p *peer) {
+	r.mutex.Lock()
+	var tracks []*publishedTrack
+	for _, t := range r.tracks {
+		if t.publisher != p {
+			tracks = append(tracks, t)
+		}
+	}
+	r.mutex.Unlock()
+
+	added := false
+	for _, t := range tracks {
+		added = r.subscribe(p, t) || added
+	}
+	if added {
+		p.negotiate()
+	}
+}
+
+// readRTCP passes a subscriber's keyframe requests on to the publisher
+// until the track is removed
+func (r *Router) readRTCP(t *publishedTrack, d *downTrack) {
+	for {
+		packets, _, err := d.sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, packet := range packets {
+			switch packet.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				t.requestKeyframe(d.current())
+			}
+		}
+	}
+}
+
+// acceptOffer answers a participant's offer. When both sides offer at once
+// the router's offer wins: the participant rolls its own back, answers, and
+// offers again afterwards.
+func (p *peer) acceptOffer(offer webrtc.SessionDescription) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.offering || p.pc.SignalingState() != webrtc.SignalingStateStable {
+		log.Printf("SFU ignoring offer from %s while its own is pending", p.id)
+		return nil
+	}
+	return p.answer(offer)
+}
+
+// answer applies an offer and sends the answer. p.mutex must be held.
+func (p *peer) answer(offer webrtc.SessionDescription) error {
+	if err := p.pc.SetRemoteDescription(offer); err != nil {
+		return fmt.Errorf("failed to set remote description: %w", err)
+	}
+	p.flushCandidates()
+
+	answer, err := p.pc.CreateAnswer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create answer: %w", err)
+	}
+	if err := p.pc.SetLocalDescription(answer); err != nil {
+		return fmt.Errorf("failed to set local description: %w", err)
+	}
+	return p.router.send(signaling.TypeAnswer, p.id, &answer, nil)
+}
+
+// acceptAnswer applies the answer to the router's offer, offering again if
+// tracks changed in the meantime
+func (p *peer) acceptAnswer(answer webrtc.SessionDescription) error {
+	p.mutex.Lock()
+	if !p.offering {
+		p.mutex.Unlock()
+		return errors.New("no offer awaiting an answer")
+	}
+	p.offering = false
+	err := p.pc.SetRemoteDescription(answer)
+	p.flushCandidates()
+	again := p.pending
+	p.mutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to set remote description: %w", err)
+	}
+	if again {
+		p.negotiate()
+	}
+	return nil
+}
+
+// negotiate offers the participant the connection's current tracks. While
+// an earlier offer awaits its answer the new one is deferred.
+func (p *peer) negotiate() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.offering || p.pc.SignalingState() != webrtc.SignalingStateStable {
+		p.pending = true
+		return
+	}
+	p.pending = false
+
+	offer, err := p.pc.CreateOffer(nil)
+	if err != nil {
+		log.Printf("SFU failed to create offer for %s: %v", p.id, err)
+		return
+	}
+	if err := p.pc.SetLocalDescription(offer); err != nil {
+		log.Printf("SFU failed to set local description for %s: %v", p.id, err)
+		return
+	}
+	p.offering = true
+
+	if err := p.router.send(signaling.TypeOffer, p.id, &offer, nil); err != nil {
+		log.Printf("SFU failed to send offer to %s: %v", p.id, err)
+	}
+}
+
+// addCandidate applies an ICE candidate, holding it until the connection
+// has a remote description
+func (p *peer) addCandidate(candidate webrtc.ICECandidateInit) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.pc.RemoteDescription() == nil {
+		p.candidates = append(p.candidates, candidate)
+		return nil
+	}
+	return p.pc.AddICECandidate(candidate)
+}
+
+// flushCandidates applies the candidates held back so far. p.mutex must be
+// held.
+func (p *peer) flushCandidates() {
+	if p.pc.RemoteDescription() == nil {
+		return
+	}
+	for _, candidate := range p.candidates {
+		if err := p.pc.AddICECandidate(candidate); err != nil {
+			log.Printf("SFU failed to add ICE candidate from %s: %v", p.id, err)
+		}
+	}
+	p.candidates = nil
+}
+
+func (r *Router) send(msgType, targetID string, sdp *webrtc.SessionDescription, candidate *webrtc.ICECandidateInit) error {
+	payload := signaling.SignalPayload{TargetID: targetID}
+
+	if sdp != nil {
+		data, err := json.Marshal(sdp)
+		if err != nil {
+			return err
+		}
+		payload.SDP = data
+	}
+	if candidate != nil {
+		data, err := json.Marshal(candidate)
+		if err != nil {
+			return err
+		}
+		payload.Candidate = data
+	}
+
+	msg, err := signaling.NewMessage(msgType, payload)
+	if err != nil {
+		return err
+	}
+	r.signaler.Send(msg)
+	return nil
+}
+
+// Close disconnects every participant
+func (r *Router) Close() {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return
+	}
+	r.closed = true
+	if r.idle != nil {
+		r.idle.Stop()
+	}
+	peers := r.peers
+	r.peers = make(map[string]*peer)
+	r.mutex.Unlock()
+
+	// Closing the connections ends every forwarding loop
+	for _, p := range peers {
+		p.pc.Close()
+	}
+}
@@ -0,0 +1,220 @@
+package sfu
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"video-conference-backend/internal/signaling"
+	"video-conference-backend/internal/webrtctest"
+)
+
+const (
+	testRouterID = "sfu_test"
+	waitTimeout  = 10 * time.Second
+)
+
+// testRoom is a router with in-process participants connected to it over
+// the loopback network. Messages are delivered in order, the way the hub
+// queues them for a socket.
+type testRoom struct {
+	t      *testing.T
+	router *Router
+	inbox  chan signaling.Message
+
+	mutex   sync.Mutex
+	clients map[string]*testClient
+}
+
+func newTestRoom(t *testing.T) *testRoom {
+	t.Helper()
+
+	api, err := NewAPI(0, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to create API: %v", err)
+	}
+	room := &testRoom{
+		t:       t,
+		router:  NewRouter(api, webrtc.Configuration{}, 0, nil),
+		clients: make(map[string]*testClient),
+	}
+	room.inbox = webrtctest.Inbox(room.router.HandleMessage)
+	room.router.Start(webrtctest.SignalerFunc(room.deliver))
+
+	t.Cleanup(func() {
+		room.router.Close()
+		close(room.inbox)
+	})
+	return room
+}
+
+// deliver passes a message from the router to the participant it targets
+func (r *testRoom) deliver(msg signaling.Message) {
+	var payload signaling.SignalPayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		r.t.Errorf("router sent an invalid %s: %v", msg.Type, err)
+		return
+	}
+	r.mutex.Lock()
+	c, ok := r.clients[payload.TargetID]
+	r.mutex.Unlock()
+	if !ok {
+		return
+	}
+	relayed, _ := signaling.NewMessage(msg.Type, signaling.RelayedSignalPayload{
+		SenderID:  testRouterID,
+		SDP:       payload.SDP,
+		Candidate: payload.Candidate,
+	})
+	c.Deliver(relayed)
+}
+
+// send passes a message from the hub to the router
+func (r *testRoom) send(msgType string, payload interface{}) {
+	msg, err := signaling.NewMessage(msgType, payload)
+	if err != nil {
+		r.t.Fatalf("failed to encode %s: %v", msgType, err)
+	}
+	r.inbox <- msg
+}
+
+// testClient is a participant's browser in the room
+type testClient struct {
+	*webrtctest.Peer
+	t    *testing.T
+	room *testRoom
+}
+
+func (r *testRoom) join(id string) *testClient {
+	r.t.Helper()
+
+	peer, err := webrtctest.NewPeer(id, func(msg signaling.Message) { r.inbox <- msg }, r.t.Errorf)
+	if err != nil {
+		r.t.Fatalf("%s: %v", id, err)
+	}
+	c := &testClient{Peer: peer, t: r.t, room: r}
+
+	r.mutex.Lock()
+	r.clients[id] = c
+	r.mutex.Unlock()
+
+	r.t.Cleanup(c.leave)
+	return c
+}
+
+// leave closes the participant's connection and tells the router
+func (c *testClient) leave() {
+	select {
+	case <-c.Done():
+		return
+	default:
+	}
+	c.Close()
+	c.room.send(signaling.TypeUserLeft, signaling.UserLeftPayload{UserID: c.ID})
+}
+
+func (c *testClient) connect() {
+	c.t.Helper()
+	if err := c.Connect(); err != nil {
+		c.t.Fatalf("%s: %v", c.ID, err)
+	}
+}
+
+func (c *testClient) publish(kind webrtc.RTPCodecType, trackID, streamID string) {
+	c.t.Helper()
+	if err := c.Publish(kind, trackID, streamID); err != nil {
+		c.t.Fatalf("%s: %v", c.ID, err)
+	}
+}
+
+// eventually waits for a condition, failing the test if it does not hold in
+// time
+func eventually(t *testing.T, name string, done func() bool) {
+	t.Helper()
+	if !webrtctest.Until(waitTimeout, done) {
+		t.Fatalf("timed out: %s", name)
+	}
+}
+
+func TestRouterForwardsMedia(t *testing.T) {
+	room := newTestRoom(t)
+
+	alice := room.join("alice")
+	alice.publish(webrtc.RTPCodecTypeAudio, "audio", "alice-camera")
+	alice.publish(webrtc.RTPCodecTypeVideo, "video", "alice-camera")
+	bob := room.join("bob")
+	bob.publish(webrtc.RTPCodecTypeAudio, "audio", "bob-camera")
+
+	alice.connect()
+	bob.connect()
+
+	eventually(t, "bob receives alice's audio", func() bool { return bob.Packets("alice:audio") > 0 })
+	eventually(t, "bob receives alice's video", func() bool { return bob.Packets("alice:video") > 0 })
+	eventually(t, "alice receives bob's audio", func() bool { return alice.Packets("bob:audio") > 0 })
+	if alice.Packets("alice:audio") > 0 {
+		t.Fatal("alice received her own audio")
+	}
+
+	offers := bob.Offers()
+	alice.leave()
+	eventually(t, "bob is renegotiated without alice's tracks", func() bool {
+		return bob.Offers() > offers && !bob.Receiving("alice:")
+	})
+}
+
+func TestRouterForwardsLateJoinersExistingTracks(t *testing.T) {
+	room := newTestRoom(t)
+
+	alice := room.join("alice")
+	alice.publish(webrtc.RTPCodecTypeVideo, "video", "alice-camera")
+	alice.connect()
+
+	bob := room.join("bob")
+	bob.publish(webrtc.RTPCodecTypeAudio, "audio", "bob-camera")
+	time.Sleep(200 * time.Millisecond)
+	bob.connect()
+
+	eventually(t, "bob receives alice's video", func() bool { return bob.Packets("alice:video") > 0 })
+}
+
+func TestRouterForwardsOnlyAnnouncedScreenShares(t *testing.T) {
+	room := newTestRoom(t)
+
+	// A second video stream the hub never announced as a screen share
+	mallory := room.join("mallory")
+	mallory.publish(webrtc.RTPCodecTypeVideo, "camera", "mallory-camera")
+	mallory.publish(webrtc.RTPCodecTypeVideo, "screen", "mallory-screen")
+
+	// Alice shares her screen before adding its track, as clients must
+	room.send(signaling.TypeScreenShareStarted, signaling.ScreenSharePayload{UserID: "alice", StreamID: "alice-screen"})
+	alice := room.join("alice")
+	alice.publish(webrtc.RTPCodecTypeVideo, "camera", "alice-camera")
+	alice.publish(webrtc.RTPCodecTypeVideo, "screen", "alice-screen")
+
+	bob := room.join("bob")
+	bob.publish(webrtc.RTPCodecTypeAudio, "audio", "bob-camera")
+
+	mallory.connect()
+	alice.connect()
+	bob.connect()
+
+	// Whichever of mallory's streams arrives first is taken as her camera
+	eventually(t, "bob receives one of mallory's streams", func() bool {
+		return bob.Packets("mallory:camera") > 0 || bob.Packets("mallory:screen") > 0
+	})
+	eventually(t, "bob receives alice's camera", func() bool { return bob.Packets("alice:camera") > 0 })
+	eventually(t, "bob receives alice's screen", func() bool { return bob.Packets("alice:screen") > 0 })
+	if bob.Receiving("mallory:camera") && bob.Receiving("mallory:screen") {
+		t.Fatal("router forwarded a screen share the hub never announced")
+	}
+
+	offers := bob.Offers()
+	room.send(signaling.TypeScreenShareStopped, signaling.ScreenShareStoppedPayload{UserID: "alice", Reason: signaling.ScreenShareStoppedByModerator})
+	eventually(t, "bob is renegotiated without alice's screen", func() bool {
+		return bob.Offers() > offers && !bob.Receiving("alice:screen")
+	})
+	if !bob.Receiving("alice:camera") {
+		t.Fatal("ending the share removed alice's camera")
+	}
+}
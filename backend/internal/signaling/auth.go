@@ -0,0 +1,149 @@
+package signaling
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// Identity is the server-resolved identity behind a signaling connection.
+// It is derived from an access token or an invitation token, never from the payload.
+type Identity struct {
+	UserID    string // identifier used on the wire (user ID, or guest_<invitation>)
+	UserName  string
+	ClientID  int
+	AccountID *int // users.id for authenticated users, nil for guests
+	Email     string
+	MeetingID int // meetings.id the identity is restricted to (invitations only)
+	IsGuest   bool
+}
+
+// authenticate resolves the caller's identity from an access or invitation token
+func (h *Hub) authenticate(r *http.Request) (*Identity, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	accessToken := r.URL.Query().Get("token")
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		accessToken = strings.TrimPrefix(authHeader, "Bearer ")
+	}
+
+	if accessToken != "" {
+		claims, err := h.services.Auth.ValidateToken(ctx, accessToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid access token")
+		}
+		if claims.TokenType != "access" {
+			return nil, fmt.Errorf("token is not an access token")
+		}
+		if revoked, err := h.services.Auth.IsTokenRevoked(ctx, claims.ID); err != nil || revoked {
+			return nil, fmt.Errorf("access token has been revoked")
+		}
+
+		user, err := h.services.User.GetUserByID(ctx, claims.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("user not found")
+		}
+		if user.Status != "active" {
+			return nil, fmt.Errorf("user account is not active")
+		}
+
+		return &Identity{
+			UserID:    strconv.Itoa(user.ID),
+			UserName:  user.GetFullName(),
+			ClientID:  user.ClientID,
+			AccountID: &user.ID,
+			Email:     user.Email,
+		}, nil
+	}
+
+	if invitationToken := r.URL.Query().Get("invitation"); invitationToken != "" {
+		claims, err := h.services.Invitation.ValidateInvitationToken(invitationToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid invitation token")
+		}
+
+		meeting, err := h.services.Meeting.GetMeetingByID(ctx, claims.MeetingID)
+		if err != nil {
+			return nil, fmt.Errorf("invitation meeting not found")
+		}
+
+		return &Identity{
+			UserID:    "guest_" + claims.ID,
+			UserName:  claims.Email,
+			ClientID:  meeting.ClientID,
+			Email:     claims.Email,
+			MeetingID: meeting.ID,
+			IsGuest:   true,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("missing access token or invitation token")
+}
+
+// resolveMeeting maps a room ID onto an active meeting the identity may join
+func (h *Hub) resolveMeeting(ctx context.Context, identity *Identity, roomID string) (*models.Meeting, error) {
+	meeting, err := h.services.Meeting.GetMeetingByMeetingID(ctx, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("meeting not found")
+	}
+
+	if meeting.ClientID != identity.ClientID {
+		return nil, fmt.Errorf("meeting not found")
+	}
+
+	if identity.MeetingID != 0 && identity.MeetingID != meeting.ID {
+		return nil, fmt.Errorf("invitation is not valid for this meeting")
+	}
+
+	if !meeting.IsActive() {
+		return nil, fmt.Errorf("meeting is not active")
+	}
+
+	return meeting, nil
+}
+
+// participantKey returns the user ID or email identifying the identity's
+// meeting_participants record
+func (i *Identity) participantKey() (*int, *string) {
+	if i.AccountID != nil {
+		return i.AccountID, nil
+	}
+	if i.Email != "" {
+		email := i.Email
+		return nil, &email
+	}
+	return nil, nil
+}
+
+// participantRecord loads the identity's meeting_participants record, or nil if it has none
+func (h *Hub) participantRecord(ctx context.Context, identity *Identity, meeting *models.Meeting) *models.MeetingParticipant {
+	userID, email := identity.participantKey()
+	if userID == nil && email == nil {
+		return nil
+	}
+
+	participant, err := h.services.Meeting.GetParticipant(ctx, meeting.ID, userID, email)
+	if err != nil {
+		return nil
+	}
+	return participant
+}
+
+// meetingRole returns the participant role the identity holds in the meeting.
+// The creator is always host; everyone else takes the role on their
+// participant record, defaulting to attendee.
+func meetingRole(identity *Identity, meeting *models.Meeting, participant *models.MeetingParticipant) string {
+	if identity.AccountID != nil && *identity.AccountID == meeting.CreatedByUserID {
+		return models.ParticipantRoleHost
+	}
+	if participant != nil && participant.Role != "" {
+		return participant.Role
+	}
+	return models.ParticipantRoleAttendee
+}
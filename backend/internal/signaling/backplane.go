@@ -0,0 +1,289 @@
+package signaling
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"video-conference-backend/internal/config"
+	"video-conference-backend/internal/models"
+)
+
+// Envelope kinds carried over the backplane
+const (
+	EnvelopeBroadcast = "broadcast"
+	EnvelopeDirect    = "direct"
+	// EnvelopeAdmit and EnvelopeDeny carry a lobby decision to the node
+	// holding the knocker's connection
+	EnvelopeAdmit = "admit"
+	EnvelopeDeny  = "deny"
+	// EnvelopeRemove disconnects TargetID, banning it if the carried
+	// moderation message says so; EnvelopeEnd disconnects the whole room
+	EnvelopeRemove = "remove"
+	EnvelopeEnd    = "end"
+	// EnvelopeLowerHand lowers TargetID's hand, or every hand when TargetID
+	// is empty, on the node holding the connection
+	EnvelopeLowerHand = "lowerHand"
+	// EnvelopeBreakout carries a breakout event to every node holding
+	// members of the meeting, in the main room or its breakout rooms
+	EnvelopeBreakout = "breakout"
+	// EnvelopeStopShare ends TargetID's screen share and EnvelopeRole
+	// changes its role, on the node holding the connection
+	EnvelopeStopShare = "stopShare"
+	EnvelopeRole      = "role"
+	// EnvelopeLogout closes every connection of account TargetID, on the
+	// sessions channel rather than a room's
+	EnvelopeLogout = "logout"
+)
+
+// Envelope is a signaling message in transit between hub instances
+type Envelope struct {
+	NodeID    string `json:"nodeId"`
+	RoomID    string `json:"roomId"`
+	Kind      string `json:"kind"`
+	TargetID  string `json:"targetId,omitempty"`
+	ExcludeID string `json:"excludeId,omitempty"`
+	// ModeratorsOnly restricts a broadcast to hosts and co-hosts
+	ModeratorsOnly bool    `json:"moderatorsOnly,omitempty"`
+	Message        Message `json:"message"`
+}
+
+// Presence records a room member and the node holding its connection
+type Presence struct {
+	UserID    string    `json:"userId"`
+	UserName  string    `json:"userName"`
+	Role      string    `json:"role,omitempty"`
+	ViewOnly  bool      `json:"viewOnly,omitempty"`
+	Hidden    bool      `json:"hidden,omitempty"` // server-side peer, not shown to participants
+	NodeID    string    `json:"nodeId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// HandRaisedAt is set while the member's hand is raised
+	HandRaisedAt *time.Time `json:"handRaisedAt,omitempty"`
+	// Breakout is the breakout room a member of the main room moved to. It
+	// keeps its seat in the main room but is not listed there.
+	Breakout string `json:"breakout,omitempty"`
+	// StreamID and SharingSince describe a screen share, in the room's set
+	// of active sharers
+	StreamID     string     `json:"streamId,omitempty"`
+	SharingSince *time.Time `json:"sharingSince,omitempty"`
+}
+
+func (p Presence) participant() Participant {
+	return Participant{UserID: p.UserID, UserName: p.UserName, Role: p.Role, ViewOnly: p.ViewOnly, HandRaisedAt: p.HandRaisedAt}
+}
+
+func (p Presence) isModerator() bool {
+	return p.Role == models.ParticipantRoleHost || p.Role == models.ParticipantRoleCoHost
+}
+
+// Capacity bounds how many members may hold a seat in a room. View-only and
+// hidden members do not take a seat. A Limit of zero means unlimited.
+type Capacity struct {
+	Limit int
+	// HostReserved seats are kept free for hosts and co-hosts until that
+	// many of them are present
+	HostReserved int
+}
+
+// admits reports whether p may take a seat among the current members
+func (c Capacity) admits(members []Presence, p Presence, now time.Time) bool {
+	if c.Limit <= 0 || p.ViewOnly {
+		return true
+	}
+
+	seated, moderators := 0, 0
+	for _, m := range members {
+		if !m.ExpiresAt.After(now) || m.ViewOnly || m.Hidden {
+			continue
+		}
+		// A reconnect keeps the seat it already holds
+		if m.UserID == p.UserID {
+			return true
+		}
+		seated++
+		if m.isModerator() {
+			moderators++
+		}
+	}
+
+	if p.isModerator() {
+		return seated < c.Limit
+	}
+
+	reserved := c.HostReserved - moderators
+	if reserved < 0 {
+		reserved = 0
+	}
+	return seated < c.Limit-reserved
+}
+
+// Backplane connects hub instances so a room can span several nodes. Presence
+// entries expire unless refreshed, so members of a crashed node are evicted.
+type Backplane interface {
+	// Publish sends an envelope to every node subscribed to the room
+	Publish(ctx context.Context, env Envelope) error
+	// Subscribe delivers envelopes for the room to handler until unsubscribed
+	Subscribe(roomID string, handler func(Envelope)) (func(), error)
+
+	// SetPresence creates or refreshes a room member for ttl
+	SetPresence(ctx context.Context, roomID string, p Presence, ttl time.Duration) error
+	// ClaimSlot atomically adds a room member for ttl if the room has a seat
+	// for it, reporting whether it was added
+	ClaimSlot(ctx context.Context, roomID string, p Presence, ttl time.Duration, capacity Capacity) (bool, error)
+	// RemovePresence deletes a room member, reporting whether it was present
+	RemovePresence(ctx context.Context, roomID, userID string) (bool, error)
+	// ListPresence returns the unexpired members of a room
+	ListPresence(ctx context.Context, roomID string) ([]Presence, error)
+	// EvictExpired removes expired members and returns those this call removed
+	EvictExpired(ctx context.Context, roomID string) ([]Presence, error)
+
+	Close() error
+}
+
+// NewBackplane creates the backplane selected by configuration
+func NewBackplane(cfg *config.Config) (Backplane, error) {
+	switch cfg.Signaling.Backplane {
+	case "", "memory":
+		return NewMemoryBackplane(), nil
+	case "redis":
+		return NewRedisBackplane(&cfg.Redis)
+	default:
+		return nil, fmt.Errorf("unknown signaling backplane %q", cfg.Signaling.Backplane)
+	}
+}
+
+// MemoryBackplane is an in-process backplane. Hubs sharing one instance behave
+// like separate nodes, which is also how a single node runs without Redis.
+type MemoryBackplane struct {
+	mutex       sync.RWMutex
+	subscribers map[string]map[int]func(Envelope)
+	presence    map[string]map[string]Presence
+	nextID      int
+}
+
+// NewMemoryBackplane creates a new in-memory backplane
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{
+		subscribers: make(map[string]map[int]func(Envelope)),
+		presence:    make(map[string]map[string]Presence),
+	}
+}
+
+func (b *MemoryBackplane) Publish(ctx context.Context, env Envelope) error {
+	b.mutex.RLock()
+	handlers := make([]func(Envelope), 0, len(b.subscribers[env.RoomID]))
+	for _, handler := range b.subscribers[env.RoomID] {
+		handlers = append(handlers, handler)
+	}
+	b.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(env)
+	}
+	return nil
+}
+
+func (b *MemoryBackplane) Subscribe(roomID string, handler func(Envelope)) (func(), error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subscribers[roomID] == nil {
+		b.subscribers[roomID] = make(map[int]func(Envelope))
+	}
+	id := b.nextID
+	b.nextID++
+	b.subscribers[roomID][id] = handler
+
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.subscribers[roomID], id)
+		if len(b.subscribers[roomID]) == 0 {
+			delete(b.subscribers, roomID)
+		}
+	}, nil
+}
+
+func (b *MemoryBackplane) SetPresence(ctx context.Context, roomID string, p Presence, ttl time.Duration) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.presence[roomID] == nil {
+		b.presence[roomID] = make(map[string]Presence)
+	}
+	p.ExpiresAt = time.Now().Add(ttl)
+	b.presence[roomID][p.UserID] = p
+	return nil
+}
+
+func (b *MemoryBackplane) ClaimSlot(ctx context.Context, roomID string, p Presence, ttl time.Duration, capacity Capacity) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	members := make([]Presence, 0, len(b.presence[roomID]))
+	for _, m := range b.presence[roomID] {
+		members = append(members, m)
+	}
+	if !capacity.admits(members, p, now) {
+		return false, nil
+	}
+
+	if b.presence[roomID] == nil {
+		b.presence[roomID] = make(map[string]Presence)
+	}
+	p.ExpiresAt = now.Add(ttl)
+	b.presence[roomID][p.UserID] = p
+	return true, nil
+}
+
+func (b *MemoryBackplane) RemovePresence(ctx context.Context, roomID, userID string) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.presence[roomID][userID]; !ok {
+		return false, nil
+	}
+	delete(b.presence[roomID], userID)
+	if len(b.presence[roomID]) == 0 {
+		delete(b.presence, roomID)
+	}
+	return true, nil
+}
+
+func (b *MemoryBackplane) ListPresence(ctx context.Context, roomID string) ([]Presence, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	now := time.Now()
+	members := make([]Presence, 0, len(b.presence[roomID]))
+	for _, p := range b.presence[roomID] {
+		if p.ExpiresAt.After(now) {
+			members = append(members, p)
+		}
+	}
+	return members, nil
+}
+
+func (b *MemoryBackplane) EvictExpired(ctx context.Context, roomID string) ([]Presence, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	var evicted []Presence
+	for userID, p := range b.presence[roomID] {
+		if !p.ExpiresAt.After(now) {
+			evicted = append(evicted, p)
+			delete(b.presence[roomID], userID)
+		}
+	}
+	if len(b.presence[roomID]) == 0 {
+		delete(b.presence, roomID)
+	}
+	return evicted, nil
+}
+
+func (b *MemoryBackplane) Close() error {
+	return nil
+}
@@ -0,0 +1,285 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"video-conference-backend/internal/config"
+)
+
+const redisKeyPrefix = "signaling:room:"
+
+// claimRetries bounds optimistic retries when presence changes under a claim
+const claimRetries = 10
+
+// evictScript deletes a presence entry only if it has not been refreshed since it was read
+var evictScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// RedisBackplane shares rooms between nodes through Redis pub/sub, with room
+// presence kept in one hash per room
+type RedisBackplane struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+
+	mutex       sync.RWMutex
+	subscribers map[string]map[int]func(Envelope)
+	nextID      int
+	done        chan struct{}
+}
+
+// NewRedisBackplane connects to Redis and starts the subscription reader
+func NewRedisBackplane(cfg *config.RedisConfig) (*RedisBackplane, error) {
+	options, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	if cfg.Password != "" {
+		options.Password = cfg.Password
+	}
+	if cfg.DB != 0 {
+		options.DB = cfg.DB
+	}
+	options.MaxRetries = cfg.MaxRetries
+
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	b := &RedisBackplane{
+		client:      client,
+		pubsub:      client.Subscribe(context.Background()),
+		subscribers: make(map[string]map[int]func(Envelope)),
+		done:        make(chan struct{}),
+	}
+	go b.receive()
+
+	log.Printf("✅ Signaling backplane connected to Redis")
+	return b, nil
+}
+
+func channelKey(roomID string) string {
+	return redisKeyPrefix + roomID + ":events"
+}
+
+func presenceKey(roomID string) string {
+	return redisKeyPrefix + roomID + ":presence"
+}
+
+func (b *RedisBackplane) receive() {
+	ch := b.pubsub.Channel()
+	for {
+		select {
+		case <-b.done:
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			var env Envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				log.Printf("Signaling backplane dropped malformed envelope: %v", err)
+				continue
+			}
+
+			b.mutex.RLock()
+			handlers := make([]func(Envelope), 0, len(b.subscribers[env.RoomID]))
+			for _, handler := range b.subscribers[env.RoomID] {
+				handlers = append(handlers, handler)
+			}
+			b.mutex.RUnlock()
+
+			for _, handler := range handlers {
+				handler(env)
+			}
+		}
+	}
+}
+
+func (b *RedisBackplane) Publish(ctx context.Context, env Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to encode envelope: %w", err)
+	}
+	if err := b.client.Publish(ctx, channelKey(env.RoomID), data).Err(); err != nil {
+		return fmt.Errorf("failed to publish envelope: %w", err)
+	}
+	return nil
+}
+
+func (b *RedisBackplane) Subscribe(roomID string, handler func(Envelope)) (func(), error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subscribers[roomID] == nil {
+		if err := b.pubsub.Subscribe(context.Background(), channelKey(roomID)); err != nil {
+			return nil, fmt.Errorf("failed to subscribe to room: %w", err)
+		}
+		b.subscribers[roomID] = make(map[int]func(Envelope))
+	}
+	id := b.nextID
+	b.nextID++
+	b.subscribers[roomID][id] = handler
+
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.subscribers[roomID], id)
+		if len(b.subscribers[roomID]) == 0 {
+			delete(b.subscribers, roomID)
+			if err := b.pubsub.Unsubscribe(context.Background(), channelKey(roomID)); err != nil {
+				log.Printf("Signaling backplane failed to unsubscribe from %s: %v", roomID, err)
+			}
+		}
+	}, nil
+}
+
+func (b *RedisBackplane) SetPresence(ctx context.Context, roomID string, p Presence, ttl time.Duration) error {
+	p.ExpiresAt = time.Now().Add(ttl)
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode presence: %w", err)
+	}
+
+	key := presenceKey(roomID)
+	pipe := b.client.TxPipeline()
+	pipe.HSet(ctx, key, p.UserID, data)
+	// The hash outlives its freshest member so abandoned rooms disappear
+	pipe.Expire(ctx, key, 2*ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to set presence: %w", err)
+	}
+	return nil
+}
+
+// ClaimSlot counts seats and adds the member under WATCH, retrying when
+// another node changes the room's presence in between
+func (b *RedisBackplane) ClaimSlot(ctx context.Context, roomID string, p Presence, ttl time.Duration, capacity Capacity) (bool, error) {
+	key := presenceKey(roomID)
+
+	for attempt := 0; attempt < claimRetries; attempt++ {
+		claimed := false
+		err := b.client.Watch(ctx, func(tx *redis.Tx) error {
+			entries, err := tx.HGetAll(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+
+			members := make([]Presence, 0, len(entries))
+			for _, data := range entries {
+				var m Presence
+				if err := json.Unmarshal([]byte(data), &m); err == nil {
+					members = append(members, m)
+				}
+			}
+
+			now := time.Now()
+			if !capacity.admits(members, p, now) {
+				return nil
+			}
+
+			p.ExpiresAt = now.Add(ttl)
+			data, err := json.Marshal(p)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, key, p.UserID, data)
+				pipe.Expire(ctx, key, 2*ttl)
+				return nil
+			})
+			if err == nil {
+				claimed = true
+			}
+			return err
+		}, key)
+
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to claim slot: %w", err)
+		}
+		return claimed, nil
+	}
+
+	return false, fmt.Errorf("failed to claim slot: too much contention on room %s", roomID)
+}
+
+func (b *RedisBackplane) RemovePresence(ctx context.Context, roomID, userID string) (bool, error) {
+	removed, err := b.client.HDel(ctx, presenceKey(roomID), userID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove presence: %w", err)
+	}
+	return removed > 0, nil
+}
+
+func (b *RedisBackplane) ListPresence(ctx context.Context, roomID string) ([]Presence, error) {
+	entries, err := b.client.HGetAll(ctx, presenceKey(roomID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list presence: %w", err)
+	}
+
+	now := time.Now()
+	members := make([]Presence, 0, len(entries))
+	for _, data := range entries {
+		var p Presence
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			continue
+		}
+		if p.ExpiresAt.After(now) {
+			members = append(members, p)
+		}
+	}
+	return members, nil
+}
+
+func (b *RedisBackplane) EvictExpired(ctx context.Context, roomID string) ([]Presence, error) {
+	key := presenceKey(roomID)
+	entries, err := b.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list presence: %w", err)
+	}
+
+	now := time.Now()
+	var evicted []Presence
+	for userID, data := range entries {
+		var p Presence
+		if err := json.Unmarshal([]byte(data), &p); err != nil || p.ExpiresAt.After(now) {
+			continue
+		}
+
+		// Compare-and-delete, so only one node reports each eviction and a
+		// concurrent refresh wins
+		removed, err := evictScript.Run(ctx, b.client, []string{key}, userID, data).Int()
+		if err != nil {
+			return evicted, fmt.Errorf("failed to evict presence: %w", err)
+		}
+		if removed > 0 {
+			evicted = append(evicted, p)
+		}
+	}
+	return evicted, nil
+}
+
+func (b *RedisBackplane) Close() error {
+	close(b.done)
+	b.pubsub.Close()
+	return b.client.Close()
+}
@@ -0,0 +1,825 @@
+package signaling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+)
+
+const (
+	maxBreakoutRooms        = 50
+	maxBreakoutNameLength   = 100
+	maxBreakoutDuration     = 24 * time.Hour
+	breakoutsNotOpenMessage = "breakout rooms are not open"
+)
+
+// breakoutRoomKey is the signaling room of a breakout room within a meeting
+func breakoutRoomKey(roomID string, breakoutRoomID int) string {
+	return fmt.Sprintf("%s/breakout/%d", roomID, breakoutRoomID)
+}
+
+func (h *Hub) breakoutsOnly(next messageHandler) messageHandler {
+	return func(c *Client, msg Message) {
+		if !h.config.BreakoutRooms {
+			c.SendError(ErrCodeBreakoutsDisabled, "breakout rooms are disabled")
+			return
+		}
+		next(c, msg)
+	}
+}
+
+// room finds a breakout room of the session by its ID
+func (b *BreakoutsPayload) room(id int) *BreakoutRoomPayload {
+	for i := range b.Rooms {
+		if b.Rooms[i].ID == id {
+			return &b.Rooms[i]
+		}
+	}
+	return nil
+}
+
+// hasBreakoutRooms reports whether any breakout room of the main room is
+// open on this node. The caller must hold h.mutex.
+func (h *Hub) hasBreakoutRooms(main *Room) bool {
+	for _, room := range h.rooms {
+		if room.parent == main {
+			return true
+		}
+	}
+	return false
+}
+
+// breakoutRooms lists the breakout rooms of the main room open on this node
+func (h *Hub) breakoutRooms(main *Room) []*Room {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	rooms := make([]*Room, 0)
+	for _, room := range h.rooms {
+		if room.parent == main {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms
+}
+
+// openBreakoutRoom returns the local signaling room of a breakout room,
+// creating it and subscribing it to the backplane on first use
+func (h *Hub) openBreakoutRoom(main *Room, breakout BreakoutRoomPayload) (*Room, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if room, exists := h.rooms[breakout.RoomID]; exists {
+		return room, nil
+	}
+
+	room := newRoom(breakout.RoomID, main.Meeting)
+	room.parent = main
+	room.Breakout = &models.BreakoutRoom{ID: breakout.ID, Name: breakout.Name}
+	if session := main.openBreakouts(); session != nil {
+		room.Breakout.SessionID = session.SessionID
+	}
+
+	unsubscribe, err := h.backplane.Subscribe(room.ID, h.handleEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	room.unsubscribe = unsubscribe
+	h.rooms[room.ID] = room
+	log.Printf("Created breakout room: %s", room.ID)
+
+	return room, nil
+}
+
+// setPresence records a local member of the room. Members of a breakout
+// room keep their seat in the main room, marked with where they went.
+func (h *Hub) setPresence(ctx context.Context, room *Room, c *Client) error {
+	if err := h.backplane.SetPresence(ctx, room.ID, h.presenceOf(c), h.config.PresenceTTL); err != nil {
+		return err
+	}
+	if room.parent == nil {
+		return nil
+	}
+
+	seat := h.presenceOf(c)
+	seat.Breakout = room.ID
+	seat.HandRaisedAt = nil
+	return h.backplane.SetPresence(ctx, room.parent.ID, seat, h.config.PresenceTTL)
+}
+
+// loadBreakouts reads the meeting's open breakout session, refreshing the
+// main room's copy. It returns nil when no session is open. A session left
+// open past its end, when no node was left to time it, is closed here.
+func (h *Hub) loadBreakouts(ctx context.Context, main *Room) (*BreakoutsPayload, error) {
+	session, err := h.services.Breakout.GetOpenSession(ctx, main.Meeting.ID)
+	if errors.Is(err, services.ErrBreakoutNotFound) {
+		main.setBreakouts(nil)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if session.EndsAt != nil {
+		if !session.EndsAt.After(time.Now()) {
+			h.closeBreakouts(main, session.ID, BreakoutsClosedByTimer, nil)
+			main.setBreakouts(nil)
+			return nil, nil
+		}
+		h.expireBreakouts(main, session.ID, *session.EndsAt)
+	}
+
+	rooms, err := h.services.Breakout.ListRooms(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	assignments, err := h.services.Breakout.ListAssignments(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	breakouts := breakoutsPayload(main, session, rooms, assignments)
+	main.setBreakouts(breakouts)
+	return breakouts, nil
+}
+
+func breakoutsPayload(main *Room, session *models.BreakoutSession, rooms []*models.BreakoutRoom, assignments []*models.BreakoutAssignment) *BreakoutsPayload {
+	breakouts := &BreakoutsPayload{
+		SessionID:   session.ID,
+		Mode:        session.Mode,
+		AllowReturn: session.AllowReturn,
+		StartedAt:   session.StartedAt,
+		EndsAt:      session.EndsAt,
+		Rooms:       make([]BreakoutRoomPayload, 0, len(rooms)),
+	}
+	for _, room := range rooms {
+		breakouts.Rooms = append(breakouts.Rooms, BreakoutRoomPayload{
+			ID:       room.ID,
+			RoomID:   breakoutRoomKey(main.ID, room.ID),
+			Name:     room.Name,
+			Assigned: make([]string, 0),
+		})
+	}
+	for _, assignment := range assignments {
+		if room := breakouts.room(assignment.BreakoutRoomID); room != nil {
+			room.Assigned = append(room.Assigned, assignment.ParticipantID)
+		}
+	}
+	return breakouts
+}
+
+// expireBreakouts closes the session when it ends. Every node that learns
+// of the session times it, so it still closes on time when the node that
+// opened it goes away; only the first to close it announces the recall.
+func (h *Hub) expireBreakouts(main *Room, sessionID int, endsAt time.Time) {
+	if !main.timeBreakouts(sessionID) {
+		return
+	}
+	time.AfterFunc(time.Until(endsAt), func() {
+		h.closeBreakouts(main, sessionID, BreakoutsClosedByTimer, nil)
+	})
+}
+
+// openSession tells the caller whether breakouts are open, replying with an
+// error when they are not or cannot be read
+func (h *Hub) openSession(ctx context.Context, c *Client, main *Room) (*BreakoutsPayload, bool) {
+	breakouts, err := h.loadBreakouts(ctx, main)
+	if err != nil {
+		log.Printf("Signaling failed to load breakout rooms of %s: %v", main.ID, err)
+		c.SendError(ErrCodeInvalidRequest, "failed to load breakout rooms")
+		return nil, false
+	}
+	if breakouts == nil {
+		c.SendError(ErrCodeInvalidRequest, breakoutsNotOpenMessage)
+		return nil, false
+	}
+	return breakouts, true
+}
+
+// welcome announces a client admitted to the main room. While breakout
+// rooms are open it is told about them, and sent straight back to the
+// room it was assigned to if it reconnected.
+func (h *Hub) welcome(room *Room, c *Client) {
+	if !h.config.BreakoutRooms || c.Hidden() {
+		h.announceJoin(room, c)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	breakouts, err := h.loadBreakouts(ctx, room)
+	if err != nil {
+		log.Printf("Signaling failed to load breakout rooms of %s: %v", room.ID, err)
+	}
+	if breakouts == nil {
+		h.announceJoin(room, c)
+		return
+	}
+
+	state, _ := NewMessage(TypeBreakouts, breakouts)
+	for _, breakout := range breakouts.Rooms {
+		for _, userID := range breakout.Assigned {
+			if userID == c.UserID() {
+				c.Send(state)
+				h.moveToBreakout(c, room, breakout, false)
+				return
+			}
+		}
+	}
+
+	h.announceJoin(room, c)
+	c.Send(state)
+}
+
+// moveToBreakout moves a local member of the meeting into a breakout room
+func (h *Hub) moveToBreakout(c *Client, main *Room, breakout BreakoutRoomPayload, announced bool) {
+	room, err := h.openBreakoutRoom(main, breakout)
+	if err != nil {
+		log.Printf("Signaling failed to open breakout room %s: %v", breakout.RoomID, err)
+		c.SendError(ErrCodeInvalidRequest, "breakout room is unavailable")
+		return
+	}
+	h.moveClient(c, room, announced)
+}
+
+// moveClient moves a local member between the main room and its breakout
+// rooms. The client keeps its connection and its seat in the meeting; it
+// is sent breakoutMoved and then joined for the room it arrived in.
+func (h *Hub) moveClient(c *Client, to *Room, announced bool) {
+	from, ok := h.room(c.RoomID())
+	if !ok || from == to || c.Hidden() || c.Waiting() {
+		return
+	}
+	if removed, _ := from.remove(c); !removed {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if from.parent != nil {
+		if _, err := h.backplane.RemovePresence(ctx, from.ID, c.UserID()); err != nil {
+			log.Printf("Signaling failed to remove presence for %s: %v", c.UserID(), err)
+		}
+	}
+
+	// Raised hands and screen shares belong to the room they started in
+	c.setHand(false)
+	h.releaseScreenShare(from, c, c.UserID(), ScreenShareStoppedLeft)
+
+	c.mutex.Lock()
+	c.roomID = to.ID
+	c.breakout = to.Breakout
+	c.mutex.Unlock()
+
+	if previous := to.add(c); previous != nil && previous != c {
+		previous.SendError(ErrCodeAlreadyJoined, "connection replaced by a newer session")
+		previous.close()
+	}
+	if err := h.setPresence(ctx, to, c); err != nil {
+		log.Printf("Signaling failed to record presence for %s: %v", c.UserID(), err)
+	}
+
+	if announced {
+		left, _ := NewMessage(TypeUserLeft, UserLeftPayload{UserID: c.UserID()})
+		h.broadcast(from, left, c.UserID())
+	}
+	h.removeIfEmpty(from)
+
+	log.Printf("User %s moved from room %s to %s", c.UserID(), from.ID, to.ID)
+
+	moved := BreakoutMovedPayload{UserID: c.UserID(), RoomID: to.ID}
+	if to.Breakout != nil {
+		moved.BreakoutRoom = &BreakoutRoomPayload{ID: to.Breakout.ID, RoomID: to.ID, Name: to.Breakout.Name}
+	}
+	event, _ := NewMessage(TypeBreakoutMoved, moved)
+	c.Send(event)
+
+	h.announceJoin(to, c)
+}
+
+// localMember finds a member of the meeting connected to this node, in the
+// main room or any of its breakout rooms
+func (h *Hub) localMember(main *Room, userID string) (*Client, bool) {
+	if c, ok := main.client(userID); ok {
+		return c, true
+	}
+	for _, room := range h.breakoutRooms(main) {
+		if c, ok := room.client(userID); ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// deliverMeeting delivers a message to the local members of the main room
+// and all of its breakout rooms
+func (h *Hub) deliverMeeting(main *Room, msg Message) {
+	h.deliverLocal(main, msg, "", false)
+	for _, room := range h.breakoutRooms(main) {
+		h.deliverLocal(room, msg, "", false)
+	}
+}
+
+// broadcastMeeting delivers a message to everyone in the meeting, whichever
+// room they are in, on every node
+func (h *Hub) broadcastMeeting(main *Room, msg Message) {
+	h.publishBreakout(main, "", msg)
+}
+
+// publishBreakout applies a breakout event here and on every other node
+// holding members of the meeting
+func (h *Hub) publishBreakout(main *Room, targetID string, msg Message) {
+	h.applyBreakout(main, targetID, msg)
+	h.publish(Envelope{
+		RoomID:   main.ID,
+		Kind:     EnvelopeBreakout,
+		TargetID: targetID,
+		Message:  msg,
+	})
+}
+
+// applyBreakout carries out a breakout event for the members of the
+// meeting connected to this node
+func (h *Hub) applyBreakout(main *Room, targetID string, msg Message) {
+	switch msg.Type {
+	case TypeBreakoutsOpened:
+		var breakouts BreakoutsPayload
+		if err := msg.DecodePayload(&breakouts); err != nil {
+			return
+		}
+		main.setBreakouts(&breakouts)
+		if breakouts.EndsAt != nil {
+			h.expireBreakouts(main, breakouts.SessionID, *breakouts.EndsAt)
+		}
+		h.deliverMeeting(main, msg)
+
+		for _, breakout := range breakouts.Rooms {
+			for _, userID := range breakout.Assigned {
+				if c, ok := main.client(userID); ok {
+					h.moveToBreakout(c, main, breakout, true)
+				}
+			}
+		}
+
+	case TypeBreakoutMoved:
+		var moved BreakoutMovedPayload
+		if err := msg.DecodePayload(&moved); err != nil {
+			return
+		}
+		c, ok := h.localMember(main, targetID)
+		if !ok {
+			return
+		}
+		if moved.BreakoutRoom == nil {
+			h.moveClient(c, main, true)
+		} else {
+			h.moveToBreakout(c, main, *moved.BreakoutRoom, true)
+		}
+
+	case TypeBreakoutsClosed:
+		main.setBreakouts(nil)
+		h.deliverMeeting(main, msg)
+
+		for _, room := range h.breakoutRooms(main) {
+			for _, c := range room.members() {
+				h.moveClient(c, main, true)
+			}
+		}
+
+	default:
+		h.deliverMeeting(main, msg)
+	}
+}
+
+// handleBreakoutOpen splits the meeting into breakout rooms and moves the
+// assigned participants into them
+func (h *Hub) handleBreakoutOpen(c *Client, msg Message) {
+	var payload BreakoutOpenPayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		c.SendError(ErrCodeInvalidRequest, "invalid breakoutOpen payload")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+	main := room.main()
+
+	if payload.DurationSeconds < 0 || time.Duration(payload.DurationSeconds)*time.Second > maxBreakoutDuration {
+		c.SendError(ErrCodeInvalidRequest, "durationSeconds is out of range")
+		return
+	}
+
+	plan, problem := h.planBreakouts(main, payload)
+	if problem != "" {
+		c.SendError(ErrCodeInvalidRequest, problem)
+		return
+	}
+
+	session := &models.BreakoutSession{
+		MeetingID:       main.Meeting.ID,
+		Mode:            payload.Mode,
+		AllowReturn:     payload.AllowReturn,
+		StartedByUserID: c.identity.AccountID,
+	}
+	duration := time.Duration(payload.DurationSeconds) * time.Second
+	if duration > 0 {
+		endsAt := time.Now().Add(duration).UTC()
+		session.EndsAt = &endsAt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.services.Breakout.OpenSession(ctx, session, plan); err != nil {
+		if errors.Is(err, services.ErrBreakoutsOpen) {
+			c.SendError(ErrCodeInvalidRequest, "breakout rooms are already open")
+			return
+		}
+		log.Printf("Signaling failed to open breakout rooms in %s: %v", main.ID, err)
+		c.SendError(ErrCodeInvalidRequest, "failed to open breakout rooms")
+		return
+	}
+
+	rooms := make([]*models.BreakoutRoom, 0, len(plan))
+	assignments := make([]*models.BreakoutAssignment, 0)
+	for _, planned := range plan {
+		rooms = append(rooms, planned.Room)
+		assignments = append(assignments, planned.Assignments...)
+	}
+
+	log.Printf("Moderator %s opened %d breakout rooms in %s", c.UserID(), len(rooms), main.ID)
+
+	h.audit(c, models.AuditActionOpenBreakouts, "", models.JSONB{
+		"session_id": session.ID,
+		"mode":       session.Mode,
+		"rooms":      len(rooms),
+	})
+
+	event, _ := NewMessage(TypeBreakoutsOpened, breakoutsPayload(main, session, rooms, assignments))
+	h.publishBreakout(main, "", event)
+}
+
+// planBreakouts lays out the rooms to open and who goes in each, or
+// describes why the request cannot be met
+func (h *Hub) planBreakouts(main *Room, payload BreakoutOpenPayload) ([]*services.BreakoutRoomPlan, string) {
+	count := payload.Count
+	switch payload.Mode {
+	case models.BreakoutModeManual:
+		count = len(payload.Rooms)
+	case models.BreakoutModeAutomatic, models.BreakoutModeSelfSelect:
+		if count == 0 {
+			count = len(payload.Rooms)
+		}
+		if len(payload.Rooms) > count {
+			return nil, "more rooms named than requested"
+		}
+	default:
+		return nil, "mode must be manual, automatic or self_select"
+	}
+	if count < 1 || count > maxBreakoutRooms {
+		return nil, fmt.Sprintf("between 1 and %d breakout rooms may be opened", maxBreakoutRooms)
+	}
+
+	plan := make([]*services.BreakoutRoomPlan, count)
+	for i := range plan {
+		name := fmt.Sprintf("Room %d", i+1)
+		if i < len(payload.Rooms) {
+			if named := strings.TrimSpace(payload.Rooms[i].Name); named != "" {
+				name = named
+			}
+		}
+		if utf8.RuneCountInString(name) > maxBreakoutNameLength {
+			return nil, fmt.Sprintf("breakout room names are limited to %d characters", maxBreakoutNameLength)
+		}
+		plan[i] = &services.BreakoutRoomPlan{Room: &models.BreakoutRoom{Name: name, Position: i}}
+	}
+
+	participants := h.participants(main, "")
+	switch payload.Mode {
+	case models.BreakoutModeManual:
+		present := make(map[string]bool, len(participants))
+		for _, p := range participants {
+			present[p.UserID] = true
+		}
+		placed := make(map[string]bool)
+		for i, spec := range payload.Rooms {
+			for _, userID := range spec.ParticipantIDs {
+				if !present[userID] {
+					return nil, fmt.Sprintf("participant %s is not in the meeting", userID)
+				}
+				if placed[userID] {
+					return nil, fmt.Sprintf("participant %s is placed in more than one room", userID)
+				}
+				placed[userID] = true
+				plan[i].Assignments = append(plan[i].Assignments, breakoutAssignment(userID))
+			}
+		}
+
+	case models.BreakoutModeAutomatic:
+		// Hosts stay in the main room to move between the breakouts
+		rand.Shuffle(len(participants), func(i, j int) {
+			participants[i], participants[j] = participants[j], participants[i]
+		})
+		n := 0
+		for _, p := range participants {
+			if p.Role == models.ParticipantRoleHost || p.Role == models.ParticipantRoleCoHost {
+				continue
+			}
+			plan[n%count].Assignments = append(plan[n%count].Assignments, breakoutAssignment(p.UserID))
+			n++
+		}
+	}
+
+	return plan, ""
+}
+
+func breakoutAssignment(userID string) *models.BreakoutAssignment {
+	return &models.BreakoutAssignment{ParticipantID: userID, UserID: accountOf(userID)}
+}
+
+// handleBreakoutAssign lets a moderator move a participant into a breakout
+// room, or back to the main room
+func (h *Hub) handleBreakoutAssign(c *Client, msg Message) {
+	var payload BreakoutAssignPayload
+	if err := msg.DecodePayload(&payload); err != nil || payload.UserID == "" {
+		c.SendError(ErrCodeInvalidRequest, "userId is required")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+	main := room.main()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	breakouts, ok := h.openSession(ctx, c, main)
+	if !ok {
+		return
+	}
+
+	if target, ok := h.member(main, payload.UserID); !ok || target.Hidden {
+		c.SendError(ErrCodeInvalidRequest, "participant is not in the meeting")
+		return
+	}
+
+	moved := BreakoutMovedPayload{UserID: payload.UserID, RoomID: main.ID}
+	if payload.BreakoutRoomID == 0 {
+		if err := h.services.Breakout.Unassign(ctx, breakouts.SessionID, payload.UserID); err != nil {
+			log.Printf("Signaling failed to unassign %s in %s: %v", payload.UserID, main.ID, err)
+			c.SendError(ErrCodeInvalidRequest, "failed to move participant")
+			return
+		}
+	} else {
+		breakout := breakouts.room(payload.BreakoutRoomID)
+		if breakout == nil {
+			c.SendError(ErrCodeInvalidRequest, "breakout room not found")
+			return
+		}
+		if !h.assignBreakout(ctx, c, breakouts, payload.UserID, breakout) {
+			return
+		}
+		moved.RoomID = breakout.RoomID
+		moved.BreakoutRoom = breakout
+	}
+
+	log.Printf("Moderator %s moved %s to %s", c.UserID(), payload.UserID, moved.RoomID)
+
+	event, _ := NewMessage(TypeBreakoutMoved, moved)
+	h.publishBreakout(main, payload.UserID, event)
+}
+
+// assignBreakout records that a participant belongs in a breakout room,
+// replying with an error when it cannot
+func (h *Hub) assignBreakout(ctx context.Context, c *Client, breakouts *BreakoutsPayload, userID string, breakout *BreakoutRoomPayload) bool {
+	assignment := breakoutAssignment(userID)
+	assignment.SessionID = breakouts.SessionID
+	assignment.BreakoutRoomID = breakout.ID
+
+	err := h.services.Breakout.Assign(ctx, assignment)
+	if errors.Is(err, services.ErrBreakoutNotFound) {
+		c.SendError(ErrCodeInvalidRequest, "breakout room not found")
+		return false
+	}
+	if err != nil {
+		log.Printf("Signaling failed to assign %s to breakout room %d: %v", userID, breakout.ID, err)
+		c.SendError(ErrCodeInvalidRequest, "failed to move participant")
+		return false
+	}
+	return true
+}
+
+// handleBreakoutJoin moves the sender into a breakout room of their
+// choosing. Participants may choose in self-select sessions; moderators
+// always may.
+func (h *Hub) handleBreakoutJoin(c *Client, msg Message) {
+	var payload BreakoutJoinPayload
+	if err := msg.DecodePayload(&payload); err != nil || payload.BreakoutRoomID == 0 {
+		c.SendError(ErrCodeInvalidRequest, "breakoutRoomId is required")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+	main := room.main()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	breakouts, ok := h.openSession(ctx, c, main)
+	if !ok {
+		return
+	}
+
+	if breakouts.Mode != models.BreakoutModeSelfSelect && !c.IsModerator() {
+		c.SendError(ErrCodeForbidden, "hosts assign the breakout rooms in this session")
+		return
+	}
+
+	breakout := breakouts.room(payload.BreakoutRoomID)
+	if breakout == nil {
+		c.SendError(ErrCodeInvalidRequest, "breakout room not found")
+		return
+	}
+	if room.ID == breakout.RoomID {
+		return
+	}
+
+	if !h.assignBreakout(ctx, c, breakouts, c.UserID(), breakout) {
+		return
+	}
+	h.moveToBreakout(c, main, *breakout, true)
+}
+
+// handleBreakoutLeave returns the sender to the main room, when the session
+// allows participants to come back on their own
+func (h *Hub) handleBreakoutLeave(c *Client, msg Message) {
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+	if room.parent == nil {
+		c.SendError(ErrCodeInvalidRequest, "you are not in a breakout room")
+		return
+	}
+	main := room.main()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	breakouts, err := h.loadBreakouts(ctx, main)
+	if err != nil {
+		log.Printf("Signaling failed to load breakout rooms of %s: %v", main.ID, err)
+		c.SendError(ErrCodeInvalidRequest, "failed to load breakout rooms")
+		return
+	}
+
+	if breakouts != nil {
+		if !c.IsModerator() && !breakouts.AllowReturn && breakouts.Mode != models.BreakoutModeSelfSelect {
+			c.SendError(ErrCodeForbidden, "hosts will bring you back to the main room")
+			return
+		}
+		if err := h.services.Breakout.Unassign(ctx, breakouts.SessionID, c.UserID()); err != nil {
+			log.Printf("Signaling failed to unassign %s in %s: %v", c.UserID(), main.ID, err)
+			c.SendError(ErrCodeInvalidRequest, "failed to leave breakout room")
+			return
+		}
+	}
+
+	h.moveClient(c, main, true)
+}
+
+// handleBreakoutBroadcast relays a host's message to every room of the
+// meeting
+func (h *Hub) handleBreakoutBroadcast(c *Client, msg Message) {
+	var payload BreakoutMessagePayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		c.SendError(ErrCodeInvalidRequest, "invalid breakoutBroadcast payload")
+		return
+	}
+	text, ok := validChatText(c, payload.Message)
+	if !ok {
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+	main := room.main()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, ok := h.openSession(ctx, c, main); !ok {
+		return
+	}
+
+	event, _ := NewMessage(TypeBreakoutMessage, BreakoutMessagePayload{
+		UserID:   c.UserID(),
+		UserName: c.identity.UserName,
+		Message:  text,
+	})
+	h.broadcastMeeting(main, event)
+}
+
+func (h *Hub) handleBreakoutClose(c *Client, msg Message) {
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+	main := room.main()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	breakouts, ok := h.openSession(ctx, c, main)
+	if !ok {
+		return
+	}
+
+	h.closeBreakouts(main, breakouts.SessionID, BreakoutsClosedByHost, c)
+}
+
+// closeBreakouts closes the session and recalls everyone to the main room.
+// Only the caller that actually closes it announces the recall, so a host
+// and an expiring timer never both do.
+func (h *Hub) closeBreakouts(main *Room, sessionID int, reason string, closedBy *Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	closed, err := h.services.Breakout.CloseSession(ctx, sessionID)
+	if err != nil {
+		log.Printf("Signaling failed to close breakout session %d: %v", sessionID, err)
+		if closedBy != nil {
+			closedBy.SendError(ErrCodeInvalidRequest, "failed to close breakout rooms")
+		}
+		return
+	}
+	if !closed {
+		return
+	}
+
+	payload := BreakoutsClosedPayload{Reason: reason}
+	if closedBy != nil {
+		payload.ClosedBy = closedBy.UserID()
+		h.audit(closedBy, models.AuditActionCloseBreakouts, "", models.JSONB{"session_id": sessionID})
+	}
+
+	log.Printf("Closed breakout session %d in %s (%s)", sessionID, main.ID, reason)
+
+	event, _ := NewMessage(TypeBreakoutsClosed, payload)
+	h.publishBreakout(main, "", event)
+}
+
+// handleGetBreakouts replies with the open session, who is assigned to each
+// room and who is in it now
+func (h *Hub) handleGetBreakouts(c *Client, msg Message) {
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+	main := room.main()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	breakouts, ok := h.openSession(ctx, c, main)
+	if !ok {
+		return
+	}
+
+	// The loaded session is shared with the room, so fill in a copy
+	reply := *breakouts
+	reply.Rooms = append([]BreakoutRoomPayload(nil), breakouts.Rooms...)
+	for i := range reply.Rooms {
+		breakout := &reply.Rooms[i]
+		members, err := h.backplane.ListPresence(ctx, breakout.RoomID)
+		if err != nil {
+			log.Printf("Signaling failed to list presence for %s: %v", breakout.RoomID, err)
+			continue
+		}
+		breakout.Participants = make([]Participant, 0, len(members))
+		for _, p := range members {
+			if !p.Hidden {
+				breakout.Participants = append(breakout.Participants, p.participant())
+			}
+		}
+	}
+
+	state, _ := NewMessage(TypeBreakouts, reply)
+	c.Send(state)
+}
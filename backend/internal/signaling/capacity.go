@@ -0,0 +1,79 @@
+package signaling
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// clientFeatures loads the tenant's feature settings, or nil if they are unavailable
+func (h *Hub) clientFeatures(ctx context.Context, clientID int) *models.ClientFeatures {
+	features, err := h.services.Client.GetClientFeatures(ctx, clientID)
+	if err != nil {
+		log.Printf("Signaling could not load features for client %d: %v", clientID, err)
+		return nil
+	}
+	return features
+}
+
+// capacity returns the seat limit for the meeting's room
+func (h *Hub) capacity(meeting *models.Meeting, features *models.ClientFeatures) Capacity {
+	return Capacity{
+		Limit:        meeting.ParticipantLimit(features),
+		HostReserved: models.HostReservedSlots,
+	}
+}
+
+// claimSeat takes a seat in the room for the client across all nodes
+func (h *Hub) claimSeat(ctx context.Context, c *Client, room *Room, capacity Capacity) (bool, error) {
+	return h.backplane.ClaimSlot(ctx, room.ID, h.presenceOf(c), h.config.PresenceTTL, capacity)
+}
+
+// refuseFull turns the client away from a full room, listing the overflow
+// options it may retry with
+func (h *Hub) refuseFull(c *Client, room *Room, limit int) {
+	log.Printf("User %s refused from room %s: room is full (limit %d)", c.UserID(), room.ID, limit)
+
+	c.resetRoom()
+	h.removeIfEmpty(room)
+
+	msg, _ := NewMessage(TypeError, RoomFullPayload{
+		Code:     ErrCodeRoomFull,
+		Message:  "the meeting is full",
+		Limit:    limit,
+		Overflow: []string{OverflowLobby, OverflowViewOnly},
+	})
+	c.Send(msg)
+}
+
+// queueForSeat keeps an admitted knocker in the lobby until a seat frees up
+func (h *Hub) queueForSeat(c *Client, room *Room) {
+	c.mutex.Lock()
+	alreadyQueued := c.queued
+	c.queued = true
+	if !alreadyQueued {
+		c.queuedAt = time.Now()
+	}
+	c.mutex.Unlock()
+
+	if alreadyQueued {
+		return
+	}
+
+	log.Printf("User %s is queued for a seat in room %s", c.UserID(), room.ID)
+
+	waiting, _ := NewMessage(TypeLobbyWaiting, LobbyWaitingPayload{RoomID: room.ID, Reason: LobbyReasonRoomFull})
+	c.Send(waiting)
+}
+
+// seatQueued admits knockers queued on this node, oldest first, for as long
+// as seats are free
+func (h *Hub) seatQueued(room *Room) {
+	for _, c := range room.queuedMembers() {
+		if !h.admitFromLobby(room, c) {
+			return
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package signaling
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+)
+
+const (
+	// maxChatMessageLength caps a chat message, in characters
+	maxChatMessageLength = 4000
+	// chatHistoryLimit is how many recent messages a joiner receives
+	chatHistoryLimit = 50
+)
+
+func (h *Hub) chatOnly(next messageHandler) messageHandler {
+	return func(c *Client, msg Message) {
+		if !c.ChatEnabled() {
+			c.SendError(ErrCodeChatDisabled, "chat is disabled for this meeting")
+			return
+		}
+		next(c, msg)
+	}
+}
+
+// chatMessagePayload converts a stored message for the wire, with signed
+// links to its attachments
+func (h *Hub) chatMessagePayload(message *models.ChatMessage) ChatMessagePayload {
+	payload := ChatMessagePayload{
+		ID:          message.ID,
+		SenderName:  message.SenderName,
+		Message:     message.Message,
+		MessageType: message.MessageType,
+		ReplyToID:   message.ReplyToID,
+		SenderID:    message.SenderWireID(),
+		Private:     message.IsPrivate,
+		ToHosts:     message.ToHosts(),
+		CreatedAt:   message.CreatedAt,
+		UpdatedAt:   message.UpdatedAt,
+	}
+	if message.RecipientID != nil {
+		payload.RecipientID = *message.RecipientID
+	}
+	payload.Edited = message.Edited()
+
+	for _, attachment := range h.services.Chat.AttachmentLinks(message) {
+		payload.Attachments = append(payload.Attachments, ChatAttachmentPayload{
+			ID:           attachment.ID,
+			Name:         attachment.Name,
+			ContentType:  attachment.ContentType,
+			Size:         attachment.Size,
+			Width:        attachment.Width,
+			Height:       attachment.Height,
+			URL:          attachment.URL,
+			ThumbnailURL: attachment.ThumbnailURL,
+			ExpiresAt:    attachment.ExpiresAt,
+		})
+	}
+	return payload
+}
+
+// chatViewer returns the client as a reader of its meeting's chat
+func chatViewer(c *Client) *services.ChatViewer {
+	viewer := &services.ChatViewer{
+		UserID:    c.identity.AccountID,
+		WireID:    c.UserID(),
+		Moderator: c.IsModerator(),
+	}
+	if breakout := c.BreakoutRoom(); breakout != nil {
+		viewer.BreakoutRoomID = &breakout.ID
+	}
+	return viewer
+}
+
+// accountOf returns the users.id behind a signaling ID, or nil for guests
+func accountOf(wireID string) *int {
+	id, err := strconv.Atoi(wireID)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+// validChatText trims a message, reporting whether what is left may be posted
+func validChatText(c *Client, text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		c.SendError(ErrCodeInvalidRequest, "message is required")
+		return "", false
+	}
+	if utf8.RuneCountInString(text) > maxChatMessageLength {
+		c.SendError(ErrCodeInvalidRequest, "message is too long")
+		return "", false
+	}
+	return text, true
+}
+
+// chatMessage loads a message of the client's meeting, replying with an
+// error when it cannot
+func (h *Hub) chatMessage(ctx context.Context, c *Client, messageID int) (*models.ChatMessage, bool) {
+	if messageID <= 0 {
+		c.SendError(ErrCodeInvalidRequest, "messageId is required")
+		return nil, false
+	}
+
+	message, err := h.services.Chat.GetMessageByID(ctx, messageID)
+	if err != nil || message.MeetingID != c.Meeting().ID || message.IsModerated || !chatViewer(c).CanRead(message) {
+		c.SendError(ErrCodeInvalidRequest, "message not found")
+		return nil, false
+	}
+	return message, true
+}
+
+func (h *Hub) handleChatSend(c *Client, msg Message) {
+	var payload ChatSendPayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		c.SendError(ErrCodeInvalidRequest, "invalid chatSend payload")
+		return
+	}
+
+	text, ok := validChatText(c, payload.Message)
+	if !ok {
+		return
+	}
+
+	switch payload.MessageType {
+	case "":
+		payload.MessageType = "text"
+	case "text", "emoji":
+	default:
+		c.SendError(ErrCodeInvalidRequest, "unsupported message type")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if payload.ReplyToID != nil {
+		if _, ok := h.chatMessage(ctx, c, *payload.ReplyToID); !ok {
+			return
+		}
+	}
+
+	private := payload.ToHosts || payload.RecipientID != ""
+	if payload.RecipientID != "" {
+		recipient, ok := h.member(room, payload.RecipientID)
+		if !ok || recipient.Hidden || recipient.UserID == c.UserID() {
+			c.SendError(ErrCodeInvalidRequest, "recipient is not in the meeting")
+			return
+		}
+	}
+
+	meeting := c.Meeting()
+	message := &models.ChatMessage{
+		ClientID:    meeting.ClientID,
+		MeetingID:   meeting.ID,
+		SenderID:    c.identity.AccountID,
+		SenderName:  c.identity.UserName,
+		Message:     text,
+		MessageType: payload.MessageType,
+		ReplyToID:   payload.ReplyToID,
+		Metadata:    models.JSONB{models.ChatMetaSenderID: c.UserID()},
+		IsPrivate:   private,
+	}
+	if breakout := c.BreakoutRoom(); breakout != nil {
+		message.BreakoutRoomID = &breakout.ID
+	}
+	if c.identity.Email != "" {
+		message.SenderEmail = &c.identity.Email
+	}
+	if payload.RecipientID != "" {
+		message.RecipientID = &payload.RecipientID
+		message.RecipientUserID = accountOf(payload.RecipientID)
+	}
+
+	if err := h.services.Chat.SendMessage(ctx, message); err != nil {
+		var limited *services.RateLimitError
+		if errors.As(err, &limited) {
+			c.SendError(ErrCodeChatRateLimit, limited.Error())
+			return
+		}
+		log.Printf("Signaling failed to store chat message from %s in meeting %d: %v", c.UserID(), meeting.ID, err)
+		c.SendError(ErrCodeInvalidRequest, "failed to send message")
+		return
+	}
+
+	event := h.chatMessagePayload(message)
+	event.ClientMessageID = payload.ClientMessageID
+	h.publishChat(room, message, event)
+	if message.IsModerated {
+		c.SendError(ErrCodeChatHeld, "your message is held for review by the hosts")
+	}
+}
+
+func (h *Hub) handleChatEdit(c *Client, msg Message) {
+	var payload ChatEditPayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		c.SendError(ErrCodeInvalidRequest, "invalid chatEdit payload")
+		return
+	}
+
+	text, ok := validChatText(c, payload.Message)
+	if !ok {
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	message, ok := h.chatMessage(ctx, c, payload.MessageID)
+	if !ok {
+		return
+	}
+	if message.SenderWireID() != c.UserID() {
+		c.SendError(ErrCodeForbidden, "you can only edit your own messages")
+		return
+	}
+
+	if message.Metadata == nil {
+		message.Metadata = models.JSONB{}
+	}
+	message.Metadata[models.ChatMetaEdited] = true
+	message.Message = text
+	message.UpdatedAt = time.Now()
+
+	if err := h.services.Chat.UpdateMessage(ctx, message); err != nil {
+		log.Printf("Signaling failed to edit chat message %d by %s: %v", message.ID, c.UserID(), err)
+		c.SendError(ErrCodeInvalidRequest, "failed to edit message")
+		return
+	}
+
+	if message.IsModerated {
+		// The edit broke the moderation policy: readers lose the message
+		// and the hosts get it to review
+		removed, _ := NewMessage(TypeChatDeleted, ChatDeletedPayload{MessageID: message.ID})
+		h.deliverChat(room, message, removed)
+		h.publishChat(room, message, h.chatMessagePayload(message))
+		c.SendError(ErrCodeChatHeld, "your message is held for review by the hosts")
+		return
+	}
+
+	reply, _ := NewMessage(TypeChatEdited, h.chatMessagePayload(message))
+	h.deliverChat(room, message, reply)
+}
+
+// handleChatDelete removes a message. Senders delete their own messages;
+// moderators hide anyone's, which keeps them for the moderation log.
+func (h *Hub) handleChatDelete(c *Client, msg Message) {
+	var payload ChatMessageRefPayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		c.SendError(ErrCodeInvalidRequest, "invalid chatDelete payload")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	message, ok := h.chatMessage(ctx, c, payload.MessageID)
+	if !ok {
+		return
+	}
+
+	accountID := c.identity.AccountID
+	var err error
+	switch {
+	case accountID == nil:
+		c.SendError(ErrCodeForbidden, "guests cannot delete messages")
+		return
+	case message.SenderWireID() == c.UserID():
+		err = h.services.Chat.DeleteMessage(ctx, message.ID, *accountID)
+	case c.IsModerator():
+		err = h.services.Chat.ModerateMessage(ctx, message.ID, *accountID)
+		if err == nil {
+			h.audit(c, models.AuditActionDeleteMessage, message.SenderWireID(), models.JSONB{"message_id": message.ID})
+		}
+	default:
+		c.SendError(ErrCodeForbidden, "you can only delete your own messages")
+		return
+	}
+	if err != nil {
+		log.Printf("Signaling failed to delete chat message %d by %s: %v", message.ID, c.UserID(), err)
+		c.SendError(ErrCodeInvalidRequest, "failed to delete message")
+		return
+	}
+
+	reply, _ := NewMessage(TypeChatDeleted, ChatDeletedPayload{MessageID: message.ID, DeletedBy: c.UserID()})
+	h.deliverChat(room, message, reply)
+}
+
+// deliverChat sends an event about a message to everyone who may read it.
+// Private messages reach their sender and recipient, or the sender and the
+// moderators for messages to the hosts.
+func (h *Hub) deliverChat(room *Room, message *models.ChatMessage, msg Message) {
+	if !message.IsPrivate {
+		h.broadcast(room, msg, "")
+		return
+	}
+
+	sender := message.SenderWireID()
+	if message.ToHosts() {
+		h.broadcastModerators(room, msg)
+		if p, ok := h.member(room, sender); ok && !p.isModerator() {
+			h.sendTo(room, sender, msg)
+		}
+		return
+	}
+
+	h.sendTo(room, sender, msg)
+	h.sendTo(room, *message.RecipientID, msg)
+}
+
+// PublishChatMessage delivers a message stored outside the socket, such as
+// through the REST API, to its readers in the meeting's room on any node.
+// Messages hidden by moderation reach the moderators only.
+func (h *Hub) PublishChatMessage(meeting *models.Meeting, message *models.ChatMessage) {
+	h.publishChat(h.chatRoom(meeting, message), message, h.chatMessagePayload(message))
+}
+
+// PublishChatDeleted tells the readers of a message removed outside the
+// socket that it is gone
+func (h *Hub) PublishChatDeleted(meeting *models.Meeting, message *models.ChatMessage, deletedBy string) {
+	msg, _ := NewMessage(TypeChatDeleted, ChatDeletedPayload{MessageID: message.ID, DeletedBy: deletedBy})
+	h.deliverChat(h.chatRoom(meeting, message), message, msg)
+}
+
+// chatRoom returns the room whose chat holds the message: the meeting's
+// main room or one of its breakout rooms
+func (h *Hub) chatRoom(meeting *models.Meeting, message *models.ChatMessage) *Room {
+	roomID := meeting.MeetingID
+	if message.BreakoutRoomID != nil {
+		roomID = breakoutRoomKey(meeting.MeetingID, *message.BreakoutRoomID)
+	}
+
+	room, ok := h.room(roomID)
+	if !ok {
+		// Nobody is connected here; an empty room still reaches other nodes
+		room = newRoom(roomID, meeting)
+	}
+	return room
+}
+
+// publishChat delivers a new message to its readers. A message the
+// moderation policy hid goes to the moderators for review instead, unless
+// it is addressed to one participant, which moderators may not read.
+func (h *Hub) publishChat(room *Room, message *models.ChatMessage, event ChatMessagePayload) {
+	if !message.IsModerated {
+		msg, _ := NewMessage(TypeChatMessage, event)
+		h.deliverChat(room, message, msg)
+		return
+	}
+	if message.IsPrivate && !message.ToHosts() {
+		return
+	}
+
+	event.HeldReason = message.ModerationReason()
+	msg, _ := NewMessage(TypeChatHeld, event)
+	h.broadcastModerators(room, msg)
+}
+
+func (h *Hub) handleChatTyping(c *Client, msg Message) {
+	var payload ChatTypingPayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		c.SendError(ErrCodeInvalidRequest, "invalid chatTyping payload")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		return
+	}
+
+	relayed, _ := NewMessage(TypeChatTyping, ChatTypingPayload{
+		UserID:   c.UserID(),
+		UserName: c.identity.UserName,
+		Typing:   payload.Typing,
+	})
+	h.broadcast(room, relayed, c.UserID())
+}
+
+func (h *Hub) handleChatRead(c *Client, msg Message) {
+	var payload ChatReadPayload
+	if err := msg.DecodePayload(&payload); err != nil || payload.MessageID <= 0 {
+		c.SendError(ErrCodeInvalidRequest, "messageId is required")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		return
+	}
+
+	relayed, _ := NewMessage(TypeChatRead, ChatReadPayload{
+		UserID:    c.UserID(),
+		MessageID: payload.MessageID,
+	})
+	h.broadcast(room, relayed, c.UserID())
+}
+
+// sendChatHistory sends the meeting's recent messages to a joiner
+func (h *Hub) sendChatHistory(c *Client) {
+	meeting := c.Meeting()
+	if meeting == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	messages, err := h.services.Chat.GetRecentMessages(ctx, meeting.ID, chatViewer(c), chatHistoryLimit)
+	if err != nil {
+		log.Printf("Signaling failed to load chat history of meeting %d: %v", meeting.ID, err)
+		return
+	}
+
+	history := ChatHistoryPayload{Messages: make([]ChatMessagePayload, 0, len(messages))}
+	for _, message := range messages {
+		history.Messages = append(history.Messages, h.chatMessagePayload(message))
+	}
+	reply, _ := NewMessage(TypeChatHistory, history)
+	c.Send(reply)
+}
@@ -0,0 +1,343 @@
+package signaling
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"video-conference-backend/internal/models"
+)
+
+// Client is a single signaling connection
+type Client struct {
+	hub      *Hub
+	conn     *websocket.Conn
+	send     chan []byte
+	identity *Identity
+
+	// Set once the client has joined a room
+	mutex    sync.RWMutex
+	roomID   string
+	meeting  *models.Meeting
+	role     string
+	waiting  bool      // parked in the room's lobby
+	queued   bool      // admitted, but waiting in the lobby for a free seat
+	queuedAt time.Time // when the client started waiting for a seat
+	viewOnly bool      // joined without a seat
+	hidden   bool      // server-side peer, never announced to the room
+	chat     bool      // chat is enabled for the joined meeting
+
+	reactions    bool        // reactions are enabled for the joined meeting
+	raiseHand    bool        // raising hands is enabled for the joined meeting
+	handRaisedAt *time.Time  // set while the client's hand is raised
+	reactionsAt  []time.Time // recent reactions, for rate limiting
+
+	breakout *models.BreakoutRoom // the breakout room the client is in, if any
+
+	screenShare  bool       // screen sharing is enabled for the joined meeting
+	screenStream string     // the stream carrying the client's screen share
+	sharingSince *time.Time // set while the client shares its screen
+
+	lastActivity atomic.Int64
+	closeOnce    sync.Once
+	done         chan struct{}
+}
+
+func newClient(hub *Hub, conn *websocket.Conn, identity *Identity) *Client {
+	c := &Client{
+		hub:      hub,
+		conn:     conn,
+		send:     make(chan []byte, hub.config.SendBufferSize),
+		identity: identity,
+		done:     make(chan struct{}),
+	}
+	c.touch()
+	return c
+}
+
+// UserID returns the wire identifier of the client
+func (c *Client) UserID() string {
+	return c.identity.UserID
+}
+
+// Identity returns the authenticated identity of the client
+func (c *Client) Identity() *Identity {
+	return c.identity
+}
+
+// RoomID returns the room the client has joined, or "" if none
+func (c *Client) RoomID() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.roomID
+}
+
+// Meeting returns the meeting behind the joined room, or nil if none
+func (c *Client) Meeting() *models.Meeting {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.meeting
+}
+
+// Role returns the participant role held in the joined meeting
+func (c *Client) Role() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.role
+}
+
+// Waiting reports whether the client is in the lobby waiting to be admitted
+func (c *Client) Waiting() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.waiting
+}
+
+// ViewOnly reports whether the client joined without a seat
+func (c *Client) ViewOnly() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viewOnly
+}
+
+// Hidden reports whether the client is a server-side peer kept out of
+// participant lists
+func (c *Client) Hidden() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.hidden
+}
+
+// ChatEnabled reports whether the client may use chat in the joined meeting
+func (c *Client) ChatEnabled() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.chat
+}
+
+// ReactionsEnabled reports whether the client may send reactions in the
+// joined meeting
+func (c *Client) ReactionsEnabled() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.reactions
+}
+
+// RaiseHandEnabled reports whether the client may raise its hand in the
+// joined meeting
+func (c *Client) RaiseHandEnabled() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.raiseHand
+}
+
+// HandRaisedAt returns when the client raised its hand, or nil if it is down
+func (c *Client) HandRaisedAt() *time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.handRaisedAt
+}
+
+// BreakoutRoom returns the breakout room the client is in, or nil in the
+// main room
+func (c *Client) BreakoutRoom() *models.BreakoutRoom {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.breakout
+}
+
+// ScreenShareEnabled reports whether screen sharing is enabled for the
+// joined meeting
+func (c *Client) ScreenShareEnabled() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.screenShare
+}
+
+// SharingSince returns when the client started sharing its screen, or nil
+// if it is not sharing
+func (c *Client) SharingSince() *time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.sharingSince
+}
+
+// CanPresent reports whether the client's role lets it share its screen
+func (c *Client) CanPresent() bool {
+	return c.IsModerator() || c.Role() == models.ParticipantRolePresenter
+}
+
+// resetRoom forgets the room the client tried to join
+func (c *Client) resetRoom() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.roomID = ""
+	c.meeting = nil
+	c.role = ""
+	c.waiting = false
+	c.queued = false
+	c.viewOnly = false
+	c.chat = false
+	c.reactions = false
+	c.raiseHand = false
+	c.handRaisedAt = nil
+	c.reactionsAt = nil
+	c.breakout = nil
+	c.screenShare = false
+	c.screenStream = ""
+	c.sharingSince = nil
+}
+
+// IsModerator reports whether the client may moderate its room
+func (c *Client) IsModerator() bool {
+	role := c.Role()
+	return role == models.ParticipantRoleHost || role == models.ParticipantRoleCoHost
+}
+
+func (c *Client) participant() Participant {
+	return Participant{
+		UserID:       c.identity.UserID,
+		UserName:     c.identity.UserName,
+		Role:         c.Role(),
+		ViewOnly:     c.ViewOnly(),
+		HandRaisedAt: c.HandRaisedAt(),
+	}
+}
+
+func (c *Client) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (c *Client) idleFor() time.Duration {
+	return time.Since(time.Unix(0, c.lastActivity.Load()))
+}
+
+// Send queues a message for the client. A client that cannot keep up with its
+// send buffer is disconnected rather than allowed to stall the room.
+func (c *Client) Send(msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Signaling failed to encode %s for %s: %v", msg.Type, c.identity.UserID, err)
+		return
+	}
+	c.sendRaw(data)
+}
+
+func (c *Client) sendRaw(data []byte) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	select {
+	case c.send <- data:
+	default:
+		log.Printf("Signaling client %s send buffer full, disconnecting", c.identity.UserID)
+		c.close()
+	}
+}
+
+// SendError notifies the client that a request was refused
+func (c *Client) SendError(code, message string) {
+	msg, _ := NewMessage(TypeError, ErrorPayload{Code: code, Message: message})
+	c.Send(msg)
+}
+
+// close stops the write pump; the read pump exits once the connection is closed
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister(c)
+		c.close()
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(c.hub.config.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongWait))
+		return nil
+	})
+
+	for {
+		var msg Message
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Signaling read error for %s: %v", c.identity.UserID, err)
+			}
+			return
+		}
+
+		c.touch()
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongWait))
+		c.hub.dispatch(c, msg)
+	}
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(c.hub.config.PingPeriod)
+	// The join deadline runs from connecting, whatever else the client sends
+	joinDeadline := time.NewTimer(c.hub.config.JoinTimeout)
+	defer func() {
+		ticker.Stop()
+		joinDeadline.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Printf("Signaling write error for %s: %v", c.identity.UserID, err)
+				return
+			}
+
+		case <-joinDeadline.C:
+			if c.RoomID() == "" {
+				c.writeClose(websocket.ClosePolicyViolation, "join timeout")
+				return
+			}
+
+		case <-ticker.C:
+			if c.hub.config.IdleTimeout > 0 && c.idleFor() > c.hub.config.IdleTimeout {
+				c.writeClose(websocket.CloseNormalClosure, "idle timeout")
+				return
+			}
+
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+
+		case <-c.done:
+			// Flush anything already queued before closing
+			for {
+				select {
+				case data := <-c.send:
+					c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait))
+					if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+						return
+					}
+				default:
+					c.writeClose(websocket.CloseGoingAway, "")
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *Client) writeClose(code int, reason string) {
+	deadline := time.Now().Add(c.hub.config.WriteWait)
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
@@ -0,0 +1,897 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/utils"
+)
+
+// Config holds the signaling hub tunables
+type Config struct {
+	// AllowedOrigins restricts browser origins; empty allows any origin
+	AllowedOrigins []string
+	// SendBufferSize is the number of queued frames per client before it is dropped
+	SendBufferSize int
+	// MaxMessageSize is the largest inbound frame accepted, in bytes
+	MaxMessageSize int64
+	// WriteWait bounds a single frame write
+	WriteWait time.Duration
+	// PongWait is how long a connection may stay silent before it is considered dead
+	PongWait time.Duration
+	// PingPeriod is how often the server pings; must be less than PongWait
+	PingPeriod time.Duration
+	// JoinTimeout is how long a connection may stay open without joining a room
+	JoinTimeout time.Duration
+	// IdleTimeout closes connections that send no messages; zero disables it
+	IdleTimeout time.Duration
+	// NodeID identifies this instance on the backplane; generated when empty
+	NodeID string
+	// PresenceTTL is how long a member survives without its node refreshing it
+	PresenceTTL time.Duration
+	// Reactions enables emoji reactions on this deployment
+	Reactions bool
+	// ReactionLimit is how many reactions a client may send per ReactionWindow
+	ReactionLimit  int
+	ReactionWindow time.Duration
+	// EngagementFlushInterval is how often buffered reactions and hand
+	// events are written to the meeting analytics
+	EngagementFlushInterval time.Duration
+	// BreakoutRooms lets hosts split meetings into breakout rooms
+	BreakoutRooms bool
+	// ScreenSharing enables screen sharing on this deployment
+	ScreenSharing bool
+	// MaxScreenShares is how many members of a room may share at once
+	MaxScreenShares int
+	// MeshLimit is how many participants a room in automatic media mode
+	// holds before its media moves to the SFU
+	MeshLimit int
+}
+
+// DefaultConfig returns the default signaling configuration
+func DefaultConfig() Config {
+	return Config{
+		SendBufferSize: 256,
+		MaxMessageSize: 64 * 1024,
+		WriteWait:      10 * time.Second,
+		PongWait:       60 * time.Second,
+		PingPeriod:     54 * time.Second,
+		JoinTimeout:    30 * time.Second,
+		IdleTimeout:    30 * time.Minute,
+		PresenceTTL:    30 * time.Second,
+		Reactions:      true,
+		ReactionLimit:  10,
+		ReactionWindow: 10 * time.Second,
+
+		ScreenSharing:   true,
+		MaxScreenShares: 1,
+		MeshLimit:       4,
+
+		EngagementFlushInterval: 5 * time.Second,
+	}
+}
+
+type messageHandler func(c *Client, msg Message)
+
+// Hub owns all signaling connections and rooms for one server instance
+type Hub struct {
+	config    Config
+	services  *services.Services
+	backplane Backplane
+	upgrader  websocket.Upgrader
+	handlers  map[string]messageHandler
+
+	rooms   map[string]*Room
+	clients map[*Client]struct{}
+	closing bool
+	mutex   sync.RWMutex
+	wg      sync.WaitGroup
+	stop    chan struct{}
+
+	engagement      []*models.MeetingEngagementEvent
+	engagementMutex sync.Mutex
+
+	media MediaServer
+
+	unsubscribeSessions func()
+}
+
+// NewHub creates a new signaling hub. Rooms are shared with other hubs
+// attached to the same backplane.
+func NewHub(cfg Config, svc *services.Services, backplane Backplane) *Hub {
+	if cfg.NodeID == "" {
+		cfg.NodeID = uuid.New().String()
+	}
+
+	h := &Hub{
+		config:    cfg,
+		services:  svc,
+		backplane: backplane,
+		rooms:     make(map[string]*Room),
+		clients:   make(map[*Client]struct{}),
+		stop:      make(chan struct{}),
+	}
+
+	h.upgrader = websocket.Upgrader{
+		CheckOrigin: h.checkOrigin,
+	}
+
+	h.handlers = map[string]messageHandler{
+		TypeJoin:            h.handleJoin,
+		TypeGetParticipants: h.inRoom(h.handleGetParticipants),
+		TypeOffer:           h.inRoom(h.handleRelay),
+		TypeAnswer:          h.inRoom(h.handleRelay),
+		TypeICECandidate:    h.inRoom(h.handleRelay),
+		TypeSelectLayer:     h.inRoom(h.handleSelectLayer),
+		TypePing:            h.handlePing,
+		TypeGetICEServers:   h.inRoom(h.handleGetICEServers),
+		TypeGetLobby:        h.inRoom(h.moderatorOnly(h.handleGetLobby)),
+		TypeLobbyAdmit:      h.inRoom(h.moderatorOnly(h.handleLobbyAdmit)),
+		TypeLobbyDeny:       h.inRoom(h.moderatorOnly(h.handleLobbyDeny)),
+
+		TypeMuteParticipant:   h.inRoom(h.moderatorOnly(h.handleMuteParticipant)),
+		TypeDisableCamera:     h.inRoom(h.moderatorOnly(h.handleDisableCamera)),
+		TypeRemoveParticipant: h.inRoom(h.moderatorOnly(h.handleRemoveParticipant)),
+		TypeLockMeeting:       h.inRoom(h.moderatorOnly(h.handleLockMeeting)),
+		TypeEndMeeting:        h.inRoom(h.moderatorOnly(h.handleEndMeeting)),
+
+		TypeChatSend:   h.inRoom(h.chatOnly(h.handleChatSend)),
+		TypeChatEdit:   h.inRoom(h.chatOnly(h.handleChatEdit)),
+		TypeChatDelete: h.inRoom(h.chatOnly(h.handleChatDelete)),
+		TypeChatTyping: h.inRoom(h.chatOnly(h.handleChatTyping)),
+		TypeChatRead:   h.inRoom(h.chatOnly(h.handleChatRead)),
+
+		TypeReaction:   h.inRoom(h.reactionsOnly(h.handleReaction)),
+		TypeRaiseHand:  h.inRoom(h.raiseHandOnly(h.handleRaiseHand)),
+		TypeLowerHand:  h.inRoom(h.raiseHandOnly(h.handleLowerHand)),
+		TypeGetHands:   h.inRoom(h.raiseHandOnly(h.moderatorOnly(h.handleGetHands))),
+		TypeClearHands: h.inRoom(h.raiseHandOnly(h.moderatorOnly(h.handleClearHands))),
+
+		TypeBreakoutOpen:      h.inRoom(h.breakoutsOnly(h.moderatorOnly(h.handleBreakoutOpen))),
+		TypeBreakoutAssign:    h.inRoom(h.breakoutsOnly(h.moderatorOnly(h.handleBreakoutAssign))),
+		TypeBreakoutBroadcast: h.inRoom(h.breakoutsOnly(h.moderatorOnly(h.handleBreakoutBroadcast))),
+		TypeBreakoutClose:     h.inRoom(h.breakoutsOnly(h.moderatorOnly(h.handleBreakoutClose))),
+		TypeBreakoutJoin:      h.inRoom(h.breakoutsOnly(h.handleBreakoutJoin)),
+		TypeBreakoutLeave:     h.inRoom(h.breakoutsOnly(h.handleBreakoutLeave)),
+		TypeGetBreakouts:      h.inRoom(h.breakoutsOnly(h.handleGetBreakouts)),
+
+		TypeScreenShareStart: h.inRoom(h.screenShareOnly(h.handleScreenShareStart)),
+		TypeScreenShareStop:  h.inRoom(h.screenShareOnly(h.handleScreenShareStop)),
+		TypeGetScreenShares:  h.inRoom(h.screenShareOnly(h.handleGetScreenShares)),
+		TypeGrantPresenter:   h.inRoom(h.moderatorOnly(h.handleGrantPresenter)),
+		TypeRevokePresenter:  h.inRoom(h.moderatorOnly(h.handleRevokePresenter)),
+	}
+
+	h.subscribeSessions()
+	go h.maintainPresence()
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.flushEngagement()
+	}()
+
+	return h
+}
+
+// ServeHTTP authenticates and upgrades a signaling connection. The caller must
+// present either an access token (Authorization header or ?token=) or an
+// invitation token (?invitation=).
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.RLock()
+	closing := h.closing
+	h.mutex.RUnlock()
+	if closing {
+		utils.WriteError(w, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
+
+	identity, err := h.authenticate(r)
+	if err != nil {
+		log.Printf("Signaling authentication failed from %s: %v", r.RemoteAddr, err)
+		utils.WriteError(w, http.StatusUnauthorized, "Authentication required: "+err.Error())
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Signaling upgrade failed: %v", err)
+		return
+	}
+
+	client := newClient(h, conn, identity)
+
+	h.mutex.Lock()
+	if h.closing {
+		h.mutex.Unlock()
+		conn.Close()
+		return
+	}
+	h.clients[client] = struct{}{}
+	h.wg.Add(2)
+	h.mutex.Unlock()
+
+	log.Printf("Signaling connection established for %s", identity.UserID)
+
+	go func() {
+		defer h.wg.Done()
+		client.writePump()
+	}()
+	go func() {
+		defer h.wg.Done()
+		client.readPump()
+	}()
+}
+
+// Shutdown disconnects every client and waits for their pumps to exit.
+// New connections are refused once shutdown has started.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mutex.Lock()
+	if !h.closing {
+		close(h.stop)
+	}
+	h.closing = true
+	unsubscribe := h.unsubscribeSessions
+	h.unsubscribeSessions = nil
+	clients := make([]*Client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mutex.Unlock()
+
+	if unsubscribe != nil {
+		unsubscribe()
+	}
+
+	log.Printf("Signaling hub shutting down (%d connections)", len(clients))
+	for _, c := range clients {
+		c.close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(h.config.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, allowed := range h.config.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch routes an inbound message to its handler
+func (h *Hub) dispatch(c *Client, msg Message) {
+	handler, ok := h.handlers[msg.Type]
+	if !ok {
+		log.Printf("Signaling unknown message type %q from %s", msg.Type, c.UserID())
+		c.SendError(ErrCodeUnknownType, "unknown message type: "+msg.Type)
+		return
+	}
+	handler(c, msg)
+}
+
+// inRoom wraps a handler that requires the client to have been admitted to a room
+func (h *Hub) inRoom(next messageHandler) messageHandler {
+	return func(c *Client, msg Message) {
+		if c.RoomID() == "" {
+			c.SendError(ErrCodeNotInRoom, "join a room first")
+			return
+		}
+		if c.Waiting() {
+			c.SendError(ErrCodeInLobby, "waiting for a host to admit you")
+			return
+		}
+		next(c, msg)
+	}
+}
+
+func (h *Hub) room(roomID string) (*Room, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	room, ok := h.rooms[roomID]
+	return room, ok
+}
+
+// unregister removes a disconnected client from the hub and its room
+func (h *Hub) unregister(c *Client) {
+	h.mutex.Lock()
+	delete(h.clients, c)
+	h.mutex.Unlock()
+
+	h.leaveRoom(c)
+}
+
+func (h *Hub) leaveRoom(c *Client) {
+	roomID := c.RoomID()
+	if roomID == "" {
+		return
+	}
+
+	room, ok := h.room(roomID)
+	if !ok {
+		return
+	}
+
+	if c.Waiting() {
+		h.leaveLobby(c, room)
+		h.removeIfEmpty(room)
+		return
+	}
+
+	removed, remaining := room.remove(c)
+	if !removed {
+		return
+	}
+
+	log.Printf("User %s left room %s (remaining on this node: %d)", c.UserID(), roomID, remaining)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := h.backplane.RemovePresence(ctx, roomID, c.UserID()); err != nil {
+		log.Printf("Signaling failed to remove presence for %s: %v", c.UserID(), err)
+	}
+
+	// Members of a breakout room also hold a seat in the main room
+	main := room
+	if room.parent != nil {
+		main = room.parent
+		if _, err := h.backplane.RemovePresence(ctx, main.ID, c.UserID()); err != nil {
+			log.Printf("Signaling failed to release seat of %s: %v", c.UserID(), err)
+		}
+	}
+
+	h.releaseScreenShare(room, c, c.UserID(), ScreenShareStoppedLeft)
+
+	if !c.Hidden() {
+		msg, _ := NewMessage(TypeUserLeft, UserLeftPayload{UserID: c.UserID()})
+		h.broadcast(room, msg, c.UserID())
+	}
+
+	if remaining == 0 {
+		h.removeIfEmpty(room)
+	}
+
+	if !c.ViewOnly() && !c.Hidden() {
+		h.seatQueued(main)
+	}
+}
+
+// removeIfEmpty drops a room that has no members or knockers left on this
+// node. A main room stays while any of its breakout rooms does, and goes
+// with the last of them.
+func (h *Hub) removeIfEmpty(room *Room) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for ; room != nil; room = room.parent {
+		if h.rooms[room.ID] != room || !room.empty() || h.hasBreakoutRooms(room) {
+			return
+		}
+		delete(h.rooms, room.ID)
+		if room.unsubscribe != nil {
+			room.unsubscribe()
+		}
+		log.Printf("Removed empty room: %s", room.ID)
+	}
+}
+
+// broadcast delivers a message to every member of the room except
+// excludeUserID, on this node and on every other node in the room
+func (h *Hub) broadcast(room *Room, msg Message, excludeUserID string) {
+	h.deliverLocal(room, msg, excludeUserID, false)
+
+	h.publish(Envelope{
+		RoomID:    room.ID,
+		Kind:      EnvelopeBroadcast,
+		ExcludeID: excludeUserID,
+		Message:   msg,
+	})
+}
+
+// broadcastModerators delivers a message to the hosts and co-hosts of the room
+func (h *Hub) broadcastModerators(room *Room, msg Message) {
+	h.deliverLocal(room, msg, "", true)
+
+	h.publish(Envelope{
+		RoomID:         room.ID,
+		Kind:           EnvelopeBroadcast,
+		ModeratorsOnly: true,
+		Message:        msg,
+	})
+}
+
+// sendTo delivers a message to a single member of the room, wherever it is connected
+func (h *Hub) sendTo(room *Room, userID string, msg Message) bool {
+	if target, ok := room.client(userID); ok {
+		target.Send(msg)
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	members, err := h.backplane.ListPresence(ctx, room.ID)
+	if err != nil {
+		log.Printf("Signaling failed to list presence for %s: %v", room.ID, err)
+		return false
+	}
+	for _, p := range members {
+		if p.UserID == userID {
+			h.publish(Envelope{
+				RoomID:   room.ID,
+				Kind:     EnvelopeDirect,
+				TargetID: userID,
+				Message:  msg,
+			})
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) deliverLocal(room *Room, msg Message, excludeUserID string, moderatorsOnly bool) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Signaling failed to encode %s: %v", msg.Type, err)
+		return
+	}
+
+	for _, c := range room.members() {
+		if c.UserID() == excludeUserID || (moderatorsOnly && !c.IsModerator()) {
+			continue
+		}
+		c.sendRaw(data)
+	}
+}
+
+func (h *Hub) publish(env Envelope) {
+	env.NodeID = h.config.NodeID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.backplane.Publish(ctx, env); err != nil {
+		log.Printf("Signaling failed to publish %s to room %s: %v", env.Message.Type, env.RoomID, err)
+	}
+}
+
+// handleEnvelope delivers a message published by another node
+func (h *Hub) handleEnvelope(env Envelope) {
+	if env.NodeID == h.config.NodeID {
+		return
+	}
+
+	room, ok := h.room(env.RoomID)
+	if !ok {
+		return
+	}
+
+	switch env.Kind {
+	case EnvelopeBroadcast:
+		h.deliverLocal(room, env.Message, env.ExcludeID, env.ModeratorsOnly)
+	case EnvelopeDirect:
+		if target, ok := room.client(env.TargetID); ok {
+			target.Send(env.Message)
+		}
+	case EnvelopeAdmit, EnvelopeDeny:
+		if knocker, ok := room.waiting(env.TargetID); ok {
+			h.applyLobbyDecision(room, knocker, env.Kind)
+		}
+	case EnvelopeRemove:
+		if target, ok := room.client(env.TargetID); ok {
+			var event ModerationPayload
+			env.Message.DecodePayload(&event)
+			h.removeMember(target, event.Banned)
+		}
+	case EnvelopeEnd:
+		h.closeRoom(room, env.Message)
+	case EnvelopeLowerHand:
+		h.lowerLocalHands(room, env.TargetID)
+	case EnvelopeBreakout:
+		h.applyBreakout(room, env.TargetID, env.Message)
+	case EnvelopeStopShare:
+		if target, ok := room.client(env.TargetID); ok {
+			var event ScreenShareStoppedPayload
+			env.Message.DecodePayload(&event)
+			h.releaseScreenShare(room, target, event.StoppedBy, event.Reason)
+		}
+	case EnvelopeRole:
+		if target, ok := room.client(env.TargetID); ok {
+			h.applyRole(room, target, env.Message)
+		}
+	}
+}
+
+// participants lists the room's members across all nodes
+func (h *Hub) participants(room *Room, excludeUserID string) []Participant {
+	participants := make([]Participant, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	members, err := h.backplane.ListPresence(ctx, room.ID)
+	if err != nil {
+		log.Printf("Signaling failed to list presence for %s, using local members: %v", room.ID, err)
+		for _, c := range room.members() {
+			if c.UserID() != excludeUserID && !c.Hidden() {
+				participants = append(participants, c.participant())
+			}
+		}
+		return participants
+	}
+
+	for _, p := range members {
+		if p.UserID != excludeUserID && !p.Hidden && p.Breakout == "" {
+			participants = append(participants, p.participant())
+		}
+	}
+	return participants
+}
+
+func (h *Hub) presenceOf(c *Client) Presence {
+	return Presence{
+		UserID:   c.UserID(),
+		UserName: c.identity.UserName,
+		Role:     c.Role(),
+		ViewOnly: c.ViewOnly(),
+		Hidden:   c.Hidden(),
+		NodeID:   h.config.NodeID,
+
+		HandRaisedAt: c.HandRaisedAt(),
+	}
+}
+
+// maintainPresence refreshes presence for local members and evicts members
+// whose node stopped refreshing them
+func (h *Hub) maintainPresence() {
+	ticker := time.NewTicker(h.config.PresenceTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+
+		h.mutex.RLock()
+		rooms := make([]*Room, 0, len(h.rooms))
+		for _, room := range h.rooms {
+			rooms = append(rooms, room)
+		}
+		h.mutex.RUnlock()
+
+		for _, room := range rooms {
+			h.refreshRoom(room)
+		}
+	}
+}
+
+func (h *Hub) refreshRoom(room *Room) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, c := range room.members() {
+		if err := h.setPresence(ctx, room, c); err != nil {
+			log.Printf("Signaling failed to refresh presence for %s: %v", c.UserID(), err)
+		}
+	}
+
+	for _, c := range room.members() {
+		if share, ok := h.screenShareOf(c); ok {
+			if err := h.backplane.SetPresence(ctx, screenShareKey(room.ID), share, h.config.PresenceTTL); err != nil {
+				log.Printf("Signaling failed to refresh screen share of %s: %v", c.UserID(), err)
+			}
+		}
+	}
+
+	for _, c := range room.waitingMembers() {
+		if err := h.backplane.SetPresence(ctx, lobbyKey(room.ID), h.presenceOf(c), h.config.PresenceTTL); err != nil {
+			log.Printf("Signaling failed to refresh lobby presence for %s: %v", c.UserID(), err)
+		}
+	}
+
+	evicted, err := h.backplane.EvictExpired(ctx, room.ID)
+	if err != nil {
+		log.Printf("Signaling failed to evict expired members of %s: %v", room.ID, err)
+	}
+	for _, p := range evicted {
+		log.Printf("Evicted stale member %s of room %s (node %s)", p.UserID, room.ID, p.NodeID)
+		if p.Hidden {
+			continue
+		}
+		msg, _ := NewMessage(TypeUserLeft, UserLeftPayload{UserID: p.UserID})
+		h.broadcast(room, msg, p.UserID)
+	}
+
+	evicted, err = h.backplane.EvictExpired(ctx, screenShareKey(room.ID))
+	if err != nil {
+		log.Printf("Signaling failed to evict expired screen shares of %s: %v", room.ID, err)
+	}
+	for _, p := range evicted {
+		msg, _ := NewMessage(TypeScreenShareStopped, ScreenShareStoppedPayload{UserID: p.UserID, Reason: ScreenShareStoppedLeft})
+		h.broadcast(room, msg, "")
+	}
+
+	h.refreshSFU(ctx, room)
+
+	// Seats freed on other nodes are only noticed here
+	h.seatQueued(room)
+
+	// Any node may recall a meeting from breakout rooms that have run out
+	// of time, in case the node that opened them is gone
+	if breakouts := room.openBreakouts(); breakouts != nil && breakouts.EndsAt != nil && time.Now().After(*breakouts.EndsAt) {
+		go h.closeBreakouts(room, breakouts.SessionID, BreakoutsClosedByTimer, nil)
+	}
+
+	evicted, err = h.backplane.EvictExpired(ctx, lobbyKey(room.ID))
+	if err != nil {
+		log.Printf("Signaling failed to evict expired knockers of %s: %v", room.ID, err)
+	}
+	for _, p := range evicted {
+		msg, _ := NewMessage(TypeLobbyLeft, LobbyLeftPayload{UserID: p.UserID, Outcome: LobbyOutcomeLeft})
+		h.broadcastModerators(room, msg)
+	}
+}
+
+func (h *Hub) handleJoin(c *Client, msg Message) {
+	var payload JoinPayload
+	if err := msg.DecodePayload(&payload); err != nil || payload.RoomID == "" {
+		c.SendError(ErrCodeInvalidRequest, "roomId is required")
+		return
+	}
+
+	if c.RoomID() != "" {
+		c.SendError(ErrCodeAlreadyJoined, "already joined a room")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	meeting, err := h.resolveMeeting(ctx, c.identity, payload.RoomID)
+	if err != nil {
+		log.Printf("User %s refused from room %s: %v", c.UserID(), payload.RoomID, err)
+		c.SendError(ErrCodeJoinRefused, err.Error())
+		return
+	}
+
+	participant := h.participantRecord(ctx, c.identity, meeting)
+	role := meetingRole(c.identity, meeting, participant)
+
+	if participant != nil && participant.Status == models.ParticipantStatusBanned {
+		log.Printf("User %s refused from room %s: banned", c.UserID(), payload.RoomID)
+		c.SendError(ErrCodeJoinRefused, "you have been removed from this meeting")
+		return
+	}
+	if participant != nil && participant.Status == models.ParticipantStatusDenied && role != models.ParticipantRoleHost && role != models.ParticipantRoleCoHost {
+		log.Printf("User %s refused from room %s: denied from the lobby", c.UserID(), payload.RoomID)
+		c.SendError(ErrCodeJoinRefused, "a host declined your request to join")
+		return
+	}
+
+	if meeting.IsLocked && role != models.ParticipantRoleHost && role != models.ParticipantRoleCoHost {
+		log.Printf("User %s refused from room %s: meeting is locked", c.UserID(), payload.RoomID)
+		c.SendError(ErrCodeJoinRefused, "the meeting is locked")
+		return
+	}
+
+	features := h.clientFeatures(ctx, meeting.ClientID)
+
+	c.mutex.Lock()
+	c.roomID = payload.RoomID
+	c.meeting = meeting
+	c.role = role
+	c.chat = meeting.ChatAllowed(features)
+	c.reactions = h.config.Reactions && (features == nil || features.ReactionsEnabled)
+	c.raiseHand = features == nil || features.RaiseHandEnabled
+	c.screenShare = h.config.ScreenSharing && meeting.EnableScreenSharing && (features == nil || features.ScreenSharingEnabled)
+	c.mutex.Unlock()
+
+	room, err := h.openRoom(payload.RoomID, meeting)
+	if err != nil {
+		log.Printf("User %s could not join room %s: %v", c.UserID(), payload.RoomID, err)
+		c.resetRoom()
+		c.SendError(ErrCodeJoinRefused, "room is unavailable")
+		return
+	}
+
+	if mustWait(c, meeting, features, participant) {
+		h.enterLobby(c, room, LobbyReasonApproval)
+		return
+	}
+
+	capacity := h.capacity(meeting, features)
+	claimed, err := h.claimSeat(ctx, c, room, capacity)
+	if err != nil {
+		log.Printf("User %s could not claim a seat in room %s: %v", c.UserID(), room.ID, err)
+		c.resetRoom()
+		h.removeIfEmpty(room)
+		c.SendError(ErrCodeJoinRefused, "room is unavailable")
+		return
+	}
+
+	if !claimed {
+		switch payload.Overflow {
+		case OverflowLobby:
+			h.enterLobby(c, room, LobbyReasonRoomFull)
+			return
+		case OverflowViewOnly:
+			c.mutex.Lock()
+			c.viewOnly = true
+			c.mutex.Unlock()
+			if err := h.backplane.SetPresence(ctx, room.ID, h.presenceOf(c), h.config.PresenceTTL); err != nil {
+				log.Printf("Signaling failed to record presence for %s: %v", c.UserID(), err)
+			}
+		default:
+			h.refuseFull(c, room, capacity.Limit)
+			return
+		}
+	}
+
+	previous := room.add(c)
+
+	// A second connection for the same user takes over from the first
+	if previous != nil && previous != c {
+		previous.SendError(ErrCodeAlreadyJoined, "connection replaced by a newer session")
+		previous.close()
+	}
+
+	if !c.Hidden() {
+		h.recordStatus(ctx, c, models.ParticipantStatusJoined)
+	}
+
+	log.Printf("User %s joined room %s (total clients: %d)", c.UserID(), payload.RoomID, room.size())
+	h.welcome(room, c)
+}
+
+// openRoom returns the local room, creating it and subscribing it to the
+// backplane on first use
+func (h *Hub) openRoom(roomID string, meeting *models.Meeting) (*Room, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if room, exists := h.rooms[roomID]; exists {
+		return room, nil
+	}
+
+	room := newRoom(roomID, meeting)
+	unsubscribe, err := h.backplane.Subscribe(roomID, h.handleEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	room.unsubscribe = unsubscribe
+	h.rooms[roomID] = room
+	log.Printf("Created new room: %s", roomID)
+
+	return room, nil
+}
+
+// announceJoin sends the room state to a newly admitted client and tells
+// everyone else about it
+func (h *Hub) announceJoin(room *Room, c *Client) {
+	existing := h.participants(room, c.UserID())
+	media, switched := h.mediaFor(room, len(existing)+1)
+
+	joined, _ := NewMessage(TypeJoined, JoinedPayload{
+		RoomID:       room.ID,
+		Self:         c.participant(),
+		Participants: existing,
+		Media:        media,
+		ICE:          h.iceConfig(c),
+	})
+	c.Send(joined)
+
+	// Everyone already here moves their media to the SFU
+	if switched {
+		event, _ := NewMessage(TypeMediaMode, media)
+		h.broadcast(room, event, c.UserID())
+	}
+
+	// Existing users are also announced individually for older clients
+	for _, p := range existing {
+		announce, _ := NewMessage(TypeUserJoined, p)
+		c.Send(announce)
+	}
+
+	userJoined, _ := NewMessage(TypeUserJoined, c.participant())
+	h.broadcast(room, userJoined, c.UserID())
+
+	// Moderators pick up any knockers that arrived before them
+	if c.IsModerator() && room.parent == nil && room.Meeting.HasLobby() {
+		h.sendLobby(c, room)
+	}
+
+	if shares := h.screenShares(room); len(shares) > 0 {
+		state, _ := NewMessage(TypeScreenShares, ScreenSharesPayload{Shares: shares, Limit: h.config.MaxScreenShares})
+		c.Send(state)
+	}
+
+	// Late joiners catch up on the conversation so far
+	if c.ChatEnabled() && !c.Hidden() {
+		h.sendChatHistory(c)
+	}
+}
+
+func (h *Hub) handleGetParticipants(c *Client, msg Message) {
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	reply, _ := NewMessage(TypeParticipants, h.participants(room, c.UserID()))
+	c.Send(reply)
+}
+
+func (h *Hub) handleRelay(c *Client, msg Message) {
+	var payload SignalPayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		c.SendError(ErrCodeInvalidRequest, "invalid "+msg.Type+" payload")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		return
+	}
+
+	// View-only members receive media but never publish it
+	if msg.Type == TypeOffer && c.ViewOnly() {
+		c.SendError(ErrCodeForbidden, "view-only participants cannot publish media")
+		return
+	}
+
+	// Screen tracks may only be offered while the server has the client
+	// down as sharing. Peers trust the flag in mesh mode; in SFU mode the
+	// router checks each video track's stream instead.
+	if msg.Type == TypeOffer && payload.ScreenShare && c.SharingSince() == nil {
+		c.SendError(ErrCodeForbidden, "start a screen share before offering it")
+		return
+	}
+
+	relayed, err := NewMessage(msg.Type, RelayedSignalPayload{
+		SenderID:    c.UserID(),
+		SDP:         payload.SDP,
+		Candidate:   payload.Candidate,
+		ScreenShare: payload.ScreenShare,
+	})
+	if err != nil {
+		return
+	}
+
+	if payload.TargetID == "" {
+		h.broadcast(room, relayed, c.UserID())
+		return
+	}
+
+	if !h.sendTo(room, payload.TargetID, relayed) {
+		log.Printf("Signaling %s target %s not in room %s", msg.Type, payload.TargetID, room.ID)
+	}
+}
+
+func (h *Hub) handlePing(c *Client, msg Message) {
+	pong, _ := NewMessage(TypePong, nil)
+	c.Send(pong)
+}
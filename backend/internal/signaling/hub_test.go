@@ -0,0 +1,391 @@
+package signaling
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"video-conference-backend/internal/models"
+	"video-conference-backend/internal/services"
+)
+
+const (
+	testClientID = 1
+	testRoomID   = "room-test"
+	testHostID   = 1
+)
+
+// fakeAuth accepts the access tokens "user-<id>"
+type fakeAuth struct{ services.AuthService }
+
+func (fakeAuth) ValidateToken(ctx context.Context, token string) (*models.JWTClaims, error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(token, "user-"))
+	if !strings.HasPrefix(token, "user-") || err != nil {
+		return nil, errors.New("invalid token")
+	}
+	return &models.JWTClaims{
+		UserID:           id,
+		ClientID:         testClientID,
+		TokenType:        "access",
+		RegisteredClaims: jwt.RegisteredClaims{ID: token},
+	}, nil
+}
+
+func (fakeAuth) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return false, nil
+}
+
+type fakeUsers struct{ services.UserService }
+
+func (fakeUsers) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	return &models.User{ID: id, ClientID: testClientID, FirstName: "User", LastName: strconv.Itoa(id), Status: "active"}, nil
+}
+
+// fakeMeetings serves one meeting and keeps its participants' statuses
+type fakeMeetings struct {
+	services.MeetingService
+
+	mutex        sync.Mutex
+	meeting      models.Meeting
+	participants map[int]*models.MeetingParticipant // by user ID
+}
+
+func (m *fakeMeetings) GetMeetingByMeetingID(ctx context.Context, meetingID string) (*models.Meeting, error) {
+	if meetingID != m.meeting.MeetingID {
+		return nil, sql.ErrNoRows
+	}
+	meeting := m.meeting
+	return &meeting, nil
+}
+
+func (m *fakeMeetings) GetParticipant(ctx context.Context, meetingID int, userID *int, email *string) (*models.MeetingParticipant, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if userID == nil || m.participants[*userID] == nil {
+		return nil, sql.ErrNoRows
+	}
+	participant := *m.participants[*userID]
+	return &participant, nil
+}
+
+func (m *fakeMeetings) RecordParticipantStatus(ctx context.Context, participant *models.MeetingParticipant) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if participant.UserID != nil {
+		recorded := *participant
+		m.participants[*participant.UserID] = &recorded
+	}
+	return nil
+}
+
+func (m *fakeMeetings) RecordAuditEvent(ctx context.Context, event *models.MeetingAuditEvent) error {
+	return nil
+}
+
+func (m *fakeMeetings) RecordEngagementEvents(ctx context.Context, events []*models.MeetingEngagementEvent) error {
+	return nil
+}
+
+type fakeClients struct {
+	services.ClientService
+	features models.ClientFeatures
+}
+
+func (c *fakeClients) GetClientFeatures(ctx context.Context, clientID int) (*models.ClientFeatures, error) {
+	features := c.features
+	return &features, nil
+}
+
+type fakeTURN struct{ services.TURNService }
+
+func (fakeTURN) ICEConfig(ctx context.Context, meetingID, participantID string) (*models.ICEConfig, error) {
+	return &models.ICEConfig{}, nil
+}
+
+// testHub serves a hub for one active meeting hosted by testHostID
+func testHub(t *testing.T, configure func(*models.Meeting, *models.ClientFeatures)) (*Hub, *httptest.Server) {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Reactions = false
+	return testHubWithConfig(t, cfg, configure)
+}
+
+func testHubWithConfig(t *testing.T, cfg Config, configure func(*models.Meeting, *models.ClientFeatures)) (*Hub, *httptest.Server) {
+	t.Helper()
+
+	meetings := &fakeMeetings{
+		meeting: models.Meeting{
+			ID:              1,
+			ClientID:        testClientID,
+			MeetingID:       testRoomID,
+			CreatedByUserID: testHostID,
+			Status:          models.MeetingStatusActive,
+		},
+		participants: make(map[int]*models.MeetingParticipant),
+	}
+	clients := &fakeClients{features: models.ClientFeatures{ClientID: testClientID, WaitingRoomEnabled: true}}
+	if configure != nil {
+		configure(&meetings.meeting, &clients.features)
+	}
+
+	svc := &services.Services{
+		Auth:    fakeAuth{},
+		User:    fakeUsers{},
+		Meeting: meetings,
+		Client:  clients,
+		TURN:    fakeTURN{},
+	}
+	hub := NewHub(cfg, svc, NewMemoryBackplane())
+	server := httptest.NewServer(hub)
+
+	t.Cleanup(func() {
+		server.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		hub.Shutdown(ctx)
+	})
+	return hub, server
+}
+
+// testConn is a signaling connection as a browser would hold it
+type testConn struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dial(t *testing.T, server *httptest.Server, userID int) *testConn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "?token=user-" + strconv.Itoa(userID)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("user %d failed to connect: %v", userID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testConn{t: t, conn: conn}
+}
+
+func (c *testConn) send(msgType string, payload interface{}) {
+	c.t.Helper()
+	msg, err := NewMessage(msgType, payload)
+	if err != nil {
+		c.t.Fatalf("failed to encode %s: %v", msgType, err)
+	}
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.t.Fatalf("failed to send %s: %v", msgType, err)
+	}
+}
+
+// expect reads until a message of the given type, skipping others
+func (c *testConn) expect(msgType string, payload interface{}) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg Message
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			c.t.Fatalf("connection ended waiting for %s: %v", msgType, err)
+		}
+		if msg.Type != msgType {
+			continue
+		}
+		if payload != nil {
+			if err := msg.DecodePayload(payload); err != nil {
+				c.t.Fatalf("invalid %s payload: %v", msgType, err)
+			}
+		}
+		return
+	}
+}
+
+// expectError reads until an error message and checks its code
+func (c *testConn) expectError(code string) {
+	c.t.Helper()
+	var payload ErrorPayload
+	c.expect(TypeError, &payload)
+	if payload.Code != code {
+		c.t.Fatalf("got error %q (%s), want %q", payload.Code, payload.Message, code)
+	}
+}
+
+// expectClosed reads until the server closes the connection
+func (c *testConn) expectClosed() {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			if isTimeout(err) {
+				c.t.Fatalf("connection still open")
+			}
+			return
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+func (c *testConn) join() JoinedPayload {
+	c.t.Helper()
+	c.send(TypeJoin, JoinPayload{RoomID: testRoomID})
+	var joined JoinedPayload
+	c.expect(TypeJoined, &joined)
+	return joined
+}
+
+func TestServeHTTPRequiresToken(t *testing.T) {
+	_, server := testHub(t, nil)
+
+	for _, query := range []string{"", "?token=forged"} {
+		resp, err := http.Get(server.URL + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("GET %q returned %d, want %d", query, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestJoinAndRelay(t *testing.T) {
+	_, server := testHub(t, nil)
+
+	host := dial(t, server, testHostID)
+	if joined := host.join(); joined.Self.Role != models.ParticipantRoleHost {
+		t.Fatalf("meeting creator joined as %q", joined.Self.Role)
+	}
+
+	guest := dial(t, server, 2)
+	joined := guest.join()
+	if len(joined.Participants) != 1 || joined.Participants[0].UserID != "1" {
+		t.Fatalf("joiner saw participants %+v, want the host", joined.Participants)
+	}
+
+	var announced Participant
+	host.expect(TypeUserJoined, &announced)
+	if announced.UserID != "2" {
+		t.Fatalf("host was told %q joined, want 2", announced.UserID)
+	}
+
+	guest.send(TypeOffer, SignalPayload{TargetID: "1", SDP: []byte(`{"type":"offer","sdp":"v=0"}`)})
+	var offer RelayedSignalPayload
+	host.expect(TypeOffer, &offer)
+	if offer.SenderID != "2" {
+		t.Fatalf("offer relayed from %q, want 2", offer.SenderID)
+	}
+}
+
+func TestJoinRefusesInactiveMeeting(t *testing.T) {
+	_, server := testHub(t, func(meeting *models.Meeting, _ *models.ClientFeatures) {
+		meeting.Status = models.MeetingStatusEnded
+	})
+
+	conn := dial(t, server, testHostID)
+	conn.send(TypeJoin, JoinPayload{RoomID: testRoomID})
+	conn.expectError(ErrCodeJoinRefused)
+}
+
+func TestJoinRefusesFullRoom(t *testing.T) {
+	_, server := testHub(t, func(meeting *models.Meeting, _ *models.ClientFeatures) {
+		meeting.MaxParticipants = 2
+	})
+
+	// One seat is kept for the host
+	dial(t, server, 2).join()
+	third := dial(t, server, 3)
+	third.send(TypeJoin, JoinPayload{RoomID: testRoomID})
+	third.expectError(ErrCodeRoomFull)
+
+	host := dial(t, server, testHostID)
+	host.join()
+}
+
+func TestLobbyDenialClosesConnectionAndRefusesRejoin(t *testing.T) {
+	_, server := testHub(t, func(meeting *models.Meeting, _ *models.ClientFeatures) {
+		meeting.EnableWaitingRoom = true
+	})
+
+	host := dial(t, server, testHostID)
+	host.join()
+
+	knocker := dial(t, server, 2)
+	knocker.send(TypeJoin, JoinPayload{RoomID: testRoomID})
+	knocker.expect(TypeLobbyWaiting, nil)
+	host.expect(TypeLobbyRequest, nil)
+
+	host.send(TypeLobbyDeny, LobbyDecisionPayload{UserIDs: []string{"2"}})
+	knocker.expect(TypeLobbyDenied, nil)
+	knocker.expectClosed()
+
+	again := dial(t, server, 2)
+	again.send(TypeJoin, JoinPayload{RoomID: testRoomID})
+	again.expectError(ErrCodeJoinRefused)
+}
+
+func TestJoinTimeoutRunsFromConnecting(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Reactions = false
+	cfg.JoinTimeout = 300 * time.Millisecond
+	_, server := testHubWithConfig(t, cfg, nil)
+	c := dial(t, server, 2)
+	// The server drops the connection after its close frame, so none is sent back
+	c.conn.SetCloseHandler(func(int, string) error { return nil })
+
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := c.conn.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+
+	// Pings keep the connection busy, but only a join keeps it open
+	ping, _ := NewMessage(TypePing, nil)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case err := <-closed:
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Fatalf("connection ended with %v, want a join timeout", err)
+			}
+			return
+		case <-ticker.C:
+			c.conn.WriteJSON(ping)
+		case <-timeout:
+			t.Fatal("connection still open without joining")
+		}
+	}
+}
+
+func TestDisconnectUserClosesConnections(t *testing.T) {
+	hub, server := testHub(t, nil)
+
+	host := dial(t, server, testHostID)
+	host.join()
+	user := dial(t, server, 2)
+	user.join()
+	host.expect(TypeUserJoined, nil)
+
+	hub.DisconnectUser(2)
+
+	user.expectClosed()
+	var left UserLeftPayload
+	host.expect(TypeUserLeft, &left)
+	if left.UserID != "2" {
+		t.Fatalf("host was told %q left, want 2", left.UserID)
+	}
+}
@@ -0,0 +1,298 @@
+package signaling
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// lobbyKey is the backplane presence key holding a room's knockers
+func lobbyKey(roomID string) string {
+	return roomID + ":lobby"
+}
+
+// lobbyEnabled reports whether joiners of the meeting must be admitted by a
+// moderator. The meeting must ask for a waiting room and the tenant must not
+// have switched the feature off, which it is on for by default; without
+// tenant settings the meeting decides.
+func lobbyEnabled(meeting *models.Meeting, features *models.ClientFeatures) bool {
+	if !meeting.HasLobby() {
+		return false
+	}
+	return features == nil || features.WaitingRoomEnabled
+}
+
+// mustWait reports whether the client has to knock before joining
+func mustWait(c *Client, meeting *models.Meeting, features *models.ClientFeatures, participant *models.MeetingParticipant) bool {
+	if c.IsModerator() {
+		return false
+	}
+	// Someone already admitted to this meeting rejoins without knocking again
+	if participant != nil && participant.Status == models.ParticipantStatusAdmitted {
+		return false
+	}
+	return lobbyEnabled(meeting, features)
+}
+
+// enterLobby parks the client in the room's lobby and asks moderators to
+// decide. Knockers queued for a seat are admitted as seats free up.
+func (h *Hub) enterLobby(c *Client, room *Room, reason string) {
+	c.mutex.Lock()
+	c.waiting = true
+	if reason == LobbyReasonRoomFull {
+		c.queued = true
+		c.queuedAt = time.Now()
+	}
+	c.mutex.Unlock()
+
+	if previous := room.addWaiting(c); previous != nil && previous != c {
+		previous.SendError(ErrCodeAlreadyJoined, "connection replaced by a newer session")
+		previous.close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.backplane.SetPresence(ctx, lobbyKey(room.ID), h.presenceOf(c), h.config.PresenceTTL); err != nil {
+		log.Printf("Signaling failed to record lobby presence for %s: %v", c.UserID(), err)
+	}
+	h.recordStatus(ctx, c, models.ParticipantStatusWaiting)
+
+	log.Printf("User %s is waiting in the lobby of room %s", c.UserID(), room.ID)
+
+	waiting, _ := NewMessage(TypeLobbyWaiting, LobbyWaitingPayload{RoomID: room.ID, Reason: reason})
+	c.Send(waiting)
+
+	request, _ := NewMessage(TypeLobbyRequest, c.participant())
+	h.broadcastModerators(room, request)
+}
+
+// leaveLobby removes a knocker that disconnected before a decision was made
+func (h *Hub) leaveLobby(c *Client, room *Room) {
+	if !room.removeWaiting(c) {
+		return
+	}
+
+	log.Printf("User %s left the lobby of room %s", c.UserID(), room.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := h.backplane.RemovePresence(ctx, lobbyKey(room.ID), c.UserID()); err != nil {
+		log.Printf("Signaling failed to remove lobby presence for %s: %v", c.UserID(), err)
+	}
+
+	left, _ := NewMessage(TypeLobbyLeft, LobbyLeftPayload{UserID: c.UserID(), Outcome: LobbyOutcomeLeft})
+	h.broadcastModerators(room, left)
+}
+
+// lobby lists the knockers waiting on every node
+func (h *Hub) lobby(room *Room) []Participant {
+	waiting := make([]Participant, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	entries, err := h.backplane.ListPresence(ctx, lobbyKey(room.ID))
+	if err != nil {
+		log.Printf("Signaling failed to list lobby for %s, using local knockers: %v", room.ID, err)
+		for _, c := range room.waitingMembers() {
+			waiting = append(waiting, c.participant())
+		}
+		return waiting
+	}
+
+	for _, p := range entries {
+		waiting = append(waiting, p.participant())
+	}
+	return waiting
+}
+
+func (h *Hub) sendLobby(c *Client, room *Room) {
+	reply, _ := NewMessage(TypeLobby, LobbyPayload{Waiting: h.lobby(room)})
+	c.Send(reply)
+}
+
+// moderatorOnly wraps a handler that only hosts and co-hosts may use
+func (h *Hub) moderatorOnly(next messageHandler) messageHandler {
+	return func(c *Client, msg Message) {
+		if !c.IsModerator() {
+			c.SendError(ErrCodeForbidden, "only hosts and co-hosts can do that")
+			return
+		}
+		next(c, msg)
+	}
+}
+
+func (h *Hub) handleGetLobby(c *Client, msg Message) {
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+	h.sendLobby(c, room)
+}
+
+func (h *Hub) handleLobbyAdmit(c *Client, msg Message) {
+	h.handleLobbyDecision(c, msg, EnvelopeAdmit)
+}
+
+func (h *Hub) handleLobbyDeny(c *Client, msg Message) {
+	h.handleLobbyDecision(c, msg, EnvelopeDeny)
+}
+
+// handleLobbyDecision applies a moderator's admit or deny to the named
+// knockers, or to the whole lobby when All is set
+func (h *Hub) handleLobbyDecision(c *Client, msg Message, decision string) {
+	var payload LobbyDecisionPayload
+	if err := msg.DecodePayload(&payload); err != nil || (!payload.All && len(payload.UserIDs) == 0) {
+		c.SendError(ErrCodeInvalidRequest, "userIds or all is required")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	targets := payload.UserIDs
+	if payload.All {
+		targets = nil
+		for _, p := range h.lobby(room) {
+			targets = append(targets, p.UserID)
+		}
+	}
+
+	log.Printf("Moderator %s %s %d knocker(s) in room %s", c.UserID(), decision, len(targets), room.ID)
+
+	for _, userID := range targets {
+		// Knockers on this node are decided directly; the rest are decided by
+		// the node holding their connection
+		if knocker, ok := room.waiting(userID); ok {
+			h.applyLobbyDecision(room, knocker, decision)
+			continue
+		}
+		h.publish(Envelope{
+			RoomID:   room.ID,
+			Kind:     decision,
+			TargetID: userID,
+		})
+	}
+}
+
+// applyLobbyDecision admits or denies a knocker connected to this node
+func (h *Hub) applyLobbyDecision(room *Room, c *Client, decision string) {
+	switch decision {
+	case EnvelopeAdmit:
+		h.admitFromLobby(room, c)
+	case EnvelopeDeny:
+		h.denyFromLobby(room, c)
+	}
+}
+
+// admitFromLobby seats an admitted knocker, reporting whether it got a seat.
+// A knocker that finds the room full stays in the lobby, queued for a seat.
+func (h *Hub) admitFromLobby(room *Room, c *Client) bool {
+	if _, ok := room.waiting(c.UserID()); !ok {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	capacity := h.capacity(room.Meeting, h.clientFeatures(ctx, room.Meeting.ClientID))
+	claimed, err := h.claimSeat(ctx, c, room, capacity)
+	if err != nil {
+		log.Printf("Signaling failed to claim a seat for %s in room %s: %v", c.UserID(), room.ID, err)
+		return false
+	}
+	if !claimed {
+		h.queueForSeat(c, room)
+		return false
+	}
+
+	admitted, previous := room.admit(c)
+	if !admitted {
+		// Denied or disconnected while the seat was being claimed
+		if _, err := h.backplane.RemovePresence(ctx, room.ID, c.UserID()); err != nil {
+			log.Printf("Signaling failed to release seat of %s: %v", c.UserID(), err)
+		}
+		return false
+	}
+	if previous != nil && previous != c {
+		previous.SendError(ErrCodeAlreadyJoined, "connection replaced by a newer session")
+		previous.close()
+	}
+
+	c.mutex.Lock()
+	c.waiting = false
+	c.queued = false
+	c.mutex.Unlock()
+
+	if _, err := h.backplane.RemovePresence(ctx, lobbyKey(room.ID), c.UserID()); err != nil {
+		log.Printf("Signaling failed to remove lobby presence for %s: %v", c.UserID(), err)
+	}
+	h.recordStatus(ctx, c, models.ParticipantStatusAdmitted)
+
+	log.Printf("User %s admitted to room %s (total clients: %d)", c.UserID(), room.ID, room.size())
+
+	left, _ := NewMessage(TypeLobbyLeft, LobbyLeftPayload{UserID: c.UserID(), Outcome: LobbyOutcomeAdmitted})
+	h.broadcastModerators(room, left)
+
+	h.welcome(room, c)
+	return true
+}
+
+func (h *Hub) denyFromLobby(room *Room, c *Client) {
+	if !room.removeWaiting(c) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := h.backplane.RemovePresence(ctx, lobbyKey(room.ID), c.UserID()); err != nil {
+		log.Printf("Signaling failed to remove lobby presence for %s: %v", c.UserID(), err)
+	}
+	h.recordStatus(ctx, c, models.ParticipantStatusDenied)
+
+	c.resetRoom()
+
+	log.Printf("User %s denied entry to room %s", c.UserID(), room.ID)
+
+	// The refusal is flushed before the connection closes. Knocking again is
+	// refused at join, so moderators are not asked twice.
+	denied, _ := NewMessage(TypeLobbyDenied, LobbyDeniedPayload{RoomID: room.ID})
+	c.Send(denied)
+	c.close()
+
+	left, _ := NewMessage(TypeLobbyLeft, LobbyLeftPayload{UserID: c.UserID(), Outcome: LobbyOutcomeDenied})
+	h.broadcastModerators(room, left)
+
+	h.removeIfEmpty(room)
+}
+
+// recordStatus persists the client's participation status for its meeting
+func (h *Hub) recordStatus(ctx context.Context, c *Client, status string) {
+	meeting := c.Meeting()
+	if meeting == nil {
+		return
+	}
+
+	userID, email := c.identity.participantKey()
+	if userID == nil && email == nil {
+		return
+	}
+
+	name := c.identity.UserName
+	participant := &models.MeetingParticipant{
+		MeetingID: meeting.ID,
+		UserID:    userID,
+		Email:     email,
+		GuestName: &name,
+		Role:      c.Role(),
+		Status:    status,
+	}
+	if err := h.services.Meeting.RecordParticipantStatus(ctx, participant); err != nil {
+		log.Printf("Signaling failed to record %s status for %s: %v", status, c.UserID(), err)
+	}
+}
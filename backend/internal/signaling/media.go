@@ -0,0 +1,230 @@
+package signaling
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// MediaServer forwards the media of rooms running in SFU mode. Attach joins
+// a forwarding peer with the given ID to the room as a hidden member; it is
+// a no-op if one is already attached. onClose runs once that peer has left
+// the room.
+type MediaServer interface {
+	Attach(roomID string, meeting *models.Meeting, peerID string, onClose func()) error
+}
+
+// SetMediaServer lets rooms move their media to an SFU. It must be called
+// before the hub serves connections; without it every room stays in mesh
+// mode.
+func (h *Hub) SetMediaServer(media MediaServer) {
+	h.media = media
+}
+
+// sfuKey is the backplane presence key naming the peer that forwards a
+// room's media. A room has at most one, on whichever node claimed it first.
+func sfuKey(roomID string) string {
+	return roomID + ":sfu"
+}
+
+func (r *Room) localSFU() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.sfuPeer
+}
+
+func (r *Room) setLocalSFU(peerID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sfuPeer = peerID
+}
+
+func (h *Hub) sfuPresence(peerID string) Presence {
+	return Presence{UserID: peerID, UserName: "Media server", NodeID: h.config.NodeID}
+}
+
+// mediaFor decides how a joiner of a room of the given size exchanges media,
+// reporting whether the room has just moved to the SFU. Breakout rooms stay
+// in mesh mode.
+func (h *Hub) mediaFor(room *Room, size int) (*MediaPayload, bool) {
+	mesh := &MediaPayload{Mode: MediaModeMesh}
+	if h.media == nil || room.parent != nil {
+		return mesh, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if peerID, ok := h.currentSFU(ctx, room); ok {
+		return &MediaPayload{Mode: MediaModeSFU, PeerID: peerID}, false
+	}
+
+	switch room.Meeting.MediaMode() {
+	case models.MediaModeMesh:
+		return mesh, false
+	case models.MediaModeAuto:
+		if size <= h.config.MeshLimit {
+			return mesh, false
+		}
+	}
+
+	peerID, err := h.startSFU(ctx, room)
+	if err != nil {
+		log.Printf("Signaling failed to start media server for %s, staying in mesh mode: %v", room.ID, err)
+		return mesh, false
+	}
+	return &MediaPayload{Mode: MediaModeSFU, PeerID: peerID}, true
+}
+
+// currentSFU finds the peer forwarding the room's media, on any node
+func (h *Hub) currentSFU(ctx context.Context, room *Room) (string, bool) {
+	if peerID := room.localSFU(); peerID != "" {
+		return peerID, true
+	}
+
+	peers, err := h.backplane.ListPresence(ctx, sfuKey(room.ID))
+	if err != nil {
+		log.Printf("Signaling failed to list media servers of %s: %v", room.ID, err)
+		return "", false
+	}
+	if len(peers) == 0 {
+		return "", false
+	}
+	return peers[0].UserID, true
+}
+
+// startSFU claims the room's media server slot for this node and attaches
+// a forwarding peer. If another node won the claim its peer is used instead.
+func (h *Hub) startSFU(ctx context.Context, room *Room) (string, error) {
+	peerID := "sfu_" + h.config.NodeID
+	claimed, err := h.backplane.ClaimSlot(ctx, sfuKey(room.ID), h.sfuPresence(peerID), h.config.PresenceTTL, Capacity{Limit: 1})
+	if err != nil {
+		return "", err
+	}
+	if !claimed {
+		if current, ok := h.currentSFU(ctx, room); ok {
+			return current, nil
+		}
+		return "", errors.New("media server slot is taken")
+	}
+
+	room.setLocalSFU(peerID)
+	err = h.media.Attach(room.ID, room.Meeting, peerID, func() {
+		h.stopSFU(room, peerID)
+	})
+	if err != nil {
+		room.setLocalSFU("")
+		if _, removeErr := h.backplane.RemovePresence(ctx, sfuKey(room.ID), peerID); removeErr != nil {
+			log.Printf("Signaling failed to release media server slot of %s: %v", room.ID, removeErr)
+		}
+		return "", err
+	}
+
+	log.Printf("Room %s moved to SFU mode, forwarding through %s", room.ID, peerID)
+	return peerID, nil
+}
+
+// stopSFU releases the room's media server slot once its peer has left and
+// sends anyone still in the room back to mesh mode
+func (h *Hub) stopSFU(room *Room, peerID string) {
+	if room.localSFU() != peerID {
+		return
+	}
+	room.setLocalSFU("")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := h.backplane.RemovePresence(ctx, sfuKey(room.ID), peerID); err != nil {
+		log.Printf("Signaling failed to release media server slot of %s: %v", room.ID, err)
+	}
+
+	event, _ := NewMessage(TypeMediaMode, MediaPayload{Mode: MediaModeMesh})
+	h.broadcast(room, event, "")
+}
+
+// refreshSFU keeps this node's claim on a room's media server alive, and
+// replaces a media server whose node has gone away
+func (h *Hub) refreshSFU(ctx context.Context, room *Room) {
+	if peerID := room.localSFU(); peerID != "" {
+		if err := h.backplane.SetPresence(ctx, sfuKey(room.ID), h.sfuPresence(peerID), h.config.PresenceTTL); err != nil {
+			log.Printf("Signaling failed to refresh media server of %s: %v", room.ID, err)
+		}
+		return
+	}
+
+	evicted, err := h.backplane.EvictExpired(ctx, sfuKey(room.ID))
+	if err != nil {
+		log.Printf("Signaling failed to evict expired media servers of %s: %v", room.ID, err)
+		return
+	}
+	if len(evicted) == 0 || h.media == nil {
+		return
+	}
+
+	log.Printf("Media server %s of room %s is gone (node %s)", evicted[0].UserID, room.ID, evicted[0].NodeID)
+
+	media := &MediaPayload{Mode: MediaModeMesh}
+	if peerID, err := h.startSFU(ctx, room); err != nil {
+		log.Printf("Signaling failed to replace media server of %s: %v", room.ID, err)
+	} else {
+		media = &MediaPayload{Mode: MediaModeSFU, PeerID: peerID}
+	}
+	event, _ := NewMessage(TypeMediaMode, media)
+	h.broadcast(room, event, "")
+}
+
+// handleSelectLayer passes a subscriber's simulcast layer choice to the
+// media server
+func (h *Hub) handleSelectLayer(c *Client, msg Message) {
+	var payload LayerPayload
+	if err := msg.DecodePayload(&payload); err != nil || payload.TargetID == "" || payload.TrackID == "" {
+		c.SendError(ErrCodeInvalidRequest, "targetId and trackId are required")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		return
+	}
+
+	relayed, _ := NewMessage(TypeSelectLayer, RelayedLayerPayload{
+		SenderID: c.UserID(),
+		TrackID:  payload.TrackID,
+		Layer:    payload.Layer,
+	})
+	if !h.sendTo(room, payload.TargetID, relayed) {
+		log.Printf("Signaling %s target %s not in room %s", msg.Type, payload.TargetID, room.ID)
+	}
+}
+
+// iceConfig issues a member the ICE servers to connect through, with TURN
+// credentials scoped to its meeting. On failure the client falls back on
+// its own configuration.
+func (h *Hub) iceConfig(c *Client) *models.ICEConfig {
+	meeting := c.Meeting()
+	if meeting == nil || c.Hidden() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ice, err := h.services.TURN.ICEConfig(ctx, meeting.MeetingID, c.UserID())
+	if err != nil {
+		log.Printf("Signaling failed to issue ICE servers for %s: %v", c.UserID(), err)
+		return nil
+	}
+	return ice
+}
+
+// handleGetICEServers renews a member's TURN credentials
+func (h *Hub) handleGetICEServers(c *Client, msg Message) {
+	ice := h.iceConfig(c)
+	if ice == nil {
+		c.SendError(ErrCodeInvalidRequest, "failed to issue ICE servers")
+		return
+	}
+	reply, _ := NewMessage(TypeICEServers, ice)
+	c.Send(reply)
+}
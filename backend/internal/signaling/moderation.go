@@ -0,0 +1,268 @@
+package signaling
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// canModerate reports whether the actor may act on a member holding
+// targetRole. Nobody acts on themselves and co-hosts cannot act on hosts.
+func canModerate(actor *Client, targetID, targetRole string) bool {
+	if targetID == actor.UserID() {
+		return false
+	}
+	if targetRole == models.ParticipantRoleHost && actor.Role() != models.ParticipantRoleHost {
+		return false
+	}
+	return true
+}
+
+// member finds a seated member of the room on any node
+func (h *Hub) member(room *Room, userID string) (Presence, bool) {
+	if c, ok := room.client(userID); ok {
+		return h.presenceOf(c), true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	members, err := h.backplane.ListPresence(ctx, room.ID)
+	if err != nil {
+		log.Printf("Signaling failed to list presence for %s: %v", room.ID, err)
+		return Presence{}, false
+	}
+	for _, p := range members {
+		if p.UserID == userID {
+			return p, true
+		}
+	}
+	return Presence{}, false
+}
+
+// moderationTarget resolves the member a moderator wants to act on,
+// replying with an error when it cannot
+func (h *Hub) moderationTarget(c *Client, room *Room, targetID string) bool {
+	target, ok := h.member(room, targetID)
+	if !ok || target.Hidden {
+		c.SendError(ErrCodeInvalidRequest, "participant is not in the meeting")
+		return false
+	}
+	if !canModerate(c, target.UserID, target.Role) {
+		c.SendError(ErrCodeForbidden, "you cannot moderate this participant")
+		return false
+	}
+	return true
+}
+
+// audit writes a moderation action to the meeting's audit trail
+func (h *Hub) audit(c *Client, action, targetID string, details models.JSONB) {
+	meeting := c.Meeting()
+	if meeting == nil {
+		return
+	}
+
+	event := &models.MeetingAuditEvent{
+		MeetingID:   meeting.ID,
+		ActorUserID: c.identity.AccountID,
+		ActorID:     c.UserID(),
+		Action:      action,
+		Details:     details,
+	}
+	if targetID != "" {
+		event.TargetID = &targetID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.services.Meeting.RecordAuditEvent(ctx, event); err != nil {
+		log.Printf("Signaling failed to audit %s by %s in meeting %d: %v", action, c.UserID(), meeting.ID, err)
+	}
+}
+
+func (h *Hub) handleMuteParticipant(c *Client, msg Message) {
+	h.handleMediaModeration(c, msg, ModerationMute, models.AuditActionMute)
+}
+
+func (h *Hub) handleDisableCamera(c *Client, msg Message) {
+	h.handleMediaModeration(c, msg, ModerationDisableCamera, models.AuditActionDisableCamera)
+}
+
+// handleMediaModeration asks one participant, or every non-moderator, to
+// turn off its microphone or camera. Media never passes through the server,
+// so the request is enforced by the receiving clients.
+func (h *Hub) handleMediaModeration(c *Client, msg Message, action, auditAction string) {
+	var payload ModerationTargetPayload
+	if err := msg.DecodePayload(&payload); err != nil || (payload.TargetID == "" && !payload.All) {
+		c.SendError(ErrCodeInvalidRequest, "targetId or all is required")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	if !payload.All && !h.moderationTarget(c, room, payload.TargetID) {
+		return
+	}
+
+	log.Printf("Moderator %s requested %s for %s in room %s", c.UserID(), action, describeTarget(payload), room.ID)
+
+	event, _ := NewMessage(TypeModeration, ModerationPayload{
+		Action:   action,
+		ActorID:  c.UserID(),
+		TargetID: payload.TargetID,
+		All:      payload.All,
+	})
+	h.broadcast(room, event, "")
+
+	h.audit(c, auditAction, payload.TargetID, models.JSONB{"all": payload.All})
+}
+
+func describeTarget(payload ModerationTargetPayload) string {
+	if payload.All {
+		return "everyone"
+	}
+	return payload.TargetID
+}
+
+// handleRemoveParticipant disconnects a participant, and with Ban set keeps
+// it out for the rest of the meeting
+func (h *Hub) handleRemoveParticipant(c *Client, msg Message) {
+	var payload RemoveParticipantPayload
+	if err := msg.DecodePayload(&payload); err != nil || payload.TargetID == "" {
+		c.SendError(ErrCodeInvalidRequest, "targetId is required")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	if !h.moderationTarget(c, room, payload.TargetID) {
+		return
+	}
+
+	log.Printf("Moderator %s removed %s from room %s (ban: %t)", c.UserID(), payload.TargetID, room.ID, payload.Ban)
+
+	event, _ := NewMessage(TypeModeration, ModerationPayload{
+		Action:   ModerationRemove,
+		ActorID:  c.UserID(),
+		TargetID: payload.TargetID,
+		Banned:   payload.Ban,
+	})
+	h.broadcast(room, event, "")
+
+	if target, ok := room.client(payload.TargetID); ok {
+		h.removeMember(target, payload.Ban)
+	} else {
+		h.publish(Envelope{
+			RoomID:   room.ID,
+			Kind:     EnvelopeRemove,
+			TargetID: payload.TargetID,
+			Message:  event,
+		})
+	}
+
+	action := models.AuditActionRemove
+	if payload.Ban {
+		action = models.AuditActionBan
+	}
+	h.audit(c, action, payload.TargetID, nil)
+}
+
+// removeMember disconnects a member connected to this node
+func (h *Hub) removeMember(c *Client, ban bool) {
+	if ban {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if userID, email := c.identity.participantKey(); userID == nil && email == nil {
+			log.Printf("Signaling cannot persist ban for %s: no user ID or email", c.UserID())
+		} else {
+			h.recordStatus(ctx, c, models.ParticipantStatusBanned)
+		}
+	}
+	c.close()
+}
+
+func (h *Hub) handleLockMeeting(c *Client, msg Message) {
+	var payload LockMeetingPayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		c.SendError(ErrCodeInvalidRequest, "invalid lockMeeting payload")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.services.Meeting.SetMeetingLocked(ctx, room.Meeting.MeetingID, payload.Locked); err != nil {
+		log.Printf("Signaling failed to lock meeting %s: %v", room.ID, err)
+		c.SendError(ErrCodeInvalidRequest, "failed to update meeting lock")
+		return
+	}
+
+	action, auditAction := ModerationUnlock, models.AuditActionUnlock
+	if payload.Locked {
+		action, auditAction = ModerationLock, models.AuditActionLock
+	}
+
+	log.Printf("Moderator %s set room %s locked=%t", c.UserID(), room.ID, payload.Locked)
+
+	event, _ := NewMessage(TypeModeration, ModerationPayload{Action: action, ActorID: c.UserID()})
+	h.broadcastMeeting(room.main(), event)
+
+	h.audit(c, auditAction, "", nil)
+}
+
+// handleEndMeeting ends the meeting and disconnects everyone in it, on every node
+func (h *Hub) handleEndMeeting(c *Client, msg Message) {
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+	room = room.main()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.services.Meeting.EndMeeting(ctx, room.ID); err != nil {
+		log.Printf("Signaling failed to end meeting %s: %v", room.ID, err)
+		c.SendError(ErrCodeInvalidRequest, "failed to end meeting")
+		return
+	}
+
+	log.Printf("Moderator %s ended meeting %s", c.UserID(), room.ID)
+
+	h.audit(c, models.AuditActionEndMeeting, "", nil)
+
+	event, _ := NewMessage(TypeModeration, ModerationPayload{Action: ModerationEndMeeting, ActorID: c.UserID()})
+	h.publish(Envelope{
+		RoomID:  room.ID,
+		Kind:    EnvelopeEnd,
+		Message: event,
+	})
+	h.closeRoom(room, event)
+}
+
+// closeRoom tells everyone on this node, knockers and breakout rooms
+// included, that the meeting is over and disconnects them
+func (h *Hub) closeRoom(room *Room, event Message) {
+	clients := append(room.members(), room.waitingMembers()...)
+	for _, breakout := range h.breakoutRooms(room) {
+		clients = append(clients, breakout.members()...)
+	}
+	for _, c := range clients {
+		c.Send(event)
+		c.close()
+	}
+}
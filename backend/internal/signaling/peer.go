@@ -0,0 +1,132 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// Peer is an in-process room member, such as the recorder, that speaks the
+// signaling protocol without a WebSocket. It is hidden from participants:
+// it takes no seat, is never announced and is left out of participant
+// lists, but can exchange offers, answers and ICE candidates with them.
+type Peer struct {
+	client *Client
+}
+
+// AttachPeer joins a hidden peer to the room of an active meeting. Messages
+// addressed to the peer are passed to deliver, one at a time and in order,
+// starting with a joined message listing the current participants.
+// onClose runs once the peer has left the room, whether it was closed by
+// the caller, by the meeting ending or by the hub shutting down.
+func (h *Hub) AttachPeer(roomID string, identity *Identity, deliver func(Message), onClose func()) (*Peer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	meeting, err := h.resolveMeeting(ctx, identity, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{
+		hub:      h,
+		send:     make(chan []byte, h.config.SendBufferSize),
+		identity: identity,
+		done:     make(chan struct{}),
+		roomID:   roomID,
+		meeting:  meeting,
+		role:     models.ParticipantRoleAttendee,
+		hidden:   true,
+	}
+	client.touch()
+
+	room, err := h.openRoom(roomID, meeting)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mutex.Lock()
+	if h.closing {
+		h.mutex.Unlock()
+		h.removeIfEmpty(room)
+		return nil, fmt.Errorf("signaling hub is shutting down")
+	}
+	h.clients[client] = struct{}{}
+	h.wg.Add(1)
+	h.mutex.Unlock()
+
+	if err := h.backplane.SetPresence(ctx, room.ID, h.presenceOf(client), h.config.PresenceTTL); err != nil {
+		log.Printf("Signaling failed to record presence for %s: %v", client.UserID(), err)
+	}
+	if previous := room.add(client); previous != nil && previous != client {
+		previous.close()
+	}
+
+	go func() {
+		defer h.wg.Done()
+		client.localPump(deliver)
+		h.unregister(client)
+		if onClose != nil {
+			onClose()
+		}
+	}()
+
+	log.Printf("Hidden peer %s joined room %s", client.UserID(), roomID)
+
+	joined, _ := NewMessage(TypeJoined, JoinedPayload{
+		RoomID:       room.ID,
+		Self:         client.participant(),
+		Participants: h.participants(room, client.UserID()),
+	})
+	client.Send(joined)
+
+	if shares := h.screenShares(room); len(shares) > 0 {
+		state, _ := NewMessage(TypeScreenShares, ScreenSharesPayload{Shares: shares, Limit: h.config.MaxScreenShares})
+		client.Send(state)
+	}
+
+	return &Peer{client: client}, nil
+}
+
+// UserID returns the wire identifier of the peer
+func (p *Peer) UserID() string {
+	return p.client.UserID()
+}
+
+// Send handles a message from the peer as if it had arrived on a socket
+func (p *Peer) Send(msg Message) {
+	select {
+	case <-p.client.done:
+		return
+	default:
+	}
+	p.client.touch()
+	p.client.hub.dispatch(p.client, msg)
+}
+
+// Close takes the peer out of its room
+func (p *Peer) Close() {
+	p.client.close()
+}
+
+// localPump delivers queued messages to an in-process peer until it is closed
+func (c *Client) localPump(deliver func(Message)) {
+	for {
+		select {
+		case data := <-c.send:
+			var msg Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				log.Printf("Signaling failed to decode message for %s: %v", c.UserID(), err)
+				continue
+			}
+			deliver(msg)
+
+		case <-c.done:
+			return
+		}
+	}
+}
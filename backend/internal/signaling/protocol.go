@@ -0,0 +1,608 @@
+package signaling
+
+import (
+	"encoding/json"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// Message types exchanged on the signaling socket
+const (
+	// Client -> server
+	TypeJoin            = "join"
+	TypeGetParticipants = "getParticipants"
+	TypePing            = "ping"
+	TypeGetICEServers   = "getIceServers" // fresh TURN credentials before the joined ones expire
+	TypeGetLobby        = "getLobby"
+	TypeLobbyAdmit      = "lobbyAdmit"
+	TypeLobbyDeny       = "lobbyDeny"
+
+	// Moderation, client -> server (hosts and co-hosts only)
+	TypeMuteParticipant   = "muteParticipant"
+	TypeDisableCamera     = "disableCamera"
+	TypeRemoveParticipant = "removeParticipant"
+	TypeLockMeeting       = "lockMeeting"
+	TypeEndMeeting        = "endMeeting"
+
+	// Chat, client -> server
+	TypeChatSend   = "chatSend"
+	TypeChatEdit   = "chatEdit"
+	TypeChatDelete = "chatDelete"
+
+	// Reactions and raised hands, client -> server. Only moderators may
+	// list or clear hands, or lower someone else's.
+	TypeReaction   = "reaction"
+	TypeRaiseHand  = "raiseHand"
+	TypeLowerHand  = "lowerHand"
+	TypeGetHands   = "getHands"
+	TypeClearHands = "clearHands"
+
+	// Breakout rooms, client -> server. Only moderators may open, close,
+	// assign or broadcast; anyone may list them, pick a room in self-select
+	// mode and, where the session allows it, return to the main room.
+	TypeBreakoutOpen      = "breakoutOpen"
+	TypeBreakoutAssign    = "breakoutAssign"
+	TypeBreakoutBroadcast = "breakoutBroadcast"
+	TypeBreakoutClose     = "breakoutClose"
+	TypeBreakoutJoin      = "breakoutJoin"
+	TypeBreakoutLeave     = "breakoutLeave"
+	TypeGetBreakouts      = "getBreakouts"
+
+	// Screen sharing, client -> server. Hosts, co-hosts and presenters may
+	// share; only moderators may stop someone else's share or grant and
+	// revoke the presenter role.
+	TypeScreenShareStart = "screenShareStart"
+	TypeScreenShareStop  = "screenShareStop"
+	TypeGetScreenShares  = "getScreenShares"
+	TypeGrantPresenter   = "grantPresenter"
+	TypeRevokePresenter  = "revokePresenter"
+
+	// Relayed between peers
+	TypeOffer        = "offer"
+	TypeAnswer       = "answer"
+	TypeICECandidate = "iceCandidate"
+	// Relayed to the media server in SFU mode
+	TypeSelectLayer = "selectLayer"
+
+	// Chat signals relayed to the rest of the room
+	TypeChatTyping = "chatTyping"
+	TypeChatRead   = "chatRead"
+
+	// Server -> client
+	TypeJoined       = "joined"
+	TypeUserJoined   = "userJoined"
+	TypeUserLeft     = "userLeft"
+	TypeParticipants = "participants"
+	TypePong         = "pong"
+	TypeError        = "error"
+
+	// Waiting room, server -> client
+	TypeLobbyWaiting = "lobbyWaiting" // to the knocker while it waits
+	TypeLobbyDenied  = "lobbyDenied"  // to the knocker when refused
+	TypeLobbyRequest = "lobbyRequest" // to moderators when someone knocks
+	TypeLobbyLeft    = "lobbyLeft"    // to moderators when a knocker leaves the lobby
+	TypeLobby        = "lobby"        // to moderators, the current lobby
+
+	// Moderation, server -> client
+	TypeModeration = "moderation" // to the whole room when a moderator acts
+
+	// Chat, server -> client
+	TypeChatMessage = "chatMessage" // to the whole room, the sender included
+	TypeChatEdited  = "chatEdited"
+	TypeChatDeleted = "chatDeleted"
+	TypeChatHistory = "chatHistory" // to a joiner, the recent messages
+	TypeChatHeld    = "chatHeld"    // to moderators, a message hidden for review
+
+	// Reactions and raised hands, server -> client. Reactions are also sent
+	// to the whole room, the sender included.
+	TypeHandRaised   = "handRaised"
+	TypeHandLowered  = "handLowered"
+	TypeHandsCleared = "handsCleared"
+	TypeHands        = "hands" // the raised hands, in the order they went up
+
+	// Breakout rooms, server -> client. A moved client then receives joined
+	// for its new room, as on a fresh join.
+	TypeBreakoutsOpened = "breakoutsOpened" // to the whole meeting
+	TypeBreakoutMoved   = "breakoutMoved"   // to a client changing rooms
+	TypeBreakoutMessage = "breakoutMessage" // to the whole meeting, from a host
+	TypeBreakoutsClosed = "breakoutsClosed" // to the whole meeting, before everyone is recalled
+	TypeBreakouts       = "breakouts"       // the open session and who is in each room
+
+	// Screen sharing, server -> client, to the whole room
+	TypeScreenShareStarted = "screenShareStarted"
+	TypeScreenShareStopped = "screenShareStopped"
+	TypeScreenShares       = "screenShares" // the active shares, also sent to joiners
+	TypeRoleChanged        = "roleChanged"
+
+	// Media, server -> client
+	TypeMediaMode  = "mediaMode" // to the whole room when it moves between mesh and SFU
+	TypeICEServers = "iceServers"
+)
+
+// Error codes carried in ErrorPayload
+const (
+	ErrCodeInvalidRequest = "invalidRequest"
+	ErrCodeUnknownType    = "unknownType"
+	ErrCodeAlreadyJoined  = "alreadyJoined"
+	ErrCodeNotInRoom      = "notInRoom"
+	ErrCodeJoinRefused    = "joinRefused"
+	ErrCodeInLobby        = "inLobby"
+	ErrCodeForbidden      = "forbidden"
+	ErrCodeRoomFull       = "roomFull"
+	ErrCodeChatDisabled   = "chatDisabled"
+	ErrCodeChatRateLimit  = "chatRateLimited"
+	ErrCodeChatHeld       = "chatHeld"
+
+	ErrCodeReactionsDisabled = "reactionsDisabled"
+	ErrCodeRaiseHandDisabled = "raiseHandDisabled"
+	ErrCodeRateLimited       = "rateLimited"
+	ErrCodeBreakoutsDisabled = "breakoutsDisabled"
+
+	ErrCodeScreenShareDisabled = "screenShareDisabled"
+	ErrCodeScreenShareBusy     = "screenShareBusy"
+)
+
+// Overflow options a joiner may request for when the room is full
+const (
+	OverflowLobby    = "lobby"    // wait in the lobby for a seat
+	OverflowViewOnly = "viewOnly" // join without a seat, receiving media only
+)
+
+// Message is the envelope for every frame exchanged on the signaling socket
+type Message struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// NewMessage builds a message with the given payload encoded as JSON
+func NewMessage(msgType string, payload interface{}) (Message, error) {
+	msg := Message{Type: msgType}
+	if payload == nil {
+		return msg, nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return msg, err
+	}
+	msg.Payload = data
+	return msg, nil
+}
+
+// DecodePayload unmarshals the message payload into v
+func (m Message) DecodePayload(v interface{}) error {
+	if len(m.Payload) == 0 {
+		return nil
+	}
+	return json.Unmarshal(m.Payload, v)
+}
+
+// JoinPayload is sent by a client to enter a meeting room
+type JoinPayload struct {
+	RoomID string `json:"roomId"`
+	// Overflow is what to do if the room is full; empty refuses the join
+	Overflow string `json:"overflow,omitempty"`
+}
+
+// SignalPayload carries an SDP or ICE candidate towards a peer. ScreenShare
+// marks an offer carrying a screen track, which only an active sharer may send.
+type SignalPayload struct {
+	TargetID    string          `json:"targetId,omitempty"`
+	SDP         json.RawMessage `json:"sdp,omitempty"`
+	Candidate   json.RawMessage `json:"candidate,omitempty"`
+	ScreenShare bool            `json:"screenShare,omitempty"`
+}
+
+// RelayedSignalPayload is an SDP or ICE candidate delivered to its target
+type RelayedSignalPayload struct {
+	SenderID    string          `json:"senderId"`
+	SDP         json.RawMessage `json:"sdp,omitempty"`
+	Candidate   json.RawMessage `json:"candidate,omitempty"`
+	ScreenShare bool            `json:"screenShare,omitempty"`
+}
+
+// Participant describes a member of a room
+type Participant struct {
+	UserID       string     `json:"userId"`
+	UserName     string     `json:"userName"`
+	Role         string     `json:"role,omitempty"`
+	ViewOnly     bool       `json:"viewOnly,omitempty"`
+	HandRaisedAt *time.Time `json:"handRaisedAt,omitempty"`
+}
+
+// JoinedPayload confirms a successful join to the joining client
+type JoinedPayload struct {
+	RoomID       string        `json:"roomId"`
+	Self         Participant   `json:"self"`
+	Participants []Participant `json:"participants"`
+	Media        *MediaPayload `json:"media,omitempty"`
+	// ICE lists the STUN and TURN servers to connect through, with TURN
+	// credentials for this participant
+	ICE *models.ICEConfig `json:"ice,omitempty"`
+}
+
+// UserLeftPayload announces that a participant left the room
+type UserLeftPayload struct {
+	UserID string `json:"userId"`
+}
+
+// ErrorPayload describes why a request was refused
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// RoomFullPayload is the error sent when a join finds no free seat. It
+// lists the overflow options the client may retry with.
+type RoomFullPayload struct {
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Limit    int      `json:"limit"`
+	Overflow []string `json:"overflow"`
+}
+
+// Reasons a knocker is kept in the lobby
+const (
+	LobbyReasonApproval = "approval" // a moderator has to admit it
+	LobbyReasonRoomFull = "roomFull" // it is waiting for a free seat
+)
+
+// LobbyWaitingPayload tells a knocker it is waiting to be admitted
+type LobbyWaitingPayload struct {
+	RoomID string `json:"roomId"`
+	Reason string `json:"reason"`
+}
+
+// LobbyDeniedPayload tells a knocker it was refused entry
+type LobbyDeniedPayload struct {
+	RoomID string `json:"roomId"`
+}
+
+// LobbyDecisionPayload is sent by a moderator to admit or deny knockers.
+// All applies the decision to everyone currently waiting.
+type LobbyDecisionPayload struct {
+	UserIDs []string `json:"userIds,omitempty"`
+	All     bool     `json:"all,omitempty"`
+}
+
+// Outcomes reported in LobbyLeftPayload
+const (
+	LobbyOutcomeAdmitted = "admitted"
+	LobbyOutcomeDenied   = "denied"
+	LobbyOutcomeLeft     = "left"
+)
+
+// LobbyLeftPayload tells moderators a knocker is no longer waiting
+type LobbyLeftPayload struct {
+	UserID  string `json:"userId"`
+	Outcome string `json:"outcome"`
+}
+
+// LobbyPayload lists the knockers waiting to be admitted
+type LobbyPayload struct {
+	Waiting []Participant `json:"waiting"`
+}
+
+// Moderation actions reported in ModerationPayload
+const (
+	ModerationMute          = "mute"
+	ModerationDisableCamera = "disableCamera"
+	ModerationRemove        = "remove"
+	ModerationLock          = "lock"
+	ModerationUnlock        = "unlock"
+	ModerationEndMeeting    = "endMeeting"
+)
+
+// ModerationTargetPayload names the participant a moderator acts on. All
+// applies the action to every participant except moderators.
+type ModerationTargetPayload struct {
+	TargetID string `json:"targetId,omitempty"`
+	All      bool   `json:"all,omitempty"`
+}
+
+// RemoveParticipantPayload removes a participant, optionally banning it
+// for the rest of the meeting
+type RemoveParticipantPayload struct {
+	TargetID string `json:"targetId"`
+	Ban      bool   `json:"ban,omitempty"`
+}
+
+// LockMeetingPayload locks or unlocks the meeting to new joins
+type LockMeetingPayload struct {
+	Locked bool `json:"locked"`
+}
+
+// ModerationPayload announces a moderation action to the room. Clients
+// named by TargetID (or every non-moderator when All is set) must apply
+// mute and camera actions locally.
+type ModerationPayload struct {
+	Action   string `json:"action"`
+	ActorID  string `json:"actorId"`
+	TargetID string `json:"targetId,omitempty"`
+	All      bool   `json:"all,omitempty"`
+	Banned   bool   `json:"banned,omitempty"`
+}
+
+// ChatSendPayload posts a chat message to the room, or privately to
+// RecipientID or to the hosts. ClientMessageID is echoed back so the sender
+// can match the stored message to its draft.
+type ChatSendPayload struct {
+	Message         string `json:"message"`
+	MessageType     string `json:"messageType,omitempty"`
+	ReplyToID       *int   `json:"replyToId,omitempty"`
+	RecipientID     string `json:"recipientId,omitempty"`
+	ToHosts         bool   `json:"toHosts,omitempty"`
+	ClientMessageID string `json:"clientMessageId,omitempty"`
+}
+
+// ChatEditPayload replaces the text of one of the sender's messages
+type ChatEditPayload struct {
+	MessageID int    `json:"messageId"`
+	Message   string `json:"message"`
+}
+
+// ChatMessageRefPayload names a chat message to delete or mark as read
+type ChatMessageRefPayload struct {
+	MessageID int `json:"messageId"`
+}
+
+// ChatMessagePayload is a stored chat message
+type ChatMessagePayload struct {
+	ID              int       `json:"id"`
+	SenderID        string    `json:"senderId"`
+	SenderName      string    `json:"senderName"`
+	Message         string    `json:"message"`
+	MessageType     string    `json:"messageType"`
+	ReplyToID       *int      `json:"replyToId,omitempty"`
+	Private         bool      `json:"private,omitempty"`
+	RecipientID     string    `json:"recipientId,omitempty"`
+	ToHosts         bool      `json:"toHosts,omitempty"`
+	Edited          bool      `json:"edited,omitempty"`
+	HeldReason      string    `json:"heldReason,omitempty"` // why moderation hid it, in chatHeld
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+	ClientMessageID string    `json:"clientMessageId,omitempty"`
+
+	Attachments []ChatAttachmentPayload `json:"attachments,omitempty"`
+}
+
+// ChatAttachmentPayload is a file attached to a chat message. Its links are
+// signed and stop working at ExpiresAt.
+type ChatAttachmentPayload struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	ContentType  string     `json:"contentType"`
+	Size         int64      `json:"size"`
+	Width        int        `json:"width,omitempty"`
+	Height       int        `json:"height,omitempty"`
+	URL          string     `json:"url"`
+	ThumbnailURL string     `json:"thumbnailUrl,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+}
+
+// ChatDeletedPayload tells the room a message was removed
+type ChatDeletedPayload struct {
+	MessageID int    `json:"messageId"`
+	DeletedBy string `json:"deletedBy"`
+}
+
+// ChatTypingPayload starts or stops a typing indicator. The server fills
+// in the typist before relaying it.
+type ChatTypingPayload struct {
+	UserID   string `json:"userId,omitempty"`
+	UserName string `json:"userName,omitempty"`
+	Typing   bool   `json:"typing"`
+}
+
+// ChatReadPayload is a read receipt: the reader has seen every message up
+// to MessageID. The server fills in the reader before relaying it.
+type ChatReadPayload struct {
+	UserID    string `json:"userId,omitempty"`
+	MessageID int    `json:"messageId"`
+}
+
+// ChatHistoryPayload carries the room's recent messages, oldest first
+type ChatHistoryPayload struct {
+	Messages []ChatMessagePayload `json:"messages"`
+}
+
+// ReactionPayload is an emoji reaction. The server fills in the sender
+// before relaying it.
+type ReactionPayload struct {
+	UserID   string `json:"userId,omitempty"`
+	UserName string `json:"userName,omitempty"`
+	Emoji    string `json:"emoji"`
+}
+
+// HandPayload is a raised hand
+type HandPayload struct {
+	UserID   string    `json:"userId"`
+	UserName string    `json:"userName"`
+	RaisedAt time.Time `json:"raisedAt"`
+}
+
+// LowerHandPayload lowers the sender's hand, or as a moderator TargetID's
+type LowerHandPayload struct {
+	TargetID string `json:"targetId,omitempty"`
+}
+
+// HandLoweredPayload tells the room a hand went down
+type HandLoweredPayload struct {
+	UserID    string `json:"userId"`
+	LoweredBy string `json:"loweredBy"`
+}
+
+// HandsClearedPayload tells the room a moderator lowered every hand
+type HandsClearedPayload struct {
+	ClearedBy string `json:"clearedBy"`
+}
+
+// HandsPayload lists the raised hands, longest waiting first
+type HandsPayload struct {
+	Hands []HandPayload `json:"hands"`
+}
+
+// BreakoutOpenPayload splits the meeting into breakout rooms. Manual mode
+// takes Rooms with the participants placed in each; the other modes take
+// Count rooms, named automatically unless Rooms names them. A zero Duration
+// keeps the rooms open until a host closes them.
+type BreakoutOpenPayload struct {
+	Mode            string             `json:"mode"`
+	Count           int                `json:"count,omitempty"`
+	Rooms           []BreakoutRoomSpec `json:"rooms,omitempty"`
+	DurationSeconds int                `json:"durationSeconds,omitempty"`
+	AllowReturn     bool               `json:"allowReturn,omitempty"`
+}
+
+// BreakoutRoomSpec names a breakout room and, in manual mode, the
+// participants placed in it
+type BreakoutRoomSpec struct {
+	Name           string   `json:"name,omitempty"`
+	ParticipantIDs []string `json:"participantIds,omitempty"`
+}
+
+// BreakoutAssignPayload moves a participant into a breakout room, or back
+// to the main room when BreakoutRoomID is zero
+type BreakoutAssignPayload struct {
+	UserID         string `json:"userId"`
+	BreakoutRoomID int    `json:"breakoutRoomId,omitempty"`
+}
+
+// BreakoutJoinPayload moves the sender into a breakout room
+type BreakoutJoinPayload struct {
+	BreakoutRoomID int `json:"breakoutRoomId"`
+}
+
+// BreakoutMessagePayload is a host's message to every room. The server
+// fills in the sender before relaying it.
+type BreakoutMessagePayload struct {
+	UserID   string `json:"userId,omitempty"`
+	UserName string `json:"userName,omitempty"`
+	Message  string `json:"message"`
+}
+
+// BreakoutsPayload describes the open breakout session
+type BreakoutsPayload struct {
+	SessionID   int                   `json:"sessionId"`
+	Mode        string                `json:"mode"`
+	AllowReturn bool                  `json:"allowReturn"`
+	StartedAt   time.Time             `json:"startedAt"`
+	EndsAt      *time.Time            `json:"endsAt,omitempty"`
+	Rooms       []BreakoutRoomPayload `json:"rooms"`
+}
+
+// BreakoutRoomPayload is a breakout room with the participants assigned to
+// it and, when listed, those currently in it
+type BreakoutRoomPayload struct {
+	ID           int           `json:"id"`
+	RoomID       string        `json:"roomId"`
+	Name         string        `json:"name"`
+	Assigned     []string      `json:"assigned"`
+	Participants []Participant `json:"participants,omitempty"`
+}
+
+// BreakoutMovedPayload tells a client which room it now belongs to.
+// BreakoutRoom is nil when it moved back to the main room.
+type BreakoutMovedPayload struct {
+	UserID       string               `json:"userId"`
+	RoomID       string               `json:"roomId"`
+	BreakoutRoom *BreakoutRoomPayload `json:"breakoutRoom,omitempty"`
+}
+
+// Reasons reported in BreakoutsClosedPayload
+const (
+	BreakoutsClosedByHost  = "host"
+	BreakoutsClosedByTimer = "timer"
+)
+
+// BreakoutsClosedPayload announces that everyone is being recalled to the
+// main room
+type BreakoutsClosedPayload struct {
+	Reason   string `json:"reason"`
+	ClosedBy string `json:"closedBy,omitempty"`
+}
+
+// ScreenSharePayload starts a screen share, naming the media stream that
+// carries it so peers can tell it apart from the camera. The server fills in
+// the sharer when announcing it. In SFU mode the router forwards video from
+// StreamID only while the share lasts, so the share must start before its
+// track is added; in mesh mode media flows between peers and the limit on
+// shares relies on clients honouring it.
+type ScreenSharePayload struct {
+	UserID    string    `json:"userId,omitempty"`
+	UserName  string    `json:"userName,omitempty"`
+	StreamID  string    `json:"streamId,omitempty"`
+	StartedAt time.Time `json:"startedAt,omitempty"`
+}
+
+// ScreenShareStopPayload stops the sender's share or, for a moderator,
+// TargetID's
+type ScreenShareStopPayload struct {
+	TargetID string `json:"targetId,omitempty"`
+}
+
+// Reasons reported in ScreenShareStoppedPayload
+const (
+	ScreenShareStoppedBySharer    = "stopped"
+	ScreenShareStoppedByModerator = "moderator"
+	ScreenShareStoppedRoleRevoked = "roleRevoked"
+	ScreenShareStoppedLeft        = "left"
+)
+
+// ScreenShareStoppedPayload announces the end of a share. Peers should drop
+// the sharer's screen stream.
+type ScreenShareStoppedPayload struct {
+	UserID    string `json:"userId"`
+	StoppedBy string `json:"stoppedBy,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// ScreenSharesPayload lists the room's active shares, oldest first
+type ScreenSharesPayload struct {
+	Shares []ScreenSharePayload `json:"shares"`
+	Limit  int                  `json:"limit"`
+}
+
+// PresenterPayload grants or revokes the presenter role
+type PresenterPayload struct {
+	UserID string `json:"userId"`
+}
+
+// RoleChangedPayload announces a member's new role
+type RoleChangedPayload struct {
+	UserID    string `json:"userId"`
+	Role      string `json:"role"`
+	ChangedBy string `json:"changedBy"`
+}
+
+// Media modes reported in MediaPayload
+const (
+	MediaModeMesh = "mesh" // participants connect to each other
+	MediaModeSFU  = "sfu"  // participants connect only to the media server
+)
+
+// MediaPayload tells clients how to exchange media in the room. In SFU mode
+// each client sends a single offer to PeerID, which forwards the other
+// participants' tracks with IDs of the form "<userId>:<trackId>" in streams
+// labelled "<userId>:<streamId>". The media server renegotiates as tracks
+// come and go; when both sides offer at once the client rolls its offer back.
+type MediaPayload struct {
+	Mode   string `json:"mode"`
+	PeerID string `json:"peerId,omitempty"`
+}
+
+// LayerPayload asks the media server to forward another simulcast layer of
+// a track, by its RID ("q", "h" or "f" by convention)
+type LayerPayload struct {
+	TargetID string `json:"targetId"`
+	TrackID  string `json:"trackId"`
+	Layer    string `json:"layer"`
+}
+
+// RelayedLayerPayload is a layer request delivered to the media server
+type RelayedLayerPayload struct {
+	SenderID string `json:"senderId"`
+	TrackID  string `json:"trackId"`
+	Layer    string `json:"layer"`
+}
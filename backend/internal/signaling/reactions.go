@@ -0,0 +1,331 @@
+package signaling
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// maxEngagementBuffer caps the events held between flushes; further events
+// are dropped while the database is unreachable
+const maxEngagementBuffer = 10000
+
+// ReactionEmojis are the reactions participants may send
+var ReactionEmojis = []string{"👍", "👎", "👏", "❤️", "😂", "😮", "😢", "🎉", "🤔", "🙌"}
+
+func validReaction(emoji string) bool {
+	for _, known := range ReactionEmojis {
+		if emoji == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) reactionsOnly(next messageHandler) messageHandler {
+	return func(c *Client, msg Message) {
+		if !c.ReactionsEnabled() {
+			c.SendError(ErrCodeReactionsDisabled, "reactions are disabled for this meeting")
+			return
+		}
+		next(c, msg)
+	}
+}
+
+func (h *Hub) raiseHandOnly(next messageHandler) messageHandler {
+	return func(c *Client, msg Message) {
+		if !c.RaiseHandEnabled() {
+			c.SendError(ErrCodeRaiseHandDisabled, "raising hands is disabled for this meeting")
+			return
+		}
+		next(c, msg)
+	}
+}
+
+// allowReaction reports whether the client is within its reaction rate
+// limit, counting the reaction if it is
+func (c *Client) allowReaction(limit int, window time.Duration) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	recent := c.reactionsAt[:0]
+	for _, at := range c.reactionsAt {
+		if now.Sub(at) < window {
+			recent = append(recent, at)
+		}
+	}
+	c.reactionsAt = recent
+
+	if len(recent) >= limit {
+		return false
+	}
+	c.reactionsAt = append(c.reactionsAt, now)
+	return true
+}
+
+// setHand raises or lowers the client's hand, reporting whether it changed
+func (c *Client) setHand(raised bool) (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if raised == (c.handRaisedAt != nil) {
+		return time.Time{}, false
+	}
+	if !raised {
+		c.handRaisedAt = nil
+		return time.Time{}, true
+	}
+	now := time.Now().UTC()
+	c.handRaisedAt = &now
+	return now, true
+}
+
+// handleReaction relays a reaction to the whole room. Reactions are not
+// stored with the chat, only counted in the meeting's analytics.
+func (h *Hub) handleReaction(c *Client, msg Message) {
+	var payload ReactionPayload
+	if err := msg.DecodePayload(&payload); err != nil || !validReaction(payload.Emoji) {
+		c.SendError(ErrCodeInvalidRequest, "unsupported reaction")
+		return
+	}
+
+	if !c.allowReaction(h.config.ReactionLimit, h.config.ReactionWindow) {
+		c.SendError(ErrCodeRateLimited, "sending reactions too quickly")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		return
+	}
+
+	reaction, _ := NewMessage(TypeReaction, ReactionPayload{
+		UserID:   c.UserID(),
+		UserName: c.identity.UserName,
+		Emoji:    payload.Emoji,
+	})
+	h.broadcast(room, reaction, "")
+
+	h.recordEngagement(c, models.EngagementReaction, &payload.Emoji)
+}
+
+func (h *Hub) handleRaiseHand(c *Client, msg Message) {
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	raisedAt, changed := c.setHand(true)
+	if !changed {
+		return
+	}
+	h.updatePresence(room, c)
+
+	event, _ := NewMessage(TypeHandRaised, HandPayload{
+		UserID:   c.UserID(),
+		UserName: c.identity.UserName,
+		RaisedAt: raisedAt,
+	})
+	h.broadcast(room, event, "")
+
+	h.recordEngagement(c, models.EngagementHandRaised, nil)
+}
+
+// handleLowerHand lowers the sender's own hand, or as a moderator someone
+// else's
+func (h *Hub) handleLowerHand(c *Client, msg Message) {
+	var payload LowerHandPayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		c.SendError(ErrCodeInvalidRequest, "invalid lowerHand payload")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	targetID := payload.TargetID
+	if targetID == "" || targetID == c.UserID() {
+		if h.lowerHand(room, c) {
+			h.announceHandLowered(room, c.UserID(), c.UserID())
+		}
+		return
+	}
+
+	if !c.IsModerator() {
+		c.SendError(ErrCodeForbidden, "only hosts and co-hosts can lower other hands")
+		return
+	}
+
+	target, ok := h.member(room, targetID)
+	if !ok || target.HandRaisedAt == nil {
+		c.SendError(ErrCodeInvalidRequest, "participant does not have a raised hand")
+		return
+	}
+
+	if local, ok := room.client(targetID); ok {
+		h.lowerHand(room, local)
+	} else {
+		h.publish(Envelope{RoomID: room.ID, Kind: EnvelopeLowerHand, TargetID: targetID})
+	}
+	h.announceHandLowered(room, targetID, c.UserID())
+}
+
+func (h *Hub) announceHandLowered(room *Room, userID, loweredBy string) {
+	event, _ := NewMessage(TypeHandLowered, HandLoweredPayload{UserID: userID, LoweredBy: loweredBy})
+	h.broadcast(room, event, "")
+}
+
+func (h *Hub) handleGetHands(c *Client, msg Message) {
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	reply, _ := NewMessage(TypeHands, HandsPayload{Hands: h.hands(room)})
+	c.Send(reply)
+}
+
+// handleClearHands lowers every hand in the room, on every node
+func (h *Hub) handleClearHands(c *Client, msg Message) {
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	h.lowerLocalHands(room, "")
+	h.publish(Envelope{RoomID: room.ID, Kind: EnvelopeLowerHand})
+
+	log.Printf("Moderator %s cleared raised hands in room %s", c.UserID(), room.ID)
+
+	event, _ := NewMessage(TypeHandsCleared, HandsClearedPayload{ClearedBy: c.UserID()})
+	h.broadcast(room, event, "")
+}
+
+// lowerLocalHands lowers the hand of targetID, or of every member when it is
+// empty, among the members connected to this node
+func (h *Hub) lowerLocalHands(room *Room, targetID string) {
+	for _, c := range room.members() {
+		if targetID == "" || c.UserID() == targetID {
+			h.lowerHand(room, c)
+		}
+	}
+}
+
+// lowerHand lowers a local member's hand, reporting whether it was raised
+func (h *Hub) lowerHand(room *Room, c *Client) bool {
+	if _, changed := c.setHand(false); !changed {
+		return false
+	}
+	h.updatePresence(room, c)
+	h.recordEngagement(c, models.EngagementHandLowered, nil)
+	return true
+}
+
+// updatePresence publishes a change to a member's state to the other nodes
+// without waiting for the next refresh
+func (h *Hub) updatePresence(room *Room, c *Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.setPresence(ctx, room, c); err != nil {
+		log.Printf("Signaling failed to update presence for %s: %v", c.UserID(), err)
+	}
+}
+
+// hands lists the room's raised hands across all nodes, longest waiting first
+func (h *Hub) hands(room *Room) []HandPayload {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	members, err := h.backplane.ListPresence(ctx, room.ID)
+	if err != nil {
+		log.Printf("Signaling failed to list presence for %s, using local members: %v", room.ID, err)
+		members = nil
+		for _, c := range room.members() {
+			members = append(members, h.presenceOf(c))
+		}
+	}
+
+	hands := make([]HandPayload, 0)
+	for _, p := range members {
+		if p.HandRaisedAt != nil && !p.Hidden {
+			hands = append(hands, HandPayload{UserID: p.UserID, UserName: p.UserName, RaisedAt: *p.HandRaisedAt})
+		}
+	}
+	sort.Slice(hands, func(i, j int) bool {
+		return hands[i].RaisedAt.Before(hands[j].RaisedAt)
+	})
+	return hands
+}
+
+// recordEngagement buffers a reaction or hand event for the meeting's
+// analytics
+func (h *Hub) recordEngagement(c *Client, eventType string, value *string) {
+	meeting := c.Meeting()
+	if meeting == nil || c.Hidden() {
+		return
+	}
+
+	event := &models.MeetingEngagementEvent{
+		MeetingID:   meeting.ID,
+		ActorUserID: c.identity.AccountID,
+		ActorID:     c.UserID(),
+		ActorName:   c.identity.UserName,
+		EventType:   eventType,
+		Value:       value,
+		CreatedAt:   time.Now(),
+	}
+
+	h.engagementMutex.Lock()
+	defer h.engagementMutex.Unlock()
+	if len(h.engagement) >= maxEngagementBuffer {
+		return
+	}
+	h.engagement = append(h.engagement, event)
+}
+
+// flushEngagement periodically writes buffered engagement events, and once
+// more when the hub stops
+func (h *Hub) flushEngagement() {
+	ticker := time.NewTicker(h.config.EngagementFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			h.writeEngagement()
+			return
+		case <-ticker.C:
+			h.writeEngagement()
+		}
+	}
+}
+
+func (h *Hub) writeEngagement() {
+	h.engagementMutex.Lock()
+	events := h.engagement
+	h.engagement = nil
+	h.engagementMutex.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.services.Meeting.RecordEngagementEvents(ctx, events); err != nil {
+		log.Printf("Signaling failed to record %d engagement events: %v", len(events), err)
+	}
+}
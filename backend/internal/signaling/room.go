@@ -0,0 +1,221 @@
+package signaling
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// Room is a signaling room backed by a meeting
+type Room struct {
+	ID      string
+	Meeting *models.Meeting
+	// Breakout is set on the breakout rooms of a meeting, which point at
+	// its main room
+	Breakout *models.BreakoutRoom
+	parent   *Room
+
+	breakouts      *BreakoutsPayload // main room: the open breakout session, if any
+	timedBreakouts map[int]bool      // main room: breakout sessions whose end this node has timed
+	sfuPeer        string            // the media server this node runs for the room, if any
+	clients        map[string]*Client
+	lobby          map[string]*Client // knockers on this node waiting for admission
+	mutex          sync.RWMutex
+	unsubscribe    func()
+}
+
+func newRoom(id string, meeting *models.Meeting) *Room {
+	return &Room{
+		ID:      id,
+		Meeting: meeting,
+		clients: make(map[string]*Client),
+		lobby:   make(map[string]*Client),
+	}
+}
+
+// main returns the meeting's main room: the room itself, or the parent of
+// a breakout room
+func (r *Room) main() *Room {
+	if r.parent != nil {
+		return r.parent
+	}
+	return r
+}
+
+// openBreakouts returns the breakout session this node knows to be open in
+// the main room, or nil
+func (r *Room) openBreakouts() *BreakoutsPayload {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.breakouts
+}
+
+func (r *Room) setBreakouts(breakouts *BreakoutsPayload) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.breakouts = breakouts
+}
+
+// timeBreakouts reports whether this node has yet to time the end of the
+// breakout session, marking it timed
+func (r *Room) timeBreakouts(sessionID int) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.timedBreakouts[sessionID] {
+		return false
+	}
+	if r.timedBreakouts == nil {
+		r.timedBreakouts = make(map[int]bool)
+	}
+	r.timedBreakouts[sessionID] = true
+	return true
+}
+
+// add places the client in the room, returning any connection it replaced
+func (r *Room) add(c *Client) *Client {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	previous := r.clients[c.UserID()]
+	r.clients[c.UserID()] = c
+	return previous
+}
+
+// remove takes the client out of the room, returning the remaining member count.
+// A newer connection for the same user is left in place.
+func (r *Room) remove(c *Client) (bool, int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.clients[c.UserID()] != c {
+		return false, len(r.clients)
+	}
+	delete(r.clients, c.UserID())
+	return true, len(r.clients)
+}
+
+// client returns the member with the given user ID
+func (r *Room) client(userID string) (*Client, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	c, ok := r.clients[userID]
+	return c, ok
+}
+
+// members returns a snapshot of the room's clients
+func (r *Room) members() []*Client {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	clients := make([]*Client, 0, len(r.clients))
+	for _, c := range r.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// addWaiting parks the client in the lobby, returning any connection it replaced
+func (r *Room) addWaiting(c *Client) *Client {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	previous := r.lobby[c.UserID()]
+	r.lobby[c.UserID()] = c
+	return previous
+}
+
+// removeWaiting takes the client out of the lobby, reporting whether it was there
+func (r *Room) removeWaiting(c *Client) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.lobby[c.UserID()] != c {
+		return false
+	}
+	delete(r.lobby, c.UserID())
+	return true
+}
+
+// admit moves a knocker from the lobby into the room in one step, so two
+// moderators deciding at once admit it only once
+func (r *Room) admit(c *Client) (bool, *Client) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.lobby[c.UserID()] != c {
+		return false, nil
+	}
+	delete(r.lobby, c.UserID())
+
+	previous := r.clients[c.UserID()]
+	r.clients[c.UserID()] = c
+	return true, previous
+}
+
+// waiting returns the knocker with the given user ID
+func (r *Room) waiting(userID string) (*Client, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	c, ok := r.lobby[userID]
+	return c, ok
+}
+
+// waitingMembers returns a snapshot of the knockers on this node
+func (r *Room) waitingMembers() []*Client {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	clients := make([]*Client, 0, len(r.lobby))
+	for _, c := range r.lobby {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// queuedMembers returns the knockers on this node waiting only for a seat,
+// oldest first
+func (r *Room) queuedMembers() []*Client {
+	type queuedClient struct {
+		client *Client
+		since  time.Time
+	}
+
+	r.mutex.RLock()
+	queue := make([]queuedClient, 0)
+	for _, c := range r.lobby {
+		c.mutex.RLock()
+		if c.queued {
+			queue = append(queue, queuedClient{client: c, since: c.queuedAt})
+		}
+		c.mutex.RUnlock()
+	}
+	r.mutex.RUnlock()
+
+	sort.Slice(queue, func(i, j int) bool {
+		return queue[i].since.Before(queue[j].since)
+	})
+
+	clients := make([]*Client, len(queue))
+	for i, q := range queue {
+		clients[i] = q.client
+	}
+	return clients
+}
+
+// empty reports whether the room has neither members nor knockers on this node
+func (r *Room) empty() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.clients) == 0 && len(r.lobby) == 0
+}
+
+// size returns the number of clients in the room
+func (r *Room) size() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.clients)
+}
@@ -0,0 +1,317 @@
+package signaling
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"video-conference-backend/internal/models"
+)
+
+// screenShareKey is the backplane presence key holding a room's active
+// screen shares
+func screenShareKey(roomID string) string {
+	return roomID + ":screen"
+}
+
+func (h *Hub) screenShareOnly(next messageHandler) messageHandler {
+	return func(c *Client, msg Message) {
+		if !c.ScreenShareEnabled() {
+			c.SendError(ErrCodeScreenShareDisabled, "screen sharing is disabled for this meeting")
+			return
+		}
+		next(c, msg)
+	}
+}
+
+// screenShareOf returns the client's entry in its room's set of sharers, if
+// it is sharing
+func (h *Hub) screenShareOf(c *Client) (Presence, bool) {
+	c.mutex.RLock()
+	since, stream := c.sharingSince, c.screenStream
+	c.mutex.RUnlock()
+
+	if since == nil {
+		return Presence{}, false
+	}
+	share := h.presenceOf(c)
+	share.StreamID = stream
+	share.SharingSince = since
+	return share, true
+}
+
+// screenShares lists the room's active shares across all nodes, oldest first
+func (h *Hub) screenShares(room *Room) []ScreenSharePayload {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sharers, err := h.backplane.ListPresence(ctx, screenShareKey(room.ID))
+	if err != nil {
+		log.Printf("Signaling failed to list screen shares of %s, using local members: %v", room.ID, err)
+		sharers = nil
+		for _, c := range room.members() {
+			if share, ok := h.screenShareOf(c); ok {
+				sharers = append(sharers, share)
+			}
+		}
+	}
+
+	shares := make([]ScreenSharePayload, 0, len(sharers))
+	for _, p := range sharers {
+		if p.SharingSince != nil {
+			shares = append(shares, ScreenSharePayload{
+				UserID:    p.UserID,
+				UserName:  p.UserName,
+				StreamID:  p.StreamID,
+				StartedAt: *p.SharingSince,
+			})
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].StartedAt.Before(shares[j].StartedAt)
+	})
+	return shares
+}
+
+// handleScreenShareStart claims one of the room's screen share slots for
+// the sender. Slots are claimed atomically on the backplane, so two nodes
+// never hand out the last one twice.
+func (h *Hub) handleScreenShareStart(c *Client, msg Message) {
+	var payload ScreenSharePayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		c.SendError(ErrCodeInvalidRequest, "invalid screenShareStart payload")
+		return
+	}
+
+	if !c.CanPresent() {
+		c.SendError(ErrCodeForbidden, "only hosts, co-hosts and presenters can share their screen")
+		return
+	}
+	if c.ViewOnly() || c.Hidden() {
+		c.SendError(ErrCodeForbidden, "view-only participants cannot publish media")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	now := time.Now().UTC()
+	share := h.presenceOf(c)
+	share.StreamID = payload.StreamID
+	share.SharingSince = &now
+	if current, ok := h.screenShareOf(c); ok {
+		// Restarting a share, e.g. to switch windows, keeps its place
+		share.SharingSince = current.SharingSince
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	claimed, err := h.backplane.ClaimSlot(ctx, screenShareKey(room.ID), share, h.config.PresenceTTL, Capacity{Limit: h.config.MaxScreenShares})
+	if err != nil {
+		log.Printf("Signaling failed to claim a screen share slot in %s: %v", room.ID, err)
+		c.SendError(ErrCodeInvalidRequest, "failed to start screen share")
+		return
+	}
+	if !claimed {
+		c.SendError(ErrCodeScreenShareBusy, "someone else is already sharing their screen")
+		return
+	}
+
+	c.mutex.Lock()
+	c.screenStream = share.StreamID
+	c.sharingSince = share.SharingSince
+	c.mutex.Unlock()
+
+	log.Printf("User %s started sharing their screen in room %s", c.UserID(), room.ID)
+
+	event, _ := NewMessage(TypeScreenShareStarted, ScreenSharePayload{
+		UserID:    c.UserID(),
+		UserName:  c.identity.UserName,
+		StreamID:  share.StreamID,
+		StartedAt: *share.SharingSince,
+	})
+	h.broadcast(room, event, "")
+}
+
+// handleScreenShareStop stops the sender's share or, for a moderator,
+// anyone else's
+func (h *Hub) handleScreenShareStop(c *Client, msg Message) {
+	var payload ScreenShareStopPayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		c.SendError(ErrCodeInvalidRequest, "invalid screenShareStop payload")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	targetID := payload.TargetID
+	if targetID == "" || targetID == c.UserID() {
+		if !h.releaseScreenShare(room, c, c.UserID(), ScreenShareStoppedBySharer) {
+			c.SendError(ErrCodeInvalidRequest, "you are not sharing your screen")
+		}
+		return
+	}
+
+	if !c.IsModerator() {
+		c.SendError(ErrCodeForbidden, "only hosts and co-hosts can stop someone else's screen share")
+		return
+	}
+	if !h.moderationTarget(c, room, targetID) {
+		return
+	}
+
+	sharing := false
+	for _, share := range h.screenShares(room) {
+		sharing = sharing || share.UserID == targetID
+	}
+	if !sharing {
+		c.SendError(ErrCodeInvalidRequest, "participant is not sharing their screen")
+		return
+	}
+
+	log.Printf("Moderator %s stopped the screen share of %s in room %s", c.UserID(), targetID, room.ID)
+
+	if local, ok := room.client(targetID); ok {
+		h.releaseScreenShare(room, local, c.UserID(), ScreenShareStoppedByModerator)
+	} else {
+		event, _ := NewMessage(TypeScreenShareStopped, ScreenShareStoppedPayload{
+			UserID:    targetID,
+			StoppedBy: c.UserID(),
+			Reason:    ScreenShareStoppedByModerator,
+		})
+		h.publish(Envelope{RoomID: room.ID, Kind: EnvelopeStopShare, TargetID: targetID, Message: event})
+	}
+
+	h.audit(c, models.AuditActionStopScreenShare, targetID, nil)
+}
+
+// releaseScreenShare ends a local member's share and tells the room,
+// reporting whether it was sharing
+func (h *Hub) releaseScreenShare(room *Room, c *Client, stoppedBy, reason string) bool {
+	c.mutex.Lock()
+	sharing := c.sharingSince != nil
+	c.screenStream = ""
+	c.sharingSince = nil
+	c.mutex.Unlock()
+
+	if !sharing {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := h.backplane.RemovePresence(ctx, screenShareKey(room.ID), c.UserID()); err != nil {
+		log.Printf("Signaling failed to release screen share of %s: %v", c.UserID(), err)
+	}
+
+	event, _ := NewMessage(TypeScreenShareStopped, ScreenShareStoppedPayload{
+		UserID:    c.UserID(),
+		StoppedBy: stoppedBy,
+		Reason:    reason,
+	})
+	h.broadcast(room, event, "")
+	return true
+}
+
+func (h *Hub) handleGetScreenShares(c *Client, msg Message) {
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	reply, _ := NewMessage(TypeScreenShares, ScreenSharesPayload{
+		Shares: h.screenShares(room),
+		Limit:  h.config.MaxScreenShares,
+	})
+	c.Send(reply)
+}
+
+func (h *Hub) handleGrantPresenter(c *Client, msg Message) {
+	h.handlePresenterRole(c, msg, models.ParticipantRolePresenter, models.AuditActionGrantPresenter)
+}
+
+// handleRevokePresenter returns a presenter to attendee, stopping any share
+// it has running
+func (h *Hub) handleRevokePresenter(c *Client, msg Message) {
+	h.handlePresenterRole(c, msg, models.ParticipantRoleAttendee, models.AuditActionRevokePresenter)
+}
+
+func (h *Hub) handlePresenterRole(c *Client, msg Message, role, auditAction string) {
+	var payload PresenterPayload
+	if err := msg.DecodePayload(&payload); err != nil || payload.UserID == "" {
+		c.SendError(ErrCodeInvalidRequest, "userId is required")
+		return
+	}
+
+	room, ok := h.room(c.RoomID())
+	if !ok {
+		c.SendError(ErrCodeNotInRoom, "room no longer exists")
+		return
+	}
+
+	if !h.moderationTarget(c, room, payload.UserID) {
+		return
+	}
+	target, _ := h.member(room, payload.UserID)
+	if target.isModerator() {
+		c.SendError(ErrCodeInvalidRequest, "hosts and co-hosts can always present")
+		return
+	}
+	if target.Role == role {
+		return
+	}
+
+	log.Printf("Moderator %s made %s %s in room %s", c.UserID(), payload.UserID, role, room.ID)
+
+	event, _ := NewMessage(TypeRoleChanged, RoleChangedPayload{
+		UserID:    payload.UserID,
+		Role:      role,
+		ChangedBy: c.UserID(),
+	})
+	if local, ok := room.client(payload.UserID); ok {
+		h.applyRole(room, local, event)
+	} else {
+		h.publish(Envelope{RoomID: room.ID, Kind: EnvelopeRole, TargetID: payload.UserID, Message: event})
+	}
+	h.broadcast(room, event, "")
+
+	h.audit(c, auditAction, payload.UserID, nil)
+}
+
+// applyRole gives a local member its new role, remembering it for the rest
+// of the meeting. A member who may no longer present stops sharing.
+func (h *Hub) applyRole(room *Room, c *Client, msg Message) {
+	var event RoleChangedPayload
+	if err := msg.DecodePayload(&event); err != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	c.role = event.Role
+	c.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if meeting := c.Meeting(); meeting != nil {
+		userID, email := c.identity.participantKey()
+		if h.participantRecord(ctx, c.identity, meeting) == nil {
+			h.recordStatus(ctx, c, models.ParticipantStatusJoined)
+		} else if err := h.services.Meeting.UpdateParticipantRole(ctx, meeting.ID, userID, email, event.Role); err != nil {
+			log.Printf("Signaling failed to record role of %s: %v", c.UserID(), err)
+		}
+	}
+
+	h.updatePresence(room, c)
+
+	if !c.CanPresent() {
+		h.releaseScreenShare(room, c, event.ChangedBy, ScreenShareStoppedRoleRevoked)
+	}
+}
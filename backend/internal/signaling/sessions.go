@@ -0,0 +1,62 @@
+package signaling
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+)
+
+// sessionsChannel is the backplane channel carrying account-wide events to
+// every node, alongside the per-room channels
+const sessionsChannel = "_sessions"
+
+// subscribeSessions listens for account-wide events from other nodes
+func (h *Hub) subscribeSessions() {
+	unsubscribe, err := h.backplane.Subscribe(sessionsChannel, func(env Envelope) {
+		if env.NodeID == h.config.NodeID {
+			return
+		}
+		if env.Kind == EnvelopeLogout {
+			h.disconnectLocal(env.TargetID)
+		}
+	})
+	if err != nil {
+		log.Printf("Signaling failed to subscribe to session events: %v", err)
+		return
+	}
+	h.unsubscribeSessions = unsubscribe
+}
+
+// DisconnectUser closes every signaling connection of an account, on every
+// node, once its sessions have been revoked. Connections are only
+// authenticated when they open, so they would otherwise outlive the
+// revocation.
+func (h *Hub) DisconnectUser(userID int) {
+	target := strconv.Itoa(userID)
+	h.disconnectLocal(target)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	env := Envelope{NodeID: h.config.NodeID, RoomID: sessionsChannel, Kind: EnvelopeLogout, TargetID: target}
+	if err := h.backplane.Publish(ctx, env); err != nil {
+		log.Printf("Signaling failed to publish logout of user %s: %v", target, err)
+	}
+}
+
+// disconnectLocal closes this node's connections of an account
+func (h *Hub) disconnectLocal(userID string) {
+	h.mutex.RLock()
+	var clients []*Client
+	for c := range h.clients {
+		if c.identity.AccountID != nil && c.UserID() == userID {
+			clients = append(clients, c)
+		}
+	}
+	h.mutex.RUnlock()
+
+	for _, c := range clients {
+		log.Printf("Signaling disconnecting %s: sessions revoked", userID)
+		c.close()
+	}
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"video-conference-backend/internal/config"
+)
+
+// s3PartSize is the part size of multipart uploads. Objects up to one part
+// are uploaded with a single request.
+const s3PartSize = 16 << 20
+
+// s3MaxCopySize is the largest object S3 copies in a single request
+const s3MaxCopySize = 5 << 30
+
+// S3Storage keeps objects in a bucket of AWS S3 or an S3-compatible service
+// such as MinIO, under a key prefix. Replicas sharing the bucket see the
+// same objects without a shared disk.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Storage creates an S3 store for the configured bucket. Keys are
+// stored below prefix.
+func NewS3Storage(cfg *config.StorageConfig, prefix string) (*S3Storage, error) {
+	if cfg.AWSBucket == "" {
+		return nil, fmt.Errorf("AWS_S3_BUCKET is required for s3 storage")
+	}
+
+	endpoint := cfg.AWSEndpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AWSAccessKey, cfg.AWSSecretKey, ""),
+		Secure: cfg.AWSUseSSL,
+		Region: cfg.AWSRegion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	return &S3Storage{client: client, bucket: cfg.AWSBucket, prefix: prefix}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	// Larger objects go up as a multipart upload, which minio-go aborts if a
+	// part fails
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s3PartSize,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) Open(ctx context.Context, key string) (Object, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	// GetObject is lazy; stat it so a missing object is reported here
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, s3Error(err)
+	}
+	return &s3Object{Object: object, info: s.info(info)}, nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, s.prefix+key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return s.info(info), nil
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix + prefix,
+		Recursive: true,
+	}) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", info.Err)
+		}
+		objects = append(objects, *s.info(info))
+	}
+	return objects, nil
+}
+
+func (s *S3Storage) Move(ctx context.Context, src, dst string) error {
+	info, err := s.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	// Copies are server side. Objects over 5 GiB are copied in parts, which
+	// does not carry over the content type.
+	to := minio.CopyDestOptions{Bucket: s.bucket, Object: s.prefix + dst}
+	from := minio.CopySrcOptions{Bucket: s.bucket, Object: s.prefix + src}
+	if info.Size <= s3MaxCopySize {
+		_, err = s.client.CopyObject(ctx, to, from)
+	} else {
+		_, err = s.client.ComposeObject(ctx, to, from)
+	}
+	if err != nil {
+		return s3Error(err)
+	}
+	return s.Delete(ctx, src)
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	err := s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) PresignGet(ctx context.Context, key string, expires time.Duration, params url.Values) (string, error) {
+	link, err := s.client.PresignedGetObject(ctx, s.bucket, s.prefix+key, expires, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign object: %w", err)
+	}
+	return link.String(), nil
+}
+
+// info converts object info, stripping the store's key prefix
+func (s *S3Storage) info(info minio.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:          strings.TrimPrefix(info.Key, s.prefix),
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+	}
+}
+
+// s3Object is an object opened from S3. Seeking issues ranged reads.
+type s3Object struct {
+	*minio.Object
+	info *ObjectInfo
+}
+
+func (o *s3Object) Stat() (*ObjectInfo, error) {
+	return o.info, nil
+}
+
+func s3Error(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return ErrNotFound
+	}
+	return err
+}
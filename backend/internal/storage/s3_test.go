@@ -0,0 +1,415 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"video-conference-backend/internal/config"
+)
+
+const testBucket = "video-conference"
+
+// fakeS3 is an in-memory stand-in for the parts of the S3 API the store
+// uses: single and multipart uploads, ranged reads, listing, server-side
+// copies and deletes. It checks neither signatures nor bucket existence.
+type fakeS3 struct {
+	mutex   sync.Mutex
+	objects map[string]*fakeObject
+	uploads map[string]*fakeUpload // by upload ID
+	nextID  int
+}
+
+type fakeUpload struct {
+	contentType string
+	parts       map[int][]byte
+}
+
+type fakeObject struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+	parts        int
+}
+
+func (o *fakeObject) etag() string {
+	sum := md5.Sum(o.data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// newTestS3Storage serves a fake S3 and returns a store on its bucket
+func newTestS3Storage(t *testing.T, prefix string) (*S3Storage, *fakeS3) {
+	t.Helper()
+
+	fake := &fakeS3{objects: make(map[string]*fakeObject), uploads: make(map[string]*fakeUpload)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3Storage(&config.StorageConfig{
+		AWSRegion:    "us-east-1",
+		AWSBucket:    testBucket,
+		AWSAccessKey: "test-access-key",
+		AWSSecretKey: "test-secret-key",
+		AWSEndpoint:  strings.TrimPrefix(server.URL, "http://"),
+	}, prefix)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	return store, fake
+}
+
+func (s *fakeS3) object(key string) *fakeObject {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.objects[key]
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != testBucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	query := r.URL.Query()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet && query.Get("list-type") == "2":
+		s.list(w, query.Get("prefix"))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.createUpload(w, key, r.Header.Get("Content-Type"))
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, r, query)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.completeUpload(w, key, query.Get("uploadId"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		s.mutex.Lock()
+		delete(s.uploads, query.Get("uploadId"))
+		s.mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copy(w, r, key)
+	case r.Method == http.MethodPut:
+		data, err := readPayload(r)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		object := s.put(key, data, r.Header.Get("Content-Type"), 1)
+		w.Header().Set("ETag", object.etag())
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.get(w, r, key)
+	case r.Method == http.MethodDelete:
+		s.mutex.Lock()
+		delete(s.objects, key)
+		s.mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (s *fakeS3) put(key string, data []byte, contentType string, parts int) *fakeObject {
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	object := &fakeObject{data: data, contentType: contentType, lastModified: time.Now().UTC().Truncate(time.Second), parts: parts}
+	s.mutex.Lock()
+	s.objects[key] = object
+	s.mutex.Unlock()
+	return object
+}
+
+// get serves an object, answering Range requests and overriding response
+// headers the way presigned links ask for
+func (s *fakeS3) get(w http.ResponseWriter, r *http.Request, key string) {
+	object := s.object(key)
+	if object == nil {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	contentType := object.contentType
+	if override := r.URL.Query().Get("response-content-type"); override != "" {
+		contentType = override
+	}
+	w.Header().Set("Content-Type", contentType)
+	if disposition := r.URL.Query().Get("response-content-disposition"); disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	w.Header().Set("ETag", object.etag())
+	http.ServeContent(w, r, key, object.lastModified, bytes.NewReader(object.data))
+}
+
+func (s *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+		StorageClass string
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []content
+	}{Name: testBucket, Prefix: prefix, MaxKeys: 1000}
+
+	s.mutex.Lock()
+	for key, object := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{
+				Key:          key,
+				LastModified: object.lastModified.Format(time.RFC3339),
+				ETag:         object.etag(),
+				Size:         len(object.data),
+				StorageClass: "STANDARD",
+			})
+		}
+	}
+	s.mutex.Unlock()
+
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	writeS3XML(w, result)
+}
+
+func (s *fakeS3) copy(w http.ResponseWriter, r *http.Request, key string) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+	_, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	original := s.object(sourceKey)
+	if original == nil {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	object := s.put(key, original.data, original.contentType, original.parts)
+	writeS3XML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		LastModified string
+		ETag         string
+	}{LastModified: object.lastModified.Format(time.RFC3339), ETag: object.etag()})
+}
+
+func (s *fakeS3) createUpload(w http.ResponseWriter, key, contentType string) {
+	s.mutex.Lock()
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.uploads[id] = &fakeUpload{contentType: contentType, parts: make(map[int][]byte)}
+	s.mutex.Unlock()
+
+	writeS3XML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Bucket: testBucket, Key: key, UploadId: id})
+}
+
+func (s *fakeS3) uploadPart(w http.ResponseWriter, r *http.Request, query url.Values) {
+	number, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+	data, err := readPayload(r)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	s.mutex.Lock()
+	upload, ok := s.uploads[query.Get("uploadId")]
+	if ok {
+		upload.parts[number] = data
+	}
+	s.mutex.Unlock()
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	w.Header().Set("ETag", (&fakeObject{data: data}).etag())
+}
+
+func (s *fakeS3) completeUpload(w http.ResponseWriter, key, id string) {
+	s.mutex.Lock()
+	upload, ok := s.uploads[id]
+	delete(s.uploads, id)
+	s.mutex.Unlock()
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	numbers := make([]int, 0, len(upload.parts))
+	for number := range upload.parts {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	var data []byte
+	for _, number := range numbers {
+		data = append(data, upload.parts[number]...)
+	}
+
+	object := s.put(key, data, upload.contentType, len(upload.parts))
+	writeS3XML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: testBucket, Key: key, ETag: object.etag()})
+}
+
+// readPayload reads a request body, decoding the aws-chunked encoding of
+// streaming signed uploads
+func readPayload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var data []byte
+	body := bufio.NewReader(r.Body)
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk size %q", size)
+		}
+		if n == 0 {
+			// Trailing checksums follow, which the fake does not check
+			return data, nil
+		}
+		chunk := make([]byte, n+2)
+		if _, err := io.ReadFull(body, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:n]...)
+	}
+}
+
+func writeS3XML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
+
+func TestS3StorageKeepsObjectsUnderPrefix(t *testing.T) {
+	store, fake := newTestS3Storage(t, AreaRecordings+"/")
+	ctx := t.Context()
+
+	if err := store.Put(ctx, "rec-1/audio.ogg", strings.NewReader("audio"), 5, "audio/ogg"); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if fake.object("recordings/rec-1/audio.ogg") == nil {
+		t.Fatal("object not stored under the area prefix")
+	}
+
+	objects, err := store.List(ctx, "rec-1/")
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != "rec-1/audio.ogg" {
+		t.Fatalf("listed %+v, want the key without the area prefix", objects)
+	}
+}
+
+func TestS3StorageUploadsLargeObjectsInParts(t *testing.T) {
+	store, fake := newTestS3Storage(t, "")
+	ctx := t.Context()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), (s3PartSize+s3PartSize/2)/16)
+	if err := store.Put(ctx, "large.webm", bytes.NewReader(data), -1, "video/webm"); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	object := fake.object("large.webm")
+	if object == nil || !bytes.Equal(object.data, data) {
+		t.Fatal("uploaded object differs")
+	}
+	if object.parts != 2 {
+		t.Fatalf("uploaded in %d parts, want 2", object.parts)
+	}
+}
+
+func TestS3StoragePresignsLinks(t *testing.T) {
+	store, _ := newTestS3Storage(t, "")
+	ctx := t.Context()
+
+	if err := store.Put(ctx, "rec-1/video.webm", strings.NewReader("video"), 5, "video/webm"); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	// ServeObject sends the client to the bucket instead of streaming
+	r := httptest.NewRequest(http.MethodGet, "/recordings/1/download", nil)
+	w := httptest.NewRecorder()
+	if err := ServeObject(w, r, store, "rec-1/video.webm", "", `attachment; filename="video.webm"`, time.Minute); err != nil {
+		t.Fatalf("failed to serve: %v", err)
+	}
+	if w.Code != http.StatusFound {
+		t.Fatalf("got status %d, want a redirect", w.Code)
+	}
+	link := w.Header().Get("Location")
+	if u, err := url.Parse(link); err != nil || u.Query().Get("X-Amz-Expires") != "60" {
+		t.Fatalf("redirected to %q, want a link valid for a minute", link)
+	}
+
+	resp, err := http.Get(link)
+	if err != nil {
+		t.Fatalf("failed to follow link: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "video" || resp.Header.Get("Content-Disposition") != `attachment; filename="video.webm"` {
+		t.Fatalf("link served %q with disposition %q", body, resp.Header.Get("Content-Disposition"))
+	}
+}
+
+func TestS3StorageMoveKeepsContentType(t *testing.T) {
+	store, _ := newTestS3Storage(t, "")
+	ctx := t.Context()
+
+	if err := store.Put(ctx, "rec-1/video.webm", strings.NewReader("video"), 5, "video/webm"); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := store.Move(ctx, "rec-1/video.webm", "archive/rec-1/video.webm"); err != nil {
+		t.Fatalf("failed to move: %v", err)
+	}
+
+	info, err := store.Stat(ctx, "archive/rec-1/video.webm")
+	if err != nil || info.ContentType != "video/webm" {
+		t.Fatalf("moved object stat returned %+v, %v", info, err)
+	}
+}
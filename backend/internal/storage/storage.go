@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"video-conference-backend/internal/config"
+)
+
+// ErrNotFound is returned for keys that have no object
+var ErrNotFound = errors.New("object not found")
+
+// ErrInvalidKey is returned for keys a store cannot hold, such as keys
+// escaping a local store's directory
+var ErrInvalidKey = errors.New("invalid object key")
+
+// ErrPresignUnsupported is returned by stores that cannot hand out direct
+// links to their objects; their objects are served through the API instead
+var ErrPresignUnsupported = errors.New("storage does not support presigned URLs")
+
+// Areas of the platform that keep objects in storage. Local areas are
+// separate directories; on S3 they share the bucket under a key prefix.
+const (
+	AreaRecordings = "recordings"
+	AreaUploads    = "uploads"
+)
+
+// Storage stores objects by key. Keys use forward slashes; a key prefix
+// ending in a slash works like a directory.
+type Storage interface {
+	// Put stores an object of the given size, or -1 if unknown. Large
+	// objects are uploaded in parts.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open opens an object for reading. The object can seek, so it can
+	// answer HTTP Range requests.
+	Open(ctx context.Context, key string) (Object, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// List returns the objects whose keys start with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	Move(ctx context.Context, src, dst string) error
+	// Delete removes an object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// PresignGet returns a URL that downloads the object without
+	// credentials until it expires. params may override response headers,
+	// e.g. response-content-disposition.
+	PresignGet(ctx context.Context, key string, expires time.Duration, params url.Values) (string, error)
+}
+
+// Object is an object opened for reading
+type Object interface {
+	io.ReadSeekCloser
+	Stat() (*ObjectInfo, error)
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Stores holds the object store of each area
+type Stores struct {
+	Recordings Storage
+	Uploads    Storage
+}
+
+// NewStores creates the object stores selected by the storage configuration
+func NewStores(cfg *config.StorageConfig) (*Stores, error) {
+	recordings, err := New(cfg, AreaRecordings)
+	if err != nil {
+		return nil, err
+	}
+	uploads, err := New(cfg, AreaUploads)
+	if err != nil {
+		return nil, err
+	}
+	return &Stores{Recordings: recordings, Uploads: uploads}, nil
+}
+
+// New creates the object store of an area
+func New(cfg *config.StorageConfig, area string) (Storage, error) {
+	switch cfg.Type {
+	case "", "local":
+		root := cfg.LocalPath
+		if area == AreaRecordings {
+			root = cfg.RecordingPath
+		}
+		return NewLocalStorage(root)
+	case "s3":
+		return NewS3Storage(cfg, area+"/")
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", cfg.Type)
+	}
+}
+
+// DeletePrefix removes every object whose key starts with prefix
+func DeletePrefix(ctx context.Context, store Storage, prefix string) error {
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := store.Delete(ctx, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrefixSize returns the total size of the objects whose keys start with prefix
+func PrefixSize(ctx context.Context, store Storage, prefix string) (int64, error) {
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, object := range objects {
+		size += object.Size
+	}
+	return size, nil
+}
+
+// ServeObject writes an object to an HTTP response. Stores that presign URLs
+// redirect the client to the object, valid for expires; others stream it
+// through this server, answering Range requests. contentType and disposition
+// are optional. Errors are returned before anything is written.
+func ServeObject(w http.ResponseWriter, r *http.Request, store Storage, key, contentType, disposition string, expires time.Duration) error {
+	params := url.Values{}
+	if contentType != "" {
+		params.Set("response-content-type", contentType)
+	}
+	if disposition != "" {
+		params.Set("response-content-disposition", disposition)
+	}
+
+	link, err := store.PresignGet(r.Context(), key, expires, params)
+	if err == nil {
+		http.Redirect(w, r, link, http.StatusFound)
+		return nil
+	}
+	if !errors.Is(err, ErrPresignUnsupported) {
+		return err
+	}
+
+	object, err := store.Open(r.Context(), key)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	info, err := object.Stat()
+	if err != nil {
+		return err
+	}
+
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+
+	// ServeContent answers Range and conditional requests
+	http.ServeContent(w, r, key, info.LastModified, object)
+	return nil
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stores runs a test against every kind of store
+func stores(t *testing.T, test func(t *testing.T, store Storage)) {
+	t.Run("local", func(t *testing.T) {
+		store, err := NewLocalStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		test(t, store)
+	})
+	t.Run("s3", func(t *testing.T) {
+		store, _ := newTestS3Storage(t, AreaUploads+"/")
+		test(t, store)
+	})
+}
+
+func put(t *testing.T, store Storage, key, data string) {
+	t.Helper()
+	if err := store.Put(t.Context(), key, strings.NewReader(data), int64(len(data)), ""); err != nil {
+		t.Fatalf("failed to put %s: %v", key, err)
+	}
+}
+
+func keys(t *testing.T, store Storage, prefix string) []string {
+	t.Helper()
+	objects, err := store.List(t.Context(), prefix)
+	if err != nil {
+		t.Fatalf("failed to list %q: %v", prefix, err)
+	}
+	keys := []string{}
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	return keys
+}
+
+func TestStoragePutAndOpen(t *testing.T) {
+	stores(t, func(t *testing.T, store Storage) {
+		ctx := t.Context()
+
+		// The size may be unknown
+		data := "0123456789"
+		if err := store.Put(ctx, "client-1/notes.txt", strings.NewReader(data), -1, "text/plain"); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+
+		info, err := store.Stat(ctx, "client-1/notes.txt")
+		if err != nil {
+			t.Fatalf("failed to stat: %v", err)
+		}
+		if info.Key != "client-1/notes.txt" || info.Size != int64(len(data)) || !strings.HasPrefix(info.ContentType, "text/plain") {
+			t.Fatalf("stat returned %+v", info)
+		}
+
+		object, err := store.Open(ctx, "client-1/notes.txt")
+		if err != nil {
+			t.Fatalf("failed to open: %v", err)
+		}
+		defer object.Close()
+		if _, err := object.Seek(4, io.SeekStart); err != nil {
+			t.Fatalf("failed to seek: %v", err)
+		}
+		rest, err := io.ReadAll(object)
+		if err != nil || string(rest) != data[4:] {
+			t.Fatalf("read %q after seeking (%v), want %q", rest, err, data[4:])
+		}
+
+		// Putting again replaces the object
+		put(t, store, "client-1/notes.txt", "replaced")
+		if info, err := store.Stat(ctx, "client-1/notes.txt"); err != nil || info.Size != int64(len("replaced")) {
+			t.Fatalf("stat after replacing returned %+v, %v", info, err)
+		}
+	})
+}
+
+func TestStorageMissingObjects(t *testing.T) {
+	stores(t, func(t *testing.T, store Storage) {
+		ctx := t.Context()
+
+		if _, err := store.Stat(ctx, "missing.txt"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("stat returned %v, want %v", err, ErrNotFound)
+		}
+		if _, err := store.Open(ctx, "missing.txt"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("open returned %v, want %v", err, ErrNotFound)
+		}
+		if err := store.Delete(ctx, "missing.txt"); err != nil {
+			t.Errorf("deleting a missing object failed: %v", err)
+		}
+		if keys := keys(t, store, "missing/"); len(keys) != 0 {
+			t.Errorf("listed %v under a missing prefix", keys)
+		}
+	})
+}
+
+func TestStorageListMoveAndDelete(t *testing.T) {
+	stores(t, func(t *testing.T, store Storage) {
+		ctx := t.Context()
+
+		put(t, store, "rec-1/audio.ogg", "audio")
+		put(t, store, "rec-1/video/camera.webm", "camera")
+		put(t, store, "rec-10/audio.ogg", "other")
+
+		if got := keys(t, store, "rec-1/"); strings.Join(got, ",") != "rec-1/audio.ogg,rec-1/video/camera.webm" {
+			t.Fatalf("listed %v, want the two objects of rec-1", got)
+		}
+		if size, err := PrefixSize(ctx, store, "rec-1/"); err != nil || size != int64(len("audio")+len("camera")) {
+			t.Fatalf("PrefixSize = %d, %v", size, err)
+		}
+
+		if err := store.Move(ctx, "rec-1/audio.ogg", "rec-2/audio.ogg"); err != nil {
+			t.Fatalf("failed to move: %v", err)
+		}
+		if _, err := store.Stat(ctx, "rec-1/audio.ogg"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("moved object still at its source: %v", err)
+		}
+		if info, err := store.Stat(ctx, "rec-2/audio.ogg"); err != nil || info.Size != int64(len("audio")) {
+			t.Fatalf("moved object stat returned %+v, %v", info, err)
+		}
+		if err := store.Move(ctx, "rec-1/missing.ogg", "rec-2/missing.ogg"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("moving a missing object returned %v, want %v", err, ErrNotFound)
+		}
+
+		if err := DeletePrefix(ctx, store, "rec-1/"); err != nil {
+			t.Fatalf("failed to delete prefix: %v", err)
+		}
+		if got := keys(t, store, "rec-"); strings.Join(got, ",") != "rec-10/audio.ogg,rec-2/audio.ogg" {
+			t.Fatalf("after deleting rec-1 listed %v", got)
+		}
+	})
+}
+
+func TestLocalStorageRefusesEscapingKeys(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStorage(filepath.Join(root, "uploads"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := t.Context()
+
+	for _, key := range []string{"", "/", "../secret.txt", "a/../../secret.txt", "a//b.txt", "/a.txt", "a/./b.txt"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("put %q returned %v, want %v", key, err, ErrInvalidKey)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "secret.txt")); err == nil {
+		t.Fatal("object written outside the store")
+	}
+	if _, err := store.List(ctx, "../"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("listing outside the store returned %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestLocalStorageHidesPartialUploadsAndPrunesDirectories(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStorage(root)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := t.Context()
+
+	put(t, store, "rec-1/tracks/audio.ogg", "audio")
+	if err := os.WriteFile(filepath.Join(root, "rec-1", "tracks", ".upload-123"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(t, store, "rec-1/"); strings.Join(got, ",") != "rec-1/tracks/audio.ogg" {
+		t.Fatalf("listed %v, want only the complete object", got)
+	}
+
+	os.Remove(filepath.Join(root, "rec-1", "tracks", ".upload-123"))
+	if err := store.Delete(ctx, "rec-1/tracks/audio.ogg"); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "rec-1")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("empty directories were left behind: %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Fatalf("the root was pruned: %v", err)
+	}
+}
+
+func TestServeObjectStreamsLocalObjects(t *testing.T) {
+	store, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	put(t, store, "rec-1/video.webm", "0123456789")
+
+	r := httptest.NewRequest(http.MethodGet, "/recordings/1/download", nil)
+	r.Header.Set("Range", "bytes=2-5")
+	w := httptest.NewRecorder()
+	err = ServeObject(w, r, store, "rec-1/video.webm", "", `attachment; filename="video.webm"`, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to serve: %v", err)
+	}
+
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+		t.Fatalf("got status %d and %q, want the requested range", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "video/webm" || w.Header().Get("Content-Disposition") != `attachment; filename="video.webm"` {
+		t.Fatalf("served with headers %v", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	if err := ServeObject(w, r, store, "rec-1/missing.webm", "", "", time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("serving a missing object returned %v, want %v", err, ErrNotFound)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatal("wrote a response before failing")
+	}
+}
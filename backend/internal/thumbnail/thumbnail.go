@@ -0,0 +1,109 @@
+// Package thumbnail renders small JPEG previews of images using only the
+// standard library.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	// Formats thumbnails can be made from
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ContentType is the media type of generated thumbnails
+const ContentType = "image/jpeg"
+
+// MaxSourcePixels bounds the images thumbnails are made from, so a small
+// file cannot decode into a huge bitmap
+const MaxSourcePixels = 40_000_000
+
+// ErrTooLarge is returned for images over MaxSourcePixels
+var ErrTooLarge = errors.New("image is too large for a thumbnail")
+
+// Supported reports whether thumbnails can be made from the content type
+func Supported(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Generate decodes an image and returns a JPEG scaled to fit within
+// maxSize x maxSize, along with the size of the original. Images already
+// small enough are re-encoded at their own size.
+func Generate(r io.ReadSeeker, maxSize int) (thumb []byte, width, height int, err error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read image: %w", err)
+	}
+	if config.Width*config.Height > MaxSourcePixels {
+		return nil, 0, 0, ErrTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to rewind image: %w", err)
+	}
+
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scale(src, maxSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), config.Width, config.Height, nil
+}
+
+// scale shrinks src to fit within maxSize x maxSize, averaging the source
+// pixels behind each target pixel. Transparent areas become white.
+func scale(src image.Image, maxSize int) *image.RGBA {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+
+	dw, dh := sw, sh
+	if sw > maxSize || sh > maxSize {
+		if sw >= sh {
+			dw, dh = maxSize, max(1, sh*maxSize/sw)
+		} else {
+			dw, dh = max(1, sw*maxSize/sh), maxSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0 := bounds.Min.Y + y*sh/dh
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*sh/dh)
+		for x := 0; x < dw; x++ {
+			x0 := bounds.Min.X + x*sw/dw
+			x1 := max(x0+1, bounds.Min.X+(x+1)*sw/dw)
+
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					// Composite over white; the colors are premultiplied
+					white := 0xffff - pa
+					r += uint64(pr + white)
+					g += uint64(pg + white)
+					b += uint64(pb + white)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
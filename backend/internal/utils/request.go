@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+)
+
+// RemoteIP returns the address a request came from, without its port. It is
+// the client's own address, or the one a trusted proxy forwarded (see
+// middleware.RealIP), never a header the client chose.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
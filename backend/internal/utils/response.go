@@ -64,4 +64,14 @@ func GetUserRoleFromContext(r *http.Request) string {
 		}
 	}
 	return ""
+}
+
+// GetTokenIDFromContext extracts the access token's jti from JWT context
+func GetTokenIDFromContext(r *http.Request) string {
+	if tokenID := r.Context().Value("token_id"); tokenID != nil {
+		if id, ok := tokenID.(string); ok {
+			return id
+		}
+	}
+	return ""
 }
\ No newline at end of file
@@ -0,0 +1,318 @@
+// Package webrtctest provides in-process participants for testing the
+// server-side WebRTC peers, the SFU router and the recorder, over the
+// loopback network. A Peer signals the way a browser does through the hub:
+// it makes one offer, answers the server's offers and trickles candidates.
+package webrtctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"video-conference-backend/internal/signaling"
+)
+
+// Synthetic media. Every video frame is a single-packet 640x480 VP8
+// keyframe and every audio frame is silent Opus.
+var (
+	VP8Keyframe = []byte{0x10, 0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01, 0x00}
+	OpusFrame   = []byte{0xf8, 0xff, 0xfe}
+)
+
+// Inbox handles queued messages one at a time, in order, until it is closed
+func Inbox(handle func(signaling.Message)) chan signaling.Message {
+	messages := make(chan signaling.Message, 256)
+	go func() {
+		for msg := range messages {
+			handle(msg)
+		}
+	}()
+	return messages
+}
+
+// SignalerFunc sends a server's messages through a function
+type SignalerFunc func(signaling.Message)
+
+func (f SignalerFunc) Send(msg signaling.Message) { f(msg) }
+
+// Until polls done until it holds or the timeout passes, reporting whether
+// it held
+func Until(timeout time.Duration, done func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
+
+// Peer is a participant's browser. Its messages go to the server as the hub
+// relays them; the server's replies are passed to Deliver.
+type Peer struct {
+	ID string
+	PC *webrtc.PeerConnection
+	// OnPacket, when set before connecting, sees every packet received
+	OnPacket func(track *webrtc.TrackRemote, packet *rtp.Packet)
+
+	send   func(signaling.Message)
+	report func(format string, args ...interface{})
+	inbox  chan signaling.Message
+	done   chan struct{}
+	offers atomic.Int32
+
+	mutex      sync.Mutex
+	candidates []webrtc.ICECandidateInit
+	received   map[string]int // packets by track ID
+}
+
+// NewPeer creates a participant that signals through send. Problems with
+// the server's messages are passed to report.
+func NewPeer(id string, send func(signaling.Message), report func(format string, args ...interface{})) (*Peer, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
+		return nil, fmt.Errorf("failed to register codecs: %w", err)
+	}
+	registry := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, registry); err != nil {
+		return nil, fmt.Errorf("failed to register interceptors: %w", err)
+	}
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine), webrtc.WithInterceptorRegistry(registry))
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create peer connection: %w", err)
+	}
+
+	p := &Peer{
+		ID:       id,
+		PC:       pc,
+		send:     send,
+		report:   report,
+		done:     make(chan struct{}),
+		received: make(map[string]int),
+	}
+	p.inbox = Inbox(p.handle)
+
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		init := candidate.ToJSON()
+		p.signal(signaling.TypeICECandidate, nil, &init)
+	})
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		go p.receive(track)
+	})
+	return p, nil
+}
+
+// Deliver queues a message from the server. Messages arriving after the
+// peer is closed are dropped.
+func (p *Peer) Deliver(msg signaling.Message) {
+	select {
+	case <-p.done:
+	case p.inbox <- msg:
+	}
+}
+
+// Connect makes the peer's one offer
+func (p *Peer) Connect() error {
+	offer, err := p.PC.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create offer: %w", err)
+	}
+	if err := p.PC.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("failed to set local description: %w", err)
+	}
+	p.signal(signaling.TypeOffer, &offer, nil)
+	return nil
+}
+
+// Publish sends a synthetic audio or video track in the given stream until
+// the peer is closed
+func (p *Peer) Publish(kind webrtc.RTPCodecType, trackID, streamID string) error {
+	mimeType, interval, step, payload := webrtc.MimeTypeOpus, 20*time.Millisecond, uint32(960), OpusFrame
+	if kind == webrtc.RTPCodecTypeVideo {
+		mimeType, interval, step, payload = webrtc.MimeTypeVP8, 33*time.Millisecond, 3000, VP8Keyframe
+	}
+
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: mimeType}, trackID, streamID)
+	if err != nil {
+		return fmt.Errorf("failed to create track: %w", err)
+	}
+	if _, err := p.PC.AddTrack(track); err != nil {
+		return fmt.Errorf("failed to add track: %w", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for i := uint16(0); ; i++ {
+			select {
+			case <-ticker.C:
+			case <-p.done:
+				return
+			}
+			packet := &rtp.Packet{
+				Header:  rtp.Header{Version: 2, Marker: true, SequenceNumber: i, Timestamp: uint32(i) * step},
+				Payload: payload,
+			}
+			if err := track.WriteRTP(packet); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Close stops the peer's media and closes its connection
+func (p *Peer) Close() {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	close(p.done)
+	p.PC.Close()
+}
+
+// Done is closed when the peer is
+func (p *Peer) Done() <-chan struct{} {
+	return p.done
+}
+
+// Offers returns how many of the server's offers the peer has answered
+func (p *Peer) Offers() int {
+	return int(p.offers.Load())
+}
+
+// Packets returns how many packets of the track the peer has received
+func (p *Peer) Packets(trackID string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.received[trackID]
+}
+
+// Receiving reports whether the server's current description sends the
+// peer a track whose ID contains trackID
+func (p *Peer) Receiving(trackID string) bool {
+	description := p.PC.RemoteDescription()
+	return description != nil && strings.Contains(description.SDP, trackID)
+}
+
+func (p *Peer) signal(msgType string, sdp *webrtc.SessionDescription, candidate *webrtc.ICECandidateInit) {
+	payload := signaling.RelayedSignalPayload{SenderID: p.ID}
+	if sdp != nil {
+		payload.SDP, _ = json.Marshal(sdp)
+	}
+	if candidate != nil {
+		payload.Candidate, _ = json.Marshal(candidate)
+	}
+	msg, err := signaling.NewMessage(msgType, payload)
+	if err != nil {
+		p.fail("failed to encode %s: %v", msgType, err)
+		return
+	}
+	p.send(msg)
+}
+
+// handle answers the server's offers and applies its answers and candidates
+func (p *Peer) handle(msg signaling.Message) {
+	var payload signaling.RelayedSignalPayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		p.fail("received an invalid %s: %v", msg.Type, err)
+		return
+	}
+
+	switch msg.Type {
+	case signaling.TypeOffer, signaling.TypeAnswer:
+		var description webrtc.SessionDescription
+		if err := json.Unmarshal(payload.SDP, &description); err != nil {
+			p.fail("received an invalid %s: %v", msg.Type, err)
+			return
+		}
+		if err := p.PC.SetRemoteDescription(description); err != nil {
+			p.fail("failed to apply %s: %v", msg.Type, err)
+			return
+		}
+		p.flushCandidates()
+		if msg.Type == signaling.TypeAnswer {
+			return
+		}
+
+		answer, err := p.PC.CreateAnswer(nil)
+		if err != nil {
+			p.fail("failed to answer: %v", err)
+			return
+		}
+		if err := p.PC.SetLocalDescription(answer); err != nil {
+			p.fail("failed to set local description: %v", err)
+			return
+		}
+		p.signal(signaling.TypeAnswer, &answer, nil)
+		p.offers.Add(1)
+
+	case signaling.TypeICECandidate:
+		var candidate webrtc.ICECandidateInit
+		if err := json.Unmarshal(payload.Candidate, &candidate); err != nil {
+			p.fail("received an invalid candidate: %v", err)
+			return
+		}
+		p.mutex.Lock()
+		p.candidates = append(p.candidates, candidate)
+		p.mutex.Unlock()
+		p.flushCandidates()
+	}
+}
+
+// flushCandidates applies the server's candidates once its description is
+// known
+func (p *Peer) flushCandidates() {
+	if p.PC.RemoteDescription() == nil {
+		return
+	}
+	p.mutex.Lock()
+	candidates := p.candidates
+	p.candidates = nil
+	p.mutex.Unlock()
+
+	for _, candidate := range candidates {
+		if err := p.PC.AddICECandidate(candidate); err != nil {
+			p.fail("failed to add candidate: %v", err)
+		}
+	}
+}
+
+// receive counts a received track's packets
+func (p *Peer) receive(track *webrtc.TrackRemote) {
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		p.mutex.Lock()
+		p.received[track.ID()]++
+		p.mutex.Unlock()
+		if p.OnPacket != nil {
+			p.OnPacket(track, packet)
+		}
+	}
+}
+
+// fail reports a problem, unless the peer has been closed and its
+// connection torn down under it
+func (p *Peer) fail(format string, args ...interface{}) {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	p.report(p.ID+": "+format, args...)
+}
@@ -13,6 +13,8 @@ import (
 	"video-conference-backend/internal/config"
 	"video-conference-backend/internal/database"
 	"video-conference-backend/internal/services"
+	"video-conference-backend/internal/signaling"
+	"video-conference-backend/internal/storage"
 )
 
 func main() {
@@ -38,12 +40,27 @@ func main() {
 		log.Printf("✅ Database migrations completed")
 	}
 	
+	// Initialize object storage for recordings and uploads
+	stores, err := storage.NewStores(&cfg.Storage)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize storage: %v", err)
+	}
+	log.Printf("✅ Object storage initialized (%s)", cfg.Storage.Type)
+
 	// Initialize services with database
-	svc := services.NewServices(db, cfg)
+	svc := services.NewServices(db, cfg, stores)
 	log.Printf("✅ Enterprise services initialized: Client, User, Auth, Meeting, Chat, etc.")
 
+	// Initialize the signaling backplane shared with other replicas
+	backplane, err := signaling.NewBackplane(cfg)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize signaling backplane: %v", err)
+	}
+	defer backplane.Close()
+	log.Printf("✅ Signaling backplane initialized (%s)", cfg.Signaling.Backplane)
+
 	// Initialize API server
-	server := api.NewServer(cfg, svc)
+	server := api.NewServer(cfg, svc, backplane)
 	handler := server.Router()
 	log.Printf("🚀 REST API endpoints initialized")
 
@@ -78,6 +95,12 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Close signaling connections; hijacked WebSocket connections are not
+	// tracked by http.Server.Shutdown
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Signaling shutdown incomplete: %v", err)
+	}
+
 	// Shutdown server gracefully
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)